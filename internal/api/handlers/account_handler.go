@@ -0,0 +1,138 @@
+package handlers
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"yoked_backend/internal/api/middleware"
+	"yoked_backend/internal/models"
+	"yoked_backend/internal/services"
+)
+
+// AccountHandler closes the signed-in user's account and exports their data
+type AccountHandler struct {
+	userService services.UserService
+	accounts    services.AccountService
+	mfa         services.MFAService
+	identities  services.IdentityService
+	throttle    services.UserThrottle
+}
+
+func NewAccountHandler(userService services.UserService, accounts services.AccountService, mfa services.MFAService, identities services.IdentityService, throttle services.UserThrottle) *AccountHandler {
+	return &AccountHandler{userService: userService, accounts: accounts, mfa: mfa, identities: identities, throttle: throttle}
+}
+
+// DeleteAccountRequest re-confirms who is asking before the account is deleted. Accounts with a
+// password confirm it; accounts without one send a two-factor code, or the code and state of a
+// login started at /users/me/reauthenticate/:provider.
+type DeleteAccountRequest struct {
+	Password string `json:"password"`
+	MFACode  string `json:"mfa_code"`
+	Provider string `json:"provider"`
+	Code     string `json:"code"`
+	State    string `json:"state"`
+}
+
+// DeleteAccount signs the user out everywhere and schedules their data to be purged once the
+// grace period has passed
+// DELETE /users/me
+func (h *AccountHandler) DeleteAccount(c *gin.Context) {
+	userID := c.MustGet("userID").(string)
+
+	var req DeleteAccountRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request: " + err.Error()})
+		return
+	}
+
+	user, err := h.userService.GetUserByID(c.Request.Context(), userID)
+	if err != nil {
+		respondError(c, err)
+		return
+	}
+	if !h.confirmIdentity(c, user, &req) {
+		return
+	}
+
+	purgeAt, err := h.accounts.DeleteAccount(c.Request.Context(), userID)
+	if err != nil {
+		respondError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Account deleted", "purge_after": purgeAt})
+}
+
+// confirmIdentity checks the proof in req, writing the error response when it fails. Wrong
+// passwords and codes count towards the user's lockout, like the ones checked by MFAService.
+func (h *AccountHandler) confirmIdentity(c *gin.Context, user *models.User, req *DeleteAccountRequest) bool {
+	switch {
+	case user.PasswordHash != "":
+		return h.checkPassword(c, user, req.Password)
+	case req.MFACode != "":
+		if err := h.mfa.VerifyCode(c.Request.Context(), user.ID, req.MFACode); err != nil {
+			respondError(c, err)
+			return false
+		}
+	case req.Provider != "":
+		if err := h.identities.Reauthenticate(c.Request.Context(), req.Provider, user.ID, req.Code, req.State); err != nil {
+			respondError(c, err)
+			return false
+		}
+	default:
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request: mfa_code or a provider re-authentication is required"})
+		return false
+	}
+	return true
+}
+
+// checkPassword compares password with the user's, answering 429 instead while they are locked out
+func (h *AccountHandler) checkPassword(c *gin.Context, user *models.User, password string) bool {
+	ctx := c.Request.Context()
+	if wait, err := h.throttle.Attempt(ctx, user.ID); err != nil {
+		if errors.Is(err, services.ErrLoginLocked) {
+			setRetryAfter(c, wait)
+		}
+		respondError(c, err)
+		return false
+	}
+
+	if err := middleware.CheckPassword(password, user.PasswordHash); err != nil {
+		if err := h.throttle.RecordFailure(ctx, user.ID); err != nil {
+			log.Printf("Failed to record password failure: %v", err)
+		}
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid password"})
+		return false
+	}
+	if err := h.throttle.RecordSuccess(ctx, user.ID); err != nil {
+		log.Printf("Failed to reset password failures: %v", err)
+	}
+	return true
+}
+
+// ExportAccount downloads everything stored about the user as a zip of JSON and CSV files
+// POST /users/me/export
+func (h *AccountHandler) ExportAccount(c *gin.Context) {
+	userID := c.MustGet("userID").(string)
+
+	export, err := h.accounts.Export(c.Request.Context(), userID)
+	if err != nil {
+		respondError(c, err)
+		return
+	}
+
+	// Build the archive first so a failure can still be reported as JSON
+	var archive bytes.Buffer
+	if err := services.WriteAccountArchive(&archive, export); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to build export"})
+		return
+	}
+
+	filename := fmt.Sprintf("yoked-export-%s.zip", export.ExportedAt.UTC().Format("2006-01-02"))
+	c.Header("Content-Disposition", `attachment; filename="`+filename+`"`)
+	c.Data(http.StatusOK, "application/zip", archive.Bytes())
+}
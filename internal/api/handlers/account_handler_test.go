@@ -0,0 +1,128 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"golang.org/x/crypto/bcrypt"
+	"yoked_backend/internal/models"
+	"yoked_backend/internal/services"
+)
+
+// fakeAccounts records which accounts were deleted
+type fakeAccounts struct {
+	services.AccountService
+	deleted []string
+}
+
+func (f *fakeAccounts) DeleteAccount(ctx context.Context, userID string) (time.Time, error) {
+	f.deleted = append(f.deleted, userID)
+	return time.Now().Add(time.Hour), nil
+}
+
+// codeMFA accepts a single code
+type codeMFA struct {
+	services.MFAService
+	code string
+}
+
+func (f *codeMFA) VerifyCode(ctx context.Context, userID, code string) error {
+	if code != f.code {
+		return services.ErrInvalidMFACode
+	}
+	return nil
+}
+
+// stateIdentities accepts re-authentications that come back with a single state
+type stateIdentities struct {
+	services.IdentityService
+	state string
+}
+
+func (f *stateIdentities) Reauthenticate(ctx context.Context, provider, userID, code, state string) error {
+	if state != f.state {
+		return services.ErrInvalidOIDCState
+	}
+	return nil
+}
+
+func newAccountRouter(user *models.User, accounts *fakeAccounts) *gin.Engine {
+	throttle := services.NewUserThrottle(services.NewMemoryLoginAttemptStore(), services.LoginThrottleConfig{
+		MaxFailures: 5, IPMaxFailures: 100, Lockout: time.Minute, MaxLockout: time.Hour,
+	})
+	h := NewAccountHandler(&fakeUsers{user: user}, accounts, &codeMFA{code: "123456"}, &stateIdentities{state: "fresh"}, throttle)
+	router := gin.New()
+	router.DELETE("/users/me", func(c *gin.Context) { c.Set("userID", user.ID) }, h.DeleteAccount)
+	return router
+}
+
+func deleteAccount(router *gin.Engine, body any) *httptest.ResponseRecorder {
+	payload, _ := json.Marshal(body)
+	req := httptest.NewRequest(http.MethodDelete, "/users/me", bytes.NewReader(payload))
+	req.Header.Set("Content-Type", "application/json")
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, req)
+	return rec
+}
+
+func TestDeleteAccountWithoutPassword(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	// Created through social login, so there is no password to confirm
+	user := &models.User{ID: "u1", Email: "lifter@example.com"}
+
+	for _, tc := range []struct {
+		name string
+		body map[string]string
+		want int
+	}{
+		{"no proof", map[string]string{}, http.StatusBadRequest},
+		{"empty password", map[string]string{"password": ""}, http.StatusBadRequest},
+		{"wrong code", map[string]string{"mfa_code": "000000"}, http.StatusUnauthorized},
+		{"two-factor code", map[string]string{"mfa_code": "123456"}, http.StatusOK},
+		{"stale login", map[string]string{"provider": "google", "code": "c", "state": "old"}, http.StatusBadRequest},
+		{"provider login", map[string]string{"provider": "google", "code": "c", "state": "fresh"}, http.StatusOK},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			accounts := &fakeAccounts{}
+			router := newAccountRouter(user, accounts)
+			rec := deleteAccount(router, tc.body)
+
+			if rec.Code != tc.want {
+				t.Fatalf("got %d %s, want %d", rec.Code, rec.Body, tc.want)
+			}
+			if deleted := len(accounts.deleted) == 1; deleted != (tc.want == http.StatusOK) {
+				t.Errorf("deleted = %v", accounts.deleted)
+			}
+		})
+	}
+}
+
+func TestDeleteAccountPasswordGuessingLocksTheUser(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	hash, err := bcrypt.GenerateFromPassword([]byte("correct horse"), bcrypt.MinCost)
+	if err != nil {
+		t.Fatal(err)
+	}
+	user := &models.User{ID: "u1", Email: "lifter@example.com", PasswordHash: string(hash)}
+	accounts := &fakeAccounts{}
+	router := newAccountRouter(user, accounts)
+
+	for i := 0; i < 5; i++ {
+		if rec := deleteAccount(router, map[string]string{"password": "wrong"}); rec.Code != http.StatusUnauthorized {
+			t.Fatalf("wrong password %d: got %d", i+1, rec.Code)
+		}
+	}
+	rec := deleteAccount(router, map[string]string{"password": "correct horse"})
+	if rec.Code != http.StatusTooManyRequests || rec.Header().Get("Retry-After") == "" {
+		t.Errorf("right password while locked: got %d %s", rec.Code, rec.Body)
+	}
+	if len(accounts.deleted) != 0 {
+		t.Errorf("deleted while locked: %v", accounts.deleted)
+	}
+}
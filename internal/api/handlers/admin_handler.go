@@ -0,0 +1,79 @@
+package handlers
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"yoked_backend/internal/services"
+)
+
+// AdminHandler serves the /admin routes. Each route is gated in main.go with RequireRole or
+// RequirePermission, so the handlers themselves do no role checks.
+type AdminHandler struct {
+	userService services.UserService
+	authorizer  services.Authorizer
+}
+
+func NewAdminHandler(userService services.UserService, authorizer services.Authorizer) *AdminHandler {
+	return &AdminHandler{userService: userService, authorizer: authorizer}
+}
+
+// UpdateRoleRequest replaces a user's role and individually granted permissions
+type UpdateRoleRequest struct {
+	Role        string   `json:"role" binding:"required"`
+	Permissions []string `json:"permissions"`
+}
+
+// CreateGrantRequest gives a coach access to one user's data
+type CreateGrantRequest struct {
+	CoachID string `json:"coach_id" binding:"required"`
+	UserID  string `json:"user_id" binding:"required"`
+}
+
+// GetUser returns any user's profile
+// GET /admin/users/:id
+func (h *AdminHandler) GetUser(c *gin.Context) {
+	user, err := h.userService.GetUserProfile(c.Request.Context(), c.Param("id"))
+	if err != nil {
+		respondError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, user)
+}
+
+// UpdateUserRole sets a user's role and permissions
+// PUT /admin/users/:id/role
+func (h *AdminHandler) UpdateUserRole(c *gin.Context) {
+	var req UpdateRoleRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request: " + err.Error()})
+		return
+	}
+
+	user, err := h.userService.UpdateUserRole(c.Request.Context(), c.Param("id"), req.Role, req.Permissions)
+	if err != nil {
+		respondError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, user)
+}
+
+// CreateAccessGrant lets a coach act on a user's data
+// POST /admin/grants
+func (h *AdminHandler) CreateAccessGrant(c *gin.Context) {
+	var req CreateGrantRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request: " + err.Error()})
+		return
+	}
+
+	grant, err := h.authorizer.GrantCoachAccess(c.Request.Context(), req.CoachID, req.UserID)
+	if err != nil {
+		respondError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusCreated, grant)
+}
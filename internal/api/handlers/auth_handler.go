@@ -1,8 +1,15 @@
 package handlers
 
 import (
+    "errors"
+    "io"
+    "log"
+    "math"
     "net/http"
+    "strconv"
+    "strings"
     "time"
+    "unicode/utf8"
 
     "github.com/gin-gonic/gin"
     "yoked_backend/internal/api/middleware"
@@ -12,11 +19,27 @@ import (
 
 type AuthHandler struct {
     userService services.UserService
+    authService services.AuthService
+    resets      services.PasswordResetService
+    verifier    services.EmailVerificationService
+    mfa         services.MFAService
+    throttle    services.LoginThrottle
+    resetLimit  services.RequestThrottle
+    identities  services.IdentityService
+    keys        services.KeyManager
 }
 
-func NewAuthHandler(userService services.UserService) *AuthHandler {
+func NewAuthHandler(userService services.UserService, authService services.AuthService, resets services.PasswordResetService, verifier services.EmailVerificationService, mfa services.MFAService, throttle services.LoginThrottle, resetLimit services.RequestThrottle, identities services.IdentityService, keys services.KeyManager) *AuthHandler {
     return &AuthHandler{
         userService: userService,
+        authService: authService,
+        resets:      resets,
+        verifier:    verifier,
+        mfa:         mfa,
+        throttle:    throttle,
+        resetLimit:  resetLimit,
+        identities:  identities,
+        keys:        keys,
     }
 }
 
@@ -33,6 +56,7 @@ type RegisterRequest struct {
     Goal            string  `json:"goal" binding:"required,oneof=weight_loss muscle_gain maintenance endurance"`
     ProgramID       int     `json:"program_id" binding:"required"`
     WeeklyBudget    float64 `json:"weekly_budget" binding:"min=0"`
+    Timezone        string  `json:"timezone"` // IANA zone, defaults to UTC
 }
 
 // LoginRequest represents the login request body
@@ -41,11 +65,122 @@ type LoginRequest struct {
     Password string `json:"password" binding:"required"`
 }
 
-// AuthResponse represents the authentication response
+// RefreshRequest carries the opaque refresh token for refresh and logout
+type RefreshRequest struct {
+    RefreshToken string `json:"refresh_token" binding:"required"`
+}
+
+// ForgotPasswordRequest asks for a reset link to be mailed to the account's email
+type ForgotPasswordRequest struct {
+    Email string `json:"email" binding:"required,email"`
+}
+
+// ResetPasswordRequest redeems a reset token for a new password
+type ResetPasswordRequest struct {
+    Token       string `json:"token" binding:"required"`
+    NewPassword string `json:"new_password" binding:"required,min=8"`
+}
+
+// VerifyEmailRequest redeems the token from a verification email
+type VerifyEmailRequest struct {
+    Token string `json:"token" binding:"required"`
+}
+
+// MFAVerifyRequest completes a two-step login with a code from the authenticator app,
+// or a recovery code
+type MFAVerifyRequest struct {
+    MFAToken string `json:"mfa_token" binding:"required"`
+    Code     string `json:"code" binding:"required"`
+}
+
+// SignupProfileRequest is the profile for an account created by a first-time social login,
+// validated like RegisterRequest
+type SignupProfileRequest struct {
+    Name          string  `json:"name" binding:"required"`
+    Age           int     `json:"age" binding:"required,min=13,max=120"`
+    Sex           string  `json:"sex" binding:"required,oneof=male female other"`
+    Height        float64 `json:"height" binding:"required,min=30,max=250"`
+    Weight        float64 `json:"weight" binding:"required,min=20,max=500"`
+    ActivityLevel string  `json:"activity_level" binding:"required,oneof=sedentary lightly_active moderately_active very_active extra_active"`
+    Goal          string  `json:"goal" binding:"required,oneof=weight_loss muscle_gain maintenance endurance"`
+    ProgramID     int     `json:"program_id" binding:"required"`
+    WeeklyBudget  float64 `json:"weekly_budget" binding:"min=0"`
+    Timezone      string  `json:"timezone"`
+}
+
+// OIDCAuthorizeRequest starts a social login. The profile is only used if no account
+// matches, so clients that expect a returning user can leave it out.
+type OIDCAuthorizeRequest struct {
+    Profile *SignupProfileRequest `json:"profile"`
+}
+
+// OIDCCallbackRequest carries the code and state the provider redirected back with
+type OIDCCallbackRequest struct {
+    Code  string `json:"code" binding:"required"`
+    State string `json:"state" binding:"required"`
+}
+
+// MFARequiredResponse is returned by login instead of a session when 2FA is enabled.
+// The token is exchanged at /auth/mfa/verify.
+type MFARequiredResponse struct {
+    MFARequired bool `json:"mfa_required"`
+    *services.IssuedMFAChallenge
+}
+
+// AuthResponse represents the authentication response. Token is a short-lived access
+// token; RefreshToken is exchanged at /auth/refresh for a new pair and is single use.
 type AuthResponse struct {
-    Token     string        `json:"token"`
-    ExpiresAt time.Time     `json:"expires_at"`
-    User      *models.User  `json:"user"`
+    Token                 string        `json:"token"`
+    ExpiresAt             time.Time     `json:"expires_at"`
+    RefreshToken          string        `json:"refresh_token"`
+    RefreshTokenExpiresAt time.Time     `json:"refresh_token_expires_at"`
+    User                  *models.User  `json:"user"`
+}
+
+// authResponse pairs a new access token with the given refresh token
+func (h *AuthHandler) authResponse(user *models.User, refresh *services.IssuedRefreshToken) (*AuthResponse, error) {
+    token, expiresAt, err := middleware.GenerateJWT(h.keys, user, refresh.FamilyID)
+    if err != nil {
+        return nil, err
+    }
+
+    // Clear password hash from response
+    user.PasswordHash = ""
+
+    return &AuthResponse{
+        Token:                 token,
+        ExpiresAt:             expiresAt,
+        RefreshToken:          refresh.Token,
+        RefreshTokenExpiresAt: refresh.ExpiresAt,
+        User:                  user,
+    }, nil
+}
+
+// deviceInfo describes the calling client. Apps name the device in the X-Device-Name header;
+// values are cut to fit the sessions table.
+func deviceInfo(c *gin.Context) services.DeviceInfo {
+    return services.DeviceInfo{
+        Name:      truncate(strings.TrimSpace(c.GetHeader("X-Device-Name")), 100),
+        UserAgent: truncate(c.Request.UserAgent(), 512),
+        IPAddress: c.ClientIP(),
+    }
+}
+
+// truncate cuts s to at most n runes
+func truncate(s string, n int) string {
+    if utf8.RuneCountInString(s) <= n {
+        return s
+    }
+    return string([]rune(s)[:n])
+}
+
+// startSession records a session for this device and issues its refresh and access tokens
+func (h *AuthHandler) startSession(c *gin.Context, user *models.User) (*AuthResponse, error) {
+    refresh, err := h.authService.IssueRefreshToken(c.Request.Context(), user.ID, deviceInfo(c))
+    if err != nil {
+        return nil, err
+    }
+    return h.authResponse(user, refresh)
 }
 
 func (h *AuthHandler) Register(c *gin.Context) {
@@ -82,121 +217,386 @@ func (h *AuthHandler) Register(c *gin.Context) {
         Goal:          req.Goal,
 	ProgramID:     req.ProgramID,
         WeeklyBudget:  req.WeeklyBudget,
+        Timezone:      req.Timezone,
     }
 
-    if err := h.userService.CreateUser(c.Request.Context(), user); err != nil {
-        c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create user: " + err.Error()})
+    if _, err := h.userService.RegisterUser(c.Request.Context(), user, req.ProgramID); err != nil {
+        respondError(c, err)
         return
     }
 
+    // The account exists either way; the user can ask for another email if this one fails
+    if err := h.verifier.SendVerification(c.Request.Context(), user); err != nil {
+        log.Printf("Failed to send verification email to user %s: %v", user.ID, err)
+    }
 
-    userProgram := &models.UserProgram{
-        UserID:    user.ID,
-        ProgramID: req.ProgramID,
-        StartDate: time.Now(),
-        IsActive:  true,
+    response, err := h.startSession(c, user)
+    if err != nil {
+        c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate token"})
+        return
     }
 
+    c.JSON(http.StatusCreated, response)
+}
 
-    if err := h.userService.CreateUserProgram(c.Request.Context(), userProgram); err != nil {
-        c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create user program: " + err.Error()})
+func (h *AuthHandler) Login(c *gin.Context) {
+    var req LoginRequest
+    if err := c.ShouldBindJSON(&req); err != nil {
+        c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request: " + err.Error()})
         return
     }
 
+    // Refuse locked out accounts and addresses before spending a bcrypt comparison. The attempt
+    // counts as a failure until it is settled below.
+    if !h.checkLoginThrottle(c, req.Email) {
+        return
+    }
 
+    // Get user by email
+    user, err := h.userService.GetUserByEmail(c.Request.Context(), req.Email)
+    if err == nil {
+        err = middleware.CheckPassword(req.Password, user.PasswordHash)
+    }
+    if err != nil {
+        h.recordLoginFailure(c, req.Email)
+        c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid email or password"})
+        return
+    }
 
+    // With 2FA on the failures are only cleared once the code is right too
+    if h.completeLogin(c, user, http.StatusOK) {
+        h.recordLoginSuccess(c, user.Email)
+    } else {
+        h.forgiveLoginAttempt(c, user.Email)
+    }
+}
 
+// completeLogin starts a session for a user who has proved their identity, or with 2FA on,
+// responds with a challenge to redeem with a code instead. It reports whether a session started.
+func (h *AuthHandler) completeLogin(c *gin.Context, user *models.User, status int) bool {
+    mfaEnabled, err := h.mfa.IsEnabled(c.Request.Context(), user.ID)
+    if err != nil {
+        respondError(c, err)
+        return false
+    }
+    if mfaEnabled {
+        challenge, err := h.mfa.IssueChallenge(c.Request.Context(), user.ID)
+        if err != nil {
+            respondError(c, err)
+            return false
+        }
+        c.JSON(http.StatusOK, MFARequiredResponse{MFARequired: true, IssuedMFAChallenge: challenge})
+        return false
+    }
 
-    // Generate JWT token
-    token, err := middleware.GenerateJWT(user.ID, user.Email)
+    response, err := h.startSession(c, user)
     if err != nil {
         c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate token"})
+        return false
+    }
+
+    c.JSON(status, response)
+    return true
+}
+
+// checkLoginThrottle counts a login attempt, answering 429 with Retry-After instead while the
+// account or address is locked out. Counted attempts are settled with recordLoginFailure,
+// recordLoginSuccess or forgiveLoginAttempt.
+func (h *AuthHandler) checkLoginThrottle(c *gin.Context, email string) bool {
+    if retryAfter, err := h.throttle.Attempt(c.Request.Context(), email, c.ClientIP()); err != nil {
+        if errors.Is(err, services.ErrLoginLocked) {
+            setRetryAfter(c, retryAfter)
+        }
+        respondError(c, err)
+        return false
+    }
+    return true
+}
+
+// setRetryAfter tells a locked out client how many seconds to wait
+func setRetryAfter(c *gin.Context, wait time.Duration) {
+    c.Header("Retry-After", strconv.Itoa(int(math.Ceil(wait.Seconds()))))
+}
+
+func (h *AuthHandler) recordLoginFailure(c *gin.Context, email string) {
+    if err := h.throttle.RecordFailure(c.Request.Context(), email, c.ClientIP()); err != nil {
+        log.Printf("Failed to record login failure: %v", err)
+    }
+}
+
+func (h *AuthHandler) recordLoginSuccess(c *gin.Context, email string) {
+    if err := h.throttle.RecordSuccess(c.Request.Context(), email, c.ClientIP()); err != nil {
+        log.Printf("Failed to reset login failures: %v", err)
+    }
+}
+
+func (h *AuthHandler) forgiveLoginAttempt(c *gin.Context, email string) {
+    if err := h.throttle.Forgive(c.Request.Context(), email, c.ClientIP()); err != nil {
+        log.Printf("Failed to take back login attempt: %v", err)
+    }
+}
+
+// OIDCProviders lists the configured social login providers
+// GET /auth/oidc/providers
+func (h *AuthHandler) OIDCProviders(c *gin.Context) {
+    c.JSON(http.StatusOK, gin.H{"providers": h.identities.Providers()})
+}
+
+// OIDCAuthorize starts a social login, returning the provider URL to send the user to.
+// The body is optional; its profile creates the account if this is the user's first login.
+// POST /auth/oidc/:provider/authorize
+func (h *AuthHandler) OIDCAuthorize(c *gin.Context) {
+    var req OIDCAuthorizeRequest
+    if err := c.ShouldBindJSON(&req); err != nil && !errors.Is(err, io.EOF) {
+        c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request: " + err.Error()})
         return
     }
 
-    expiresAt := time.Now().Add(24 * time.Hour * 7)
+    var profile *models.SignupProfile
+    if p := req.Profile; p != nil {
+        profile = &models.SignupProfile{
+            Name:          p.Name,
+            Age:           p.Age,
+            Sex:           p.Sex,
+            Height:        p.Height,
+            Weight:        p.Weight,
+            ActivityLevel: p.ActivityLevel,
+            Goal:          p.Goal,
+            ProgramID:     p.ProgramID,
+            WeeklyBudget:  p.WeeklyBudget,
+            Timezone:      p.Timezone,
+        }
+    }
 
-    // Clear password hash from response
-    user.PasswordHash = ""
+    authorization, err := h.identities.StartLogin(c.Request.Context(), c.Param("provider"), profile)
+    if err != nil {
+        respondError(c, err)
+        return
+    }
 
-    c.JSON(http.StatusCreated, AuthResponse{
-        Token:     token,
-        ExpiresAt: expiresAt,
-        User:      user,
-    })
+    c.JSON(http.StatusOK, authorization)
 }
 
-func (h *AuthHandler) Login(c *gin.Context) {
-    var req LoginRequest
+// OIDCCallback completes a social login with the code and state from the provider redirect.
+// It answers like Login, with 201 when the login created the account.
+// POST /auth/oidc/:provider/callback
+func (h *AuthHandler) OIDCCallback(c *gin.Context) {
+    var req OIDCCallbackRequest
     if err := c.ShouldBindJSON(&req); err != nil {
         c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request: " + err.Error()})
         return
     }
 
-    // Get user by email
-    user, err := h.userService.GetUserByEmail(c.Request.Context(), req.Email)
+    user, created, err := h.identities.CompleteLogin(c.Request.Context(), c.Param("provider"), req.Code, req.State)
     if err != nil {
-        c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid email or password"})
+        respondError(c, err)
         return
     }
 
-    // Check password
-    if err := middleware.CheckPassword(req.Password, user.PasswordHash); err != nil {
-        c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid email or password"})
+    status := http.StatusOK
+    if created {
+        status = http.StatusCreated
+    }
+    h.completeLogin(c, user, status)
+}
+
+// VerifyMFA exchanges the challenge from a two-step login and a code for a session. Wrong
+// codes count towards the account's login lockout, so fresh challenges cannot be used to keep
+// guessing.
+// POST /auth/mfa/verify
+func (h *AuthHandler) VerifyMFA(c *gin.Context) {
+    var req MFAVerifyRequest
+    if err := c.ShouldBindJSON(&req); err != nil {
+        c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request: " + err.Error()})
         return
     }
 
-    // Generate JWT token
-    token, err := middleware.GenerateJWT(user.ID, user.Email)
+    challengeUserID, err := h.mfa.ChallengeUser(c.Request.Context(), req.MFAToken)
     if err != nil {
-        c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate token"})
+        respondError(c, err)
+        return
+    }
+    user, err := h.userService.GetUserByID(c.Request.Context(), challengeUserID)
+    if err != nil {
+        respondError(c, err)
+        return
+    }
+    if !h.checkLoginThrottle(c, user.Email) {
         return
     }
 
-    expiresAt := time.Now().Add(24 * time.Hour * 7)
+    if _, err := h.mfa.VerifyChallenge(c.Request.Context(), req.MFAToken, req.Code); err != nil {
+        if errors.Is(err, services.ErrInvalidMFACode) || errors.Is(err, services.ErrInvalidMFAChallenge) {
+            h.recordLoginFailure(c, user.Email)
+        } else {
+            h.forgiveLoginAttempt(c, user.Email)
+        }
+        respondError(c, err)
+        return
+    }
 
-    // Clear password hash from response
-    user.PasswordHash = ""
+    response, err := h.startSession(c, user)
+    if err != nil {
+        h.forgiveLoginAttempt(c, user.Email)
+        c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate token"})
+        return
+    }
+    h.recordLoginSuccess(c, user.Email)
 
-    c.JSON(http.StatusOK, AuthResponse{
-        Token:     token,
-        ExpiresAt: expiresAt,
-        User:      user,
-    })
+    c.JSON(http.StatusOK, response)
 }
 
+// Logout revokes the refresh token for this device
+// POST /auth/logout
 func (h *AuthHandler) Logout(c *gin.Context) {
+    userID := c.MustGet("userID").(string)
+
+    var req RefreshRequest
+    if err := c.ShouldBindJSON(&req); err != nil {
+        c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request: " + err.Error()})
+        return
+    }
+
+    if err := h.authService.RevokeRefreshToken(c.Request.Context(), userID, req.RefreshToken); err != nil {
+        respondError(c, err)
+        return
+    }
+
     c.JSON(http.StatusOK, gin.H{"message": "Successfully logged out"})
 }
 
+// LogoutAll revokes every refresh token the user holds, signing out all devices
+// POST /auth/logout-all
+func (h *AuthHandler) LogoutAll(c *gin.Context) {
+    userID := c.MustGet("userID").(string)
+
+    if err := h.authService.RevokeAllRefreshTokens(c.Request.Context(), userID); err != nil {
+        respondError(c, err)
+        return
+    }
+
+    c.JSON(http.StatusOK, gin.H{"message": "Logged out of all devices"})
+}
+
+// RefreshToken exchanges a refresh token for a new access token and refresh token.
+// It does not need a valid access token, so clients can renew after expiry.
+// POST /auth/refresh
 func (h *AuthHandler) RefreshToken(c *gin.Context) {
-    userID, err := middleware.GetUserIDFromContext(c)
-    if err != nil {
-        c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid token"})
+    var req RefreshRequest
+    if err := c.ShouldBindJSON(&req); err != nil {
+        c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request: " + err.Error()})
         return
     }
 
-    user, err := h.userService.GetUserByID(c.Request.Context(), userID)
+    user, refresh, err := h.authService.RotateRefreshToken(c.Request.Context(), req.RefreshToken, deviceInfo(c))
     if err != nil {
-        c.JSON(http.StatusUnauthorized, gin.H{"error": "User not found"})
+        respondError(c, err)
         return
     }
 
-    // Generate new JWT token
-    token, err := middleware.GenerateJWT(user.ID, user.Email)
+    response, err := h.authResponse(user, refresh)
     if err != nil {
         c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate token"})
         return
     }
 
-    expiresAt := time.Now().Add(24 * time.Hour * 7)
+    c.JSON(http.StatusOK, response)
+}
+
+// ForgotPassword mails a password reset link. The response is the same whether or not the
+// email belongs to an account, and failures are only logged, so it cannot be used to probe emails.
+// Each address may only ask so often, answered with 429 once it has used up its requests.
+// POST /auth/password/forgot
+func (h *AuthHandler) ForgotPassword(c *gin.Context) {
+    var req ForgotPasswordRequest
+    if err := c.ShouldBindJSON(&req); err != nil {
+        c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request: " + err.Error()})
+        return
+    }
+
+    if retryAfter, err := h.resetLimit.Allow(c.Request.Context(), c.ClientIP()); err != nil {
+        if errors.Is(err, services.ErrTooManyRequests) {
+            setRetryAfter(c, retryAfter)
+        }
+        respondError(c, err)
+        return
+    }
 
-    // Clear password hash from response
-    user.PasswordHash = ""
+    // A throttled email is answered like any other, so it does not reveal the account either
+    err := h.resets.RequestPasswordReset(c.Request.Context(), req.Email)
+    if err != nil && !errors.Is(err, services.ErrPasswordResetThrottled) {
+        log.Printf("Failed to start password reset: %v", err)
+    }
+
+    c.JSON(http.StatusAccepted, gin.H{"message": "If an account exists for that email, a reset link has been sent"})
+}
+
+// ResetPassword sets a new password using the token from a reset email
+// POST /auth/password/reset
+func (h *AuthHandler) ResetPassword(c *gin.Context) {
+    var req ResetPasswordRequest
+    if err := c.ShouldBindJSON(&req); err != nil {
+        c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request: " + err.Error()})
+        return
+    }
+
+    hashedPassword, err := middleware.HashPassword(req.NewPassword)
+    if err != nil {
+        c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to process password"})
+        return
+    }
+
+    if err := h.resets.ResetPassword(c.Request.Context(), req.Token, hashedPassword); err != nil {
+        if errors.Is(err, services.ErrInvalidResetToken) {
+            respondError(c, err)
+            return
+        }
+        c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to reset password"})
+        return
+    }
+
+    c.JSON(http.StatusOK, gin.H{"message": "Password has been reset, please log in again"})
+}
+
+// VerifyEmail confirms the account's email using the token from a verification email.
+// It does not need an access token, so the link works on any device.
+// POST /auth/verify-email
+func (h *AuthHandler) VerifyEmail(c *gin.Context) {
+    var req VerifyEmailRequest
+    if err := c.ShouldBindJSON(&req); err != nil {
+        c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request: " + err.Error()})
+        return
+    }
+
+    if err := h.verifier.VerifyEmail(c.Request.Context(), req.Token); err != nil {
+        respondError(c, err)
+        return
+    }
+
+    c.JSON(http.StatusOK, gin.H{"message": "Email verified"})
+}
+
+// ResendVerificationEmail sends the signed-in user a new verification link, at most once
+// every few minutes
+// POST /auth/verify-email/resend
+func (h *AuthHandler) ResendVerificationEmail(c *gin.Context) {
+    userID := c.MustGet("userID").(string)
+
+    if err := h.verifier.ResendVerification(c.Request.Context(), userID); err != nil {
+        if errors.Is(err, services.ErrVerificationThrottled) {
+            c.Header("Retry-After", strconv.Itoa(int(services.VerificationResendInterval.Seconds())))
+        }
+        respondError(c, err)
+        return
+    }
+
+    c.JSON(http.StatusAccepted, gin.H{"message": "Verification email sent"})
+}
 
-    c.JSON(http.StatusOK, AuthResponse{
-        Token:     token,
-        ExpiresAt: expiresAt,
-        User:      user,
-    })
+// JWKS publishes the public signing keys so other services can verify our access tokens
+// GET /.well-known/jwks.json
+func (h *AuthHandler) JWKS(c *gin.Context) {
+    // Shorter than the key propagation delay, so caches pick up a new key before it signs
+    c.Header("Cache-Control", "public, max-age=300")
+    c.JSON(http.StatusOK, h.keys.JWKS())
 }
@@ -0,0 +1,106 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"golang.org/x/crypto/bcrypt"
+	"yoked_backend/internal/models"
+	"yoked_backend/internal/services"
+)
+
+// fakeUsers serves a single user
+type fakeUsers struct {
+	services.UserService
+	user *models.User
+}
+
+func (f *fakeUsers) GetUserByEmail(ctx context.Context, email string) (*models.User, error) {
+	copied := *f.user
+	return &copied, nil
+}
+
+func (f *fakeUsers) GetUserByID(ctx context.Context, userID string) (*models.User, error) {
+	copied := *f.user
+	return &copied, nil
+}
+
+// rejectingMFA has 2FA on for everyone and refuses every code
+type rejectingMFA struct {
+	services.MFAService
+	userID string
+	issued int
+}
+
+func (f *rejectingMFA) IsEnabled(ctx context.Context, userID string) (bool, error) {
+	return true, nil
+}
+
+func (f *rejectingMFA) IssueChallenge(ctx context.Context, userID string) (*services.IssuedMFAChallenge, error) {
+	f.issued++
+	return &services.IssuedMFAChallenge{Token: fmt.Sprintf("challenge-%d", f.issued), ExpiresAt: time.Now().Add(time.Minute)}, nil
+}
+
+func (f *rejectingMFA) ChallengeUser(ctx context.Context, challengeToken string) (string, error) {
+	return f.userID, nil
+}
+
+func (f *rejectingMFA) VerifyChallenge(ctx context.Context, challengeToken, code string) (string, error) {
+	return "", services.ErrInvalidMFACode
+}
+
+func postJSON(router *gin.Engine, path string, body any) *httptest.ResponseRecorder {
+	payload, _ := json.Marshal(body)
+	req := httptest.NewRequest(http.MethodPost, path, bytes.NewReader(payload))
+	req.Header.Set("Content-Type", "application/json")
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, req)
+	return rec
+}
+
+func TestWrongMFACodesLockTheAccount(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	hash, err := bcrypt.GenerateFromPassword([]byte("correct horse"), bcrypt.MinCost)
+	if err != nil {
+		t.Fatal(err)
+	}
+	user := &models.User{ID: "u1", Email: "lifter@example.com", PasswordHash: string(hash)}
+	throttle := services.NewLoginThrottle(services.NewMemoryLoginAttemptStore(), services.LoginThrottleConfig{
+		MaxFailures: 5, IPMaxFailures: 100, Lockout: time.Minute, MaxLockout: time.Hour,
+	})
+	h := NewAuthHandler(&fakeUsers{user: user}, nil, nil, nil, &rejectingMFA{userID: user.ID}, throttle, nil, nil, nil)
+
+	router := gin.New()
+	router.POST("/auth/login", h.Login)
+	router.POST("/auth/mfa/verify", h.VerifyMFA)
+
+	login := map[string]string{"email": user.Email, "password": "correct horse"}
+	for i := 0; i < 5; i++ {
+		rec := postJSON(router, "/auth/login", login)
+		var challenge MFARequiredResponse
+		if err := json.Unmarshal(rec.Body.Bytes(), &challenge); err != nil || !challenge.MFARequired {
+			t.Fatalf("login %d: %d %s", i+1, rec.Code, rec.Body)
+		}
+		rec = postJSON(router, "/auth/mfa/verify", map[string]string{"mfa_token": challenge.Token, "code": "000000"})
+		if rec.Code != http.StatusUnauthorized {
+			t.Fatalf("code %d: got %d", i+1, rec.Code)
+		}
+	}
+
+	// The right password no longer clears the failures, so the account is locked out
+	rec := postJSON(router, "/auth/login", login)
+	if rec.Code != http.StatusTooManyRequests || rec.Header().Get("Retry-After") == "" {
+		t.Errorf("login after wrong codes: got %d %s", rec.Code, rec.Body)
+	}
+	rec = postJSON(router, "/auth/mfa/verify", map[string]string{"mfa_token": "challenge-5", "code": "000000"})
+	if rec.Code != http.StatusTooManyRequests {
+		t.Errorf("verify after wrong codes: got %d %s", rec.Code, rec.Body)
+	}
+}
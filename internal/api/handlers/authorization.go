@@ -0,0 +1,29 @@
+package handlers
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"yoked_backend/internal/api/middleware"
+	"yoked_backend/internal/services"
+)
+
+// resolveTargetUser returns the user a request acts on: the requested ID when the caller
+// is allowed to act on it, or the caller when none was given. On failure the response has
+// already been written and ok is false.
+func resolveTargetUser(c *gin.Context, authorizer services.Authorizer, requestedID string) (userID string, ok bool) {
+	actorID, err := middleware.GetUserIDFromContext(c)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid token"})
+		return "", false
+	}
+	if requestedID == "" {
+		return actorID, true
+	}
+
+	if err := authorizer.AuthorizeUser(c.Request.Context(), actorID, requestedID); err != nil {
+		respondError(c, err)
+		return "", false
+	}
+	return requestedID, true
+}
@@ -0,0 +1,290 @@
+package handlers
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"yoked_backend/internal/models"
+	"yoked_backend/internal/services"
+)
+
+// CatalogHandler serves the /admin/programs routes coaches use to edit the program catalog.
+// Edits change the program's draft and respond with the whole draft tree as saved.
+type CatalogHandler struct {
+	catalog services.CatalogService
+}
+
+func NewCatalogHandler(catalog services.CatalogService) *CatalogHandler {
+	return &CatalogHandler{catalog: catalog}
+}
+
+// ReorderExercisesRequest lists a workout's prescription ids in their new order
+type ReorderExercisesRequest struct {
+	ExerciseIDs []int `json:"exercise_ids" binding:"required"`
+}
+
+// pathIDs parses the named integer path parameters, answering 400 when one is malformed
+func pathIDs(c *gin.Context, names ...string) ([]int, bool) {
+	ids := make([]int, len(names))
+	for i, name := range names {
+		id, err := strconv.Atoi(c.Param(name))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid " + name})
+			return nil, false
+		}
+		ids[i] = id
+	}
+	return ids, true
+}
+
+// respondTree writes the result of a catalog edit
+func respondTree(c *gin.Context, status int, tree *models.ProgramTree, err error) {
+	if err != nil {
+		respondError(c, err)
+		return
+	}
+	c.JSON(status, tree)
+}
+
+// ListPrograms returns every program, published or not
+// GET /admin/programs
+func (h *CatalogHandler) ListPrograms(c *gin.Context) {
+	programs, err := h.catalog.ListPrograms(c.Request.Context())
+	if err != nil {
+		respondError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, programs)
+}
+
+// GetProgram returns a program with its draft workouts and exercises
+// GET /admin/programs/:id
+func (h *CatalogHandler) GetProgram(c *gin.Context) {
+	ids, ok := pathIDs(c, "id")
+	if !ok {
+		return
+	}
+
+	tree, err := h.catalog.GetProgram(c.Request.Context(), ids[0])
+	respondTree(c, http.StatusOK, tree, err)
+}
+
+// CreateProgram adds an unpublished program, optionally with its workouts and exercises
+// POST /admin/programs
+func (h *CatalogHandler) CreateProgram(c *gin.Context) {
+	var req models.ProgramTree
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request: " + err.Error()})
+		return
+	}
+
+	tree, err := h.catalog.CreateProgram(c.Request.Context(), &req)
+	respondTree(c, http.StatusCreated, tree, err)
+}
+
+// ReplaceProgram saves a whole program tree in one go. Exercises are ordered as listed.
+// PUT /admin/programs/:id
+func (h *CatalogHandler) ReplaceProgram(c *gin.Context) {
+	ids, ok := pathIDs(c, "id")
+	if !ok {
+		return
+	}
+	var req models.ProgramTree
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request: " + err.Error()})
+		return
+	}
+
+	tree, err := h.catalog.ReplaceProgram(c.Request.Context(), ids[0], &req)
+	respondTree(c, http.StatusOK, tree, err)
+}
+
+// DeleteProgram removes a program nobody has enrolled in
+// DELETE /admin/programs/:id
+func (h *CatalogHandler) DeleteProgram(c *gin.Context) {
+	ids, ok := pathIDs(c, "id")
+	if !ok {
+		return
+	}
+
+	if err := h.catalog.DeleteProgram(c.Request.Context(), ids[0]); err != nil {
+		respondError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Program deleted"})
+}
+
+// PublishProgram lists the program for users and makes the draft its latest version
+// POST /admin/programs/:id/publish
+func (h *CatalogHandler) PublishProgram(c *gin.Context) {
+	ids, ok := pathIDs(c, "id")
+	if !ok {
+		return
+	}
+
+	program, err := h.catalog.PublishProgram(c.Request.Context(), ids[0])
+	if err != nil {
+		respondError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, program)
+}
+
+// UnpublishProgram hides the program from users who are not already on it
+// POST /admin/programs/:id/unpublish
+func (h *CatalogHandler) UnpublishProgram(c *gin.Context) {
+	ids, ok := pathIDs(c, "id")
+	if !ok {
+		return
+	}
+
+	program, err := h.catalog.UnpublishProgram(c.Request.Context(), ids[0])
+	if err != nil {
+		respondError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, program)
+}
+
+// ListVersions returns the program's published versions, newest first
+// GET /admin/programs/:id/versions
+func (h *CatalogHandler) ListVersions(c *gin.Context) {
+	ids, ok := pathIDs(c, "id")
+	if !ok {
+		return
+	}
+
+	versions, err := h.catalog.ListVersions(c.Request.Context(), ids[0])
+	if err != nil {
+		respondError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, versions)
+}
+
+// GetVersion returns a published version with its workouts and exercises
+// GET /admin/programs/:id/versions/:version
+func (h *CatalogHandler) GetVersion(c *gin.Context) {
+	ids, ok := pathIDs(c, "id", "version")
+	if !ok {
+		return
+	}
+
+	tree, err := h.catalog.GetVersion(c.Request.Context(), ids[0], ids[1])
+	respondTree(c, http.StatusOK, tree, err)
+}
+
+// AddWorkout adds a workout, optionally with its exercises
+// POST /admin/programs/:id/workouts
+func (h *CatalogHandler) AddWorkout(c *gin.Context) {
+	ids, ok := pathIDs(c, "id")
+	if !ok {
+		return
+	}
+	var req models.ProgramWorkoutTree
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request: " + err.Error()})
+		return
+	}
+
+	tree, err := h.catalog.AddWorkout(c.Request.Context(), ids[0], &req)
+	respondTree(c, http.StatusCreated, tree, err)
+}
+
+// UpdateWorkout changes a workout's name, day or description
+// PUT /admin/programs/:id/workouts/:workout_id
+func (h *CatalogHandler) UpdateWorkout(c *gin.Context) {
+	ids, ok := pathIDs(c, "id", "workout_id")
+	if !ok {
+		return
+	}
+	var req models.ProgramWorkout
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request: " + err.Error()})
+		return
+	}
+
+	tree, err := h.catalog.UpdateWorkout(c.Request.Context(), ids[0], ids[1], &req)
+	respondTree(c, http.StatusOK, tree, err)
+}
+
+// DeleteWorkout removes a workout and its exercises
+// DELETE /admin/programs/:id/workouts/:workout_id
+func (h *CatalogHandler) DeleteWorkout(c *gin.Context) {
+	ids, ok := pathIDs(c, "id", "workout_id")
+	if !ok {
+		return
+	}
+
+	tree, err := h.catalog.DeleteWorkout(c.Request.Context(), ids[0], ids[1])
+	respondTree(c, http.StatusOK, tree, err)
+}
+
+// AddExercise prescribes an exercise, at exercise_order when given and last otherwise
+// POST /admin/programs/:id/workouts/:workout_id/exercises
+func (h *CatalogHandler) AddExercise(c *gin.Context) {
+	ids, ok := pathIDs(c, "id", "workout_id")
+	if !ok {
+		return
+	}
+	var req models.ProgramWorkoutExercise
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request: " + err.Error()})
+		return
+	}
+
+	tree, err := h.catalog.AddExercise(c.Request.Context(), ids[0], ids[1], &req)
+	respondTree(c, http.StatusCreated, tree, err)
+}
+
+// UpdateExercise replaces a prescription, moving it when exercise_order is given
+// PUT /admin/programs/:id/workouts/:workout_id/exercises/:exercise_id
+func (h *CatalogHandler) UpdateExercise(c *gin.Context) {
+	ids, ok := pathIDs(c, "id", "workout_id", "exercise_id")
+	if !ok {
+		return
+	}
+	var req models.ProgramWorkoutExercise
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request: " + err.Error()})
+		return
+	}
+
+	tree, err := h.catalog.UpdateExercise(c.Request.Context(), ids[0], ids[1], ids[2], &req)
+	respondTree(c, http.StatusOK, tree, err)
+}
+
+// DeleteExercise removes a prescription
+// DELETE /admin/programs/:id/workouts/:workout_id/exercises/:exercise_id
+func (h *CatalogHandler) DeleteExercise(c *gin.Context) {
+	ids, ok := pathIDs(c, "id", "workout_id", "exercise_id")
+	if !ok {
+		return
+	}
+
+	tree, err := h.catalog.DeleteExercise(c.Request.Context(), ids[0], ids[1], ids[2])
+	respondTree(c, http.StatusOK, tree, err)
+}
+
+// ReorderExercises sets the order of a workout's exercises
+// PUT /admin/programs/:id/workouts/:workout_id/exercise-order
+func (h *CatalogHandler) ReorderExercises(c *gin.Context) {
+	ids, ok := pathIDs(c, "id", "workout_id")
+	if !ok {
+		return
+	}
+	var req ReorderExercisesRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request: " + err.Error()})
+		return
+	}
+
+	tree, err := h.catalog.ReorderExercises(c.Request.Context(), ids[0], ids[1], req.ExerciseIDs)
+	respondTree(c, http.StatusOK, tree, err)
+}
@@ -0,0 +1,71 @@
+package handlers
+
+import (
+	"errors"
+	"log"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"yoked_backend/internal/db/repositories"
+	"yoked_backend/internal/services"
+)
+
+// respondError writes err with the status matching its kind, falling back to 500. Server
+// errors are logged and answered with a generic message.
+func respondError(c *gin.Context, err error) {
+	status, message := errorResponse(err)
+	if status >= http.StatusInternalServerError {
+		log.Printf("%s %s: %v", c.Request.Method, c.FullPath(), err)
+	}
+	c.JSON(status, gin.H{"error": message})
+}
+
+// errorKinds maps the errors clients may see to their status, in the order they are matched
+var errorKinds = []struct {
+	err    error
+	status int
+}{
+	{services.ErrInvalidInput, http.StatusBadRequest},
+	{repositories.ErrInvalid, http.StatusBadRequest},
+	{services.ErrInvalidResetToken, http.StatusBadRequest},
+	{services.ErrInvalidVerificationToken, http.StatusBadRequest},
+	{services.ErrInvalidOIDCState, http.StatusBadRequest},
+	{services.ErrInvalidRefreshToken, http.StatusUnauthorized},
+	{services.ErrRefreshTokenReused, http.StatusUnauthorized},
+	{services.ErrInvalidMFACode, http.StatusUnauthorized},
+	{services.ErrInvalidMFAChallenge, http.StatusUnauthorized},
+	{services.ErrOIDCAuthFailed, http.StatusUnauthorized},
+	{services.ErrForbidden, http.StatusForbidden},
+	{services.ErrOIDCEmailUnverified, http.StatusForbidden},
+	{repositories.ErrNotFound, http.StatusNotFound},
+	{services.ErrUnknownProvider, http.StatusNotFound},
+	{repositories.ErrConflict, http.StatusConflict},
+	{services.ErrMFAAlreadyEnabled, http.StatusConflict},
+	{services.ErrWorkoutInProgress, http.StatusConflict},
+	{services.ErrWorkoutNotInProgress, http.StatusConflict},
+	{services.ErrIdentityConflict, http.StatusConflict},
+	{services.ErrLastLoginMethod, http.StatusConflict},
+	{services.ErrCatalogInUse, http.StatusConflict},
+	{services.ErrProgramUpToDate, http.StatusConflict},
+	{repositories.ErrForeignKey, http.StatusUnprocessableEntity},
+	{services.ErrSignupProfileRequired, http.StatusUnprocessableEntity},
+	{services.ErrVerificationThrottled, http.StatusTooManyRequests},
+	{services.ErrLoginLocked, http.StatusTooManyRequests},
+	{services.ErrTooManyRequests, http.StatusTooManyRequests},
+}
+
+// errorResponse returns the status and message to answer err with. Only the matched kind's
+// own message is sent, since what wraps it can carry database and upstream details; validation
+// errors are the exception, as invalidInput words them for the client.
+func errorResponse(err error) (int, string) {
+	for _, kind := range errorKinds {
+		if !errors.Is(err, kind.err) {
+			continue
+		}
+		if kind.err == services.ErrInvalidInput {
+			return kind.status, err.Error()
+		}
+		return kind.status, kind.err.Error()
+	}
+	return http.StatusInternalServerError, "Internal server error"
+}
@@ -0,0 +1,34 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"testing"
+
+	"yoked_backend/internal/db/repositories"
+	"yoked_backend/internal/services"
+)
+
+func TestErrorResponse(t *testing.T) {
+	dbErr := errors.New(`duplicate key value violates unique constraint "users_email_key"`)
+
+	for _, tc := range []struct {
+		name        string
+		err         error
+		wantStatus  int
+		wantMessage string
+	}{
+		{"validation", fmt.Errorf("exercise 3 set 1: %w", services.ErrInvalidInput), http.StatusBadRequest, "exercise 3 set 1: invalid input"},
+		{"wrapped sentinel", fmt.Errorf("failed to create user: %w", fmt.Errorf("%w: %w", repositories.ErrConflict, dbErr)), http.StatusConflict, "already exists"},
+		{"not found", fmt.Errorf("program 7: %w", repositories.ErrNotFound), http.StatusNotFound, "not found"},
+		{"server error", fmt.Errorf("failed to get user: %w", dbErr), http.StatusInternalServerError, "Internal server error"},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			status, message := errorResponse(tc.err)
+			if status != tc.wantStatus || message != tc.wantMessage {
+				t.Errorf("got %d %q, want %d %q", status, message, tc.wantStatus, tc.wantMessage)
+			}
+		})
+	}
+}
@@ -0,0 +1,142 @@
+package handlers
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"yoked_backend/internal/models"
+	"yoked_backend/internal/services"
+)
+
+// ExerciseHandler serves the exercise library: searching it under /exercises and editing it
+// under /admin/exercises
+type ExerciseHandler struct {
+	exercises services.ExerciseService
+}
+
+func NewExerciseHandler(exercises services.ExerciseService) *ExerciseHandler {
+	return &ExerciseHandler{exercises: exercises}
+}
+
+// SearchExercisesRequest holds the search query parameters
+type SearchExercisesRequest struct {
+	Query           string `form:"q"`
+	Muscle          string `form:"muscle"`
+	Equipment       string `form:"equipment"`
+	MovementPattern string `form:"movement_pattern"`
+	Mechanics       string `form:"mechanics"`
+	Difficulty      string `form:"difficulty"`
+	Limit           int    `form:"limit"`
+	Offset          int    `form:"offset"`
+}
+
+// MergeExerciseRequest names the exercise a duplicate is merged into
+type MergeExerciseRequest struct {
+	IntoID int `json:"into_id" binding:"required"`
+}
+
+// SearchExercises returns a page of exercises matching the query and filters, with facet counts
+// GET /exercises?q=&muscle=&equipment=&movement_pattern=&mechanics=&difficulty=&limit=&offset=
+func (h *ExerciseHandler) SearchExercises(c *gin.Context) {
+	var req SearchExercisesRequest
+	if err := c.ShouldBindQuery(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request: " + err.Error()})
+		return
+	}
+
+	page, err := h.exercises.SearchExercises(c.Request.Context(), models.ExerciseFilter{
+		Query:           req.Query,
+		Muscle:          req.Muscle,
+		Equipment:       req.Equipment,
+		MovementPattern: req.MovementPattern,
+		Mechanics:       req.Mechanics,
+		Difficulty:      req.Difficulty,
+		Limit:           req.Limit,
+		Offset:          req.Offset,
+	})
+	if err != nil {
+		respondError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, page)
+}
+
+// GetExercise returns an exercise, including one merged into another
+// GET /exercises/:id
+func (h *ExerciseHandler) GetExercise(c *gin.Context) {
+	ids, ok := pathIDs(c, "id")
+	if !ok {
+		return
+	}
+
+	exercise, err := h.exercises.GetExercise(c.Request.Context(), ids[0])
+	if err != nil {
+		respondError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, exercise)
+}
+
+// CreateExercise adds an exercise to the library
+// POST /admin/exercises
+func (h *ExerciseHandler) CreateExercise(c *gin.Context) {
+	var req models.Exercise
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request: " + err.Error()})
+		return
+	}
+
+	exercise, err := h.exercises.CreateExercise(c.Request.Context(), &req)
+	if err != nil {
+		respondError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusCreated, exercise)
+}
+
+// UpdateExercise replaces an exercise's details
+// PUT /admin/exercises/:id
+func (h *ExerciseHandler) UpdateExercise(c *gin.Context) {
+	ids, ok := pathIDs(c, "id")
+	if !ok {
+		return
+	}
+	var req models.Exercise
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request: " + err.Error()})
+		return
+	}
+
+	exercise, err := h.exercises.UpdateExercise(c.Request.Context(), ids[0], &req)
+	if err != nil {
+		respondError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, exercise)
+}
+
+// MergeExercise folds a duplicate exercise into another and returns the one that remains
+// POST /admin/exercises/:id/merge
+func (h *ExerciseHandler) MergeExercise(c *gin.Context) {
+	ids, ok := pathIDs(c, "id")
+	if !ok {
+		return
+	}
+	var req MergeExerciseRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request: " + err.Error()})
+		return
+	}
+
+	exercise, err := h.exercises.MergeExercise(c.Request.Context(), ids[0], req.IntoID)
+	if err != nil {
+		respondError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, exercise)
+}
@@ -0,0 +1,94 @@
+package handlers
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"yoked_backend/internal/services"
+)
+
+// IdentityHandler manages the social login providers linked to the signed-in user. Logging
+// in with a provider is AuthHandler.OIDCAuthorize and OIDCCallback, since it starts a session.
+type IdentityHandler struct {
+	identities services.IdentityService
+}
+
+func NewIdentityHandler(identities services.IdentityService) *IdentityHandler {
+	return &IdentityHandler{identities: identities}
+}
+
+// GetIdentities lists the providers linked to the account
+// GET /users/me/identities
+func (h *IdentityHandler) GetIdentities(c *gin.Context) {
+	userID := c.MustGet("userID").(string)
+
+	identities, err := h.identities.ListIdentities(c.Request.Context(), userID)
+	if err != nil {
+		respondError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, identities)
+}
+
+// Authorize starts linking a provider, returning the provider URL to send the user to
+// POST /users/me/identities/:provider/authorize
+func (h *IdentityHandler) Authorize(c *gin.Context) {
+	userID := c.MustGet("userID").(string)
+
+	authorization, err := h.identities.StartLink(c.Request.Context(), c.Param("provider"), userID)
+	if err != nil {
+		respondError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, authorization)
+}
+
+// Reauthorize starts a fresh login to a linked provider, for an account without a password to
+// confirm a sensitive action such as deleting the account
+// POST /users/me/reauthenticate/:provider
+func (h *IdentityHandler) Reauthorize(c *gin.Context) {
+	userID := c.MustGet("userID").(string)
+
+	authorization, err := h.identities.StartReauthentication(c.Request.Context(), c.Param("provider"), userID)
+	if err != nil {
+		respondError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, authorization)
+}
+
+// Callback links the provider account the user signed in to
+// POST /users/me/identities/:provider/callback
+func (h *IdentityHandler) Callback(c *gin.Context) {
+	userID := c.MustGet("userID").(string)
+
+	var req OIDCCallbackRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request: " + err.Error()})
+		return
+	}
+
+	identity, err := h.identities.CompleteLink(c.Request.Context(), c.Param("provider"), userID, req.Code, req.State)
+	if err != nil {
+		respondError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusCreated, identity)
+}
+
+// Unlink removes a provider from the account, unless it is the only way left to log in
+// DELETE /users/me/identities/:provider
+func (h *IdentityHandler) Unlink(c *gin.Context) {
+	userID := c.MustGet("userID").(string)
+
+	if err := h.identities.Unlink(c.Request.Context(), userID, c.Param("provider")); err != nil {
+		respondError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Provider unlinked"})
+}
@@ -0,0 +1,103 @@
+package handlers
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"yoked_backend/internal/services"
+)
+
+// MFAHandler manages two-factor enrollment for the signed-in user. The second login step
+// itself is AuthHandler.VerifyMFA, since it starts a session.
+type MFAHandler struct {
+	userService services.UserService
+	mfa         services.MFAService
+}
+
+func NewMFAHandler(userService services.UserService, mfa services.MFAService) *MFAHandler {
+	return &MFAHandler{userService: userService, mfa: mfa}
+}
+
+// MFACodeRequest carries a code from the authenticator app, or a recovery code
+type MFACodeRequest struct {
+	Code string `json:"code" binding:"required"`
+}
+
+// Enroll starts 2FA enrollment, returning the secret and a provisioning URI for a QR code
+// POST /auth/mfa/enroll
+func (h *MFAHandler) Enroll(c *gin.Context) {
+	userID := c.MustGet("userID").(string)
+
+	user, err := h.userService.GetUserByID(c.Request.Context(), userID)
+	if err != nil {
+		respondError(c, err)
+		return
+	}
+
+	enrollment, err := h.mfa.BeginEnrollment(c.Request.Context(), user)
+	if err != nil {
+		respondError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, enrollment)
+}
+
+// Confirm enables 2FA with a first code from the authenticator and returns the recovery codes
+// POST /auth/mfa/confirm
+func (h *MFAHandler) Confirm(c *gin.Context) {
+	userID := c.MustGet("userID").(string)
+
+	var req MFACodeRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request: " + err.Error()})
+		return
+	}
+
+	codes, err := h.mfa.ConfirmEnrollment(c.Request.Context(), userID, req.Code)
+	if err != nil {
+		respondError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"recovery_codes": codes})
+}
+
+// Disable turns 2FA off
+// POST /auth/mfa/disable
+func (h *MFAHandler) Disable(c *gin.Context) {
+	userID := c.MustGet("userID").(string)
+
+	var req MFACodeRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request: " + err.Error()})
+		return
+	}
+
+	if err := h.mfa.Disable(c.Request.Context(), userID, req.Code); err != nil {
+		respondError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Two-factor authentication disabled"})
+}
+
+// RegenerateRecoveryCodes replaces the user's recovery codes
+// POST /auth/mfa/recovery-codes
+func (h *MFAHandler) RegenerateRecoveryCodes(c *gin.Context) {
+	userID := c.MustGet("userID").(string)
+
+	var req MFACodeRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request: " + err.Error()})
+		return
+	}
+
+	codes, err := h.mfa.RegenerateRecoveryCodes(c.Request.Context(), userID, req.Code)
+	if err != nil {
+		respondError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"recovery_codes": codes})
+}
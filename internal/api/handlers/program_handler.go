@@ -13,10 +13,11 @@ import (
 type ProgramHandler struct {
 	programService services.ProgramService
 	userService services.UserService
+	authorizer services.Authorizer
 }
 
-func NewProgramHandler(programService services.ProgramService, userService services.UserService) *ProgramHandler {
-	return &ProgramHandler{programService: programService, userService: userService}
+func NewProgramHandler(programService services.ProgramService, userService services.UserService, authorizer services.Authorizer) *ProgramHandler {
+	return &ProgramHandler{programService: programService, userService: userService, authorizer: authorizer}
 }
 
 // GetProgramsByGoal returns programs filtered by goal
@@ -30,69 +31,76 @@ func (h *ProgramHandler) GetProgramsByGoal(c *gin.Context) {
 
 	programs, err := h.programService.GetProgramsByGoal(c.Request.Context(), goal)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		respondError(c, err)
 		return
 	}
 
 	c.JSON(http.StatusOK, programs)
 }
 
-// GetAllExercises returns all available exercises
-// GET /api/exercises
-func (h *ProgramHandler) GetAllExercises(c *gin.Context) {
-	exercises, err := h.programService.GetAllExercises(c.Request.Context())
-	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
-		return
+// AssignProgram assigns a program to a user, the caller when user_id is omitted
+// POST /api/programs/assign
+func (h *ProgramHandler) AssignProgram(c *gin.Context) {
+	var request struct {
+		UserID    string `json:"user_id"`
+		ProgramID int    `json:"program_id"`
 	}
 
-	c.JSON(http.StatusOK, exercises)
-}
+	if err := c.BindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request body"})
+		return
+	}
 
-// GetExerciseByID returns a specific exercise
-// GET /api/exercises/{id}
-func (h *ProgramHandler) GetExerciseByID(c *gin.Context) {
-	exerciseID, err := strconv.Atoi(c.Param("id"))
-	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid exercise ID"})
+	userID, ok := resolveTargetUser(c, h.authorizer, request.UserID)
+	if !ok {
 		return
 	}
 
-	exercise, err := h.programService.GetExerciseByID(c.Request.Context(), exerciseID)
+	err := h.programService.AssignProgramToUser(c.Request.Context(), userID, request.ProgramID)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		respondError(c, err)
 		return
 	}
 
-	c.JSON(http.StatusOK, exercise)
+	c.JSON(http.StatusCreated, gin.H{"message": "Program assigned successfully"})
 }
 
-// AssignProgram assigns a program to a user
-// POST /api/programs/assign
-func (h *ProgramHandler) AssignProgram(c *gin.Context) {
+// UpgradeProgram moves a user's active program to its latest version, the caller's when
+// user_id is omitted
+// POST /api/programs/upgrade
+func (h *ProgramHandler) UpgradeProgram(c *gin.Context) {
 	var request struct {
-		UserID    string `json:"user_id"`
-		ProgramID int    `json:"program_id"`
+		UserID string `json:"user_id"`
+	}
+	// The body is optional
+	if c.Request.ContentLength != 0 {
+		if err := c.ShouldBindJSON(&request); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request: " + err.Error()})
+			return
+		}
 	}
 
-	if err := c.BindJSON(&request); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request body"})
+	userID, ok := resolveTargetUser(c, h.authorizer, request.UserID)
+	if !ok {
 		return
 	}
 
-	err := h.programService.AssignProgramToUser(c.Request.Context(), request.UserID, request.ProgramID)
+	programDetail, err := h.programService.UpgradeUserProgram(c.Request.Context(), userID)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		respondError(c, err)
 		return
 	}
 
-	c.JSON(http.StatusCreated, gin.H{"message": "Program assigned successfully"})
+	c.JSON(http.StatusOK, programDetail)
 }
 
 // GetUserProgram returns user's current program with workouts
 // GET /api/programs/user/{user_id}
 func (h *ProgramHandler) GetUserProgram(c *gin.Context) {
-	userID := c.Param("user_id")
+	userID, ok := resolveTargetUser(c, h.authorizer, c.Param("user_id"))
+	if !ok {
+		return
+	}
 
 	// Get user details first
 	//user, err := h.userService.GetUserByID(c.Request.Context(), userID)
@@ -104,7 +112,7 @@ func (h *ProgramHandler) GetUserProgram(c *gin.Context) {
 	// Get program details
 	programDetail, err := h.programService.GetUserProgramWithWorkouts(c.Request.Context(), userID)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		respondError(c, err)
 		return
 	}
 
@@ -135,9 +143,14 @@ func (h *ProgramHandler) StartWorkoutSession(c *gin.Context) {
 		return
 	}
 
-	session, err := h.programService.StartWorkoutSession(c.Request.Context(), request.UserID, request.ProgramWorkoutID)
+	userID, ok := resolveTargetUser(c, h.authorizer, request.UserID)
+	if !ok {
+		return
+	}
+
+	session, err := h.programService.StartWorkoutSession(c.Request.Context(), userID, request.ProgramWorkoutID)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		respondError(c, err)
 		return
 	}
 
@@ -154,11 +167,7 @@ func (h *ProgramHandler) CompleteWorkoutSession(c *gin.Context) {
 	}
 
 	var request struct {
-		Exercises []struct {
-			ProgramWorkoutExerciseID int   `json:"program_workout_exercise_id"`
-			ActualReps               []int `json:"actual_reps"`
-			ActualRIR                []int `json:"actual_rir"`
-		} `json:"exercises"`
+		Exercises []services.ExerciseLogRequest `json:"exercises"`
 	}
 
 	if err := c.BindJSON(&request); err != nil {
@@ -166,29 +175,64 @@ func (h *ProgramHandler) CompleteWorkoutSession(c *gin.Context) {
 		return
 	}
 
-	// Convert to service layer format
-	exerciseLogs := make([]services.ExerciseLogRequest, len(request.Exercises))
-	for i, ex := range request.Exercises {
-		exerciseLogs[i] = services.ExerciseLogRequest{
-			ProgramWorkoutExerciseID: ex.ProgramWorkoutExerciseID,
-			ActualReps:               ex.ActualReps,
-			ActualRIR:                ex.ActualRIR,
-		}
+	actorID := c.MustGet("userID").(string)
+	session, records, err := h.programService.CompleteWorkoutSession(c.Request.Context(), actorID, sessionID, request.Exercises)
+	if err != nil {
+		respondError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message":          "Workout completed successfully",
+		"session":          session,
+		"personal_records": records,
+	})
+}
+
+// GetActiveWorkoutSession returns the current user's in-progress session so it can be resumed
+// GET /api/workouts/active
+func (h *ProgramHandler) GetActiveWorkoutSession(c *gin.Context) {
+	userID := c.MustGet("userID").(string)
+
+	session, err := h.programService.GetActiveWorkoutSession(c.Request.Context(), userID)
+	if err != nil {
+		respondError(c, err)
+		return
+	}
+	if session == nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "No workout session in progress"})
+		return
 	}
 
-	err = h.programService.CompleteWorkoutSession(c.Request.Context(), sessionID, exerciseLogs)
+	c.JSON(http.StatusOK, session)
+}
+
+// AbandonWorkoutSession ends an in-progress session without logging it
+// POST /api/workouts/{id}/abandon
+func (h *ProgramHandler) AbandonWorkoutSession(c *gin.Context) {
+	sessionID, err := strconv.Atoi(c.Param("id"))
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid session ID"})
 		return
 	}
 
-	c.JSON(http.StatusOK, gin.H{"message": "Workout completed successfully"})
+	actorID := c.MustGet("userID").(string)
+	session, err := h.programService.AbandonWorkoutSession(c.Request.Context(), actorID, sessionID)
+	if err != nil {
+		respondError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, session)
 }
 
 // GetWorkoutHistory returns user's workout history
 // GET /api/workouts/history/{user_id}
 func (h *ProgramHandler) GetWorkoutHistory(c *gin.Context) {
-	userID := c.Param("user_id")
+	userID, ok := resolveTargetUser(c, h.authorizer, c.Param("user_id"))
+	if !ok {
+		return
+	}
 
 	limit := 10
 	if limitStr := c.Query("limit"); limitStr != "" {
@@ -199,19 +243,18 @@ func (h *ProgramHandler) GetWorkoutHistory(c *gin.Context) {
 
 	history, err := h.programService.GetWorkoutHistory(c.Request.Context(), userID, limit)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		respondError(c, err)
 		return
 	}
 
 	c.JSON(http.StatusOK, history)
 }
 
-// GetNextWorkoutWeights calculates weights for next workout based on previous performance
-// GET /api/workouts/next-weights?user_id=xxx&program_workout_id=123
+// GetNextWorkoutWeights suggests load and reps for the next workout using each exercise's progression strategy
+// GET /api/workouts/next-weights?user_id=xxx&program_workout_id=123 (user_id defaults to the caller)
 func (h *ProgramHandler) GetNextWorkoutWeights(c *gin.Context) {
-	userID := c.Query("user_id")
-	if userID == "" {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "User ID is required"})
+	userID, ok := resolveTargetUser(c, h.authorizer, c.Query("user_id"))
+	if !ok {
 		return
 	}
 
@@ -221,11 +264,14 @@ func (h *ProgramHandler) GetNextWorkoutWeights(c *gin.Context) {
 		return
 	}
 
-	weights, err := h.programService.CalculateNextWorkoutWeights(c.Request.Context(), userID, programWorkoutID)
+	suggestions, err := h.programService.CalculateNextWorkoutWeights(c.Request.Context(), userID, programWorkoutID)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		respondError(c, err)
 		return
 	}
 
-	c.JSON(http.StatusOK, weights)
+	c.JSON(http.StatusOK, gin.H{
+		"program_workout_id": programWorkoutID,
+		"exercises":          suggestions,
+	})
 }
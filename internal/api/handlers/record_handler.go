@@ -0,0 +1,51 @@
+package handlers
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"yoked_backend/internal/services"
+)
+
+type RecordHandler struct {
+	recordService services.RecordService
+}
+
+func NewRecordHandler(recordService services.RecordService) *RecordHandler {
+	return &RecordHandler{recordService: recordService}
+}
+
+// GetMyRecords returns the current user's standing personal records across all exercises
+// GET /users/me/records
+func (h *RecordHandler) GetMyRecords(c *gin.Context) {
+	userID := c.MustGet("userID").(string)
+
+	records, err := h.recordService.GetUserRecords(c.Request.Context(), userID)
+	if err != nil {
+		respondError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, records)
+}
+
+// GetExerciseRecords returns the current user's records and record history for one exercise
+// GET /exercises/{id}/records
+func (h *RecordHandler) GetExerciseRecords(c *gin.Context) {
+	userID := c.MustGet("userID").(string)
+
+	exerciseID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid exercise ID"})
+		return
+	}
+
+	records, err := h.recordService.GetExerciseRecords(c.Request.Context(), userID, exerciseID)
+	if err != nil {
+		respondError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, records)
+}
@@ -0,0 +1,44 @@
+package handlers
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"yoked_backend/internal/services"
+)
+
+// SessionHandler lists and signs out the devices the current user is logged in on
+type SessionHandler struct {
+	authService services.AuthService
+}
+
+func NewSessionHandler(authService services.AuthService) *SessionHandler {
+	return &SessionHandler{authService: authService}
+}
+
+// GetSessions lists the user's signed-in devices, most recently used first
+// GET /users/me/sessions
+func (h *SessionHandler) GetSessions(c *gin.Context) {
+	userID := c.MustGet("userID").(string)
+
+	sessions, err := h.authService.ListSessions(c.Request.Context(), userID)
+	if err != nil {
+		respondError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, sessions)
+}
+
+// RevokeSession signs a device out remotely
+// DELETE /users/me/sessions/:id
+func (h *SessionHandler) RevokeSession(c *gin.Context) {
+	userID := c.MustGet("userID").(string)
+
+	if err := h.authService.RevokeSession(c.Request.Context(), userID, c.Param("id")); err != nil {
+		respondError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Session signed out"})
+}
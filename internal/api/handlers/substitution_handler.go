@@ -0,0 +1,124 @@
+package handlers
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"yoked_backend/internal/models"
+	"yoked_backend/internal/services"
+)
+
+// SubstitutionHandler suggests alternatives to exercises and manages users' standing swaps.
+// Each route acts on the caller unless user_id names someone they have a grant for.
+type SubstitutionHandler struct {
+	substitutions services.SubstitutionService
+	authorizer    services.Authorizer
+}
+
+func NewSubstitutionHandler(substitutions services.SubstitutionService, authorizer services.Authorizer) *SubstitutionHandler {
+	return &SubstitutionHandler{substitutions: substitutions, authorizer: authorizer}
+}
+
+// SuggestSubstitutesRequest holds the suggestion query parameters
+type SuggestSubstitutesRequest struct {
+	UserID string `form:"user_id"`
+	Limit  int    `form:"limit"`
+}
+
+// SetOverrideRequest swaps an exercise of a program for another
+type SetOverrideRequest struct {
+	UserID               string `json:"user_id"`
+	ProgramID            int    `json:"program_id" binding:"required"`
+	ExerciseID           int    `json:"exercise_id" binding:"required"`
+	SubstituteExerciseID int    `json:"substitute_exercise_id" binding:"required"`
+}
+
+// SuggestSubstitutes ranks alternatives to an exercise against the user's equipment
+// GET /exercises/:id/substitutes?user_id=&limit=
+func (h *SubstitutionHandler) SuggestSubstitutes(c *gin.Context) {
+	ids, ok := pathIDs(c, "id")
+	if !ok {
+		return
+	}
+	var req SuggestSubstitutesRequest
+	if err := c.ShouldBindQuery(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request: " + err.Error()})
+		return
+	}
+	userID, ok := resolveTargetUser(c, h.authorizer, req.UserID)
+	if !ok {
+		return
+	}
+
+	suggestions, err := h.substitutions.SuggestSubstitutes(c.Request.Context(), userID, ids[0], req.Limit)
+	if err != nil {
+		respondError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"substitutes": suggestions})
+}
+
+// GetOverrides lists the user's exercise overrides across programs
+// GET /programs/overrides?user_id=
+func (h *SubstitutionHandler) GetOverrides(c *gin.Context) {
+	userID, ok := resolveTargetUser(c, h.authorizer, c.Query("user_id"))
+	if !ok {
+		return
+	}
+
+	overrides, err := h.substitutions.GetOverrides(c.Request.Context(), userID)
+	if err != nil {
+		respondError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"overrides": overrides})
+}
+
+// SetOverride saves the user's swap of an exercise in a program, replacing any earlier one
+// POST /programs/overrides
+func (h *SubstitutionHandler) SetOverride(c *gin.Context) {
+	var req SetOverrideRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request: " + err.Error()})
+		return
+	}
+	userID, ok := resolveTargetUser(c, h.authorizer, req.UserID)
+	if !ok {
+		return
+	}
+
+	override, err := h.substitutions.SetOverride(c.Request.Context(), &models.ExerciseOverride{
+		UserID:               userID,
+		ProgramID:            req.ProgramID,
+		ExerciseID:           req.ExerciseID,
+		SubstituteExerciseID: req.SubstituteExerciseID,
+	})
+	if err != nil {
+		respondError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, override)
+}
+
+// DeleteOverride goes back to the prescribed exercise
+// DELETE /programs/overrides/:id?user_id=
+func (h *SubstitutionHandler) DeleteOverride(c *gin.Context) {
+	ids, ok := pathIDs(c, "id")
+	if !ok {
+		return
+	}
+	userID, ok := resolveTargetUser(c, h.authorizer, c.Query("user_id"))
+	if !ok {
+		return
+	}
+
+	if err := h.substitutions.DeleteOverride(c.Request.Context(), userID, ids[0]); err != nil {
+		respondError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Override deleted"})
+}
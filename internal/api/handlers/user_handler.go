@@ -10,11 +10,12 @@ import (
 )
 
 type UserHandler struct {
-    userService services.UserService
+    userService  services.UserService
+    statsService services.StatsService
 }
 
-func NewUserHandler(userService services.UserService) *UserHandler {
-    return &UserHandler{userService: userService}
+func NewUserHandler(userService services.UserService, statsService services.StatsService) *UserHandler {
+    return &UserHandler{userService: userService, statsService: statsService}
 }
 
 func (h *UserHandler) GetCurrentUser(c *gin.Context) {
@@ -22,7 +23,7 @@ func (h *UserHandler) GetCurrentUser(c *gin.Context) {
     
     user, err := h.userService.GetUserProfile(c.Request.Context(), userID)
     if err != nil {
-        c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+        respondError(c, err)
         return
     }
     
@@ -40,7 +41,7 @@ func (h *UserHandler) UpdateUser(c *gin.Context) {
     
     user, err := h.userService.UpdateUserProfile(c.Request.Context(), userID, updates)
     if err != nil {
-        c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+        respondError(c, err)
         return
     }
     
@@ -52,7 +53,7 @@ func (h *UserHandler) GetUserPreferences(c *gin.Context) {
     
     preferences, err := h.userService.GetUserPreferences(c.Request.Context(), userID)
     if err != nil {
-        c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+        respondError(c, err)
         return
     }
     
@@ -70,7 +71,7 @@ func (h *UserHandler) UpdateUserPreferences(c *gin.Context) {
     
     err := h.userService.UpdateUserPreferences(c.Request.Context(), userID, &prefs)
     if err != nil {
-        c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+        respondError(c, err)
         return
     }
     
@@ -93,7 +94,7 @@ func (h *UserHandler) UpdatePassword(c *gin.Context) {
     // Get user to verify old password
     user, err := h.userService.GetUserByID(c.Request.Context(), userID)
     if err != nil {
-        c.JSON(http.StatusInternalServerError, gin.H{"error": "User not found"})
+        respondError(c, err)
         return
     }
     
@@ -122,11 +123,25 @@ func (h *UserHandler) UpdatePassword(c *gin.Context) {
 
 func (h *UserHandler) GetUserStats(c *gin.Context) {
     userID := c.MustGet("userID").(string)
-    
-    // This would use a stats service if you implement it
-    // For now, just return a placeholder response
-    c.JSON(http.StatusOK, gin.H{
-        "user_id": userID,
-        "message": "User stats endpoint - implement stats service",
-    })
+
+    stats, err := h.statsService.GetUserStats(c.Request.Context(), userID)
+    if err != nil {
+        respondError(c, err)
+        return
+    }
+
+    c.JSON(http.StatusOK, stats)
+}
+
+// RecomputeUserStats rebuilds the current user's stats from their full workout history
+func (h *UserHandler) RecomputeUserStats(c *gin.Context) {
+    userID := c.MustGet("userID").(string)
+
+    stats, err := h.statsService.RecomputeUserStats(c.Request.Context(), userID)
+    if err != nil {
+        respondError(c, err)
+        return
+    }
+
+    c.JSON(http.StatusOK, stats)
 }
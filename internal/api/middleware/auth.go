@@ -1,7 +1,11 @@
 package middleware
 
 import (
-	"os"
+	"context"
+	"crypto"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
 	"fmt"
 	"net/http"
 	"strings"
@@ -10,38 +14,55 @@ import (
 	"github.com/gin-gonic/gin"
 	"github.com/golang-jwt/jwt/v5"
 	"golang.org/x/crypto/bcrypt"
+	"yoked_backend/internal/models"
 )
 
 // JWT claims structure
 type Claims struct {
-	UserID string `json:"user_id"`
-	Email  string `json:"email"`
+	UserID       string   `json:"user_id"`
+	Email        string   `json:"email"`
+	Role         string   `json:"role"`
+	Permissions  []string `json:"permissions"`   // role scopes plus individually granted ones
+	TokenVersion int      `json:"ver"`           // must match the user's current token_version
+	SessionID    string   `json:"sid,omitempty"` // the session it was issued for, refused once signed out
 	jwt.RegisteredClaims
 }
 
+// ErrTokenRevoked is returned for a token minted before the user's token version was bumped
+var ErrTokenRevoked = errors.New("token has been revoked")
+
+// TokenVersionChecker returns the token version a user's access tokens must carry. It is
+// called on every authenticated request, so implementations are expected to cache.
+type TokenVersionChecker interface {
+	CurrentTokenVersion(ctx context.Context, userID string) (int, error)
+}
+
+// SessionChecker reports whether the session an access token was issued for has been signed
+// out. Like TokenVersionChecker it is called on every authenticated request.
+type SessionChecker interface {
+	SessionRevoked(ctx context.Context, sessionID string) (bool, error)
+}
+
 // Auth context key type (to avoid key collisions)
 type contextKey string
 
 const (
-	UserIDKey contextKey = "userID"
-)
-
-var (
-	jwtSecret = []byte(getJWTSecret())
+	UserIDKey      contextKey = "userID"
+	RoleKey        contextKey = "role"
+	PermissionsKey contextKey = "permissions"
 )
 
-// Get JWT secret from environment variable with fallback
-func getJWTSecret() []byte {
-	secret := os.Getenv("JWT_SECRET")
-	if secret == "" {
-		// In production, you should always set this via environment variable
-		return []byte("your-default-super-secret-key-change-in-production")
-	}
-	return []byte(secret)
+// KeySet supplies the key to sign new tokens with and looks up verification keys by kid
+type KeySet interface {
+	SigningKey() (kid, alg string, key crypto.PrivateKey, err error)
+	VerificationKey(kid string) (alg string, key crypto.PublicKey, err error)
 }
 
-// AuthMiddleware validates JWT tokens and sets user context
-func AuthMiddleware() gin.HandlerFunc {
+// signingMethods are the algorithms tokens may use; anything else is rejected before key lookup
+var signingMethods = []string{jwt.SigningMethodRS256.Alg(), jwt.SigningMethodEdDSA.Alg()}
+
+// AuthMiddleware validates JWT tokens, rejects revoked ones and sets user context
+func AuthMiddleware(keys KeySet, versions TokenVersionChecker, sessions SessionChecker) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		authHeader := c.GetHeader("Authorization")
 		if authHeader == "" {
@@ -59,50 +80,82 @@ func AuthMiddleware() gin.HandlerFunc {
 		}
 
 		// Parse and validate token
-		claims, err := ValidateJWT(tokenString)
+		claims, err := ValidateAccessToken(c.Request.Context(), keys, versions, sessions, tokenString)
 		if err != nil {
 			c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid token: " + err.Error()})
 			c.Abort()
 			return
 		}
 
-		// Set user ID in context for downstream handlers
-		c.Set(string(UserIDKey), claims.UserID)
+		// Set user ID, role and permissions in context for downstream handlers
+		setClaims(c, claims)
 		c.Next()
 	}
 }
 
-// GenerateJWT creates a new JWT token for a user
-func GenerateJWT(userID, email string) (string, error) {
-	expirationTime := time.Now().Add(24 * time.Hour * 7) // 7 days expiration
+// AccessTokenTTL keeps access tokens short-lived; clients renew them with a refresh token
+const AccessTokenTTL = 15 * time.Minute
+
+// GenerateJWT creates a new access token for a user's session and returns it with its expiry
+func GenerateJWT(keys KeySet, user *models.User, sessionID string) (string, time.Time, error) {
+	kid, alg, signingKey, err := keys.SigningKey()
+	if err != nil {
+		return "", time.Time{}, err
+	}
+	method := jwt.GetSigningMethod(alg)
+	if method == nil {
+		return "", time.Time{}, fmt.Errorf("unsupported signing algorithm %q", alg)
+	}
+
+	expirationTime := time.Now().Add(AccessTokenTTL)
+
+	jti := make([]byte, 16)
+	if _, err := rand.Read(jti); err != nil {
+		return "", time.Time{}, fmt.Errorf("failed to generate token id: %w", err)
+	}
 
 	claims := &Claims{
-		UserID: userID,
-		Email:  email,
+		UserID:       user.ID,
+		Email:        user.Email,
+		Role:         user.Role,
+		Permissions:  user.EffectivePermissions(),
+		TokenVersion: user.TokenVersion,
+		SessionID:    sessionID,
 		RegisteredClaims: jwt.RegisteredClaims{
+			ID:        hex.EncodeToString(jti),
 			ExpiresAt: jwt.NewNumericDate(expirationTime),
 			IssuedAt:  jwt.NewNumericDate(time.Now()),
 			NotBefore: jwt.NewNumericDate(time.Now()),
 			Issuer:    "fitness-app",
-			Subject:   userID,
+			Subject:   user.ID,
 		},
 	}
 
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
-	return token.SignedString(jwtSecret)
+	token := jwt.NewWithClaims(method, claims)
+	token.Header["kid"] = kid
+	signed, err := token.SignedString(signingKey)
+	if err != nil {
+		return "", time.Time{}, err
+	}
+	return signed, expirationTime, nil
 }
 
-// ValidateJWT validates a JWT token and returns claims
-func ValidateJWT(tokenString string) (*Claims, error) {
+// ValidateJWT validates a JWT token against the key named by its kid header and returns claims
+func ValidateJWT(keys KeySet, tokenString string) (*Claims, error) {
 	claims := &Claims{}
 
 	token, err := jwt.ParseWithClaims(tokenString, claims, func(token *jwt.Token) (interface{}, error) {
-		// Validate signing method
-		if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
+		kid, _ := token.Header["kid"].(string)
+		alg, key, err := keys.VerificationKey(kid)
+		if err != nil {
+			return nil, err
+		}
+		// The key decides the algorithm, never the token header
+		if token.Method.Alg() != alg {
 			return nil, fmt.Errorf("unexpected signing method: %v", token.Header["alg"])
 		}
-		return jwtSecret, nil
-	})
+		return key, nil
+	}, jwt.WithValidMethods(signingMethods))
 
 	if err != nil {
 		return nil, err
@@ -115,6 +168,28 @@ func ValidateJWT(tokenString string) (*Claims, error) {
 	return claims, nil
 }
 
+// ValidateAccessToken validates a token's signature and expiry, then checks it has not been
+// revoked by a password change, account deletion or sign-out of its session since it was minted
+func ValidateAccessToken(ctx context.Context, keys KeySet, versions TokenVersionChecker, sessions SessionChecker, tokenString string) (*Claims, error) {
+	claims, err := ValidateJWT(keys, tokenString)
+	if err != nil {
+		return nil, err
+	}
+
+	current, err := versions.CurrentTokenVersion(ctx, claims.UserID)
+	if err != nil || claims.TokenVersion != current {
+		return nil, ErrTokenRevoked
+	}
+	if claims.SessionID != "" {
+		revoked, err := sessions.SessionRevoked(ctx, claims.SessionID)
+		if err != nil || revoked {
+			return nil, ErrTokenRevoked
+		}
+	}
+
+	return claims, nil
+}
+
 // HashPassword hashes a plain text password using bcrypt
 func HashPassword(password string) (string, error) {
 	bytes, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
@@ -158,7 +233,7 @@ func GetUserIDFromContextOrEmpty(c *gin.Context) string {
 }
 
 // OptionalAuthMiddleware allows endpoints to work with or without authentication
-func OptionalAuthMiddleware() gin.HandlerFunc {
+func OptionalAuthMiddleware(keys KeySet, versions TokenVersionChecker, sessions SessionChecker) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		authHeader := c.GetHeader("Authorization")
 		if authHeader == "" {
@@ -173,8 +248,8 @@ func OptionalAuthMiddleware() gin.HandlerFunc {
 		}
 
 		// Try to validate token, but don't fail if invalid
-		if claims, err := ValidateJWT(tokenString); err == nil {
-			c.Set(string(UserIDKey), claims.UserID)
+		if claims, err := ValidateAccessToken(c.Request.Context(), keys, versions, sessions, tokenString); err == nil {
+			setClaims(c, claims)
 		}
 
 		c.Next()
@@ -0,0 +1,58 @@
+package middleware
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+// setClaims exposes the authenticated user's identity and powers to later handlers
+func setClaims(c *gin.Context, claims *Claims) {
+	c.Set(string(UserIDKey), claims.UserID)
+	c.Set(string(RoleKey), claims.Role)
+	c.Set(string(PermissionsKey), claims.Permissions)
+}
+
+// GetRoleFromContext returns the authenticated user's role, or "" when unauthenticated
+func GetRoleFromContext(c *gin.Context) string {
+	return c.GetString(string(RoleKey))
+}
+
+// HasPermission reports whether the authenticated user's token carries permission
+func HasPermission(c *gin.Context, permission string) bool {
+	for _, held := range c.GetStringSlice(string(PermissionsKey)) {
+		if held == permission {
+			return true
+		}
+	}
+	return false
+}
+
+// RequireRole allows the request through only for users holding one of roles.
+// It must run after AuthMiddleware.
+func RequireRole(roles ...string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		role := GetRoleFromContext(c)
+		for _, allowed := range roles {
+			if role == allowed {
+				c.Next()
+				return
+			}
+		}
+		c.JSON(http.StatusForbidden, gin.H{"error": "Insufficient role"})
+		c.Abort()
+	}
+}
+
+// RequirePermission allows the request through only for users holding permission, through
+// their role or individually. It must run after AuthMiddleware.
+func RequirePermission(permission string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if !HasPermission(c, permission) {
+			c.JSON(http.StatusForbidden, gin.H{"error": "Missing permission: " + permission})
+			c.Abort()
+			return
+		}
+		c.Next()
+	}
+}
@@ -0,0 +1,38 @@
+package middleware
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+// EmailVerificationChecker reports whether a user has verified their email address
+type EmailVerificationChecker interface {
+	IsEmailVerified(ctx context.Context, userID string) (bool, error)
+}
+
+// RequireVerifiedEmail turns away users who have not verified their email. When required is
+// false it lets every request through, so routes can be wired the same way whatever the
+// policy. It must run after AuthMiddleware.
+func RequireVerifiedEmail(checker EmailVerificationChecker, required bool) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if !required {
+			c.Next()
+			return
+		}
+
+		verified, err := checker.IsEmailVerified(c.Request.Context(), GetUserIDFromContextOrEmpty(c))
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to check email verification"})
+			c.Abort()
+			return
+		}
+		if !verified {
+			c.JSON(http.StatusForbidden, gin.H{"error": "Please verify your email address first"})
+			c.Abort()
+			return
+		}
+		c.Next()
+	}
+}
@@ -0,0 +1,63 @@
+package db
+
+import (
+	"strings"
+	"testing"
+	"testing/fstest"
+)
+
+func TestLoadMigrationsOrdersAndPairs(t *testing.T) {
+	fsys := fstest.MapFS{
+		"m/0002_add_index.up.sql":   {Data: []byte("CREATE INDEX a ON t(a);")},
+		"m/0002_add_index.down.sql": {Data: []byte("DROP INDEX a;")},
+		"m/0001_init.up.sql":        {Data: []byte("CREATE TABLE t (a INT);")},
+		"m/0001_init.down.sql":      {Data: []byte("DROP TABLE t;")},
+		"m/README.md":               {Data: []byte("ignored")},
+	}
+
+	migrations, err := loadMigrations(fsys, "m")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(migrations) != 2 {
+		t.Fatalf("got %d migrations, want 2", len(migrations))
+	}
+	if migrations[0].Version != 1 || migrations[0].Name != "init" || migrations[1].Version != 2 {
+		t.Errorf("migrations out of order: %+v", migrations)
+	}
+	if migrations[1].Down != "DROP INDEX a;" {
+		t.Errorf("down file not paired, got %q", migrations[1].Down)
+	}
+}
+
+func TestLoadMigrationsRejectsBadFiles(t *testing.T) {
+	tests := map[string]fstest.MapFS{
+		"missing up":       {"m/0001_init.down.sql": {Data: []byte("DROP TABLE t;")}},
+		"bad version":      {"m/abc_init.up.sql": {Data: []byte("SELECT 1;")}},
+		"no name":          {"m/0001.up.sql": {Data: []byte("SELECT 1;")}},
+		"conflicting name": {"m/0001_a.up.sql": {Data: []byte("SELECT 1;")}, "m/0001_b.down.sql": {Data: []byte("SELECT 1;")}},
+	}
+
+	for name, fsys := range tests {
+		t.Run(name, func(t *testing.T) {
+			if _, err := loadMigrations(fsys, "m"); err == nil {
+				t.Error("expected an error")
+			}
+		})
+	}
+}
+
+func TestEmbeddedMigrationsLoad(t *testing.T) {
+	migrations, err := loadMigrations(migrationFiles, "migrations")
+	if err != nil {
+		t.Fatalf("embedded migrations are invalid: %v", err)
+	}
+	for i, migration := range migrations {
+		if migration.Version != i+1 {
+			t.Errorf("migration versions should be contiguous, got %d at position %d", migration.Version, i)
+		}
+		if strings.TrimSpace(migration.Down) == "" {
+			t.Errorf("migration %d_%s has no down file", migration.Version, migration.Name)
+		}
+	}
+}
@@ -0,0 +1,13 @@
+DROP TABLE IF EXISTS personal_records;
+DROP TABLE IF EXISTS workout_exercise_sets;
+DROP TABLE IF EXISTS workout_exercises;
+DROP TABLE IF EXISTS workouts;
+DROP TABLE IF EXISTS user_programs;
+DROP TABLE IF EXISTS program_workout_exercises;
+DROP TABLE IF EXISTS program_workouts;
+DROP TABLE IF EXISTS programs;
+DROP TABLE IF EXISTS exercises;
+DROP TABLE IF EXISTS access_grants;
+DROP TABLE IF EXISTS user_stats;
+DROP TABLE IF EXISTS user_preferences;
+DROP TABLE IF EXISTS users;
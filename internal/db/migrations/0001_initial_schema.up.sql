@@ -1,3 +1,5 @@
+-- Initial schema: users, programs, exercises, workout logs, records and access grants
+
 -- Enable UUID generation --
 CREATE EXTENSION IF NOT EXISTS "uuid-ossp";
 
@@ -15,11 +17,58 @@ CREATE TABLE IF NOT EXISTS users (
     goal VARCHAR(20) NOT NULL CHECK (goal IN ('weight_loss', 'muscle_gain', 'maintenance', 'endurance')),
     program_id INTEGER NOT NULL CHECK (program_id > 0),
     weekly_budget DECIMAL(10,2) DEFAULT 0,
+    timezone VARCHAR(64) NOT NULL DEFAULT 'UTC', -- IANA zone used for calendar days and streaks
     created_at TIMESTAMP WITH TIME ZONE DEFAULT NOW(),
     updated_at TIMESTAMP WITH TIME ZONE DEFAULT NOW(),
     deleted_at TIMESTAMP WITH TIME ZONE
 );
 
+-- User preferences --
+CREATE TABLE IF NOT EXISTS user_preferences (
+    user_id UUID PRIMARY KEY REFERENCES users(id) ON DELETE CASCADE,
+    preferences TEXT[] NOT NULL DEFAULT '{}',
+    allergies TEXT[] NOT NULL DEFAULT '{}',
+    dislikes TEXT[] NOT NULL DEFAULT '{}',
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT NOW(),
+    updated_at TIMESTAMP WITH TIME ZONE DEFAULT NOW()
+);
+
+-- User stats --
+-- Denormalised training totals, updated as sessions complete and recomputable from the logs
+CREATE TABLE IF NOT EXISTS user_stats (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    user_id UUID NOT NULL UNIQUE REFERENCES users(id) ON DELETE CASCADE,
+    completed_workouts INTEGER NOT NULL DEFAULT 0, -- Exercise entries logged
+    completed_sessions INTEGER NOT NULL DEFAULT 0,
+    total_weight_lifted DOUBLE PRECISION NOT NULL DEFAULT 0, -- Tonnage in kilograms
+    current_streak INTEGER NOT NULL DEFAULT 0,
+    longest_streak INTEGER NOT NULL DEFAULT 0,
+    last_workout_date TIMESTAMP WITH TIME ZONE,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT NOW(),
+    updated_at TIMESTAMP WITH TIME ZONE DEFAULT NOW()
+);
+
+-- Access grants --
+-- Lets a coach or admin act on another user's data. A NULL user_id grants access to every user.
+CREATE TABLE IF NOT EXISTS access_grants (
+    id SERIAL PRIMARY KEY,
+    grantee_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    user_id UUID REFERENCES users(id) ON DELETE CASCADE,
+    role VARCHAR(20) NOT NULL CHECK (role IN ('coach', 'admin')),
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    UNIQUE (grantee_id, user_id, role)
+);
+
+-- Exercises --
+CREATE TABLE exercises (
+    id SERIAL PRIMARY KEY,
+    name VARCHAR(255) NOT NULL UNIQUE,
+    description TEXT,
+    primary_muscle_group VARCHAR(100),
+    equipment VARCHAR(100),
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+);
+
 -- Program Tables --
 
 -- This stores the high-level program definition (e.g., "Jeff Nippard Hypertrophy")
@@ -29,6 +78,8 @@ CREATE TABLE programs (
     description TEXT,
     goal VARCHAR(100), -- e.g., 'hypertrophy', 'strength', 'endurance'
     estimated_weeks INTEGER,
+    progression_strategy VARCHAR(30) NOT NULL DEFAULT 'rir_autoregulation'
+        CHECK (progression_strategy IN ('linear', 'double_progression', 'rir_autoregulation', 'training_max')),
     created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
 );
 
@@ -56,22 +107,18 @@ CREATE TABLE program_workout_exercises (
     prescribed_weight REAL CHECK (prescribed_weight >= 0), -- Optional starting weight
     exercise_order INTEGER NOT NULL CHECK (exercise_order > 0), -- Order of the exercise in the workout
     notes TEXT,
+    -- Optional per-exercise progression overrides; NULL strategy inherits the program's
+    progression_strategy VARCHAR(30)
+        CHECK (progression_strategy IN ('linear', 'double_progression', 'rir_autoregulation', 'training_max')),
+    rep_range_max INTEGER CHECK (rep_range_max >= reps), -- Top of the range for double progression
+    weight_increment REAL CHECK (weight_increment > 0),
+    training_max REAL CHECK (training_max >= 0), -- For percentage-based (5/3/1) programming
     -- A unique constraint to prevent an exercise from being added twice to the same workout
     CONSTRAINT unique_exercise_in_workout UNIQUE (program_workout_id, exercise_id),
     -- A unique constraint to maintain consistent ordering within a workout
     CONSTRAINT unique_order_in_workout UNIQUE (program_workout_id, exercise_order)
 );
 
--- Exercises -- 
-CREATE TABLE exercises (
-    id SERIAL PRIMARY KEY,
-    name VARCHAR(255) NOT NULL UNIQUE,
-    description TEXT,
-    primary_muscle_group VARCHAR(100),
-    equipment VARCHAR(100),
-    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
-);
-
 -- Logs for Dynamic Changes -- 
 CREATE TABLE user_programs (
     id SERIAL PRIMARY KEY,
@@ -83,12 +130,16 @@ CREATE TABLE user_programs (
 );
 
 -- Table: workouts
--- A record of a user completing a specific workout from their program
+-- A user's session of a specific workout from their program, from start to completion or abandonment
 CREATE TABLE workouts (
     id SERIAL PRIMARY KEY,
     user_program_id INTEGER NOT NULL REFERENCES user_programs(id) ON DELETE CASCADE,
     program_workout_id INTEGER NOT NULL REFERENCES program_workouts(id) ON DELETE CASCADE,
-    completed_date TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    status VARCHAR(20) NOT NULL DEFAULT 'in_progress' CHECK (status IN ('in_progress', 'completed', 'abandoned')),
+    started_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    completed_at TIMESTAMP WITH TIME ZONE,
+    abandoned_at TIMESTAMP WITH TIME ZONE,
+    duration_seconds INTEGER CHECK (duration_seconds >= 0),
     notes TEXT,
     created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
 );
@@ -115,6 +166,41 @@ CREATE TABLE workout_exercises (
     created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
 );
 
+-- Table: workout_exercise_sets
+-- One row per performed set, including the load that was lifted
+CREATE TABLE workout_exercise_sets (
+    id SERIAL PRIMARY KEY,
+    workout_exercise_id INTEGER NOT NULL REFERENCES workout_exercises(id) ON DELETE CASCADE,
+    set_number INTEGER NOT NULL CHECK (set_number > 0),
+    weight REAL NOT NULL CHECK (weight >= 0),
+    unit VARCHAR(2) NOT NULL DEFAULT 'kg' CHECK (unit IN ('kg', 'lb')),
+    reps INTEGER NOT NULL CHECK (reps >= 0),
+    rir INTEGER CHECK (rir >= 0),
+    rpe REAL CHECK (rpe >= 1 AND rpe <= 10),
+    set_type VARCHAR(10) NOT NULL DEFAULT 'working' CHECK (set_type IN ('warm_up', 'working', 'drop', 'failure')),
+    performed_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    CONSTRAINT unique_set_number_in_exercise UNIQUE (workout_exercise_id, set_number)
+);
+
+-- Table: personal_records
+-- Every time a user beats their best e1RM or rep max on an exercise a row is added
+CREATE TABLE personal_records (
+    id SERIAL PRIMARY KEY,
+    user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    exercise_id INTEGER NOT NULL REFERENCES exercises(id) ON DELETE CASCADE,
+    record_type VARCHAR(10) NOT NULL CHECK (record_type IN ('e1rm', 'rep_max')),
+    reps INTEGER NOT NULL CHECK (reps > 0),
+    weight REAL NOT NULL CHECK (weight > 0),
+    unit VARCHAR(2) NOT NULL CHECK (unit IN ('kg', 'lb')),
+    weight_kg REAL NOT NULL CHECK (weight_kg > 0), -- Normalised for comparisons across units
+    estimated_one_rep_max REAL NOT NULL, -- In kilograms
+    formula VARCHAR(20) NOT NULL,
+    workout_id INTEGER REFERENCES workouts(id) ON DELETE SET NULL,
+    workout_exercise_set_id INTEGER REFERENCES workout_exercise_sets(id) ON DELETE SET NULL,
+    achieved_at TIMESTAMP WITH TIME ZONE NOT NULL,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+);
 
 -- Indexes for better performance --
 CREATE INDEX IF NOT EXISTS idx_users_email ON users(email);
@@ -132,29 +218,13 @@ CREATE INDEX idx_user_programs_is_active ON user_programs(is_active) WHERE is_ac
 
 CREATE INDEX idx_workouts_user_program_id ON workouts(user_program_id);
 CREATE INDEX idx_workouts_program_workout_id ON workouts(program_workout_id);
-CREATE INDEX idx_workouts_completed_date ON workouts(completed_date);
+CREATE INDEX idx_workouts_completed_at ON workouts(completed_at);
+CREATE INDEX idx_workouts_in_progress_started_at ON workouts(started_at) WHERE status = 'in_progress';
+-- At most one open session per user program
+CREATE UNIQUE INDEX idx_workouts_one_in_progress ON workouts(user_program_id) WHERE status = 'in_progress';
 
 CREATE INDEX idx_workout_exercises_workout_id ON workout_exercises(workout_id);
 CREATE INDEX idx_workout_exercises_pwe_id ON workout_exercises(program_workout_exercise_id);
-
-
-
--- Insert sample workout types (optional)
-INSERT INTO workouts (id, user_id, name, type, duration_weeks, completed) 
-VALUES 
-    ('00000000-0000-0000-0000-000000000001', '00000000-0000-0000-0000-000000000001', '4-Week Strength Program', 'strength', 4, false),
-    ('00000000-0000-0000-0000-000000000002', '00000000-0000-0000-0000-000000000001', '8-Week Hypertrophy Program', 'hypertrophy', 8, false)
-ON CONFLICT (id) DO NOTHING;
-
--- Insert sample exercises (optional)
-INSERT INTO exercises (id, session_id, name, sets, reps, weight, completed) 
-VALUES 
-    ('00000000-0000-0000-0000-000000000001', '00000000-0000-0000-0000-000000000001', 'Bench Press', 4, 8, 185.5, false),
-    ('00000000-0000-0000-0000-000000000002', '00000000-0000-0000-0000-000000000001', 'Squats', 4, 10, 225.0, false)
-ON CONFLICT (id) DO NOTHING;
-
--- Create a test user for CI/CD (optional)
-INSERT INTO users (id, email, password_hash, name, age, sex, height, weight, activity_level, goal, weekly_budget) 
-VALUES 
-    ('00000000-0000-0000-0000-000000000001', 'test@example.com', '$2a$10$examplehashedpassword', 'Test User', 25, 'male', 175.5, 70.0, 'moderately_active', 'muscle_gain', 150.0)
-ON CONFLICT (id) DO NOTHING;
+CREATE INDEX idx_workout_exercise_sets_we_id ON workout_exercise_sets(workout_exercise_id);
+CREATE INDEX idx_personal_records_user_exercise ON personal_records(user_id, exercise_id, record_type);
+CREATE INDEX idx_access_grants_grantee ON access_grants(grantee_id);
@@ -0,0 +1,2 @@
+-- Access tokens carry the user's token_version; bumping it invalidates every token minted before
+ALTER TABLE users ADD COLUMN token_version INTEGER NOT NULL DEFAULT 1;
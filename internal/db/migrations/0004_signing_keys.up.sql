@@ -0,0 +1,11 @@
+-- Access-token signing keys shared by every instance. The newest key signs once it has had
+-- time to propagate; older keys remain for verification until their grace period ends.
+CREATE TABLE signing_keys (
+    kid VARCHAR(64) PRIMARY KEY,
+    algorithm VARCHAR(16) NOT NULL,
+    private_key BYTEA NOT NULL,
+    public_key BYTEA NOT NULL,
+    created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX idx_signing_keys_created_at ON signing_keys(created_at);
@@ -0,0 +1,4 @@
+INSERT INTO access_grants (grantee_id, user_id, role)
+SELECT id, NULL, 'admin' FROM users WHERE role = 'admin';
+
+ALTER TABLE users DROP COLUMN IF EXISTS permissions, DROP COLUMN IF EXISTS role;
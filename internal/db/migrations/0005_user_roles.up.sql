@@ -0,0 +1,10 @@
+-- Roles and individually granted permission scopes, embedded in access tokens
+ALTER TABLE users
+    ADD COLUMN role VARCHAR(16) NOT NULL DEFAULT 'user' CHECK (role IN ('user', 'coach', 'admin')),
+    ADD COLUMN permissions TEXT[] NOT NULL DEFAULT '{}';
+
+-- Grants covering every user were the old way to make an admin
+UPDATE users SET role = 'admin'
+WHERE id IN (SELECT grantee_id FROM access_grants WHERE role = 'admin' AND user_id IS NULL);
+
+DELETE FROM access_grants WHERE role = 'admin' AND user_id IS NULL;
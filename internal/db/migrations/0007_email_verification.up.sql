@@ -0,0 +1,7 @@
+-- Email verification state; verification_sent_at throttles resends
+ALTER TABLE users
+    ADD COLUMN email_verified BOOLEAN NOT NULL DEFAULT FALSE,
+    ADD COLUMN verification_sent_at TIMESTAMP WITH TIME ZONE;
+
+-- Accounts created before verification existed are trusted as they are
+UPDATE users SET email_verified = TRUE;
@@ -0,0 +1,2 @@
+DROP TABLE IF EXISTS oidc_auth_requests;
+DROP TABLE IF EXISTS external_identities;
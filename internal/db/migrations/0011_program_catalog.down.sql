@@ -0,0 +1,21 @@
+ALTER TABLE workout_exercises
+    DROP CONSTRAINT workout_exercises_program_workout_exercise_id_fkey,
+    ADD CONSTRAINT workout_exercises_program_workout_exercise_id_fkey
+        FOREIGN KEY (program_workout_exercise_id) REFERENCES program_workout_exercises(id) ON DELETE CASCADE;
+ALTER TABLE workouts
+    DROP CONSTRAINT workouts_program_workout_id_fkey,
+    ADD CONSTRAINT workouts_program_workout_id_fkey FOREIGN KEY (program_workout_id) REFERENCES program_workouts(id) ON DELETE CASCADE;
+ALTER TABLE user_programs
+    DROP CONSTRAINT user_programs_program_id_fkey,
+    ADD CONSTRAINT user_programs_program_id_fkey FOREIGN KEY (program_id) REFERENCES programs(id) ON DELETE CASCADE;
+
+ALTER TABLE program_workout_exercises
+    DROP CONSTRAINT unique_exercise_in_workout,
+    DROP CONSTRAINT unique_order_in_workout,
+    ADD CONSTRAINT unique_exercise_in_workout UNIQUE (program_workout_id, exercise_id),
+    ADD CONSTRAINT unique_order_in_workout UNIQUE (program_workout_id, exercise_order);
+ALTER TABLE program_workouts
+    DROP CONSTRAINT unique_workout_per_program,
+    ADD CONSTRAINT unique_workout_per_program UNIQUE (program_id, day_of_week);
+
+ALTER TABLE programs DROP COLUMN IF EXISTS published_at;
@@ -0,0 +1,27 @@
+-- Programs are edited through the admin API and only listed once published. Everything
+-- already in the catalog was live, so it starts out published.
+ALTER TABLE programs ADD COLUMN published_at TIMESTAMP WITH TIME ZONE;
+UPDATE programs SET published_at = COALESCE(created_at, NOW());
+
+-- Reordering exercises or swapping training days moves rows through each other's slots, so
+-- uniqueness is checked when the edit commits rather than row by row
+ALTER TABLE program_workouts
+    DROP CONSTRAINT unique_workout_per_program,
+    ADD CONSTRAINT unique_workout_per_program UNIQUE (program_id, day_of_week) DEFERRABLE INITIALLY DEFERRED;
+ALTER TABLE program_workout_exercises
+    DROP CONSTRAINT unique_exercise_in_workout,
+    DROP CONSTRAINT unique_order_in_workout,
+    ADD CONSTRAINT unique_exercise_in_workout UNIQUE (program_workout_id, exercise_id) DEFERRABLE INITIALLY DEFERRED,
+    ADD CONSTRAINT unique_order_in_workout UNIQUE (program_workout_id, exercise_order) DEFERRABLE INITIALLY DEFERRED;
+
+-- Removing catalog content must never silently delete the training history logged against it
+ALTER TABLE user_programs
+    DROP CONSTRAINT user_programs_program_id_fkey,
+    ADD CONSTRAINT user_programs_program_id_fkey FOREIGN KEY (program_id) REFERENCES programs(id);
+ALTER TABLE workouts
+    DROP CONSTRAINT workouts_program_workout_id_fkey,
+    ADD CONSTRAINT workouts_program_workout_id_fkey FOREIGN KEY (program_workout_id) REFERENCES program_workouts(id);
+ALTER TABLE workout_exercises
+    DROP CONSTRAINT workout_exercises_program_workout_exercise_id_fkey,
+    ADD CONSTRAINT workout_exercises_program_workout_exercise_id_fkey
+        FOREIGN KEY (program_workout_exercise_id) REFERENCES program_workout_exercises(id);
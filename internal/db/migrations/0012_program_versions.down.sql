@@ -0,0 +1,83 @@
+-- Only reversible while every program is still on version 1 and no draft has unpublished
+-- edits: the single-version schema has nowhere to put either, so refuse rather than drop them
+DO $$
+BEGIN
+    IF EXISTS (SELECT 1 FROM program_versions WHERE version > 1) THEN
+        RAISE EXCEPTION 'programs have versions after 1; they cannot be folded back into a single version';
+    END IF;
+
+    IF EXISTS (
+        SELECT 1
+        FROM program_versions draft
+        JOIN program_versions v1 ON v1.program_id = draft.program_id AND v1.version = 1
+        WHERE draft.version IS NULL
+          AND (
+              EXISTS (
+                  (SELECT lineage_id, name, day_of_week, description FROM program_workouts WHERE program_version_id = draft.id
+                   EXCEPT
+                   SELECT lineage_id, name, day_of_week, description FROM program_workouts WHERE program_version_id = v1.id)
+                  UNION ALL
+                  (SELECT lineage_id, name, day_of_week, description FROM program_workouts WHERE program_version_id = v1.id
+                   EXCEPT
+                   SELECT lineage_id, name, day_of_week, description FROM program_workouts WHERE program_version_id = draft.id)
+              )
+              OR EXISTS (
+                  (SELECT pw.lineage_id, pwe.lineage_id, pwe.exercise_id, pwe.sets, pwe.reps, pwe.target_rir, pwe.prescribed_weight,
+                          pwe.exercise_order, pwe.notes, pwe.progression_strategy, pwe.rep_range_max, pwe.weight_increment, pwe.training_max
+                   FROM program_workout_exercises pwe
+                   JOIN program_workouts pw ON pw.id = pwe.program_workout_id
+                   WHERE pw.program_version_id = draft.id
+                   EXCEPT
+                   SELECT pw.lineage_id, pwe.lineage_id, pwe.exercise_id, pwe.sets, pwe.reps, pwe.target_rir, pwe.prescribed_weight,
+                          pwe.exercise_order, pwe.notes, pwe.progression_strategy, pwe.rep_range_max, pwe.weight_increment, pwe.training_max
+                   FROM program_workout_exercises pwe
+                   JOIN program_workouts pw ON pw.id = pwe.program_workout_id
+                   WHERE pw.program_version_id = v1.id)
+                  UNION ALL
+                  (SELECT pw.lineage_id, pwe.lineage_id, pwe.exercise_id, pwe.sets, pwe.reps, pwe.target_rir, pwe.prescribed_weight,
+                          pwe.exercise_order, pwe.notes, pwe.progression_strategy, pwe.rep_range_max, pwe.weight_increment, pwe.training_max
+                   FROM program_workout_exercises pwe
+                   JOIN program_workouts pw ON pw.id = pwe.program_workout_id
+                   WHERE pw.program_version_id = v1.id
+                   EXCEPT
+                   SELECT pw.lineage_id, pwe.lineage_id, pwe.exercise_id, pwe.sets, pwe.reps, pwe.target_rir, pwe.prescribed_weight,
+                          pwe.exercise_order, pwe.notes, pwe.progression_strategy, pwe.rep_range_max, pwe.weight_increment, pwe.training_max
+                   FROM program_workout_exercises pwe
+                   JOIN program_workouts pw ON pw.id = pwe.program_workout_id
+                   WHERE pw.program_version_id = draft.id)
+              )
+          )
+    ) THEN
+        RAISE EXCEPTION 'program drafts have unpublished changes; publish or discard them before reverting';
+    END IF;
+END $$;
+
+-- Deferred checks left pending by the UPDATE below would block the ALTER TABLEs after it
+SET CONSTRAINTS ALL IMMEDIATE;
+
+ALTER TABLE user_programs DROP COLUMN IF EXISTS program_version_id;
+
+-- Programs that were never published only have their draft, which becomes the program's
+-- workouts again instead of going with it
+ALTER TABLE program_workouts ALTER COLUMN program_version_id DROP NOT NULL;
+UPDATE program_workouts pw
+SET program_version_id = NULL
+FROM program_versions draft
+WHERE draft.id = pw.program_version_id
+  AND draft.version IS NULL
+  AND NOT EXISTS (SELECT 1 FROM program_versions v1 WHERE v1.program_id = draft.program_id AND v1.version = 1);
+
+-- The rest of the drafts are copies of version 1 by now
+DELETE FROM program_versions WHERE version IS NULL;
+
+ALTER TABLE program_workout_exercises
+    DROP CONSTRAINT IF EXISTS unique_exercise_lineage,
+    DROP COLUMN IF EXISTS lineage_id;
+ALTER TABLE program_workouts
+    DROP CONSTRAINT IF EXISTS unique_workout_lineage,
+    DROP CONSTRAINT unique_workout_per_program,
+    ADD CONSTRAINT unique_workout_per_program UNIQUE (program_id, day_of_week) DEFERRABLE INITIALLY DEFERRED,
+    DROP COLUMN IF EXISTS lineage_id,
+    DROP COLUMN IF EXISTS program_version_id;
+
+DROP TABLE IF EXISTS program_versions;
@@ -0,0 +1,76 @@
+-- Program versions. Each program has one draft, the only version the catalog edits, and
+-- publishing copies the draft into the next numbered version, which never changes again.
+-- Users train a pinned version and their logs point at its rows, so catalog edits never
+-- change what was logged.
+CREATE TABLE program_versions (
+    id SERIAL PRIMARY KEY,
+    program_id INTEGER NOT NULL REFERENCES programs(id) ON DELETE CASCADE,
+    version INTEGER CHECK (version > 0), -- NULL for the draft
+    published_at TIMESTAMP WITH TIME ZONE,
+    created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW(),
+    CONSTRAINT unique_program_version UNIQUE (program_id, version),
+    CONSTRAINT published_versions_are_numbered CHECK ((version IS NULL) = (published_at IS NULL))
+);
+
+CREATE UNIQUE INDEX idx_program_versions_one_draft ON program_versions(program_id) WHERE version IS NULL;
+
+-- A lineage follows a workout or prescription from version to version, so progression carries
+-- over when a user moves to a newer version
+ALTER TABLE program_workouts
+    ADD COLUMN program_version_id INTEGER REFERENCES program_versions(id) ON DELETE CASCADE,
+    ADD COLUMN lineage_id UUID NOT NULL DEFAULT gen_random_uuid();
+ALTER TABLE program_workout_exercises
+    ADD COLUMN lineage_id UUID NOT NULL DEFAULT gen_random_uuid();
+
+-- Programs that are live or have users become version 1 as they stand; the rest only have a draft
+INSERT INTO program_versions (program_id, version, published_at, created_at)
+SELECT p.id, 1, COALESCE(p.published_at, p.created_at, NOW()), COALESCE(p.created_at, NOW())
+FROM programs p
+WHERE p.published_at IS NOT NULL OR EXISTS (SELECT 1 FROM user_programs up WHERE up.program_id = p.id);
+
+INSERT INTO program_versions (program_id) SELECT id FROM programs;
+
+UPDATE program_workouts pw
+SET program_version_id = pv.id
+FROM program_versions pv
+WHERE pv.program_id = pw.program_id
+  AND pv.version IS NOT DISTINCT FROM (
+      SELECT MAX(version) FROM program_versions latest WHERE latest.program_id = pw.program_id
+  );
+
+-- Drafts of version 1 programs start as a copy of it
+INSERT INTO program_workouts (program_id, program_version_id, lineage_id, name, day_of_week, description)
+SELECT pw.program_id, draft.id, pw.lineage_id, pw.name, pw.day_of_week, pw.description
+FROM program_workouts pw
+JOIN program_versions pv ON pv.id = pw.program_version_id AND pv.version = 1
+JOIN program_versions draft ON draft.program_id = pw.program_id AND draft.version IS NULL;
+
+INSERT INTO program_workout_exercises (
+    program_workout_id, lineage_id, exercise_id, sets, reps, target_rir, prescribed_weight, exercise_order,
+    notes, progression_strategy, rep_range_max, weight_increment, training_max
+)
+SELECT draft_pw.id, pwe.lineage_id, pwe.exercise_id, pwe.sets, pwe.reps, pwe.target_rir, pwe.prescribed_weight,
+       pwe.exercise_order, pwe.notes, pwe.progression_strategy, pwe.rep_range_max, pwe.weight_increment, pwe.training_max
+FROM program_workout_exercises pwe
+JOIN program_workouts pw ON pw.id = pwe.program_workout_id
+JOIN program_versions pv ON pv.id = pw.program_version_id AND pv.version = 1
+JOIN program_workouts draft_pw ON draft_pw.lineage_id = pw.lineage_id AND draft_pw.id <> pw.id;
+
+ALTER TABLE program_workouts
+    ALTER COLUMN program_version_id SET NOT NULL,
+    DROP CONSTRAINT unique_workout_per_program,
+    ADD CONSTRAINT unique_workout_per_program UNIQUE (program_version_id, day_of_week) DEFERRABLE INITIALLY DEFERRED,
+    ADD CONSTRAINT unique_workout_lineage UNIQUE (program_version_id, lineage_id);
+ALTER TABLE program_workout_exercises
+    ADD CONSTRAINT unique_exercise_lineage UNIQUE (program_workout_id, lineage_id);
+
+CREATE INDEX idx_program_workouts_lineage_id ON program_workouts(lineage_id);
+CREATE INDEX idx_program_workout_exercises_lineage_id ON program_workout_exercises(lineage_id);
+
+-- Enrollments pin a published version
+ALTER TABLE user_programs ADD COLUMN program_version_id INTEGER REFERENCES program_versions(id);
+UPDATE user_programs up
+SET program_version_id = pv.id
+FROM program_versions pv
+WHERE pv.program_id = up.program_id AND pv.version = 1;
+ALTER TABLE user_programs ALTER COLUMN program_version_id SET NOT NULL;
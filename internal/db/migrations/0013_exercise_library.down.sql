@@ -0,0 +1,19 @@
+DROP INDEX IF EXISTS idx_exercises_equipment;
+DROP INDEX IF EXISTS idx_exercises_secondary_muscles;
+DROP INDEX IF EXISTS idx_exercises_primary_muscle;
+DROP INDEX IF EXISTS idx_exercises_search;
+
+ALTER TABLE exercises
+    DROP COLUMN search_vector,
+    DROP CONSTRAINT exercise_not_merged_into_itself,
+    DROP COLUMN updated_at,
+    DROP COLUMN merged_into_id,
+    DROP COLUMN instructions,
+    DROP COLUMN aliases,
+    DROP COLUMN difficulty,
+    DROP COLUMN mechanics,
+    DROP COLUMN laterality,
+    DROP COLUMN movement_pattern,
+    DROP COLUMN secondary_muscle_groups;
+
+DROP FUNCTION exercise_search_vector(TEXT, TEXT[], TEXT[], TEXT);
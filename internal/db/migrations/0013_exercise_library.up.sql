@@ -0,0 +1,41 @@
+-- The exercise library. Muscle groups and equipment are stored lowercase so they work as
+-- search facets; the remaining attributes are fixed vocabularies.
+UPDATE exercises
+SET primary_muscle_group = NULLIF(LOWER(TRIM(primary_muscle_group)), ''),
+    equipment = NULLIF(LOWER(TRIM(equipment)), '');
+
+ALTER TABLE exercises
+    ADD COLUMN secondary_muscle_groups TEXT[] NOT NULL DEFAULT '{}',
+    ADD COLUMN movement_pattern VARCHAR(20) CHECK (movement_pattern IN (
+        'squat', 'hinge', 'lunge', 'horizontal_push', 'vertical_push',
+        'horizontal_pull', 'vertical_pull', 'carry', 'core', 'other'
+    )),
+    ADD COLUMN laterality VARCHAR(20) CHECK (laterality IN ('bilateral', 'unilateral')),
+    ADD COLUMN mechanics VARCHAR(20) CHECK (mechanics IN ('compound', 'isolation')),
+    ADD COLUMN difficulty VARCHAR(20) CHECK (difficulty IN ('beginner', 'intermediate', 'advanced')),
+    ADD COLUMN aliases TEXT[] NOT NULL DEFAULT '{}',
+    ADD COLUMN instructions TEXT[] NOT NULL DEFAULT '{}', -- One step per entry
+    -- A duplicate merged into another exercise stays for the history that points at it but is
+    -- no longer listed
+    ADD COLUMN merged_into_id INTEGER REFERENCES exercises(id),
+    ADD COLUMN updated_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    ADD CONSTRAINT exercise_not_merged_into_itself CHECK (merged_into_id <> id);
+
+-- array_to_string is only stable, so the search document is built by a function declared
+-- immutable for the generated column
+CREATE FUNCTION exercise_search_vector(name TEXT, aliases TEXT[], muscles TEXT[], description TEXT)
+RETURNS tsvector LANGUAGE sql IMMUTABLE AS $$
+    SELECT setweight(to_tsvector('english', COALESCE(name, '')), 'A') ||
+           setweight(to_tsvector('english', array_to_string(aliases, ' ')), 'A') ||
+           setweight(to_tsvector('english', array_to_string(muscles, ' ')), 'B') ||
+           setweight(to_tsvector('english', COALESCE(description, '')), 'C')
+$$;
+
+ALTER TABLE exercises ADD COLUMN search_vector tsvector GENERATED ALWAYS AS (
+    exercise_search_vector(name, aliases, ARRAY[primary_muscle_group::TEXT] || secondary_muscle_groups, description)
+) STORED;
+
+CREATE INDEX idx_exercises_search ON exercises USING GIN (search_vector);
+CREATE INDEX idx_exercises_primary_muscle ON exercises(primary_muscle_group) WHERE merged_into_id IS NULL;
+CREATE INDEX idx_exercises_secondary_muscles ON exercises USING GIN (secondary_muscle_groups);
+CREATE INDEX idx_exercises_equipment ON exercises(equipment) WHERE merged_into_id IS NULL;
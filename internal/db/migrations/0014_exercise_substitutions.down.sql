@@ -0,0 +1,6 @@
+DROP TABLE IF EXISTS exercise_overrides;
+
+ALTER TABLE user_preferences DROP COLUMN equipment;
+
+DROP INDEX IF EXISTS idx_workout_exercises_exercise_id;
+ALTER TABLE workout_exercises DROP COLUMN exercise_id;
@@ -0,0 +1,25 @@
+-- The exercise each logged entry was performed with. It differs from the prescribed exercise
+-- when the user swapped it, and is what records and progression follow.
+ALTER TABLE workout_exercises ADD COLUMN exercise_id INTEGER REFERENCES exercises(id);
+UPDATE workout_exercises we
+SET exercise_id = pwe.exercise_id
+FROM program_workout_exercises pwe
+WHERE pwe.id = we.program_workout_exercise_id;
+ALTER TABLE workout_exercises ALTER COLUMN exercise_id SET NOT NULL;
+CREATE INDEX idx_workout_exercises_exercise_id ON workout_exercises(exercise_id);
+
+-- Equipment the user can train with; empty means a fully equipped gym
+ALTER TABLE user_preferences ADD COLUMN equipment TEXT[] NOT NULL DEFAULT '{}';
+
+-- A user's standing swaps: within the program, exercise_id is always replaced by the substitute
+CREATE TABLE exercise_overrides (
+    id SERIAL PRIMARY KEY,
+    user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    program_id INTEGER NOT NULL REFERENCES programs(id) ON DELETE CASCADE,
+    exercise_id INTEGER NOT NULL REFERENCES exercises(id),
+    substitute_exercise_id INTEGER NOT NULL REFERENCES exercises(id),
+    created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW(),
+    updated_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW(),
+    CONSTRAINT unique_exercise_override UNIQUE (user_id, program_id, exercise_id),
+    CONSTRAINT override_substitutes_another_exercise CHECK (exercise_id <> substitute_exercise_id)
+);
@@ -0,0 +1,2 @@
+-- password_reset_sent_at throttles reset emails to one account, like verification_sent_at
+ALTER TABLE users ADD COLUMN password_reset_sent_at TIMESTAMP WITH TIME ZONE;
@@ -0,0 +1,89 @@
+package repositories
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+	"yoked_backend/internal/models"
+)
+
+type AccessGrantRepository interface {
+	CreateAccessGrant(ctx context.Context, grant *models.AccessGrant) error
+	HasAccessGrant(ctx context.Context, granteeID, userID string) (bool, error)
+	// GetUserAccessGrants lists the grants the user holds and the ones over their data
+	GetUserAccessGrants(ctx context.Context, userID string) ([]*models.AccessGrant, error)
+}
+
+type accessGrantRepository struct {
+	db *pgxpool.Pool
+}
+
+func NewAccessGrantRepository(db *pgxpool.Pool) AccessGrantRepository {
+	return &accessGrantRepository{db: db}
+}
+
+// conn returns the querier for ctx, see TxManager
+func (r *accessGrantRepository) conn(ctx context.Context) DBTX {
+	return connFromContext(ctx, r.db)
+}
+
+// CreateAccessGrant stores a coach or admin grant
+func (r *accessGrantRepository) CreateAccessGrant(ctx context.Context, grant *models.AccessGrant) error {
+	query := `
+		INSERT INTO access_grants (grantee_id, user_id, role)
+		VALUES ($1, $2, $3)
+		RETURNING id, created_at
+	`
+
+	err := r.conn(ctx).QueryRow(ctx, query, grant.GranteeID, grant.UserID, grant.Role).Scan(&grant.ID, &grant.CreatedAt)
+	if err != nil {
+		return fmt.Errorf("failed to create access grant: %w", err)
+	}
+
+	return nil
+}
+
+// HasAccessGrant reports whether the grantee may act on the user's data, either through a
+// grant for that user or a grant covering every user
+func (r *accessGrantRepository) HasAccessGrant(ctx context.Context, granteeID, userID string) (bool, error) {
+	query := `
+		SELECT EXISTS (
+			SELECT 1 FROM access_grants
+			WHERE grantee_id = $1 AND (user_id = $2 OR user_id IS NULL)
+		)
+	`
+
+	var granted bool
+	if err := r.conn(ctx).QueryRow(ctx, query, granteeID, userID).Scan(&granted); err != nil {
+		return false, fmt.Errorf("failed to check access grant: %w", err)
+	}
+
+	return granted, nil
+}
+
+func (r *accessGrantRepository) GetUserAccessGrants(ctx context.Context, userID string) ([]*models.AccessGrant, error) {
+	query := `
+		SELECT id, grantee_id, user_id, role, created_at
+		FROM access_grants
+		WHERE grantee_id = $1 OR user_id = $1
+		ORDER BY id
+	`
+
+	rows, err := r.conn(ctx).Query(ctx, query, userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get access grants: %w", err)
+	}
+	defer rows.Close()
+
+	grants := []*models.AccessGrant{}
+	for rows.Next() {
+		var grant models.AccessGrant
+		if err := rows.Scan(&grant.ID, &grant.GranteeID, &grant.UserID, &grant.Role, &grant.CreatedAt); err != nil {
+			return nil, fmt.Errorf("failed to scan access grant: %w", err)
+		}
+		grants = append(grants, &grant)
+	}
+
+	return grants, rows.Err()
+}
@@ -0,0 +1,475 @@
+package repositories
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+	"yoked_backend/internal/models"
+)
+
+// CatalogRepository writes the program catalog. Reads for users go through ProgramRepository;
+// these see unpublished programs too. Workouts and prescriptions are only ever written in a
+// program's draft version: published versions are copied from it and never change.
+type CatalogRepository interface {
+	// LockProgram returns the program and holds its row lock until the transaction ends, so
+	// concurrent edits to one program tree apply one after the other
+	LockProgram(ctx context.Context, id int) (*models.Program, error)
+	// GetProgramTree loads the program with the workouts of one of its versions
+	GetProgramTree(ctx context.Context, programVersionID int) (*models.ProgramTree, error)
+	CreateProgram(ctx context.Context, program *models.Program) error
+	UpdateProgram(ctx context.Context, program *models.Program) error
+	SetProgramPublished(ctx context.Context, id int, publishedAt *time.Time) (*models.Program, error)
+	DeleteProgram(ctx context.Context, id int) error
+
+	CreateDraftVersion(ctx context.Context, programID int) (*models.ProgramVersion, error)
+	GetDraftVersion(ctx context.Context, programID int) (*models.ProgramVersion, error)
+	GetProgramVersionByNumber(ctx context.Context, programID, version int) (*models.ProgramVersion, error)
+	// ListProgramVersions returns the published versions, newest first
+	ListProgramVersions(ctx context.Context, programID int) ([]*models.ProgramVersion, error)
+	// PublishDraft copies the draft's workouts and prescriptions into the next numbered version
+	PublishDraft(ctx context.Context, programID int, publishedAt time.Time) (*models.ProgramVersion, error)
+
+	CreateProgramWorkout(ctx context.Context, workout *models.ProgramWorkout) error
+	UpdateProgramWorkout(ctx context.Context, workout *models.ProgramWorkout) error
+	DeleteProgramWorkout(ctx context.Context, id int) error
+
+	CreateProgramWorkoutExercise(ctx context.Context, exercise *models.ProgramWorkoutExercise) error
+	UpdateProgramWorkoutExercise(ctx context.Context, exercise *models.ProgramWorkoutExercise) error
+	DeleteProgramWorkoutExercise(ctx context.Context, id int) error
+
+	// MissingExerciseIDs returns the ids that do not match an exercise, counting merged ones as missing
+	MissingExerciseIDs(ctx context.Context, ids []int) ([]int, error)
+}
+
+type catalogRepository struct {
+	db *pgxpool.Pool
+}
+
+func NewCatalogRepository(db *pgxpool.Pool) CatalogRepository {
+	return &catalogRepository{db: db}
+}
+
+func (r *catalogRepository) conn(ctx context.Context) DBTX {
+	return connFromContext(ctx, r.db)
+}
+
+const catalogProgramColumns = `id, name, COALESCE(description, ''), COALESCE(goal, ''), COALESCE(estimated_weeks, 0),
+	progression_strategy, published_at, created_at`
+
+func scanCatalogProgram(row interface{ Scan(...any) error }) (*models.Program, error) {
+	var program models.Program
+	err := row.Scan(
+		&program.ID, &program.Name, &program.Description, &program.Goal, &program.EstimatedWeeks,
+		&program.ProgressionStrategy, &program.PublishedAt, &program.CreatedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+	return &program, nil
+}
+
+func (r *catalogRepository) LockProgram(ctx context.Context, id int) (*models.Program, error) {
+	query := `SELECT ` + catalogProgramColumns + ` FROM programs WHERE id = $1 FOR UPDATE`
+
+	program, err := scanCatalogProgram(r.conn(ctx).QueryRow(ctx, query, id))
+	if err != nil {
+		return nil, fmt.Errorf("failed to lock program: %w", err)
+	}
+	return program, nil
+}
+
+// GetProgramTree loads a program version with its workouts by day and their exercises in order
+func (r *catalogRepository) GetProgramTree(ctx context.Context, programVersionID int) (*models.ProgramTree, error) {
+	version, err := scanProgramVersion(r.conn(ctx).QueryRow(ctx,
+		`SELECT `+programVersionColumns+` FROM program_versions WHERE id = $1`, programVersionID))
+	if err != nil {
+		return nil, fmt.Errorf("failed to get program version: %w", err)
+	}
+	program, err := scanCatalogProgram(r.conn(ctx).QueryRow(ctx,
+		`SELECT `+catalogProgramColumns+` FROM programs WHERE id = $1`, version.ProgramID))
+	if err != nil {
+		return nil, fmt.Errorf("failed to get program: %w", err)
+	}
+	tree := &models.ProgramTree{Program: *program, Version: *version, Workouts: []*models.ProgramWorkoutTree{}}
+
+	rows, err := r.conn(ctx).Query(ctx, `
+		SELECT id, program_id, program_version_id, lineage_id, name, COALESCE(day_of_week, 0), COALESCE(description, '')
+		FROM program_workouts
+		WHERE program_version_id = $1
+		ORDER BY day_of_week, id
+	`, programVersionID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get program workouts: %w", err)
+	}
+	defer rows.Close()
+
+	workouts := make(map[int]*models.ProgramWorkoutTree)
+	for rows.Next() {
+		workout := &models.ProgramWorkoutTree{Exercises: []*models.ProgramWorkoutExercise{}}
+		if err := rows.Scan(
+			&workout.ID, &workout.ProgramID, &workout.ProgramVersionID, &workout.LineageID,
+			&workout.Name, &workout.DayOfWeek, &workout.Description,
+		); err != nil {
+			return nil, fmt.Errorf("failed to scan program workout: %w", err)
+		}
+		tree.Workouts = append(tree.Workouts, workout)
+		workouts[workout.ID] = workout
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to get program workouts: %w", err)
+	}
+
+	exerciseRows, err := r.conn(ctx).Query(ctx, `
+		SELECT pwe.id, pwe.program_workout_id, pwe.lineage_id, pwe.exercise_id, pwe.sets, pwe.reps, COALESCE(pwe.target_rir, 0),
+		       COALESCE(pwe.prescribed_weight, 0), pwe.exercise_order, COALESCE(pwe.notes, ''),
+		       COALESCE(pwe.progression_strategy, ''), COALESCE(pwe.rep_range_max, 0),
+		       COALESCE(pwe.weight_increment, 0), COALESCE(pwe.training_max, 0)
+		FROM program_workout_exercises pwe
+		JOIN program_workouts pw ON pw.id = pwe.program_workout_id
+		WHERE pw.program_version_id = $1
+		ORDER BY pwe.program_workout_id, pwe.exercise_order
+	`, programVersionID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get program exercises: %w", err)
+	}
+	defer exerciseRows.Close()
+
+	for exerciseRows.Next() {
+		var exercise models.ProgramWorkoutExercise
+		if err := exerciseRows.Scan(
+			&exercise.ID, &exercise.ProgramWorkoutID, &exercise.LineageID, &exercise.ExerciseID,
+			&exercise.Sets, &exercise.Reps, &exercise.TargetRIR,
+			&exercise.PrescribedWeight, &exercise.ExerciseOrder, &exercise.Notes,
+			&exercise.ProgressionStrategy, &exercise.RepRangeMax,
+			&exercise.WeightIncrement, &exercise.TrainingMax,
+		); err != nil {
+			return nil, fmt.Errorf("failed to scan program exercise: %w", err)
+		}
+		workout := workouts[exercise.ProgramWorkoutID]
+		workout.Exercises = append(workout.Exercises, &exercise)
+	}
+	if err := exerciseRows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to get program exercises: %w", err)
+	}
+
+	return tree, nil
+}
+
+// CreateProgram adds an unpublished program
+func (r *catalogRepository) CreateProgram(ctx context.Context, program *models.Program) error {
+	query := `
+		INSERT INTO programs (name, description, goal, estimated_weeks, progression_strategy)
+		VALUES ($1, $2, $3, $4, $5)
+		RETURNING id, published_at, created_at
+	`
+
+	err := r.conn(ctx).QueryRow(ctx, query,
+		program.Name, program.Description, program.Goal, program.EstimatedWeeks, program.ProgressionStrategy,
+	).Scan(&program.ID, &program.PublishedAt, &program.CreatedAt)
+	if err != nil {
+		return fmt.Errorf("failed to create program: %w", err)
+	}
+	return nil
+}
+
+// UpdateProgram saves the program's own fields; publishing is left to SetProgramPublished
+func (r *catalogRepository) UpdateProgram(ctx context.Context, program *models.Program) error {
+	query := `
+		UPDATE programs
+		SET name = $2, description = $3, goal = $4, estimated_weeks = $5, progression_strategy = $6
+		WHERE id = $1
+	`
+
+	tag, err := r.conn(ctx).Exec(ctx, query,
+		program.ID, program.Name, program.Description, program.Goal, program.EstimatedWeeks, program.ProgressionStrategy,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to update program: %w", err)
+	}
+	if tag.RowsAffected() == 0 {
+		return fmt.Errorf("program %w", ErrNotFound)
+	}
+	return nil
+}
+
+// SetProgramPublished publishes the program at publishedAt, or hides it when that is nil
+func (r *catalogRepository) SetProgramPublished(ctx context.Context, id int, publishedAt *time.Time) (*models.Program, error) {
+	query := `UPDATE programs SET published_at = $2 WHERE id = $1 RETURNING ` + catalogProgramColumns
+
+	program, err := scanCatalogProgram(r.conn(ctx).QueryRow(ctx, query, id, publishedAt))
+	if err != nil {
+		return nil, fmt.Errorf("failed to publish program: %w", err)
+	}
+	return program, nil
+}
+
+// DeleteProgram removes the program with all its versions. It returns ErrForeignKey while
+// anyone is or was enrolled in it.
+func (r *catalogRepository) DeleteProgram(ctx context.Context, id int) error {
+	tag, err := r.conn(ctx).Exec(ctx, `DELETE FROM programs WHERE id = $1`, id)
+	if err != nil {
+		return fmt.Errorf("failed to delete program: %w", err)
+	}
+	if tag.RowsAffected() == 0 {
+		return fmt.Errorf("program %w", ErrNotFound)
+	}
+	return nil
+}
+
+const programVersionColumns = `id, program_id, COALESCE(version, 0), published_at, created_at`
+
+func scanProgramVersion(row interface{ Scan(...any) error }) (*models.ProgramVersion, error) {
+	var version models.ProgramVersion
+	if err := row.Scan(&version.ID, &version.ProgramID, &version.Version, &version.PublishedAt, &version.CreatedAt); err != nil {
+		return nil, err
+	}
+	return &version, nil
+}
+
+func (r *catalogRepository) CreateDraftVersion(ctx context.Context, programID int) (*models.ProgramVersion, error) {
+	query := `INSERT INTO program_versions (program_id) VALUES ($1) RETURNING ` + programVersionColumns
+
+	version, err := scanProgramVersion(r.conn(ctx).QueryRow(ctx, query, programID))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create draft version: %w", err)
+	}
+	return version, nil
+}
+
+func (r *catalogRepository) GetDraftVersion(ctx context.Context, programID int) (*models.ProgramVersion, error) {
+	query := `SELECT ` + programVersionColumns + ` FROM program_versions WHERE program_id = $1 AND version IS NULL`
+
+	version, err := scanProgramVersion(r.conn(ctx).QueryRow(ctx, query, programID))
+	if err != nil {
+		return nil, fmt.Errorf("failed to get draft version: %w", err)
+	}
+	return version, nil
+}
+
+func (r *catalogRepository) GetProgramVersionByNumber(ctx context.Context, programID, number int) (*models.ProgramVersion, error) {
+	query := `SELECT ` + programVersionColumns + ` FROM program_versions WHERE program_id = $1 AND version = $2`
+
+	version, err := scanProgramVersion(r.conn(ctx).QueryRow(ctx, query, programID, number))
+	if err != nil {
+		return nil, fmt.Errorf("failed to get program version: %w", err)
+	}
+	return version, nil
+}
+
+func (r *catalogRepository) ListProgramVersions(ctx context.Context, programID int) ([]*models.ProgramVersion, error) {
+	query := `
+		SELECT ` + programVersionColumns + `
+		FROM program_versions
+		WHERE program_id = $1 AND version IS NOT NULL
+		ORDER BY version DESC
+	`
+
+	rows, err := r.conn(ctx).Query(ctx, query, programID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list program versions: %w", err)
+	}
+	defer rows.Close()
+
+	versions := []*models.ProgramVersion{}
+	for rows.Next() {
+		version, err := scanProgramVersion(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan program version: %w", err)
+		}
+		versions = append(versions, version)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to list program versions: %w", err)
+	}
+	return versions, nil
+}
+
+// PublishDraft numbers the new version after the latest one. Copies keep their lineage, which
+// is also how the prescriptions find their copied workout.
+func (r *catalogRepository) PublishDraft(ctx context.Context, programID int, publishedAt time.Time) (*models.ProgramVersion, error) {
+	query := `
+		INSERT INTO program_versions (program_id, version, published_at)
+		SELECT $1, COALESCE(MAX(version), 0) + 1, $2 FROM program_versions WHERE program_id = $1
+		RETURNING ` + programVersionColumns
+
+	version, err := scanProgramVersion(r.conn(ctx).QueryRow(ctx, query, programID, publishedAt))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create program version: %w", err)
+	}
+
+	_, err = r.conn(ctx).Exec(ctx, `
+		INSERT INTO program_workouts (program_id, program_version_id, lineage_id, name, day_of_week, description)
+		SELECT pw.program_id, $2, pw.lineage_id, pw.name, pw.day_of_week, pw.description
+		FROM program_workouts pw
+		JOIN program_versions draft ON draft.id = pw.program_version_id
+		WHERE draft.program_id = $1 AND draft.version IS NULL
+	`, programID, version.ID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to copy program workouts: %w", err)
+	}
+
+	_, err = r.conn(ctx).Exec(ctx, `
+		INSERT INTO program_workout_exercises (
+			program_workout_id, lineage_id, exercise_id, sets, reps, target_rir, prescribed_weight, exercise_order,
+			notes, progression_strategy, rep_range_max, weight_increment, training_max
+		)
+		SELECT copy.id, pwe.lineage_id, pwe.exercise_id, pwe.sets, pwe.reps, pwe.target_rir, pwe.prescribed_weight,
+		       pwe.exercise_order, pwe.notes, pwe.progression_strategy, pwe.rep_range_max, pwe.weight_increment,
+		       pwe.training_max
+		FROM program_workout_exercises pwe
+		JOIN program_workouts pw ON pw.id = pwe.program_workout_id
+		JOIN program_versions draft ON draft.id = pw.program_version_id
+		JOIN program_workouts copy ON copy.lineage_id = pw.lineage_id AND copy.program_version_id = $2
+		WHERE draft.program_id = $1 AND draft.version IS NULL
+	`, programID, version.ID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to copy program exercises: %w", err)
+	}
+
+	return version, nil
+}
+
+// inDraftSQL limits a write to workouts of a draft version, so published versions stay as they were
+const inDraftSQL = `program_version_id IN (SELECT id FROM program_versions WHERE version IS NULL)`
+
+func (r *catalogRepository) CreateProgramWorkout(ctx context.Context, workout *models.ProgramWorkout) error {
+	query := `
+		INSERT INTO program_workouts (program_id, program_version_id, name, day_of_week, description)
+		SELECT program_id, id, $2, $3, $4 FROM program_versions WHERE id = $1 AND version IS NULL
+		RETURNING id, program_id, lineage_id
+	`
+
+	err := r.conn(ctx).QueryRow(ctx, query,
+		workout.ProgramVersionID, workout.Name, workout.DayOfWeek, workout.Description,
+	).Scan(&workout.ID, &workout.ProgramID, &workout.LineageID)
+	if err != nil {
+		return fmt.Errorf("failed to create program workout: %w", err)
+	}
+	return nil
+}
+
+func (r *catalogRepository) UpdateProgramWorkout(ctx context.Context, workout *models.ProgramWorkout) error {
+	query := `
+		UPDATE program_workouts
+		SET name = $3, day_of_week = $4, description = $5
+		WHERE id = $1 AND program_version_id = $2 AND ` + inDraftSQL + `
+	`
+
+	tag, err := r.conn(ctx).Exec(ctx, query,
+		workout.ID, workout.ProgramVersionID, workout.Name, workout.DayOfWeek, workout.Description,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to update program workout: %w", err)
+	}
+	if tag.RowsAffected() == 0 {
+		return fmt.Errorf("program workout %w", ErrNotFound)
+	}
+	return nil
+}
+
+// DeleteProgramWorkout removes a draft workout and its prescriptions
+func (r *catalogRepository) DeleteProgramWorkout(ctx context.Context, id int) error {
+	tag, err := r.conn(ctx).Exec(ctx, `DELETE FROM program_workouts WHERE id = $1 AND `+inDraftSQL, id)
+	if err != nil {
+		return fmt.Errorf("failed to delete program workout: %w", err)
+	}
+	if tag.RowsAffected() == 0 {
+		return fmt.Errorf("program workout %w", ErrNotFound)
+	}
+	return nil
+}
+
+// Optional prescription fields are stored as NULL when left at zero
+const programWorkoutExerciseValues = `$1, $2, $3, $4, $5, NULLIF($6, 0::REAL), $7, NULLIF($8, ''),
+	NULLIF($9, ''), NULLIF($10, 0), NULLIF($11, 0::REAL), NULLIF($12, 0::REAL)`
+
+func programWorkoutExerciseArgs(exercise *models.ProgramWorkoutExercise) []any {
+	return []any{
+		exercise.ProgramWorkoutID, exercise.ExerciseID, exercise.Sets, exercise.Reps,
+		exercise.TargetRIR, exercise.PrescribedWeight, exercise.ExerciseOrder, exercise.Notes,
+		exercise.ProgressionStrategy, exercise.RepRangeMax, exercise.WeightIncrement, exercise.TrainingMax,
+	}
+}
+
+func (r *catalogRepository) CreateProgramWorkoutExercise(ctx context.Context, exercise *models.ProgramWorkoutExercise) error {
+	query := `
+		INSERT INTO program_workout_exercises (
+			program_workout_id, exercise_id, sets, reps, target_rir, prescribed_weight, exercise_order,
+			notes, progression_strategy, rep_range_max, weight_increment, training_max
+		)
+		SELECT ` + programWorkoutExerciseValues + `
+		WHERE EXISTS (SELECT 1 FROM program_workouts WHERE id = $1 AND ` + inDraftSQL + `)
+		RETURNING id, lineage_id
+	`
+
+	err := r.conn(ctx).QueryRow(ctx, query, programWorkoutExerciseArgs(exercise)...).Scan(&exercise.ID, &exercise.LineageID)
+	if err != nil {
+		return fmt.Errorf("failed to create program exercise: %w", err)
+	}
+	return nil
+}
+
+func (r *catalogRepository) UpdateProgramWorkoutExercise(ctx context.Context, exercise *models.ProgramWorkoutExercise) error {
+	query := `
+		UPDATE program_workout_exercises
+		SET (program_workout_id, exercise_id, sets, reps, target_rir, prescribed_weight, exercise_order,
+		     notes, progression_strategy, rep_range_max, weight_increment, training_max)
+		  = (` + programWorkoutExerciseValues + `)
+		WHERE id = $13 AND program_workout_id IN (SELECT id FROM program_workouts WHERE ` + inDraftSQL + `)
+	`
+
+	tag, err := r.conn(ctx).Exec(ctx, query, append(programWorkoutExerciseArgs(exercise), exercise.ID)...)
+	if err != nil {
+		return fmt.Errorf("failed to update program exercise: %w", err)
+	}
+	if tag.RowsAffected() == 0 {
+		return fmt.Errorf("program exercise %w", ErrNotFound)
+	}
+	return nil
+}
+
+// DeleteProgramWorkoutExercise removes a draft prescription
+func (r *catalogRepository) DeleteProgramWorkoutExercise(ctx context.Context, id int) error {
+	query := `
+		DELETE FROM program_workout_exercises
+		WHERE id = $1 AND program_workout_id IN (SELECT id FROM program_workouts WHERE ` + inDraftSQL + `)
+	`
+
+	tag, err := r.conn(ctx).Exec(ctx, query, id)
+	if err != nil {
+		return fmt.Errorf("failed to delete program exercise: %w", err)
+	}
+	if tag.RowsAffected() == 0 {
+		return fmt.Errorf("program exercise %w", ErrNotFound)
+	}
+	return nil
+}
+
+func (r *catalogRepository) MissingExerciseIDs(ctx context.Context, ids []int) ([]int, error) {
+	query := `
+		SELECT id FROM UNNEST($1::INTEGER[]) AS requested(id)
+		WHERE NOT EXISTS (SELECT 1 FROM exercises e WHERE e.id = requested.id AND e.merged_into_id IS NULL)
+		ORDER BY id
+	`
+
+	rows, err := r.conn(ctx).Query(ctx, query, ids)
+	if err != nil {
+		return nil, fmt.Errorf("failed to check exercises: %w", err)
+	}
+	defer rows.Close()
+
+	var missing []int
+	for rows.Next() {
+		var id int
+		if err := rows.Scan(&id); err != nil {
+			return nil, fmt.Errorf("failed to scan exercise id: %w", err)
+		}
+		missing = append(missing, id)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to check exercises: %w", err)
+	}
+	return missing, nil
+}
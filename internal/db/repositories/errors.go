@@ -0,0 +1,91 @@
+package repositories
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+)
+
+// Sentinel errors returned by every repository. The original pgx error stays wrapped
+// alongside, so callers can match on these with errors.Is without importing pgx.
+var (
+	ErrNotFound   = errors.New("not found")
+	ErrConflict   = errors.New("already exists")
+	ErrForeignKey = errors.New("referenced record does not exist")
+	ErrInvalid    = errors.New("violates a data constraint")
+)
+
+// PostgreSQL error codes, see https://www.postgresql.org/docs/current/errcodes-appendix.html
+const (
+	pgNotNullViolation    = "23502"
+	pgForeignKeyViolation = "23503"
+	pgUniqueViolation     = "23505"
+	pgCheckViolation      = "23514"
+	pgExclusionViolation  = "23P01"
+)
+
+// translateError maps pgx and PostgreSQL errors onto the repository sentinels
+func translateError(err error) error {
+	if err == nil {
+		return nil
+	}
+	if errors.Is(err, pgx.ErrNoRows) {
+		return fmt.Errorf("%w: %w", ErrNotFound, err)
+	}
+
+	var pgErr *pgconn.PgError
+	if !errors.As(err, &pgErr) {
+		return err
+	}
+	switch pgErr.Code {
+	case pgUniqueViolation, pgExclusionViolation:
+		return fmt.Errorf("%w: %w", ErrConflict, err)
+	case pgForeignKeyViolation:
+		return fmt.Errorf("%w: %w", ErrForeignKey, err)
+	case pgNotNullViolation, pgCheckViolation:
+		return fmt.Errorf("%w: %w", ErrInvalid, err)
+	}
+	return err
+}
+
+// translatingConn applies translateError to everything a DBTX returns, so repositories
+// get typed errors without checking each call site
+type translatingConn struct {
+	conn DBTX
+}
+
+func (c translatingConn) Exec(ctx context.Context, sql string, args ...any) (pgconn.CommandTag, error) {
+	tag, err := c.conn.Exec(ctx, sql, args...)
+	return tag, translateError(err)
+}
+
+func (c translatingConn) Query(ctx context.Context, sql string, args ...any) (pgx.Rows, error) {
+	rows, err := c.conn.Query(ctx, sql, args...)
+	if err != nil {
+		return nil, translateError(err)
+	}
+	return translatingRows{rows}, nil
+}
+
+func (c translatingConn) QueryRow(ctx context.Context, sql string, args ...any) pgx.Row {
+	return translatingRow{c.conn.QueryRow(ctx, sql, args...)}
+}
+
+type translatingRow struct {
+	row pgx.Row
+}
+
+func (r translatingRow) Scan(dest ...any) error {
+	return translateError(r.row.Scan(dest...))
+}
+
+type translatingRows struct {
+	pgx.Rows
+}
+
+func (r translatingRows) Err() error {
+	return translateError(r.Rows.Err())
+}
@@ -0,0 +1,44 @@
+package repositories
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+)
+
+func TestTranslateError(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		want error
+	}{
+		{name: "no rows", err: pgx.ErrNoRows, want: ErrNotFound},
+		{name: "wrapped no rows", err: fmt.Errorf("scan: %w", pgx.ErrNoRows), want: ErrNotFound},
+		{name: "unique violation", err: &pgconn.PgError{Code: pgUniqueViolation, ConstraintName: "users_email_key"}, want: ErrConflict},
+		{name: "foreign key violation", err: &pgconn.PgError{Code: pgForeignKeyViolation}, want: ErrForeignKey},
+		{name: "check violation", err: &pgconn.PgError{Code: pgCheckViolation}, want: ErrInvalid},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := translateError(tt.err)
+			if !errors.Is(got, tt.want) {
+				t.Errorf("got %v, want %v", got, tt.want)
+			}
+			if !errors.Is(got, tt.err) {
+				t.Errorf("original error %v is no longer wrapped", tt.err)
+			}
+		})
+	}
+
+	other := errors.New("connection refused")
+	if got := translateError(other); got != other {
+		t.Errorf("unrelated errors should pass through, got %v", got)
+	}
+	if translateError(nil) != nil {
+		t.Error("nil should stay nil")
+	}
+}
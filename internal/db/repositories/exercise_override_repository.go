@@ -0,0 +1,105 @@
+package repositories
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+	"yoked_backend/internal/models"
+)
+
+// ExerciseOverrideRepository stores users' standing exercise swaps. A user has at most one
+// override per exercise in a program.
+type ExerciseOverrideRepository interface {
+	GetUserOverrides(ctx context.Context, userID string) ([]*models.ExerciseOverride, error)
+	GetProgramOverrides(ctx context.Context, userID string, programID int) ([]*models.ExerciseOverride, error)
+	// UpsertOverride creates the override or replaces the substitute of the existing one
+	UpsertOverride(ctx context.Context, override *models.ExerciseOverride) error
+	DeleteOverride(ctx context.Context, userID string, id int) error
+}
+
+type exerciseOverrideRepository struct {
+	db *pgxpool.Pool
+}
+
+func NewExerciseOverrideRepository(db *pgxpool.Pool) ExerciseOverrideRepository {
+	return &exerciseOverrideRepository{db: db}
+}
+
+func (r *exerciseOverrideRepository) conn(ctx context.Context) DBTX {
+	return connFromContext(ctx, r.db)
+}
+
+const exerciseOverrideColumns = `id, user_id, program_id, exercise_id, substitute_exercise_id, created_at, updated_at`
+
+func scanExerciseOverride(row interface{ Scan(...any) error }) (*models.ExerciseOverride, error) {
+	var override models.ExerciseOverride
+	err := row.Scan(
+		&override.ID, &override.UserID, &override.ProgramID, &override.ExerciseID,
+		&override.SubstituteExerciseID, &override.CreatedAt, &override.UpdatedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+	return &override, nil
+}
+
+func (r *exerciseOverrideRepository) GetUserOverrides(ctx context.Context, userID string) ([]*models.ExerciseOverride, error) {
+	return r.list(ctx, `WHERE user_id = $1`, userID)
+}
+
+func (r *exerciseOverrideRepository) GetProgramOverrides(ctx context.Context, userID string, programID int) ([]*models.ExerciseOverride, error) {
+	return r.list(ctx, `WHERE user_id = $1 AND program_id = $2`, userID, programID)
+}
+
+func (r *exerciseOverrideRepository) list(ctx context.Context, where string, args ...any) ([]*models.ExerciseOverride, error) {
+	query := `SELECT ` + exerciseOverrideColumns + ` FROM exercise_overrides ` + where + ` ORDER BY program_id, id`
+
+	rows, err := r.conn(ctx).Query(ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get exercise overrides: %w", err)
+	}
+	defer rows.Close()
+
+	overrides := []*models.ExerciseOverride{}
+	for rows.Next() {
+		override, err := scanExerciseOverride(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan exercise override: %w", err)
+		}
+		overrides = append(overrides, override)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to get exercise overrides: %w", err)
+	}
+	return overrides, nil
+}
+
+func (r *exerciseOverrideRepository) UpsertOverride(ctx context.Context, override *models.ExerciseOverride) error {
+	query := `
+		INSERT INTO exercise_overrides (user_id, program_id, exercise_id, substitute_exercise_id)
+		VALUES ($1, $2, $3, $4)
+		ON CONFLICT (user_id, program_id, exercise_id)
+		DO UPDATE SET substitute_exercise_id = EXCLUDED.substitute_exercise_id, updated_at = NOW()
+		RETURNING ` + exerciseOverrideColumns
+
+	saved, err := scanExerciseOverride(r.conn(ctx).QueryRow(ctx, query,
+		override.UserID, override.ProgramID, override.ExerciseID, override.SubstituteExerciseID,
+	))
+	if err != nil {
+		return fmt.Errorf("failed to save exercise override: %w", err)
+	}
+	*override = *saved
+	return nil
+}
+
+func (r *exerciseOverrideRepository) DeleteOverride(ctx context.Context, userID string, id int) error {
+	tag, err := r.conn(ctx).Exec(ctx, `DELETE FROM exercise_overrides WHERE id = $1 AND user_id = $2`, id, userID)
+	if err != nil {
+		return fmt.Errorf("failed to delete exercise override: %w", err)
+	}
+	if tag.RowsAffected() == 0 {
+		return fmt.Errorf("exercise override %w", ErrNotFound)
+	}
+	return nil
+}
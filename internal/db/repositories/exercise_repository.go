@@ -0,0 +1,376 @@
+package repositories
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+	"yoked_backend/internal/models"
+)
+
+// ExerciseRepository manages the exercise library. Searches skip exercises merged into
+// another; lookups by id still find them.
+type ExerciseRepository interface {
+	SearchExercises(ctx context.Context, filter *models.ExerciseFilter) ([]*models.Exercise, int, error)
+	// CountExerciseFacets counts the exercises matching filter by primary muscle group and by
+	// equipment. Each count ignores its own facet's filter.
+	CountExerciseFacets(ctx context.Context, filter *models.ExerciseFilter) (*models.ExerciseFacets, error)
+	GetExercise(ctx context.Context, id int) (*models.Exercise, error)
+	// LockExercise returns the exercise and holds its row lock until the transaction ends
+	LockExercise(ctx context.Context, id int) (*models.Exercise, error)
+	CreateExercise(ctx context.Context, exercise *models.Exercise) error
+	UpdateExercise(ctx context.Context, exercise *models.Exercise) error
+	// MergeExercise marks source as a duplicate of target, along with anything merged into
+	// source before, and moves draft prescriptions and users' overrides of source over to
+	// target. Published program versions and logged history keep pointing at source.
+	MergeExercise(ctx context.Context, sourceID, targetID int) error
+	// GetMergedExercises maps each exercise merged into one of ids to the one it was merged into
+	GetMergedExercises(ctx context.Context, ids []int) (map[int]int, error)
+	// ListSubstituteCandidates returns the listed exercises other than exercise that share its
+	// movement pattern or any of its muscle groups
+	ListSubstituteCandidates(ctx context.Context, exercise *models.Exercise) ([]*models.Exercise, error)
+}
+
+type exerciseRepository struct {
+	db *pgxpool.Pool
+}
+
+func NewExerciseRepository(db *pgxpool.Pool) ExerciseRepository {
+	return &exerciseRepository{db: db}
+}
+
+func (r *exerciseRepository) conn(ctx context.Context) DBTX {
+	return connFromContext(ctx, r.db)
+}
+
+const exerciseColumns = `e.id, e.name, COALESCE(e.description, ''), COALESCE(e.primary_muscle_group, ''),
+	e.secondary_muscle_groups, COALESCE(e.equipment, ''), COALESCE(e.movement_pattern, ''),
+	COALESCE(e.laterality, ''), COALESCE(e.mechanics, ''), COALESCE(e.difficulty, ''), e.aliases,
+	e.instructions, e.merged_into_id, e.created_at, COALESCE(e.updated_at, e.created_at)`
+
+func exerciseDest(exercise *models.Exercise) []any {
+	return []any{
+		&exercise.ID, &exercise.Name, &exercise.Description, &exercise.PrimaryMuscleGroup,
+		&exercise.SecondaryMuscleGroups, &exercise.Equipment, &exercise.MovementPattern,
+		&exercise.Laterality, &exercise.Mechanics, &exercise.Difficulty, &exercise.Aliases,
+		&exercise.Instructions, &exercise.MergedIntoID, &exercise.CreatedAt, &exercise.UpdatedAt,
+	}
+}
+
+func scanExercise(row interface{ Scan(...any) error }) (*models.Exercise, error) {
+	var exercise models.Exercise
+	if err := row.Scan(exerciseDest(&exercise)...); err != nil {
+		return nil, err
+	}
+	return &exercise, nil
+}
+
+// exerciseSearchWhere holds the search conditions shared by the result and facet queries: $1
+// is the full-text query, $2 the same text as a LIKE pattern so partial words match while
+// typing, then the muscle, equipment, movement pattern, mechanics and difficulty filters
+const exerciseSearchWhere = `
+	e.merged_into_id IS NULL
+	AND ($1 = '' OR e.search_vector @@ websearch_to_tsquery('english', $1)
+		OR e.name ILIKE $2 OR EXISTS (SELECT 1 FROM UNNEST(e.aliases) AS alias WHERE alias ILIKE $2))
+	AND ($3 = '' OR e.primary_muscle_group = $3 OR $3 = ANY(e.secondary_muscle_groups))
+	AND ($4 = '' OR e.equipment = $4)
+	AND ($5 = '' OR e.movement_pattern = $5)
+	AND ($6 = '' OR e.mechanics = $6)
+	AND ($7 = '' OR e.difficulty = $7)`
+
+func exerciseSearchArgs(filter *models.ExerciseFilter) []any {
+	pattern := "%" + likeEscaper.Replace(filter.Query) + "%"
+	return []any{
+		filter.Query, pattern, filter.Muscle, filter.Equipment,
+		filter.MovementPattern, filter.Mechanics, filter.Difficulty,
+	}
+}
+
+var likeEscaper = strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`)
+
+// SearchExercises returns a page of matches, best first, with the number of matches overall.
+// Names starting with the query rank above other matches.
+func (r *exerciseRepository) SearchExercises(ctx context.Context, filter *models.ExerciseFilter) ([]*models.Exercise, int, error) {
+	query := `
+		SELECT ` + exerciseColumns + `, COUNT(*) OVER ()
+		FROM exercises e
+		WHERE ` + exerciseSearchWhere + `
+		ORDER BY
+			$1 <> '' AND e.name ILIKE SUBSTRING($2 FROM 2) DESC,
+			CASE WHEN $1 = '' THEN 0 ELSE ts_rank(e.search_vector, websearch_to_tsquery('english', $1)) END DESC,
+			e.name
+		LIMIT $8 OFFSET $9
+	`
+
+	args := append(exerciseSearchArgs(filter), filter.Limit, filter.Offset)
+	rows, err := r.conn(ctx).Query(ctx, query, args...)
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to search exercises: %w", err)
+	}
+	defer rows.Close()
+
+	exercises := []*models.Exercise{}
+	total := 0
+	for rows.Next() {
+		var exercise models.Exercise
+		if err := rows.Scan(append(exerciseDest(&exercise), &total)...); err != nil {
+			return nil, 0, fmt.Errorf("failed to scan exercise: %w", err)
+		}
+		exercises = append(exercises, &exercise)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, 0, fmt.Errorf("failed to search exercises: %w", err)
+	}
+	if len(exercises) == 0 && filter.Offset > 0 {
+		// Past the last page the window count is lost with the rows
+		row := r.conn(ctx).QueryRow(ctx, `SELECT COUNT(*) FROM exercises e WHERE `+exerciseSearchWhere,
+			exerciseSearchArgs(filter)...)
+		if err := row.Scan(&total); err != nil {
+			return nil, 0, fmt.Errorf("failed to count exercises: %w", err)
+		}
+	}
+	return exercises, total, nil
+}
+
+func (r *exerciseRepository) CountExerciseFacets(ctx context.Context, filter *models.ExerciseFilter) (*models.ExerciseFacets, error) {
+	byMuscle := *filter
+	byMuscle.Muscle = ""
+	muscles, err := r.countBy(ctx, "muscle.name", exerciseMusclesJoin, &byMuscle)
+	if err != nil {
+		return nil, err
+	}
+
+	byEquipment := *filter
+	byEquipment.Equipment = ""
+	equipment, err := r.countBy(ctx, "e.equipment", "", &byEquipment)
+	if err != nil {
+		return nil, err
+	}
+
+	return &models.ExerciseFacets{Muscles: muscles, Equipment: equipment}, nil
+}
+
+// exerciseMusclesJoin gives each exercise one muscle.name row per muscle it works, primary or
+// secondary, so a muscle's facet count matches the muscle filter in exerciseSearchWhere
+const exerciseMusclesJoin = `
+		CROSS JOIN LATERAL (
+			SELECT DISTINCT m FROM UNNEST(ARRAY[e.primary_muscle_group::TEXT] || e.secondary_muscle_groups) AS m
+		) AS muscle(name)`
+
+// countBy counts the matches of filter by column, which is one of our own column names,
+// optionally drawn from join, one of our own joins
+func (r *exerciseRepository) countBy(ctx context.Context, column, join string, filter *models.ExerciseFilter) (map[string]int, error) {
+	query := `
+		SELECT ` + column + `, COUNT(*)
+		FROM exercises e` + join + `
+		WHERE ` + exerciseSearchWhere + ` AND ` + column + ` IS NOT NULL
+		GROUP BY ` + column
+
+	rows, err := r.conn(ctx).Query(ctx, query, exerciseSearchArgs(filter)...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to count exercise facets: %w", err)
+	}
+	defer rows.Close()
+
+	counts := make(map[string]int)
+	for rows.Next() {
+		var value string
+		var count int
+		if err := rows.Scan(&value, &count); err != nil {
+			return nil, fmt.Errorf("failed to scan exercise facet: %w", err)
+		}
+		counts[value] = count
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to count exercise facets: %w", err)
+	}
+	return counts, nil
+}
+
+func (r *exerciseRepository) GetExercise(ctx context.Context, id int) (*models.Exercise, error) {
+	query := `SELECT ` + exerciseColumns + ` FROM exercises e WHERE e.id = $1`
+
+	exercise, err := scanExercise(r.conn(ctx).QueryRow(ctx, query, id))
+	if err != nil {
+		return nil, fmt.Errorf("failed to get exercise: %w", err)
+	}
+	return exercise, nil
+}
+
+func (r *exerciseRepository) LockExercise(ctx context.Context, id int) (*models.Exercise, error) {
+	query := `SELECT ` + exerciseColumns + ` FROM exercises e WHERE e.id = $1 FOR UPDATE`
+
+	exercise, err := scanExercise(r.conn(ctx).QueryRow(ctx, query, id))
+	if err != nil {
+		return nil, fmt.Errorf("failed to lock exercise: %w", err)
+	}
+	return exercise, nil
+}
+
+// exerciseValues stores empty optional fields as NULL so the vocabulary checks pass
+const exerciseValues = `$1, NULLIF($2, ''), NULLIF($3, ''), $4, NULLIF($5, ''), NULLIF($6, ''),
+	NULLIF($7, ''), NULLIF($8, ''), NULLIF($9, ''), $10, $11`
+
+func exerciseArgs(exercise *models.Exercise) []any {
+	return []any{
+		exercise.Name, exercise.Description, exercise.PrimaryMuscleGroup, exercise.SecondaryMuscleGroups,
+		exercise.Equipment, exercise.MovementPattern, exercise.Laterality, exercise.Mechanics,
+		exercise.Difficulty, exercise.Aliases, exercise.Instructions,
+	}
+}
+
+func (r *exerciseRepository) CreateExercise(ctx context.Context, exercise *models.Exercise) error {
+	query := `
+		INSERT INTO exercises (
+			name, description, primary_muscle_group, secondary_muscle_groups, equipment,
+			movement_pattern, laterality, mechanics, difficulty, aliases, instructions
+		)
+		VALUES (` + exerciseValues + `)
+		RETURNING id, created_at, updated_at
+	`
+
+	err := r.conn(ctx).QueryRow(ctx, query, exerciseArgs(exercise)...).Scan(
+		&exercise.ID, &exercise.CreatedAt, &exercise.UpdatedAt,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to create exercise: %w", err)
+	}
+	return nil
+}
+
+func (r *exerciseRepository) UpdateExercise(ctx context.Context, exercise *models.Exercise) error {
+	query := `
+		UPDATE exercises
+		SET (
+			name, description, primary_muscle_group, secondary_muscle_groups, equipment,
+			movement_pattern, laterality, mechanics, difficulty, aliases, instructions
+		) = (` + exerciseValues + `), updated_at = NOW()
+		WHERE id = $12
+		RETURNING updated_at
+	`
+
+	args := append(exerciseArgs(exercise), exercise.ID)
+	if err := r.conn(ctx).QueryRow(ctx, query, args...).Scan(&exercise.UpdatedAt); err != nil {
+		return fmt.Errorf("failed to update exercise: %w", err)
+	}
+	return nil
+}
+
+func (r *exerciseRepository) MergeExercise(ctx context.Context, sourceID, targetID int) error {
+	_, err := r.conn(ctx).Exec(ctx, `
+		UPDATE exercises SET merged_into_id = $2, updated_at = NOW()
+		WHERE id = $1 OR merged_into_id = $1
+	`, sourceID, targetID)
+	if err != nil {
+		return fmt.Errorf("failed to merge exercise: %w", err)
+	}
+
+	// Drafts are what the catalog edits next, so they move to the surviving exercise. A draft
+	// workout already prescribing it keeps that prescription and drops the duplicate's.
+	_, err = r.conn(ctx).Exec(ctx, `
+		DELETE FROM program_workout_exercises pwe
+		USING program_workouts pw, program_versions pv
+		WHERE pwe.exercise_id = $1 AND pw.id = pwe.program_workout_id
+			AND pv.id = pw.program_version_id AND pv.version IS NULL
+			AND EXISTS (
+				SELECT 1 FROM program_workout_exercises kept
+				WHERE kept.program_workout_id = pwe.program_workout_id AND kept.exercise_id = $2)
+	`, sourceID, targetID)
+	if err != nil {
+		return fmt.Errorf("failed to fold draft prescriptions: %w", err)
+	}
+	_, err = r.conn(ctx).Exec(ctx, `
+		UPDATE program_workout_exercises SET exercise_id = $2
+		WHERE exercise_id = $1 AND program_workout_id IN (
+			SELECT pw.id FROM program_workouts pw
+			JOIN program_versions pv ON pv.id = pw.program_version_id
+			WHERE pv.version IS NULL)
+	`, sourceID, targetID)
+	if err != nil {
+		return fmt.Errorf("failed to move draft prescriptions: %w", err)
+	}
+
+	// Swaps between source and target would now swap the exercise for itself, and a user's swap
+	// of source gives way to their swap of target in the same program
+	_, err = r.conn(ctx).Exec(ctx, `
+		DELETE FROM exercise_overrides o
+		WHERE (o.exercise_id = $1 AND o.substitute_exercise_id = $2)
+			OR (o.exercise_id = $2 AND o.substitute_exercise_id = $1)
+			OR (o.exercise_id = $1 AND EXISTS (
+				SELECT 1 FROM exercise_overrides kept
+				WHERE kept.user_id = o.user_id AND kept.program_id = o.program_id AND kept.exercise_id = $2))
+	`, sourceID, targetID)
+	if err != nil {
+		return fmt.Errorf("failed to drop exercise overrides: %w", err)
+	}
+	_, err = r.conn(ctx).Exec(ctx, `
+		UPDATE exercise_overrides
+		SET exercise_id = CASE WHEN exercise_id = $1 THEN $2 ELSE exercise_id END,
+			substitute_exercise_id = CASE WHEN substitute_exercise_id = $1 THEN $2 ELSE substitute_exercise_id END,
+			updated_at = NOW()
+		WHERE exercise_id = $1 OR substitute_exercise_id = $1
+	`, sourceID, targetID)
+	if err != nil {
+		return fmt.Errorf("failed to move exercise overrides: %w", err)
+	}
+	return nil
+}
+
+func (r *exerciseRepository) GetMergedExercises(ctx context.Context, ids []int) (map[int]int, error) {
+	rows, err := r.conn(ctx).Query(ctx, `
+		SELECT id, merged_into_id FROM exercises WHERE merged_into_id = ANY($1)
+	`, ids)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get merged exercises: %w", err)
+	}
+	defer rows.Close()
+
+	merged := make(map[int]int)
+	for rows.Next() {
+		var id, into int
+		if err := rows.Scan(&id, &into); err != nil {
+			return nil, fmt.Errorf("failed to scan merged exercise: %w", err)
+		}
+		merged[id] = into
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to get merged exercises: %w", err)
+	}
+	return merged, nil
+}
+
+func (r *exerciseRepository) ListSubstituteCandidates(ctx context.Context, exercise *models.Exercise) ([]*models.Exercise, error) {
+	muscles := exercise.SecondaryMuscleGroups
+	if exercise.PrimaryMuscleGroup != "" {
+		muscles = append([]string{exercise.PrimaryMuscleGroup}, muscles...)
+	}
+
+	query := `
+		SELECT ` + exerciseColumns + `
+		FROM exercises e
+		WHERE e.merged_into_id IS NULL AND e.id <> $1
+			AND (e.movement_pattern = NULLIF($2, '')
+				OR e.primary_muscle_group = ANY($3::TEXT[]) OR e.secondary_muscle_groups && $3::TEXT[])
+		ORDER BY e.name
+	`
+
+	rows, err := r.conn(ctx).Query(ctx, query, exercise.ID, exercise.MovementPattern, muscles)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list substitute candidates: %w", err)
+	}
+	defer rows.Close()
+
+	candidates := []*models.Exercise{}
+	for rows.Next() {
+		candidate, err := scanExercise(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan exercise: %w", err)
+		}
+		candidates = append(candidates, candidate)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to list substitute candidates: %w", err)
+	}
+	return candidates, nil
+}
@@ -0,0 +1,154 @@
+package repositories
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+	"yoked_backend/internal/models"
+)
+
+type IdentityRepository interface {
+	CreateOIDCAuthRequest(ctx context.Context, req *models.OIDCAuthRequest) error
+	ConsumeOIDCAuthRequest(ctx context.Context, stateHash string) (*models.OIDCAuthRequest, error)
+	CreateIdentity(ctx context.Context, identity *models.ExternalIdentity) error
+	GetIdentity(ctx context.Context, provider, subject string) (*models.ExternalIdentity, error)
+	GetUserIdentities(ctx context.Context, userID string) ([]*models.ExternalIdentity, error)
+	DeleteIdentity(ctx context.Context, userID, provider string) error
+}
+
+type identityRepository struct {
+	db *pgxpool.Pool
+}
+
+func NewIdentityRepository(db *pgxpool.Pool) IdentityRepository {
+	return &identityRepository{db: db}
+}
+
+func (r *identityRepository) conn(ctx context.Context) DBTX {
+	return connFromContext(ctx, r.db)
+}
+
+// CreateOIDCAuthRequest stores a pending authorization until its callback
+func (r *identityRepository) CreateOIDCAuthRequest(ctx context.Context, req *models.OIDCAuthRequest) error {
+	query := `
+		INSERT INTO oidc_auth_requests (state_hash, provider, nonce, code_verifier, user_id, profile, expires_at)
+		VALUES ($1, $2, $3, $4, NULLIF($5, '')::UUID, $6, $7)
+		RETURNING created_at
+	`
+
+	err := r.conn(ctx).QueryRow(ctx, query,
+		req.StateHash, req.Provider, req.Nonce, req.CodeVerifier, req.UserID, req.Profile, req.ExpiresAt,
+	).Scan(&req.CreatedAt)
+	if err != nil {
+		return fmt.Errorf("failed to create oidc auth request: %w", err)
+	}
+
+	return nil
+}
+
+// ConsumeOIDCAuthRequest removes and returns an unexpired request. Deleting it in the same
+// statement means each state can only complete one callback.
+func (r *identityRepository) ConsumeOIDCAuthRequest(ctx context.Context, stateHash string) (*models.OIDCAuthRequest, error) {
+	query := `
+		DELETE FROM oidc_auth_requests
+		WHERE state_hash = $1 AND expires_at > NOW()
+		RETURNING state_hash, provider, nonce, code_verifier, COALESCE(user_id::TEXT, ''), profile, expires_at, created_at
+	`
+
+	var req models.OIDCAuthRequest
+	err := r.conn(ctx).QueryRow(ctx, query, stateHash).Scan(
+		&req.StateHash, &req.Provider, &req.Nonce, &req.CodeVerifier,
+		&req.UserID, &req.Profile, &req.ExpiresAt, &req.CreatedAt,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to consume oidc auth request: %w", err)
+	}
+
+	return &req, nil
+}
+
+// CreateIdentity links an external account. It returns ErrConflict when the external account
+// is linked to someone already, or the user already has an identity at the provider.
+func (r *identityRepository) CreateIdentity(ctx context.Context, identity *models.ExternalIdentity) error {
+	query := `
+		INSERT INTO external_identities (user_id, provider, subject, email)
+		VALUES ($1, $2, $3, $4)
+		RETURNING id, created_at
+	`
+
+	err := r.conn(ctx).QueryRow(ctx, query,
+		identity.UserID, identity.Provider, identity.Subject, identity.Email,
+	).Scan(&identity.ID, &identity.CreatedAt)
+	if err != nil {
+		return fmt.Errorf("failed to create identity: %w", err)
+	}
+
+	return nil
+}
+
+// GetIdentity finds the identity for a provider's subject
+func (r *identityRepository) GetIdentity(ctx context.Context, provider, subject string) (*models.ExternalIdentity, error) {
+	query := `
+		SELECT id, user_id, provider, subject, email, created_at
+		FROM external_identities
+		WHERE provider = $1 AND subject = $2
+	`
+
+	var identity models.ExternalIdentity
+	err := r.conn(ctx).QueryRow(ctx, query, provider, subject).Scan(
+		&identity.ID, &identity.UserID, &identity.Provider, &identity.Subject, &identity.Email, &identity.CreatedAt,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get identity: %w", err)
+	}
+
+	return &identity, nil
+}
+
+// GetUserIdentities lists the user's linked providers
+func (r *identityRepository) GetUserIdentities(ctx context.Context, userID string) ([]*models.ExternalIdentity, error) {
+	query := `
+		SELECT id, user_id, provider, subject, email, created_at
+		FROM external_identities
+		WHERE user_id = $1
+		ORDER BY created_at
+	`
+
+	rows, err := r.conn(ctx).Query(ctx, query, userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get identities: %w", err)
+	}
+	defer rows.Close()
+
+	identities := []*models.ExternalIdentity{}
+	for rows.Next() {
+		var identity models.ExternalIdentity
+		if err := rows.Scan(
+			&identity.ID, &identity.UserID, &identity.Provider, &identity.Subject, &identity.Email, &identity.CreatedAt,
+		); err != nil {
+			return nil, fmt.Errorf("failed to scan identity: %w", err)
+		}
+		identities = append(identities, &identity)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to get identities: %w", err)
+	}
+
+	return identities, nil
+}
+
+// DeleteIdentity unlinks the user's identity at provider
+func (r *identityRepository) DeleteIdentity(ctx context.Context, userID, provider string) error {
+	result, err := r.conn(ctx).Exec(ctx, `DELETE FROM external_identities WHERE user_id = $1 AND provider = $2`, userID, provider)
+	if err != nil {
+		return fmt.Errorf("failed to delete identity: %w", err)
+	}
+
+	if result.RowsAffected() == 0 {
+		return fmt.Errorf("identity %w", ErrNotFound)
+	}
+
+	return nil
+}
@@ -0,0 +1,229 @@
+package repositories
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+	"yoked_backend/internal/models"
+)
+
+type MFARepository interface {
+	SavePendingMFASecret(ctx context.Context, userID string, secret []byte) error
+	GetMFASecret(ctx context.Context, userID string) (*models.MFASecret, error)
+	EnableMFA(ctx context.Context, userID string, step int64) error
+	UseMFAStep(ctx context.Context, userID string, step int64) (bool, error)
+	DeleteMFA(ctx context.Context, userID string) error
+	ReplaceRecoveryCodes(ctx context.Context, userID string, codeHashes []string) error
+	UseRecoveryCode(ctx context.Context, userID, codeHash string) (bool, error)
+	CreateMFAChallenge(ctx context.Context, challenge *models.MFAChallenge) error
+	GetMFAChallengeByHash(ctx context.Context, tokenHash string) (*models.MFAChallenge, error)
+	ClaimMFAChallengeAttempt(ctx context.Context, id string, maxAttempts int, now time.Time) (bool, error)
+	ConsumeMFAChallenge(ctx context.Context, id string) error
+}
+
+type mfaRepository struct {
+	db *pgxpool.Pool
+}
+
+func NewMFARepository(db *pgxpool.Pool) MFARepository {
+	return &mfaRepository{db: db}
+}
+
+func (r *mfaRepository) conn(ctx context.Context) DBTX {
+	return connFromContext(ctx, r.db)
+}
+
+// SavePendingMFASecret starts or restarts an enrollment. It returns ErrConflict when 2FA is
+// already enabled, so an enrolled secret can never be silently replaced.
+func (r *mfaRepository) SavePendingMFASecret(ctx context.Context, userID string, secret []byte) error {
+	query := `
+		INSERT INTO user_mfa (user_id, secret)
+		VALUES ($1, $2)
+		ON CONFLICT (user_id) DO UPDATE
+		SET secret = EXCLUDED.secret, last_used_step = 0, created_at = NOW()
+		WHERE user_mfa.enabled_at IS NULL
+	`
+
+	result, err := r.conn(ctx).Exec(ctx, query, userID, secret)
+	if err != nil {
+		return fmt.Errorf("failed to save mfa secret: %w", err)
+	}
+
+	if result.RowsAffected() == 0 {
+		return fmt.Errorf("two-factor authentication %w", ErrConflict)
+	}
+
+	return nil
+}
+
+// GetMFASecret returns the user's secret, enabled or pending
+func (r *mfaRepository) GetMFASecret(ctx context.Context, userID string) (*models.MFASecret, error) {
+	query := `
+		SELECT user_id, secret, enabled_at, last_used_step, created_at
+		FROM user_mfa
+		WHERE user_id = $1
+	`
+
+	var secret models.MFASecret
+	err := r.conn(ctx).QueryRow(ctx, query, userID).Scan(
+		&secret.UserID, &secret.Secret, &secret.EnabledAt, &secret.LastUsedStep, &secret.CreatedAt,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get mfa secret: %w", err)
+	}
+
+	return &secret, nil
+}
+
+// EnableMFA completes a pending enrollment, recording the step of the confirming code
+func (r *mfaRepository) EnableMFA(ctx context.Context, userID string, step int64) error {
+	query := `
+		UPDATE user_mfa
+		SET enabled_at = NOW(), last_used_step = $2
+		WHERE user_id = $1 AND enabled_at IS NULL
+	`
+
+	result, err := r.conn(ctx).Exec(ctx, query, userID, step)
+	if err != nil {
+		return fmt.Errorf("failed to enable mfa: %w", err)
+	}
+
+	if result.RowsAffected() == 0 {
+		return fmt.Errorf("pending mfa enrollment %w", ErrNotFound)
+	}
+
+	return nil
+}
+
+// UseMFAStep records that the code for step was used. It reports false when that step or a
+// later one was already used, which is how a replayed code is caught.
+func (r *mfaRepository) UseMFAStep(ctx context.Context, userID string, step int64) (bool, error) {
+	query := `UPDATE user_mfa SET last_used_step = $2 WHERE user_id = $1 AND last_used_step < $2`
+
+	result, err := r.conn(ctx).Exec(ctx, query, userID, step)
+	if err != nil {
+		return false, fmt.Errorf("failed to record mfa code: %w", err)
+	}
+
+	return result.RowsAffected() > 0, nil
+}
+
+// DeleteMFA turns 2FA off, removing the secret and every recovery code
+func (r *mfaRepository) DeleteMFA(ctx context.Context, userID string) error {
+	if _, err := r.conn(ctx).Exec(ctx, `DELETE FROM mfa_recovery_codes WHERE user_id = $1`, userID); err != nil {
+		return fmt.Errorf("failed to delete recovery codes: %w", err)
+	}
+	if _, err := r.conn(ctx).Exec(ctx, `DELETE FROM user_mfa WHERE user_id = $1`, userID); err != nil {
+		return fmt.Errorf("failed to delete mfa secret: %w", err)
+	}
+	return nil
+}
+
+// ReplaceRecoveryCodes swaps the user's recovery codes for a new set. Call it inside a
+// unit of work so the user is never left without codes.
+func (r *mfaRepository) ReplaceRecoveryCodes(ctx context.Context, userID string, codeHashes []string) error {
+	if _, err := r.conn(ctx).Exec(ctx, `DELETE FROM mfa_recovery_codes WHERE user_id = $1`, userID); err != nil {
+		return fmt.Errorf("failed to delete recovery codes: %w", err)
+	}
+
+	query := `
+		INSERT INTO mfa_recovery_codes (user_id, code_hash)
+		SELECT $1, UNNEST($2::TEXT[])
+	`
+	if _, err := r.conn(ctx).Exec(ctx, query, userID, codeHashes); err != nil {
+		return fmt.Errorf("failed to create recovery codes: %w", err)
+	}
+
+	return nil
+}
+
+// UseRecoveryCode spends an unused recovery code, reporting false when there is none to spend
+func (r *mfaRepository) UseRecoveryCode(ctx context.Context, userID, codeHash string) (bool, error) {
+	query := `
+		UPDATE mfa_recovery_codes
+		SET used_at = NOW()
+		WHERE user_id = $1 AND code_hash = $2 AND used_at IS NULL
+	`
+
+	result, err := r.conn(ctx).Exec(ctx, query, userID, codeHash)
+	if err != nil {
+		return false, fmt.Errorf("failed to use recovery code: %w", err)
+	}
+
+	return result.RowsAffected() > 0, nil
+}
+
+// CreateMFAChallenge stores a new login challenge
+func (r *mfaRepository) CreateMFAChallenge(ctx context.Context, challenge *models.MFAChallenge) error {
+	query := `
+		INSERT INTO mfa_challenges (user_id, token_hash, expires_at)
+		VALUES ($1, $2, $3)
+		RETURNING id, created_at
+	`
+
+	err := r.conn(ctx).QueryRow(ctx, query, challenge.UserID, challenge.TokenHash, challenge.ExpiresAt).Scan(&challenge.ID, &challenge.CreatedAt)
+	if err != nil {
+		return fmt.Errorf("failed to create mfa challenge: %w", err)
+	}
+
+	return nil
+}
+
+// GetMFAChallengeByHash looks a challenge up by its token hash, including used ones
+func (r *mfaRepository) GetMFAChallengeByHash(ctx context.Context, tokenHash string) (*models.MFAChallenge, error) {
+	query := `
+		SELECT id, user_id, token_hash, expires_at, attempts, used_at, created_at
+		FROM mfa_challenges
+		WHERE token_hash = $1
+	`
+
+	var challenge models.MFAChallenge
+	err := r.conn(ctx).QueryRow(ctx, query, tokenHash).Scan(
+		&challenge.ID, &challenge.UserID, &challenge.TokenHash, &challenge.ExpiresAt,
+		&challenge.Attempts, &challenge.UsedAt, &challenge.CreatedAt,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get mfa challenge: %w", err)
+	}
+
+	return &challenge, nil
+}
+
+// ClaimMFAChallengeAttempt counts an attempt against the challenge before its code is checked.
+// It reports false once the challenge is used, expired or out of attempts; the check and the
+// count are one statement, so parallel requests cannot share an attempt.
+func (r *mfaRepository) ClaimMFAChallengeAttempt(ctx context.Context, id string, maxAttempts int, now time.Time) (bool, error) {
+	query := `
+		UPDATE mfa_challenges SET attempts = attempts + 1
+		WHERE id = $1 AND used_at IS NULL AND attempts < $2 AND expires_at > $3
+		RETURNING attempts
+	`
+
+	var attempts int
+	err := r.conn(ctx).QueryRow(ctx, query, id, maxAttempts, now).Scan(&attempts)
+	if errors.Is(err, ErrNotFound) {
+		return false, nil
+	}
+	if err != nil {
+		return false, fmt.Errorf("failed to claim mfa attempt: %w", err)
+	}
+	return true, nil
+}
+
+// ConsumeMFAChallenge marks a challenge used. It returns ErrNotFound when it already was, so a
+// challenge can only ever start one session.
+func (r *mfaRepository) ConsumeMFAChallenge(ctx context.Context, id string) error {
+	result, err := r.conn(ctx).Exec(ctx, `UPDATE mfa_challenges SET used_at = NOW() WHERE id = $1 AND used_at IS NULL`, id)
+	if err != nil {
+		return fmt.Errorf("failed to consume mfa challenge: %w", err)
+	}
+
+	if result.RowsAffected() == 0 {
+		return fmt.Errorf("unused mfa challenge %w", ErrNotFound)
+	}
+
+	return nil
+}
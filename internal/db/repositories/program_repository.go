@@ -4,7 +4,10 @@ package repositories
 import (
     "fmt"
     "context"
+    "errors"
     "log"
+    "time"
+    "github.com/jackc/pgx/v5"
     "github.com/jackc/pgx/v5/pgxpool"
     "yoked_backend/internal/models"
 )
@@ -12,16 +15,21 @@ import (
 type ProgramRepository interface {
     // Program management
     GetProgramByID(ctx context.Context, programID int) (*models.Program, error)
+    // GetProgramsByGoal lists published programs only
     GetProgramsByGoal(ctx context.Context, goal string) ([]*models.Program, error)
     GetAllPrograms(ctx context.Context) ([]*models.Program, error)
     
-    // Program structure
-    GetProgramWorkouts(ctx context.Context, programID int) ([]*models.ProgramWorkout, error)
+    // Program versions
+    GetProgramVersion(ctx context.Context, id int) (*models.ProgramVersion, error)
+    GetLatestProgramVersion(ctx context.Context, programID int) (*models.ProgramVersion, error)
+    
+    // Program structure, read from one version of the program
+    GetProgramWorkouts(ctx context.Context, programVersionID int) ([]*models.ProgramWorkout, error)
+    GetProgramWorkout(ctx context.Context, id int) (*models.ProgramWorkout, error)
     GetProgramWorkoutExercises(ctx context.Context, workoutID int) ([]*models.ProgramWorkoutExercise, error)
     GetProgramWorkoutExercise(ctx context.Context, id int) (*models.ProgramWorkoutExercise, error)
     
-    // Exercises
-    GetAllExercises(ctx context.Context) ([]*models.Exercise, error)
+    // Exercises; the library itself is managed through ExerciseRepository
     GetExerciseByID(ctx context.Context, id int) (*models.Exercise, error)
     
     // User program tracking
@@ -33,13 +41,24 @@ type ProgramRepository interface {
     // Workout sessions
     CreateWorkoutSession(ctx context.Context, session *models.WorkoutSession) (int, error)
     GetWorkoutSessionByID(ctx context.Context, id int) (*models.WorkoutSession, error)
+    GetActiveWorkoutSession(ctx context.Context, userID string) (*models.WorkoutSession, error)
+    CompleteWorkoutSession(ctx context.Context, id int, completedAt time.Time) (*models.WorkoutSession, error)
+    AbandonWorkoutSession(ctx context.Context, id int, abandonedAt time.Time) (*models.WorkoutSession, error)
+    AbandonStaleWorkoutSessions(ctx context.Context, startedBefore time.Time) (int64, error)
     GetWorkoutSessionsByUserProgram(ctx context.Context, userProgramID int, limit int) ([]*models.WorkoutSession, error)
+    GetWorkoutSessionsSince(ctx context.Context, userProgramID int, since time.Time) ([]*models.WorkoutSession, error)
+    // Sessions "by type" match the program workout in any version of the program
     GetLastWorkoutSessionByType(ctx context.Context, userID string, programWorkoutID int) (*models.WorkoutSession, error)
+    CountWorkoutSessionsByType(ctx context.Context, userProgramID int, programWorkoutID int) (int, error)
+    GetUserPrograms(ctx context.Context, userID string) ([]*models.UserProgram, error)
+    GetUserWorkoutHistory(ctx context.Context, userID string) ([]*models.WorkoutSession, error)
     
     // Exercise logs
     CreateWorkoutExerciseLog(ctx context.Context, log *models.WorkoutExerciseLog) error
     GetExerciseLogsByWorkout(ctx context.Context, workoutID int) ([]*models.WorkoutExerciseLog, error)
-    GetLastExerciseLog(ctx context.Context, userID string, programWorkoutExerciseID int) (*models.WorkoutExerciseLog, error)
+    // GetLastExerciseLog matches the prescription in any version of the program, performed
+    // as exerciseID so logs of a swapped-in exercise do not drive the prescribed one
+    GetLastExerciseLog(ctx context.Context, userID string, programWorkoutExerciseID, exerciseID int) (*models.WorkoutExerciseLog, error)
     
 }
 
@@ -51,15 +70,20 @@ func NewProgramRepository(pool *pgxpool.Pool) ProgramRepository {
     return &programRepository{pool: pool}
 }
 
+// conn joins the transaction carried by ctx, falling back to the pool
+func (r *programRepository) conn(ctx context.Context) DBTX {
+    return connFromContext(ctx, r.pool)
+}
+
 // Implement all the interface methods below...
 func (r *programRepository) GetProgramByID(ctx context.Context, programID int) (*models.Program, error) {
-    query := `SELECT id, name, description, goal, estimated_weeks, created_at 
+    query := `SELECT id, name, description, goal, estimated_weeks, progression_strategy, published_at, created_at 
               FROM programs WHERE id = $1`
     
     var program models.Program
-    err := r.pool.QueryRow(ctx, query, programID).Scan(
+    err := r.conn(ctx).QueryRow(ctx, query, programID).Scan(
         &program.ID, &program.Name, &program.Description, 
-        &program.Goal, &program.EstimatedWeeks, &program.CreatedAt,
+        &program.Goal, &program.EstimatedWeeks, &program.ProgressionStrategy, &program.PublishedAt, &program.CreatedAt,
     )
     if err != nil {
         return nil, err
@@ -68,10 +92,10 @@ func (r *programRepository) GetProgramByID(ctx context.Context, programID int) (
 }
 
 func (r *programRepository) GetProgramsByGoal(ctx context.Context, goal string) ([]*models.Program, error) {
-    query := `SELECT id, name, description, goal, estimated_weeks, created_at 
-              FROM programs WHERE goal = $1 ORDER BY name`
+    query := `SELECT id, name, description, goal, estimated_weeks, progression_strategy, published_at, created_at 
+              FROM programs WHERE goal = $1 AND published_at IS NOT NULL ORDER BY name`
     
-    rows, err := r.pool.Query(ctx, query, goal)
+    rows, err := r.conn(ctx).Query(ctx, query, goal)
     if err != nil {
         return nil, err
     }
@@ -82,7 +106,7 @@ func (r *programRepository) GetProgramsByGoal(ctx context.Context, goal string)
         var program models.Program
         if err := rows.Scan(
             &program.ID, &program.Name, &program.Description,
-            &program.Goal, &program.EstimatedWeeks, &program.CreatedAt,
+            &program.Goal, &program.EstimatedWeeks, &program.ProgressionStrategy, &program.PublishedAt, &program.CreatedAt,
         ); err != nil {
             return nil, err
         }
@@ -92,10 +116,10 @@ func (r *programRepository) GetProgramsByGoal(ctx context.Context, goal string)
 }
 
 func (r *programRepository) GetAllPrograms(ctx context.Context) ([]*models.Program, error) {
-    query := `SELECT id, name, description, goal, estimated_weeks, created_at 
+    query := `SELECT id, name, description, goal, estimated_weeks, progression_strategy, published_at, created_at 
               FROM programs ORDER BY name`
     
-    rows, err := r.pool.Query(ctx, query)
+    rows, err := r.conn(ctx).Query(ctx, query)
     if err != nil {
         return nil, err
     }
@@ -106,7 +130,7 @@ func (r *programRepository) GetAllPrograms(ctx context.Context) ([]*models.Progr
         var program models.Program
         if err := rows.Scan(
             &program.ID, &program.Name, &program.Description,
-            &program.Goal, &program.EstimatedWeeks, &program.CreatedAt,
+            &program.Goal, &program.EstimatedWeeks, &program.ProgressionStrategy, &program.PublishedAt, &program.CreatedAt,
         ); err != nil {
             return nil, err
         }
@@ -115,11 +139,41 @@ func (r *programRepository) GetAllPrograms(ctx context.Context) ([]*models.Progr
     return programs, nil
 }
 
-func (r *programRepository) GetProgramWorkouts(ctx context.Context, programID int) ([]*models.ProgramWorkout, error) {
-    query := `SELECT id, program_id, name, day_of_week, description 
-              FROM program_workouts WHERE program_id = $1 ORDER BY day_of_week`
+func (r *programRepository) GetProgramVersion(ctx context.Context, id int) (*models.ProgramVersion, error) {
+    query := `SELECT id, program_id, COALESCE(version, 0), published_at, created_at
+              FROM program_versions WHERE id = $1`
     
-    rows, err := r.pool.Query(ctx, query, programID)
+    var version models.ProgramVersion
+    err := r.conn(ctx).QueryRow(ctx, query, id).Scan(
+        &version.ID, &version.ProgramID, &version.Version, &version.PublishedAt, &version.CreatedAt,
+    )
+    if err != nil {
+        return nil, err
+    }
+    return &version, nil
+}
+
+// GetLatestProgramVersion returns the program's newest published version
+func (r *programRepository) GetLatestProgramVersion(ctx context.Context, programID int) (*models.ProgramVersion, error) {
+    query := `SELECT id, program_id, version, published_at, created_at
+              FROM program_versions WHERE program_id = $1 AND version IS NOT NULL
+              ORDER BY version DESC LIMIT 1`
+    
+    var version models.ProgramVersion
+    err := r.conn(ctx).QueryRow(ctx, query, programID).Scan(
+        &version.ID, &version.ProgramID, &version.Version, &version.PublishedAt, &version.CreatedAt,
+    )
+    if err != nil {
+        return nil, err
+    }
+    return &version, nil
+}
+
+func (r *programRepository) GetProgramWorkouts(ctx context.Context, programVersionID int) ([]*models.ProgramWorkout, error) {
+    query := `SELECT id, program_id, program_version_id, lineage_id, name, day_of_week, description 
+              FROM program_workouts WHERE program_version_id = $1 ORDER BY day_of_week`
+    
+    rows, err := r.conn(ctx).Query(ctx, query, programVersionID)
     if err != nil {
         return nil, err
     }
@@ -129,7 +183,7 @@ func (r *programRepository) GetProgramWorkouts(ctx context.Context, programID in
     for rows.Next() {
         var workout models.ProgramWorkout
         if err := rows.Scan(
-            &workout.ID, &workout.ProgramID, &workout.Name,
+            &workout.ID, &workout.ProgramID, &workout.ProgramVersionID, &workout.LineageID, &workout.Name,
             &workout.DayOfWeek, &workout.Description,
         ); err != nil {
             return nil, err
@@ -139,13 +193,30 @@ func (r *programRepository) GetProgramWorkouts(ctx context.Context, programID in
     return workouts, nil
 }
 
+func (r *programRepository) GetProgramWorkout(ctx context.Context, id int) (*models.ProgramWorkout, error) {
+    query := `SELECT id, program_id, program_version_id, lineage_id, name, day_of_week, description 
+              FROM program_workouts WHERE id = $1`
+    
+    var workout models.ProgramWorkout
+    err := r.conn(ctx).QueryRow(ctx, query, id).Scan(
+        &workout.ID, &workout.ProgramID, &workout.ProgramVersionID, &workout.LineageID, &workout.Name,
+        &workout.DayOfWeek, &workout.Description,
+    )
+    if err != nil {
+        return nil, err
+    }
+    return &workout, nil
+}
+
 func (r *programRepository) GetProgramWorkoutExercises(ctx context.Context, workoutID int) ([]*models.ProgramWorkoutExercise, error) {
-    query := `SELECT id, program_workout_id, exercise_id, sets, reps, target_rir, 
-                     prescribed_weight, exercise_order, notes
+    query := `SELECT id, program_workout_id, lineage_id, exercise_id, sets, reps, COALESCE(target_rir, 0), 
+                     COALESCE(prescribed_weight, 0), exercise_order, COALESCE(notes, ''),
+                     COALESCE(progression_strategy, ''), COALESCE(rep_range_max, 0),
+                     COALESCE(weight_increment, 0), COALESCE(training_max, 0)
               FROM program_workout_exercises 
               WHERE program_workout_id = $1 ORDER BY exercise_order`
     
-    rows, err := r.pool.Query(ctx, query, workoutID)
+    rows, err := r.conn(ctx).Query(ctx, query, workoutID)
     if err != nil {
         return nil, err
     }
@@ -155,9 +226,11 @@ func (r *programRepository) GetProgramWorkoutExercises(ctx context.Context, work
     for rows.Next() {
         var exercise models.ProgramWorkoutExercise
         if err := rows.Scan(
-            &exercise.ID, &exercise.ProgramWorkoutID, &exercise.ExerciseID,
+            &exercise.ID, &exercise.ProgramWorkoutID, &exercise.LineageID, &exercise.ExerciseID,
             &exercise.Sets, &exercise.Reps, &exercise.TargetRIR,
             &exercise.PrescribedWeight, &exercise.ExerciseOrder, &exercise.Notes,
+            &exercise.ProgressionStrategy, &exercise.RepRangeMax,
+            &exercise.WeightIncrement, &exercise.TrainingMax,
         ); err != nil {
             return nil, err
         }
@@ -167,15 +240,19 @@ func (r *programRepository) GetProgramWorkoutExercises(ctx context.Context, work
 }
 
 func (r *programRepository) GetProgramWorkoutExercise(ctx context.Context, id int) (*models.ProgramWorkoutExercise, error) {
-    query := `SELECT id, program_workout_id, exercise_id, sets, reps, target_rir, 
-                     prescribed_weight, exercise_order, notes
+    query := `SELECT id, program_workout_id, lineage_id, exercise_id, sets, reps, COALESCE(target_rir, 0), 
+                     COALESCE(prescribed_weight, 0), exercise_order, COALESCE(notes, ''),
+                     COALESCE(progression_strategy, ''), COALESCE(rep_range_max, 0),
+                     COALESCE(weight_increment, 0), COALESCE(training_max, 0)
               FROM program_workout_exercises WHERE id = $1`
     
     var exercise models.ProgramWorkoutExercise
-    err := r.pool.QueryRow(ctx, query, id).Scan(
-        &exercise.ID, &exercise.ProgramWorkoutID, &exercise.ExerciseID,
+    err := r.conn(ctx).QueryRow(ctx, query, id).Scan(
+        &exercise.ID, &exercise.ProgramWorkoutID, &exercise.LineageID, &exercise.ExerciseID,
         &exercise.Sets, &exercise.Reps, &exercise.TargetRIR,
         &exercise.PrescribedWeight, &exercise.ExerciseOrder, &exercise.Notes,
+            &exercise.ProgressionStrategy, &exercise.RepRangeMax,
+            &exercise.WeightIncrement, &exercise.TrainingMax,
     )
     if err != nil {
         return nil, err
@@ -183,61 +260,35 @@ func (r *programRepository) GetProgramWorkoutExercise(ctx context.Context, id in
     return &exercise, nil
 }
 
-func (r *programRepository) GetAllExercises(ctx context.Context) ([]*models.Exercise, error) {
-    query := `SELECT id, name, description, primary_muscle_group, equipment, created_at 
-              FROM exercises ORDER BY name`
-    
-    rows, err := r.pool.Query(ctx, query)
-    if err != nil {
-        return nil, err
-    }
-    defer rows.Close()
-    
-    var exercises []*models.Exercise
-    for rows.Next() {
-        var exercise models.Exercise
-        if err := rows.Scan(
-            &exercise.ID, &exercise.Name, &exercise.Description,
-            &exercise.PrimaryMuscleGroup, &exercise.Equipment, &exercise.CreatedAt,
-        ); err != nil {
-            return nil, err
-        }
-        exercises = append(exercises, &exercise)
-    }
-    return exercises, nil
-}
-
 func (r *programRepository) GetExerciseByID(ctx context.Context, id int) (*models.Exercise, error) {
-    query := `SELECT id, name, description, primary_muscle_group, equipment, created_at 
-              FROM exercises WHERE id = $1`
+    query := `SELECT ` + exerciseColumns + ` FROM exercises e WHERE e.id = $1`
     
-    var exercise models.Exercise
-    err := r.pool.QueryRow(ctx, query, id).Scan(
-        &exercise.ID, &exercise.Name, &exercise.Description,
-        &exercise.PrimaryMuscleGroup, &exercise.Equipment, &exercise.CreatedAt,
-    )
-    if err != nil {
-        return nil, err
-    }
-    return &exercise, nil
+    return scanExercise(r.conn(ctx).QueryRow(ctx, query, id))
 }
 
+// latestProgramVersionSQL picks the newest published version of the program in $2, for
+// enrollments that do not name a version
+const latestProgramVersionSQL = `(SELECT id FROM program_versions
+              WHERE program_id = $2 AND version IS NOT NULL ORDER BY version DESC LIMIT 1)`
+
+// CreateUserProgram enrolls the user in the given version, or the latest when none is set
 func (r *programRepository) CreateUserProgram(ctx context.Context, userProgram *models.UserProgram) error {
-    query := `INSERT INTO user_programs (user_id, program_id, start_date, is_active) 
-              VALUES ($1, $2, $3, $4) RETURNING id, created_at`
+    query := `INSERT INTO user_programs (user_id, program_id, program_version_id, start_date, is_active) 
+              VALUES ($1, $2, COALESCE(NULLIF($3, 0), ` + latestProgramVersionSQL + `), $4, $5)
+              RETURNING id, program_version_id, created_at`
     
-    return r.pool.QueryRow(ctx, query, 
-        userProgram.UserID, userProgram.ProgramID, userProgram.StartDate, userProgram.IsActive,
-    ).Scan(&userProgram.ID, &userProgram.CreatedAt)
+    return r.conn(ctx).QueryRow(ctx, query, 
+        userProgram.UserID, userProgram.ProgramID, userProgram.ProgramVersionID, userProgram.StartDate, userProgram.IsActive,
+    ).Scan(&userProgram.ID, &userProgram.ProgramVersionID, &userProgram.CreatedAt)
 }
 
 func (r *programRepository) GetUserActiveProgram(ctx context.Context, userID string) (*models.UserProgram, error) {
-    query := `SELECT id, user_id, program_id, start_date, is_active, created_at 
+    query := `SELECT id, user_id, program_id, program_version_id, start_date, is_active, created_at 
               FROM user_programs WHERE user_id = $1 AND is_active = true`
     
     var userProgram models.UserProgram
-    err := r.pool.QueryRow(ctx, query, userID).Scan(
-        &userProgram.ID, &userProgram.UserID, &userProgram.ProgramID,
+    err := r.conn(ctx).QueryRow(ctx, query, userID).Scan(
+        &userProgram.ID, &userProgram.UserID, &userProgram.ProgramID, &userProgram.ProgramVersionID,
         &userProgram.StartDate, &userProgram.IsActive, &userProgram.CreatedAt,
     )
     if err != nil {
@@ -250,12 +301,12 @@ func (r *programRepository) GetUserActiveProgram(ctx context.Context, userID str
 }
 
 func (r *programRepository) GetUserProgramByID(ctx context.Context, id int) (*models.UserProgram, error) {
-    query := `SELECT id, user_id, program_id, start_date, is_active, created_at 
+    query := `SELECT id, user_id, program_id, program_version_id, start_date, is_active, created_at 
               FROM user_programs WHERE id = $1`
     
     var userProgram models.UserProgram
-    err := r.pool.QueryRow(ctx, query, id).Scan(
-        &userProgram.ID, &userProgram.UserID, &userProgram.ProgramID,
+    err := r.conn(ctx).QueryRow(ctx, query, id).Scan(
+        &userProgram.ID, &userProgram.UserID, &userProgram.ProgramID, &userProgram.ProgramVersionID,
         &userProgram.StartDate, &userProgram.IsActive, &userProgram.CreatedAt,
     )
     if err != nil {
@@ -265,104 +316,270 @@ func (r *programRepository) GetUserProgramByID(ctx context.Context, id int) (*mo
 }
 
 func (r *programRepository) UpdateUserProgram(ctx context.Context, userProgram *models.UserProgram) error {
-    query := `UPDATE user_programs SET is_active = $1 WHERE id = $2`
+    query := `UPDATE user_programs SET is_active = $1, program_version_id = $3 WHERE id = $2`
     
-    result, err := r.pool.Exec(ctx, query, userProgram.IsActive, userProgram.ID)
+    result, err := r.conn(ctx).Exec(ctx, query, userProgram.IsActive, userProgram.ID, userProgram.ProgramVersionID)
     if err != nil {
         return err
     }
     
     rows := result.RowsAffected()
     if rows == 0 {
-        return fmt.Errorf("user program not found")
+        return fmt.Errorf("user program %w", ErrNotFound)
     }
     return nil
 }
 
+// workoutSessionColumns is the column list scanned by scanWorkoutSession, qualified for the w alias
+const workoutSessionColumns = `w.id, w.user_program_id, w.program_workout_id, w.status, w.started_at,
+              w.completed_at, w.abandoned_at, w.duration_seconds, COALESCE(w.notes, ''), w.created_at`
+
+func scanWorkoutSession(row pgx.Row) (*models.WorkoutSession, error) {
+    var session models.WorkoutSession
+    err := row.Scan(
+        &session.ID, &session.UserProgramID, &session.ProgramWorkoutID, &session.Status, &session.StartedAt,
+        &session.CompletedAt, &session.AbandonedAt, &session.DurationSeconds, &session.Notes, &session.CreatedAt,
+    )
+    if err != nil {
+        return nil, err
+    }
+    return &session, nil
+}
+
+func (r *programRepository) queryWorkoutSessions(ctx context.Context, query string, args ...interface{}) ([]*models.WorkoutSession, error) {
+    rows, err := r.conn(ctx).Query(ctx, query, args...)
+    if err != nil {
+        return nil, err
+    }
+    defer rows.Close()
+    
+    var sessions []*models.WorkoutSession
+    for rows.Next() {
+        session, err := scanWorkoutSession(rows)
+        if err != nil {
+            return nil, err
+        }
+        sessions = append(sessions, session)
+    }
+    return sessions, rows.Err()
+}
+
+// CreateWorkoutSession opens a new in-progress session
 func (r *programRepository) CreateWorkoutSession(ctx context.Context, session *models.WorkoutSession) (int, error) {
-    query := `INSERT INTO workouts (user_program_id, program_workout_id, completed_date, notes) 
-              VALUES ($1, $2, $3, $4) RETURNING id, created_at`
+    query := `INSERT INTO workouts (user_program_id, program_workout_id, notes) 
+              VALUES ($1, $2, $3) RETURNING id, status, started_at, created_at`
     
-    err := r.pool.QueryRow(ctx, query,
-        session.UserProgramID, session.ProgramWorkoutID, session.CompletedDate, session.Notes,
-    ).Scan(&session.ID, &session.CreatedAt)
+    err := r.conn(ctx).QueryRow(ctx, query,
+        session.UserProgramID, session.ProgramWorkoutID, session.Notes,
+    ).Scan(&session.ID, &session.Status, &session.StartedAt, &session.CreatedAt)
     
     return session.ID, err
 }
 
 func (r *programRepository) GetWorkoutSessionByID(ctx context.Context, id int) (*models.WorkoutSession, error) {
-    query := `SELECT id, user_program_id, program_workout_id, completed_date, notes, created_at 
-              FROM workouts WHERE id = $1`
+    query := `SELECT ` + workoutSessionColumns + ` FROM workouts w WHERE w.id = $1`
+    return scanWorkoutSession(r.conn(ctx).QueryRow(ctx, query, id))
+}
+
+// GetActiveWorkoutSession returns the user's in-progress session, or nil when there is none
+func (r *programRepository) GetActiveWorkoutSession(ctx context.Context, userID string) (*models.WorkoutSession, error) {
+    query := `SELECT ` + workoutSessionColumns + `
+              FROM workouts w
+              JOIN user_programs up ON w.user_program_id = up.id
+              WHERE up.user_id = $1 AND w.status = 'in_progress'
+              ORDER BY w.started_at DESC LIMIT 1`
     
-    var session models.WorkoutSession
-    err := r.pool.QueryRow(ctx, query, id).Scan(
-        &session.ID, &session.UserProgramID, &session.ProgramWorkoutID,
-        &session.CompletedDate, &session.Notes, &session.CreatedAt,
-    )
+    session, err := scanWorkoutSession(r.conn(ctx).QueryRow(ctx, query, userID))
+    if errors.Is(err, ErrNotFound) {
+        return nil, nil
+    }
+    return session, err
+}
+
+// CompleteWorkoutSession marks an in-progress session completed and records its duration.
+// It returns ErrNotFound when the session does not exist or has already ended.
+func (r *programRepository) CompleteWorkoutSession(ctx context.Context, id int, completedAt time.Time) (*models.WorkoutSession, error) {
+    query := `UPDATE workouts w SET status = 'completed', completed_at = $2,
+                  duration_seconds = GREATEST(0, EXTRACT(EPOCH FROM ($2 - w.started_at)))::INTEGER
+              WHERE w.id = $1 AND w.status = 'in_progress'
+              RETURNING ` + workoutSessionColumns
+    return scanWorkoutSession(r.conn(ctx).QueryRow(ctx, query, id, completedAt))
+}
+
+// AbandonWorkoutSession marks an in-progress session abandoned.
+// It returns ErrNotFound when the session does not exist or has already ended.
+func (r *programRepository) AbandonWorkoutSession(ctx context.Context, id int, abandonedAt time.Time) (*models.WorkoutSession, error) {
+    query := `UPDATE workouts w SET status = 'abandoned', abandoned_at = $2
+              WHERE w.id = $1 AND w.status = 'in_progress'
+              RETURNING ` + workoutSessionColumns
+    return scanWorkoutSession(r.conn(ctx).QueryRow(ctx, query, id, abandonedAt))
+}
+
+// AbandonStaleWorkoutSessions abandons every in-progress session started before the cutoff
+func (r *programRepository) AbandonStaleWorkoutSessions(ctx context.Context, startedBefore time.Time) (int64, error) {
+    query := `UPDATE workouts SET status = 'abandoned', abandoned_at = CURRENT_TIMESTAMP
+              WHERE status = 'in_progress' AND started_at < $1`
+    
+    result, err := r.conn(ctx).Exec(ctx, query, startedBefore)
     if err != nil {
-        return nil, err
+        return 0, err
     }
-    return &session, nil
+    return result.RowsAffected(), nil
 }
 
+// GetWorkoutSessionsByUserProgram returns the most recently completed sessions of a user program
 func (r *programRepository) GetWorkoutSessionsByUserProgram(ctx context.Context, userProgramID int, limit int) ([]*models.WorkoutSession, error) {
-    query := `SELECT id, user_program_id, program_workout_id, completed_date, notes, created_at 
-              FROM workouts WHERE user_program_id = $1 
-              ORDER BY completed_date DESC LIMIT $2`
-    
-    rows, err := r.pool.Query(ctx, query, userProgramID, limit)
+    query := `SELECT ` + workoutSessionColumns + `
+              FROM workouts w WHERE w.user_program_id = $1 AND w.status = 'completed'
+              ORDER BY w.completed_at DESC LIMIT $2`
+    return r.queryWorkoutSessions(ctx, query, userProgramID, limit)
+}
+
+// GetWorkoutSessionsSince returns the sessions of a user program completed from a point in time onwards
+func (r *programRepository) GetWorkoutSessionsSince(ctx context.Context, userProgramID int, since time.Time) ([]*models.WorkoutSession, error) {
+    query := `SELECT ` + workoutSessionColumns + `
+              FROM workouts w WHERE w.user_program_id = $1 AND w.status = 'completed' AND w.completed_at >= $2
+              ORDER BY w.completed_at`
+    return r.queryWorkoutSessions(ctx, query, userProgramID, since)
+}
+
+// sameWorkoutLineageSQL matches w.program_workout_id against every version of workout $2
+const sameWorkoutLineageSQL = `w.program_workout_id IN (
+                  SELECT copy.id FROM program_workouts copy
+                  JOIN program_workouts pw ON pw.lineage_id = copy.lineage_id
+                  WHERE pw.id = $2)`
+
+func (r *programRepository) GetLastWorkoutSessionByType(ctx context.Context, userID string, programWorkoutID int) (*models.WorkoutSession, error) {
+    query := `SELECT ` + workoutSessionColumns + `
+              FROM workouts w
+              JOIN user_programs up ON w.user_program_id = up.id
+              WHERE up.user_id = $1 AND ` + sameWorkoutLineageSQL + ` AND w.status = 'completed'
+              ORDER BY w.completed_at DESC LIMIT 1`
+    return scanWorkoutSession(r.conn(ctx).QueryRow(ctx, query, userID, programWorkoutID))
+}
+
+// CountWorkoutSessionsByType counts how many sessions of a program workout were completed in
+// one enrollment, so re-enrolling in a program starts the count over
+func (r *programRepository) CountWorkoutSessionsByType(ctx context.Context, userProgramID int, programWorkoutID int) (int, error) {
+    query := `SELECT COUNT(*)
+              FROM workouts w
+              WHERE w.user_program_id = $1 AND ` + sameWorkoutLineageSQL + ` AND w.status = 'completed'`
+
+    var count int
+    err := r.conn(ctx).QueryRow(ctx, query, userProgramID, programWorkoutID).Scan(&count)
+    return count, err
+}
+
+// GetUserPrograms returns every program the user has enrolled in, oldest first
+func (r *programRepository) GetUserPrograms(ctx context.Context, userID string) ([]*models.UserProgram, error) {
+    query := `SELECT id, user_id, program_id, program_version_id, start_date, is_active, created_at
+              FROM user_programs WHERE user_id = $1 ORDER BY created_at, id`
+
+    rows, err := r.conn(ctx).Query(ctx, query, userID)
     if err != nil {
         return nil, err
     }
     defer rows.Close()
-    
-    var sessions []*models.WorkoutSession
+
+    programs := []*models.UserProgram{}
     for rows.Next() {
-        var session models.WorkoutSession
+        var program models.UserProgram
         if err := rows.Scan(
-            &session.ID, &session.UserProgramID, &session.ProgramWorkoutID,
-            &session.CompletedDate, &session.Notes, &session.CreatedAt,
+            &program.ID, &program.UserID, &program.ProgramID, &program.ProgramVersionID, &program.StartDate, &program.IsActive, &program.CreatedAt,
         ); err != nil {
             return nil, err
         }
-        sessions = append(sessions, &session)
+        programs = append(programs, &program)
     }
-    return sessions, nil
+    return programs, rows.Err()
 }
 
-func (r *programRepository) GetLastWorkoutSessionByType(ctx context.Context, userID string, programWorkoutID int) (*models.WorkoutSession, error) {
-    query := `SELECT w.id, w.user_program_id, w.program_workout_id, w.completed_date, w.notes, w.created_at
+// GetUserWorkoutHistory returns every session the user has started, across all their programs,
+// with the exercise logs and sets recorded in each
+func (r *programRepository) GetUserWorkoutHistory(ctx context.Context, userID string) ([]*models.WorkoutSession, error) {
+    sessions, err := r.queryWorkoutSessions(ctx, `SELECT `+workoutSessionColumns+`
               FROM workouts w
               JOIN user_programs up ON w.user_program_id = up.id
-              WHERE up.user_id = $1 AND w.program_workout_id = $2
-              ORDER BY w.completed_date DESC LIMIT 1`
-    
-    var session models.WorkoutSession
-    err := r.pool.QueryRow(ctx, query, userID, programWorkoutID).Scan(
-        &session.ID, &session.UserProgramID, &session.ProgramWorkoutID,
-        &session.CompletedDate, &session.Notes, &session.CreatedAt,
-    )
+              WHERE up.user_id = $1
+              ORDER BY w.started_at, w.id`, userID)
     if err != nil {
         return nil, err
     }
-    return &session, nil
+    if len(sessions) == 0 {
+        return []*models.WorkoutSession{}, nil
+    }
+
+    byID := make(map[int]*models.WorkoutSession, len(sessions))
+    ids := make([]int, len(sessions))
+    for i, session := range sessions {
+        session.Exercises = []*models.WorkoutExerciseLog{}
+        byID[session.ID] = session
+        ids[i] = session.ID
+    }
+
+    query := `SELECT id, workout_id, program_workout_exercise_id, exercise_id, actual_reps, actual_rir, created_at
+              FROM workout_exercises WHERE workout_id = ANY($1) ORDER BY workout_id, id`
+
+    rows, err := r.conn(ctx).Query(ctx, query, ids)
+    if err != nil {
+        return nil, err
+    }
+    defer rows.Close()
+
+    var logs []*models.WorkoutExerciseLog
+    for rows.Next() {
+        var log models.WorkoutExerciseLog
+        if err := rows.Scan(
+            &log.ID, &log.WorkoutID, &log.ProgramWorkoutExerciseID, &log.ExerciseID,
+            &log.ActualReps, &log.ActualRIR, &log.CreatedAt,
+        ); err != nil {
+            return nil, err
+        }
+        logs = append(logs, &log)
+        byID[log.WorkoutID].Exercises = append(byID[log.WorkoutID].Exercises, &log)
+    }
+    if err := rows.Err(); err != nil {
+        return nil, err
+    }
+
+    if err := r.attachSets(ctx, logs); err != nil {
+        return nil, err
+    }
+    return sessions, nil
 }
 
 func (r *programRepository) CreateWorkoutExerciseLog(ctx context.Context, log *models.WorkoutExerciseLog) error {
-    query := `INSERT INTO workout_exercises (workout_id, program_workout_exercise_id, actual_reps, actual_rir) 
-              VALUES ($1, $2, $3, $4) RETURNING id, created_at`
+    query := `INSERT INTO workout_exercises (workout_id, program_workout_exercise_id, exercise_id, actual_reps, actual_rir) 
+              VALUES ($1, $2, $3, $4, $5) RETURNING id, created_at`
     
-    return r.pool.QueryRow(ctx, query,
-        log.WorkoutID, log.ProgramWorkoutExerciseID,
+    err := r.conn(ctx).QueryRow(ctx, query,
+        log.WorkoutID, log.ProgramWorkoutExerciseID, log.ExerciseID,
         log.ActualReps, log.ActualRIR,
     ).Scan(&log.ID, &log.CreatedAt)
+    if err != nil {
+        return err
+    }
+
+    setQuery := `INSERT INTO workout_exercise_sets (workout_exercise_id, set_number, weight, unit, reps, rir, rpe, set_type, performed_at)
+                 VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9) RETURNING id, created_at`
+
+    for _, set := range log.Sets {
+        set.WorkoutExerciseID = log.ID
+        if err := r.conn(ctx).QueryRow(ctx, setQuery,
+            set.WorkoutExerciseID, set.SetNumber, set.Weight, set.Unit,
+            set.Reps, set.RIR, set.RPE, set.SetType, set.PerformedAt,
+        ).Scan(&set.ID, &set.CreatedAt); err != nil {
+            return err
+        }
+    }
+    return nil
 }
 
 func (r *programRepository) GetExerciseLogsByWorkout(ctx context.Context, workoutID int) ([]*models.WorkoutExerciseLog, error) {
-    query := `SELECT id, workout_id, program_workout_exercise_id, actual_reps, actual_rir, created_at
+    query := `SELECT id, workout_id, program_workout_exercise_id, exercise_id, actual_reps, actual_rir, created_at
               FROM workout_exercises WHERE workout_id = $1 ORDER BY id`
     
-    rows, err := r.pool.Query(ctx, query, workoutID)
+    rows, err := r.conn(ctx).Query(ctx, query, workoutID)
     if err != nil {
         return nil, err
     }
@@ -372,31 +589,90 @@ func (r *programRepository) GetExerciseLogsByWorkout(ctx context.Context, workou
     for rows.Next() {
         var log models.WorkoutExerciseLog
         if err := rows.Scan(
-            &log.ID, &log.WorkoutID, &log.ProgramWorkoutExerciseID,
+            &log.ID, &log.WorkoutID, &log.ProgramWorkoutExerciseID, &log.ExerciseID,
             &log.ActualReps, &log.ActualRIR, &log.CreatedAt,
         ); err != nil {
             return nil, err
         }
         logs = append(logs, &log)
     }
+    if err := rows.Err(); err != nil {
+        return nil, err
+    }
+
+    if err := r.attachSets(ctx, logs); err != nil {
+        return nil, err
+    }
     return logs, nil
 }
 
-func (r *programRepository) GetLastExerciseLog(ctx context.Context, userID string, programWorkoutExerciseID int) (*models.WorkoutExerciseLog, error) {
-    query := `SELECT we.id, we.workout_id, we.program_workout_exercise_id, we.actual_reps, we.actual_rir, we.created_at
+func (r *programRepository) GetLastExerciseLog(ctx context.Context, userID string, programWorkoutExerciseID, exerciseID int) (*models.WorkoutExerciseLog, error) {
+    query := `SELECT we.id, we.workout_id, we.program_workout_exercise_id, we.exercise_id, we.actual_reps, we.actual_rir, we.created_at
               FROM workout_exercises we
               JOIN workouts w ON we.workout_id = w.id
               JOIN user_programs up ON w.user_program_id = up.id
-              WHERE up.user_id = $1 AND we.program_workout_exercise_id = $2
-              ORDER BY w.completed_date DESC LIMIT 1`
+              WHERE up.user_id = $1 AND w.status = 'completed' AND we.program_workout_exercise_id IN (
+                  SELECT copy.id FROM program_workout_exercises copy
+                  JOIN program_workout_exercises pwe ON pwe.lineage_id = copy.lineage_id
+                  WHERE pwe.id = $2)
+                AND we.exercise_id = $3
+              ORDER BY w.completed_at DESC LIMIT 1`
     
     var log models.WorkoutExerciseLog
-    err := r.pool.QueryRow(ctx, query, userID, programWorkoutExerciseID).Scan(
-        &log.ID, &log.WorkoutID, &log.ProgramWorkoutExerciseID,
+    err := r.conn(ctx).QueryRow(ctx, query, userID, programWorkoutExerciseID, exerciseID).Scan(
+        &log.ID, &log.WorkoutID, &log.ProgramWorkoutExerciseID, &log.ExerciseID,
         &log.ActualReps, &log.ActualRIR, &log.CreatedAt,
     )
+    if errors.Is(err, ErrNotFound) {
+        // The exercise has never been logged by this user
+        return nil, nil
+    }
     if err != nil {
         return nil, err
     }
+
+    if err := r.attachSets(ctx, []*models.WorkoutExerciseLog{&log}); err != nil {
+        return nil, err
+    }
     return &log, nil
 }
+
+// attachSets loads the per-set records for the given exercise logs in a single query
+func (r *programRepository) attachSets(ctx context.Context, logs []*models.WorkoutExerciseLog) error {
+    if len(logs) == 0 {
+        return nil
+    }
+
+    byID := make(map[int]*models.WorkoutExerciseLog, len(logs))
+    ids := make([]int, len(logs))
+    for i, log := range logs {
+        log.Sets = []*models.WorkoutSetLog{}
+        byID[log.ID] = log
+        ids[i] = log.ID
+    }
+
+    query := `SELECT id, workout_exercise_id, set_number, weight, unit, reps, rir, rpe, set_type, performed_at, created_at
+              FROM workout_exercise_sets
+              WHERE workout_exercise_id = ANY($1)
+              ORDER BY workout_exercise_id, set_number`
+
+    rows, err := r.conn(ctx).Query(ctx, query, ids)
+    if err != nil {
+        return err
+    }
+    defer rows.Close()
+
+    for rows.Next() {
+        var set models.WorkoutSetLog
+        if err := rows.Scan(
+            &set.ID, &set.WorkoutExerciseID, &set.SetNumber, &set.Weight, &set.Unit,
+            &set.Reps, &set.RIR, &set.RPE, &set.SetType, &set.PerformedAt, &set.CreatedAt,
+        ); err != nil {
+            return err
+        }
+        if log, ok := byID[set.WorkoutExerciseID]; ok {
+            log.Sets = append(log.Sets, &set)
+        }
+    }
+    return rows.Err()
+}
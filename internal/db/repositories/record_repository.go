@@ -0,0 +1,169 @@
+package repositories
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+	"yoked_backend/internal/models"
+)
+
+type RecordRepository interface {
+	CreatePersonalRecord(ctx context.Context, record *models.PersonalRecord) error
+	GetBestEstimatedOneRepMax(ctx context.Context, userID string, exerciseID int, formula string) (float64, error)
+	GetBestRepMaxes(ctx context.Context, userID string, exerciseID int) (map[int]float64, error)
+	GetCurrentRecordsByUser(ctx context.Context, userID string) ([]*models.PersonalRecord, error)
+	GetRecordHistoryByExercise(ctx context.Context, userID string, exerciseID int) ([]*models.PersonalRecord, error)
+	GetRecordHistoryByUser(ctx context.Context, userID string) ([]*models.PersonalRecord, error)
+}
+
+type recordRepository struct {
+	db *pgxpool.Pool
+}
+
+func NewRecordRepository(db *pgxpool.Pool) RecordRepository {
+	return &recordRepository{db: db}
+}
+
+// conn returns the querier for ctx, see TxManager
+func (r *recordRepository) conn(ctx context.Context) DBTX {
+	return connFromContext(ctx, r.db)
+}
+
+const personalRecordColumns = `id, user_id, exercise_id, record_type, reps, weight, unit, weight_kg,
+		       estimated_one_rep_max, formula, workout_id, workout_exercise_set_id, achieved_at, created_at`
+
+// CreatePersonalRecord stores a newly achieved personal record
+func (r *recordRepository) CreatePersonalRecord(ctx context.Context, record *models.PersonalRecord) error {
+	query := `
+		INSERT INTO personal_records (user_id, exercise_id, record_type, reps, weight, unit, weight_kg,
+		                              estimated_one_rep_max, formula, workout_id, workout_exercise_set_id, achieved_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12)
+		RETURNING id, created_at
+	`
+
+	err := r.conn(ctx).QueryRow(ctx, query,
+		record.UserID, record.ExerciseID, record.RecordType, record.Reps, record.Weight, record.Unit,
+		record.WeightKg, record.EstimatedOneRepMax, record.Formula, record.WorkoutID, record.WorkoutSetID,
+		record.AchievedAt,
+	).Scan(&record.ID, &record.CreatedAt)
+
+	if err != nil {
+		return fmt.Errorf("failed to create personal record: %w", err)
+	}
+
+	return nil
+}
+
+// GetBestEstimatedOneRepMax returns the user's best e1RM for an exercise under a formula, or 0 if none
+func (r *recordRepository) GetBestEstimatedOneRepMax(ctx context.Context, userID string, exerciseID int, formula string) (float64, error) {
+	query := `
+		SELECT COALESCE(MAX(estimated_one_rep_max), 0)
+		FROM personal_records
+		WHERE user_id = $1 AND exercise_id = $2 AND record_type = 'e1rm' AND formula = $3
+	`
+
+	var best float64
+	if err := r.conn(ctx).QueryRow(ctx, query, userID, exerciseID, formula).Scan(&best); err != nil {
+		return 0, fmt.Errorf("failed to get best e1RM: %w", err)
+	}
+
+	return best, nil
+}
+
+// GetBestRepMaxes returns the heaviest load in kilograms lifted for each rep count
+func (r *recordRepository) GetBestRepMaxes(ctx context.Context, userID string, exerciseID int) (map[int]float64, error) {
+	query := `
+		SELECT reps, MAX(weight_kg)
+		FROM personal_records
+		WHERE user_id = $1 AND exercise_id = $2 AND record_type = 'rep_max'
+		GROUP BY reps
+	`
+
+	rows, err := r.conn(ctx).Query(ctx, query, userID, exerciseID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get rep maxes: %w", err)
+	}
+	defer rows.Close()
+
+	best := make(map[int]float64)
+	for rows.Next() {
+		var reps int
+		var weight float64
+		if err := rows.Scan(&reps, &weight); err != nil {
+			return nil, fmt.Errorf("failed to scan rep max: %w", err)
+		}
+		best[reps] = weight
+	}
+
+	return best, rows.Err()
+}
+
+// GetCurrentRecordsByUser returns the standing record for every exercise, type and rep count
+func (r *recordRepository) GetCurrentRecordsByUser(ctx context.Context, userID string) ([]*models.PersonalRecord, error) {
+	query := `
+		SELECT ` + personalRecordColumns + `
+		FROM (
+			SELECT DISTINCT ON (exercise_id, record_type, formula, rep_bucket) *
+			FROM (
+				-- e1RM records compete across rep counts, rep maxes only within one
+				SELECT *, CASE WHEN record_type = 'e1rm' THEN 0 ELSE reps END AS rep_bucket
+				FROM personal_records
+				WHERE user_id = $1
+			) bucketed
+			ORDER BY exercise_id, record_type, formula, rep_bucket,
+			         CASE WHEN record_type = 'e1rm' THEN estimated_one_rep_max ELSE weight_kg END DESC,
+			         achieved_at
+		) current
+		ORDER BY exercise_id, record_type, reps
+	`
+
+	return r.queryRecords(ctx, query, userID)
+}
+
+// GetRecordHistoryByExercise returns every record the user has set on an exercise, newest first
+func (r *recordRepository) GetRecordHistoryByExercise(ctx context.Context, userID string, exerciseID int) ([]*models.PersonalRecord, error) {
+	query := `
+		SELECT ` + personalRecordColumns + `
+		FROM personal_records
+		WHERE user_id = $1 AND exercise_id = $2
+		ORDER BY achieved_at DESC, id DESC
+	`
+
+	return r.queryRecords(ctx, query, userID, exerciseID)
+}
+
+// GetRecordHistoryByUser returns every record the user has set, oldest first
+func (r *recordRepository) GetRecordHistoryByUser(ctx context.Context, userID string) ([]*models.PersonalRecord, error) {
+	query := `
+		SELECT ` + personalRecordColumns + `
+		FROM personal_records
+		WHERE user_id = $1
+		ORDER BY achieved_at, id
+	`
+
+	return r.queryRecords(ctx, query, userID)
+}
+
+func (r *recordRepository) queryRecords(ctx context.Context, query string, args ...interface{}) ([]*models.PersonalRecord, error) {
+	rows, err := r.conn(ctx).Query(ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get personal records: %w", err)
+	}
+	defer rows.Close()
+
+	records := []*models.PersonalRecord{}
+	for rows.Next() {
+		var record models.PersonalRecord
+		if err := rows.Scan(
+			&record.ID, &record.UserID, &record.ExerciseID, &record.RecordType, &record.Reps,
+			&record.Weight, &record.Unit, &record.WeightKg, &record.EstimatedOneRepMax, &record.Formula,
+			&record.WorkoutID, &record.WorkoutSetID, &record.AchievedAt, &record.CreatedAt,
+		); err != nil {
+			return nil, fmt.Errorf("failed to scan personal record: %w", err)
+		}
+		records = append(records, &record)
+	}
+
+	return records, rows.Err()
+}
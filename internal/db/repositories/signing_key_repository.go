@@ -0,0 +1,91 @@
+package repositories
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+	"yoked_backend/internal/models"
+)
+
+type SigningKeyRepository interface {
+	CreateSigningKeyIfStale(ctx context.Context, key *models.SigningKey, newerThan time.Time) (bool, error)
+	GetSigningKeys(ctx context.Context) ([]*models.SigningKey, error)
+	DeleteSigningKeys(ctx context.Context, kids []string) error
+}
+
+type signingKeyRepository struct {
+	db *pgxpool.Pool
+}
+
+func NewSigningKeyRepository(db *pgxpool.Pool) SigningKeyRepository {
+	return &signingKeyRepository{db: db}
+}
+
+func (r *signingKeyRepository) conn(ctx context.Context) DBTX {
+	return connFromContext(ctx, r.db)
+}
+
+// CreateSigningKeyIfStale stores key unless some key was created after newerThan, so instances
+// rotating at the same moment rarely both add one. It reports whether the key was stored.
+func (r *signingKeyRepository) CreateSigningKeyIfStale(ctx context.Context, key *models.SigningKey, newerThan time.Time) (bool, error) {
+	query := `
+		INSERT INTO signing_keys (kid, algorithm, private_key, public_key)
+		SELECT $1, $2, $3, $4
+		WHERE NOT EXISTS (SELECT 1 FROM signing_keys WHERE created_at > $5)
+		RETURNING created_at
+	`
+
+	rows, err := r.conn(ctx).Query(ctx, query, key.KID, key.Algorithm, key.PrivateKey, key.PublicKey, newerThan)
+	if err != nil {
+		return false, fmt.Errorf("failed to create signing key: %w", err)
+	}
+	defer rows.Close()
+
+	created := false
+	for rows.Next() {
+		if err := rows.Scan(&key.CreatedAt); err != nil {
+			return false, fmt.Errorf("failed to create signing key: %w", err)
+		}
+		created = true
+	}
+	if err := rows.Err(); err != nil {
+		return false, fmt.Errorf("failed to create signing key: %w", err)
+	}
+	return created, nil
+}
+
+// GetSigningKeys returns every stored key, oldest first
+func (r *signingKeyRepository) GetSigningKeys(ctx context.Context) ([]*models.SigningKey, error) {
+	rows, err := r.conn(ctx).Query(ctx, `
+		SELECT kid, algorithm, private_key, public_key, created_at
+		FROM signing_keys
+		ORDER BY created_at, kid
+	`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get signing keys: %w", err)
+	}
+	defer rows.Close()
+
+	var keys []*models.SigningKey
+	for rows.Next() {
+		var key models.SigningKey
+		if err := rows.Scan(&key.KID, &key.Algorithm, &key.PrivateKey, &key.PublicKey, &key.CreatedAt); err != nil {
+			return nil, fmt.Errorf("failed to scan signing key: %w", err)
+		}
+		keys = append(keys, &key)
+	}
+	return keys, rows.Err()
+}
+
+// DeleteSigningKeys removes keys whose verification grace period is over
+func (r *signingKeyRepository) DeleteSigningKeys(ctx context.Context, kids []string) error {
+	if len(kids) == 0 {
+		return nil
+	}
+	if _, err := r.conn(ctx).Exec(ctx, `DELETE FROM signing_keys WHERE kid = ANY($1)`, kids); err != nil {
+		return fmt.Errorf("failed to delete signing keys: %w", err)
+	}
+	return nil
+}
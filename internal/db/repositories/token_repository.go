@@ -0,0 +1,295 @@
+package repositories
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+	"yoked_backend/internal/models"
+)
+
+type TokenRepository interface {
+	CreateRefreshToken(ctx context.Context, token *models.RefreshToken) error
+	GetRefreshTokenByHash(ctx context.Context, tokenHash string) (*models.RefreshToken, error)
+	RotateRefreshToken(ctx context.Context, id string) error
+	RevokeRefreshToken(ctx context.Context, id string) error
+	RevokeTokenFamily(ctx context.Context, familyID string) error
+	RevokeUserRefreshTokens(ctx context.Context, userID string) error
+	CreatePasswordResetToken(ctx context.Context, token *models.PasswordResetToken) error
+	ConsumePasswordResetToken(ctx context.Context, tokenHash string) (string, error)
+	InvalidatePasswordResetTokens(ctx context.Context, userID string) error
+	CreateSession(ctx context.Context, session *models.Session) error
+	TouchSession(ctx context.Context, id, ipAddress, userAgent string) error
+	GetUserSessions(ctx context.Context, userID string) ([]*models.Session, error)
+	CountUserSessions(ctx context.Context, userID, deviceName, userAgent string) (total, sameDevice int, err error)
+	RevokeSession(ctx context.Context, userID, id string) error
+	// IsSessionActive reports whether the session still has a live refresh token. Once it has
+	// none it never gets one again, so a false answer is final.
+	IsSessionActive(ctx context.Context, id string) (bool, error)
+}
+
+type tokenRepository struct {
+	db *pgxpool.Pool
+}
+
+func NewTokenRepository(db *pgxpool.Pool) TokenRepository {
+	return &tokenRepository{db: db}
+}
+
+func (r *tokenRepository) conn(ctx context.Context) DBTX {
+	return connFromContext(ctx, r.db)
+}
+
+// CreateRefreshToken stores a new refresh token. When FamilyID is empty a new family is started.
+func (r *tokenRepository) CreateRefreshToken(ctx context.Context, token *models.RefreshToken) error {
+	query := `
+		INSERT INTO refresh_tokens (user_id, family_id, token_hash, expires_at)
+		VALUES ($1, COALESCE(NULLIF($2, '')::UUID, gen_random_uuid()), $3, $4)
+		RETURNING id, family_id, created_at
+	`
+
+	err := r.conn(ctx).QueryRow(ctx, query,
+		token.UserID, token.FamilyID, token.TokenHash, token.ExpiresAt,
+	).Scan(&token.ID, &token.FamilyID, &token.CreatedAt)
+
+	if err != nil {
+		return fmt.Errorf("failed to create refresh token: %w", err)
+	}
+
+	return nil
+}
+
+// GetRefreshTokenByHash looks a token up by its hash, including rotated and revoked tokens
+func (r *tokenRepository) GetRefreshTokenByHash(ctx context.Context, tokenHash string) (*models.RefreshToken, error) {
+	query := `
+		SELECT id, user_id, family_id, token_hash, expires_at, rotated_at, revoked_at, created_at
+		FROM refresh_tokens
+		WHERE token_hash = $1
+	`
+
+	var token models.RefreshToken
+	err := r.conn(ctx).QueryRow(ctx, query, tokenHash).Scan(
+		&token.ID, &token.UserID, &token.FamilyID, &token.TokenHash,
+		&token.ExpiresAt, &token.RotatedAt, &token.RevokedAt, &token.CreatedAt,
+	)
+
+	if err != nil {
+		return nil, fmt.Errorf("failed to get refresh token: %w", err)
+	}
+
+	return &token, nil
+}
+
+// RotateRefreshToken marks a live token as used. It returns ErrNotFound when the token was
+// already rotated or revoked, which is how a concurrent reuse is detected.
+func (r *tokenRepository) RotateRefreshToken(ctx context.Context, id string) error {
+	query := `
+		UPDATE refresh_tokens
+		SET rotated_at = NOW()
+		WHERE id = $1 AND rotated_at IS NULL AND revoked_at IS NULL
+	`
+
+	result, err := r.conn(ctx).Exec(ctx, query, id)
+	if err != nil {
+		return fmt.Errorf("failed to rotate refresh token: %w", err)
+	}
+
+	if result.RowsAffected() == 0 {
+		return fmt.Errorf("live refresh token %w", ErrNotFound)
+	}
+
+	return nil
+}
+
+// RevokeRefreshToken revokes a single token
+func (r *tokenRepository) RevokeRefreshToken(ctx context.Context, id string) error {
+	query := `UPDATE refresh_tokens SET revoked_at = NOW() WHERE id = $1 AND revoked_at IS NULL`
+
+	if _, err := r.conn(ctx).Exec(ctx, query, id); err != nil {
+		return fmt.Errorf("failed to revoke refresh token: %w", err)
+	}
+
+	return nil
+}
+
+// RevokeTokenFamily revokes every token descended from the same login
+func (r *tokenRepository) RevokeTokenFamily(ctx context.Context, familyID string) error {
+	query := `UPDATE refresh_tokens SET revoked_at = NOW() WHERE family_id = $1 AND revoked_at IS NULL`
+
+	if _, err := r.conn(ctx).Exec(ctx, query, familyID); err != nil {
+		return fmt.Errorf("failed to revoke token family: %w", err)
+	}
+
+	return nil
+}
+
+// RevokeUserRefreshTokens revokes every refresh token the user holds
+func (r *tokenRepository) RevokeUserRefreshTokens(ctx context.Context, userID string) error {
+	query := `UPDATE refresh_tokens SET revoked_at = NOW() WHERE user_id = $1 AND revoked_at IS NULL`
+
+	if _, err := r.conn(ctx).Exec(ctx, query, userID); err != nil {
+		return fmt.Errorf("failed to revoke refresh tokens: %w", err)
+	}
+
+	return nil
+}
+
+// CreatePasswordResetToken stores a new reset token
+func (r *tokenRepository) CreatePasswordResetToken(ctx context.Context, token *models.PasswordResetToken) error {
+	query := `
+		INSERT INTO password_reset_tokens (user_id, token_hash, expires_at)
+		VALUES ($1, $2, $3)
+		RETURNING id, created_at
+	`
+
+	err := r.conn(ctx).QueryRow(ctx, query, token.UserID, token.TokenHash, token.ExpiresAt).Scan(&token.ID, &token.CreatedAt)
+	if err != nil {
+		return fmt.Errorf("failed to create password reset token: %w", err)
+	}
+
+	return nil
+}
+
+// ConsumePasswordResetToken marks an unused, unexpired token as used and returns its user.
+// Checking and using the token in one statement means it can only ever be redeemed once.
+func (r *tokenRepository) ConsumePasswordResetToken(ctx context.Context, tokenHash string) (string, error) {
+	query := `
+		UPDATE password_reset_tokens
+		SET used_at = NOW()
+		WHERE token_hash = $1 AND used_at IS NULL AND expires_at > NOW()
+		RETURNING user_id
+	`
+
+	var userID string
+	if err := r.conn(ctx).QueryRow(ctx, query, tokenHash).Scan(&userID); err != nil {
+		return "", fmt.Errorf("failed to consume password reset token: %w", err)
+	}
+
+	return userID, nil
+}
+
+// InvalidatePasswordResetTokens uses up every outstanding reset token for the user
+func (r *tokenRepository) InvalidatePasswordResetTokens(ctx context.Context, userID string) error {
+	query := `UPDATE password_reset_tokens SET used_at = NOW() WHERE user_id = $1 AND used_at IS NULL`
+
+	if _, err := r.conn(ctx).Exec(ctx, query, userID); err != nil {
+		return fmt.Errorf("failed to invalidate password reset tokens: %w", err)
+	}
+
+	return nil
+}
+
+// CreateSession records a new login; its ID becomes the family of the login's refresh tokens
+func (r *tokenRepository) CreateSession(ctx context.Context, session *models.Session) error {
+	query := `
+		INSERT INTO sessions (user_id, device_name, user_agent, ip_address)
+		VALUES ($1, $2, $3, $4)
+		RETURNING id, created_at, last_seen_at
+	`
+
+	err := r.conn(ctx).QueryRow(ctx, query,
+		session.UserID, session.DeviceName, session.UserAgent, session.IPAddress,
+	).Scan(&session.ID, &session.CreatedAt, &session.LastSeenAt)
+	if err != nil {
+		return fmt.Errorf("failed to create session: %w", err)
+	}
+
+	return nil
+}
+
+// TouchSession records that the session was just used, from where and with what client
+func (r *tokenRepository) TouchSession(ctx context.Context, id, ipAddress, userAgent string) error {
+	query := `UPDATE sessions SET last_seen_at = NOW(), ip_address = $2, user_agent = $3 WHERE id = $1`
+
+	if _, err := r.conn(ctx).Exec(ctx, query, id, ipAddress, userAgent); err != nil {
+		return fmt.Errorf("failed to touch session: %w", err)
+	}
+
+	return nil
+}
+
+// GetUserSessions lists the user's sessions that still hold a usable refresh token, most
+// recently seen first
+func (r *tokenRepository) GetUserSessions(ctx context.Context, userID string) ([]*models.Session, error) {
+	query := `
+		SELECT s.id, s.user_id, s.device_name, s.user_agent, s.ip_address, s.created_at, s.last_seen_at
+		FROM sessions s
+		WHERE s.user_id = $1
+		  AND EXISTS (
+			SELECT 1 FROM refresh_tokens t
+			WHERE t.family_id = s.id AND t.rotated_at IS NULL AND t.revoked_at IS NULL AND t.expires_at > NOW()
+		  )
+		ORDER BY s.last_seen_at DESC
+	`
+
+	rows, err := r.conn(ctx).Query(ctx, query, userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get sessions: %w", err)
+	}
+	defer rows.Close()
+
+	sessions := []*models.Session{}
+	for rows.Next() {
+		var session models.Session
+		if err := rows.Scan(
+			&session.ID, &session.UserID, &session.DeviceName, &session.UserAgent,
+			&session.IPAddress, &session.CreatedAt, &session.LastSeenAt,
+		); err != nil {
+			return nil, fmt.Errorf("failed to scan session: %w", err)
+		}
+		sessions = append(sessions, &session)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to get sessions: %w", err)
+	}
+
+	return sessions, nil
+}
+
+// CountUserSessions counts every session the user ever started, and those from the given device
+func (r *tokenRepository) CountUserSessions(ctx context.Context, userID, deviceName, userAgent string) (int, int, error) {
+	query := `
+		SELECT COUNT(*), COUNT(*) FILTER (WHERE device_name = $2 AND user_agent = $3)
+		FROM sessions
+		WHERE user_id = $1
+	`
+
+	var total, sameDevice int
+	if err := r.conn(ctx).QueryRow(ctx, query, userID, deviceName, userAgent).Scan(&total, &sameDevice); err != nil {
+		return 0, 0, fmt.Errorf("failed to count sessions: %w", err)
+	}
+
+	return total, sameDevice, nil
+}
+
+// RevokeSession signs one of the user's sessions out by revoking its refresh tokens. It
+// returns ErrNotFound when the session is not the user's or is already signed out.
+func (r *tokenRepository) RevokeSession(ctx context.Context, userID, id string) error {
+	query := `UPDATE refresh_tokens SET revoked_at = NOW() WHERE family_id = $1 AND user_id = $2 AND revoked_at IS NULL`
+
+	result, err := r.conn(ctx).Exec(ctx, query, id, userID)
+	if err != nil {
+		return fmt.Errorf("failed to revoke session: %w", err)
+	}
+
+	if result.RowsAffected() == 0 {
+		return fmt.Errorf("session %w", ErrNotFound)
+	}
+
+	return nil
+}
+
+func (r *tokenRepository) IsSessionActive(ctx context.Context, id string) (bool, error) {
+	query := `
+		SELECT EXISTS (
+			SELECT 1 FROM refresh_tokens
+			WHERE family_id = $1 AND rotated_at IS NULL AND revoked_at IS NULL
+		)`
+
+	var active bool
+	if err := r.conn(ctx).QueryRow(ctx, query, id).Scan(&active); err != nil {
+		return false, fmt.Errorf("failed to check session: %w", err)
+	}
+	return active, nil
+}
@@ -3,9 +3,11 @@ package repositories
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"time"
 
+	"github.com/jackc/pgx/v5"
 	"github.com/jackc/pgx/v5/pgxpool"
 	"yoked_backend/internal/models"
 )
@@ -17,11 +19,29 @@ type UserRepository interface {
 	GetUserByEmail(ctx context.Context, email string) (*models.User, error)
 	UpdateUser(ctx context.Context, user *models.User) error
 	DeleteUser(ctx context.Context, id string) error
+	PurgeDeletedUsers(ctx context.Context, deletedBefore time.Time) (int64, error)
 	UpdateUserPreferences(ctx context.Context, userID string, prefs *models.UserPreferences) error
 	GetUserPreferences(ctx context.Context, userID string) (*models.UserPreferences, error)
 	UpdateUserPassword(ctx context.Context, userID, passwordHash string) error
-	UpdateUserStats(ctx context.Context, userID string)(*models.UserStats, error)
 	GetUserStats(ctx context.Context, userID string) (*models.UserStats, error)
+	// LockUserStats returns the stats row locked until the surrounding transaction ends
+	LockUserStats(ctx context.Context, userID string) (*models.UserStats, error)
+	SaveUserStats(ctx context.Context, stats *models.UserStats) error
+	GetWorkoutTotals(ctx context.Context, userID string) (*WorkoutTotals, error)
+	GetCompletedWorkoutDates(ctx context.Context, userID string) ([]time.Time, error)
+	GetTokenVersion(ctx context.Context, userID string) (int, error)
+	UpdateUserRole(ctx context.Context, userID, role string, permissions []string) error
+	MarkEmailVerified(ctx context.Context, userID string) error
+	MarkVerificationSent(ctx context.Context, userID string, since time.Time) (bool, error)
+	MarkPasswordResetSent(ctx context.Context, userID string, since time.Time) (bool, error)
+}
+
+// WorkoutTotals are the aggregate counts used to rebuild a user's stats from their logs
+type WorkoutTotals struct {
+	CompletedSessions int
+	CompletedWorkouts int
+	TotalWeightLifted float64
+	LastWorkoutDate   *time.Time
 }
 
 type userRepository struct {
@@ -32,20 +52,25 @@ func NewUserRepository(db *pgxpool.Pool) UserRepository {
 	return &userRepository{db: db}
 }
 
+// conn returns the querier for ctx, see TxManager
+func (r *userRepository) conn(ctx context.Context) DBTX {
+	return connFromContext(ctx, r.db)
+}
+
 // CreateUser inserts a new user into the database
 func (r *userRepository) CreateUser(ctx context.Context, user *models.User) error {
 	query := `
 		INSERT INTO users (email, password_hash, name, age, sex, height, weight, 
-		                  activity_level, goal, program_id, weekly_budget, created_at, updated_at)
-		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13)
-		RETURNING id
+		                  activity_level, goal, program_id, weekly_budget, timezone, created_at, updated_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14)
+		RETURNING id, role, permissions, token_version, email_verified
 	`
 
-	err := r.db.QueryRow(ctx, query,
+	err := r.conn(ctx).QueryRow(ctx, query,
 		user.Email, user.PasswordHash, user.Name, user.Age, user.Sex,
 		user.Height, user.Weight, user.ActivityLevel, user.Goal, user.ProgramID, user.WeeklyBudget,
-		time.Now(), time.Now(),
-	).Scan(&user.ID)
+		user.Timezone, time.Now(), time.Now(),
+	).Scan(&user.ID, &user.Role, &user.Permissions, &user.TokenVersion, &user.EmailVerified)
 
 	if err != nil {
 		return fmt.Errorf("failed to create user: %w", err)
@@ -58,18 +83,19 @@ func (r *userRepository) CreateUser(ctx context.Context, user *models.User) erro
 
 func (r *userRepository) CreateUserProgram(ctx context.Context, userProgram *models.UserProgram) error {
 	query := `
-		INSERT INTO user_programs(user_id, program_id, start_date, is_active, created_at)
-		VALUES ($1, $2, $3, $4, $5)
-		RETURNING id
+		INSERT INTO user_programs(user_id, program_id, program_version_id, start_date, is_active, created_at)
+		VALUES ($1, $2, COALESCE(NULLIF($6, 0), `+latestProgramVersionSQL+`), $3, $4, $5)
+		RETURNING id, program_version_id
 	`
 
-	err := r.db.QueryRow(ctx, query,
+	err := r.conn(ctx).QueryRow(ctx, query,
 		userProgram.UserID,
 		userProgram.ProgramID,
 		userProgram.StartDate,
 		userProgram.IsActive,
 		time.Now(),
-	).Scan(&userProgram.ID)
+		userProgram.ProgramVersionID,
+	).Scan(&userProgram.ID, &userProgram.ProgramVersionID)
 
 	if err != nil {
 		return fmt.Errorf("Failed to create user program: %w", err)
@@ -79,64 +105,68 @@ func (r *userRepository) CreateUserProgram(ctx context.Context, userProgram *mod
 }
 
 
+// userColumns is the column list scanUser expects, in order
+const userColumns = `id, email, password_hash, name, age, sex, height, weight,
+		       activity_level, goal, program_id, weekly_budget, timezone, role, permissions, token_version, email_verified, created_at, updated_at`
+
+func scanUser(row pgx.Row) (*models.User, error) {
+	var user models.User
+	err := row.Scan(
+		&user.ID, &user.Email, &user.PasswordHash, &user.Name, &user.Age, &user.Sex,
+		&user.Height, &user.Weight, &user.ActivityLevel, &user.Goal, &user.ProgramID, &user.WeeklyBudget,
+		&user.Timezone, &user.Role, &user.Permissions, &user.TokenVersion, &user.EmailVerified, &user.CreatedAt, &user.UpdatedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+	return &user, nil
+}
+
 // GetUserByID retrieves a user by their ID
 func (r *userRepository) GetUserByID(ctx context.Context, id string) (*models.User, error) {
 	query := `
-		SELECT id, email, password_hash, name, age, sex, height, weight, 
-		       activity_level, goal, program_id, weekly_budget, created_at, updated_at
+		SELECT ` + userColumns + `
 		FROM users 
 		WHERE id = $1 AND deleted_at IS NULL
 	`
 
-	var user models.User
-	err := r.db.QueryRow(ctx, query, id).Scan(
-		&user.ID, &user.Email, &user.PasswordHash, &user.Name, &user.Age, &user.Sex,
-		&user.Height, &user.Weight, &user.ActivityLevel, &user.Goal, &user.ProgramID, &user.WeeklyBudget,
-		&user.CreatedAt, &user.UpdatedAt,
-	)
-
+	user, err := scanUser(r.conn(ctx).QueryRow(ctx, query, id))
 	if err != nil {
 		return nil, fmt.Errorf("failed to get user by ID: %w", err)
 	}
 
-	return &user, nil
+	return user, nil
 }
 
 // GetUserByEmail retrieves a user by their email
 func (r *userRepository) GetUserByEmail(ctx context.Context, email string) (*models.User, error) {
 	query := `
-		SELECT id, email, password_hash, name, age, sex, height, weight, 
-		       activity_level, goal, program_id, weekly_budget, created_at, updated_at
+		SELECT ` + userColumns + `
 		FROM users 
 		WHERE email = $1 AND deleted_at IS NULL
 	`
 
-	var user models.User
-	err := r.db.QueryRow(ctx, query, email).Scan(
-		&user.ID, &user.Email, &user.PasswordHash, &user.Name, &user.Age, &user.Sex,
-		&user.Height, &user.Weight, &user.ActivityLevel, &user.Goal, &user.ProgramID, &user.WeeklyBudget,
-		&user.CreatedAt, &user.UpdatedAt,
-	)
-
+	user, err := scanUser(r.conn(ctx).QueryRow(ctx, query, email))
 	if err != nil {
 		return nil, fmt.Errorf("failed to get user by email: %w", err)
 	}
 
-	return &user, nil
+	return user, nil
 }
 
-// UpdateUser updates an existing user's information
+// UpdateUser updates an existing user's information. Changing the email clears email_verified.
 func (r *userRepository) UpdateUser(ctx context.Context, user *models.User) error {
 	query := `
 		UPDATE users 
-		SET email = $2, name = $3, age = $4, sex = $5, height = $6, weight = $7,
-		    activity_level = $8, goal = $9, program_id = $10, weekly_budget = $11, updated_at = $12
+		SET email_verified = (email_verified AND email = $2),
+		    email = $2, name = $3, age = $4, sex = $5, height = $6, weight = $7,
+		    activity_level = $8, goal = $9, program_id = $10, weekly_budget = $11, timezone = $12, updated_at = $13
 		WHERE id = $1 AND deleted_at IS NULL
 	`
 
-	result, err := r.db.Exec(ctx, query,
+	result, err := r.conn(ctx).Exec(ctx, query,
 		user.ID, user.Email, user.Name, user.Age, user.Sex, user.Height, user.Weight,
-		user.ActivityLevel, user.Goal, user.ProgramID, user.WeeklyBudget, time.Now(),
+		user.ActivityLevel, user.Goal, user.ProgramID, user.WeeklyBudget, user.Timezone, time.Now(),
 	)
 
 	if err != nil {
@@ -144,38 +174,49 @@ func (r *userRepository) UpdateUser(ctx context.Context, user *models.User) erro
 	}
 
 	if result.RowsAffected() == 0 {
-		return fmt.Errorf("user not found or already deleted")
+		return fmt.Errorf("user %w or already deleted", ErrNotFound)
 	}
 
 	return nil
 }
 
-// DeleteUser soft deletes a user by setting deleted_at timestamp
+// DeleteUser soft deletes a user by setting deleted_at timestamp and revokes their access tokens
 func (r *userRepository) DeleteUser(ctx context.Context, id string) error {
 	query := `
 		UPDATE users 
-		SET deleted_at = $2 
+		SET deleted_at = $2, token_version = token_version + 1
 		WHERE id = $1 AND deleted_at IS NULL
 	`
 
-	result, err := r.db.Exec(ctx, query, id, time.Now())
+	result, err := r.conn(ctx).Exec(ctx, query, id, time.Now())
 	if err != nil {
 		return fmt.Errorf("failed to delete user: %w", err)
 	}
 
 	if result.RowsAffected() == 0 {
-		return fmt.Errorf("user not found or already deleted")
+		return fmt.Errorf("user %w or already deleted", ErrNotFound)
 	}
 
 	return nil
 }
 
+// PurgeDeletedUsers permanently removes users soft deleted before deletedBefore. Everything
+// tied to a user references it with ON DELETE CASCADE, so their data goes with them.
+func (r *userRepository) PurgeDeletedUsers(ctx context.Context, deletedBefore time.Time) (int64, error) {
+	result, err := r.conn(ctx).Exec(ctx, `DELETE FROM users WHERE deleted_at IS NOT NULL AND deleted_at < $1`, deletedBefore)
+	if err != nil {
+		return 0, fmt.Errorf("failed to purge deleted users: %w", err)
+	}
+
+	return result.RowsAffected(), nil
+}
+
 // UpdateUserPreferences updates or creates user preferences
 func (r *userRepository) UpdateUserPreferences(ctx context.Context, userID string, prefs *models.UserPreferences) error {
 	// First check if preferences exist
 	checkQuery := `SELECT COUNT(*) FROM user_preferences WHERE user_id = $1`
 	var count int
-	err := r.db.QueryRow(ctx, checkQuery, userID).Scan(&count)
+	err := r.conn(ctx).QueryRow(ctx, checkQuery, userID).Scan(&count)
 	if err != nil {
 		return fmt.Errorf("failed to check existing preferences: %w", err)
 	}
@@ -184,17 +225,17 @@ func (r *userRepository) UpdateUserPreferences(ctx context.Context, userID strin
 		// Update existing preferences
 		query := `
 			UPDATE user_preferences 
-			SET preferences = $2, allergies = $3, dislikes = $4, updated_at = $5
+			SET preferences = $2, allergies = $3, dislikes = $4, equipment = $5, updated_at = $6
 			WHERE user_id = $1
 		`
-		_, err = r.db.Exec(ctx, query, userID, prefs.Preferences, prefs.Allergies, prefs.Dislikes, time.Now())
+		_, err = r.conn(ctx).Exec(ctx, query, userID, prefs.Preferences, prefs.Allergies, prefs.Dislikes, prefs.Equipment, time.Now())
 	} else {
 		// Insert new preferences
 		query := `
-			INSERT INTO user_preferences (user_id, preferences, allergies, dislikes, created_at, updated_at)
-			VALUES ($1, $2, $3, $4, $5, $6)
+			INSERT INTO user_preferences (user_id, preferences, allergies, dislikes, equipment, created_at, updated_at)
+			VALUES ($1, $2, $3, $4, $5, $6, $7)
 		`
-		_, err = r.db.Exec(ctx, query, userID, prefs.Preferences, prefs.Allergies, prefs.Dislikes, time.Now(), time.Now())
+		_, err = r.conn(ctx).Exec(ctx, query, userID, prefs.Preferences, prefs.Allergies, prefs.Dislikes, prefs.Equipment, time.Now(), time.Now())
 	}
 
 	if err != nil {
@@ -207,14 +248,14 @@ func (r *userRepository) UpdateUserPreferences(ctx context.Context, userID strin
 // GetUserPreferences retrieves user preferences
 func (r *userRepository) GetUserPreferences(ctx context.Context, userID string) (*models.UserPreferences, error) {
 	query := `
-		SELECT user_id, preferences, allergies, dislikes
+		SELECT user_id, preferences, allergies, dislikes, equipment
 		FROM user_preferences 
 		WHERE user_id = $1
 	`
 
 	var prefs models.UserPreferences
-	err := r.db.QueryRow(ctx, query, userID).Scan(
-		&prefs.UserID, &prefs.Preferences, &prefs.Allergies, &prefs.Dislikes,
+	err := r.conn(ctx).QueryRow(ctx, query, userID).Scan(
+		&prefs.UserID, &prefs.Preferences, &prefs.Allergies, &prefs.Dislikes, &prefs.Equipment,
 	)
 
 	if err != nil {
@@ -224,97 +265,238 @@ func (r *userRepository) GetUserPreferences(ctx context.Context, userID string)
 			Preferences: []string{},
 			Allergies:   []string{},
 			Dislikes:    []string{},
+			Equipment:   []string{},
 		}, nil
 	}
 
 	return &prefs, nil
 }
 
-// UpdateUserPassword updates a user's password hash
+// UpdateUserPassword updates a user's password hash and bumps token_version so
+// access tokens issued under the old password stop working
 func (r *userRepository) UpdateUserPassword(ctx context.Context, userID, passwordHash string) error {
 	query := `
 		UPDATE users 
-		SET password_hash = $2, updated_at = $3
+		SET password_hash = $2, token_version = token_version + 1, updated_at = $3
 		WHERE id = $1 AND deleted_at IS NULL
 	`
 
-	result, err := r.db.Exec(ctx, query, userID, passwordHash, time.Now())
+	result, err := r.conn(ctx).Exec(ctx, query, userID, passwordHash, time.Now())
 	if err != nil {
 		return fmt.Errorf("failed to update password: %w", err)
 	}
 
 	if result.RowsAffected() == 0 {
-		return fmt.Errorf("user not found or already deleted")
+		return fmt.Errorf("user %w or already deleted", ErrNotFound)
 	}
 
 	return nil
 }
 
-// UpdateUserStats updates and returns user statistics
-func (r *userRepository) UpdateUserStats(ctx context.Context, userID string) (*models.UserStats, error) {
-    // First get current stats to calculate updates
-    currentStats, err := r.GetUserStats(ctx, userID)
-    if err != nil {
-        return nil, fmt.Errorf("failed to get current stats: %w", err)
-    }
+// GetTokenVersion returns the token version access tokens must carry, or ErrNotFound for a deleted user
+func (r *userRepository) GetTokenVersion(ctx context.Context, userID string) (int, error) {
+	var version int
+	err := r.conn(ctx).QueryRow(ctx, `
+		SELECT token_version FROM users WHERE id = $1 AND deleted_at IS NULL
+	`, userID).Scan(&version)
+	if err != nil {
+		return 0, fmt.Errorf("failed to get token version: %w", err)
+	}
+	return version, nil
+}
 
-    // Calculate new statistics based on recent activities
-    // This is where you'd add your business logic
-    query := `
-        SELECT 
-            COUNT(*) as completed_workouts,
-            COALESCE(SUM(weight * sets * reps), 0) as total_weight
-        FROM exercises e
-        JOIN workout_sessions ws ON e.session_id = ws.id
-        JOIN workouts w ON ws.workout_id = w.id
-        WHERE w.user_id = $1 AND e.completed = true
-        AND e.created_at > $2
-    `
+// UpdateUserRole sets the user's role and individual permissions. Tokens carry both, so the
+// token version is bumped; the user's next refresh picks up the change.
+func (r *userRepository) UpdateUserRole(ctx context.Context, userID, role string, permissions []string) error {
+	query := `
+		UPDATE users
+		SET role = $2, permissions = $3, token_version = token_version + 1, updated_at = $4
+		WHERE id = $1 AND deleted_at IS NULL
+	`
 
-    var newWorkouts int
-    var newWeight float64
-    err = r.db.QueryRow(ctx, query, userID, currentStats.UpdatedAt).Scan(
-        &newWorkouts, &newWeight,
-    )
-    if err != nil {
-        return nil, fmt.Errorf("failed to calculate new stats: %w", err)
-    }
+	result, err := r.conn(ctx).Exec(ctx, query, userID, role, permissions, time.Now())
+	if err != nil {
+		return fmt.Errorf("failed to update user role: %w", err)
+	}
 
-    // Update the statistics
-    updateQuery := `
-        INSERT INTO user_stats (user_id, completed_workouts, completed_sessions, 
-                               total_weight_lifted, current_streak, longest_streak, 
-                               last_workout_date, updated_at)
-        VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
-        ON CONFLICT (user_id) 
-        DO UPDATE SET 
-            completed_workouts = user_stats.completed_workouts + EXCLUDED.completed_workouts,
-            total_weight_lifted = user_stats.total_weight_lifted + EXCLUDED.total_weight_lifted,
-            last_workout_date = EXCLUDED.last_workout_date,
-            updated_at = EXCLUDED.updated_at
-        RETURNING id, completed_workouts, completed_sessions, total_weight_lifted,
-                  current_streak, longest_streak, last_workout_date, created_at, updated_at
-    `
+	if result.RowsAffected() == 0 {
+		return fmt.Errorf("user %w or already deleted", ErrNotFound)
+	}
 
-    var stats models.UserStats
-    err = r.db.QueryRow(ctx, updateQuery,
-        userID, newWorkouts, 0, newWeight, // completed_sessions would need similar logic
-        currentStats.CurrentStreak, currentStats.LongestStreak,
-        time.Now(), time.Now(),
-    ).Scan(
-        &stats.ID, &stats.CompletedWorkouts, &stats.CompletedSessions,
-        &stats.TotalWeightLifted, &stats.CurrentStreak, &stats.LongestStreak,
-        &stats.LastWorkoutDate, &stats.CreatedAt, &stats.UpdatedAt,
-    )
+	return nil
+}
 
-    if err != nil {
-        return nil, fmt.Errorf("failed to update user stats: %w", err)
-    }
+// MarkEmailVerified records that the user proved they own their email
+func (r *userRepository) MarkEmailVerified(ctx context.Context, userID string) error {
+	query := `
+		UPDATE users
+		SET email_verified = TRUE, updated_at = $2
+		WHERE id = $1 AND deleted_at IS NULL
+	`
 
-    stats.UserID = userID
-    return &stats, nil
+	result, err := r.conn(ctx).Exec(ctx, query, userID, time.Now())
+	if err != nil {
+		return fmt.Errorf("failed to mark email verified: %w", err)
+	}
+
+	if result.RowsAffected() == 0 {
+		return fmt.Errorf("user %w or already deleted", ErrNotFound)
+	}
+
+	return nil
+}
+
+// MarkVerificationSent records a verification email unless one was already sent after since.
+// It reports false when throttled; the check and update are one statement so concurrent
+// resends cannot both get through.
+func (r *userRepository) MarkVerificationSent(ctx context.Context, userID string, since time.Time) (bool, error) {
+	query := `
+		UPDATE users
+		SET verification_sent_at = NOW()
+		WHERE id = $1 AND deleted_at IS NULL
+		  AND (verification_sent_at IS NULL OR verification_sent_at < $2)
+	`
+
+	result, err := r.conn(ctx).Exec(ctx, query, userID, since)
+	if err != nil {
+		return false, fmt.Errorf("failed to record verification email: %w", err)
+	}
+
+	return result.RowsAffected() > 0, nil
+}
+
+// MarkPasswordResetSent records a password reset email unless one was already sent after since.
+// Like MarkVerificationSent it reports false when throttled, in a single statement.
+func (r *userRepository) MarkPasswordResetSent(ctx context.Context, userID string, since time.Time) (bool, error) {
+	query := `
+		UPDATE users
+		SET password_reset_sent_at = NOW()
+		WHERE id = $1 AND deleted_at IS NULL
+		  AND (password_reset_sent_at IS NULL OR password_reset_sent_at < $2)
+	`
+
+	result, err := r.conn(ctx).Exec(ctx, query, userID, since)
+	if err != nil {
+		return false, fmt.Errorf("failed to record password reset email: %w", err)
+	}
+
+	return result.RowsAffected() > 0, nil
+}
+
+// SaveUserStats upserts a user's statistics row
+func (r *userRepository) SaveUserStats(ctx context.Context, stats *models.UserStats) error {
+	query := `
+		INSERT INTO user_stats (user_id, completed_workouts, completed_sessions, total_weight_lifted,
+		                        current_streak, longest_streak, last_workout_date, updated_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
+		ON CONFLICT (user_id)
+		DO UPDATE SET
+			completed_workouts = EXCLUDED.completed_workouts,
+			completed_sessions = EXCLUDED.completed_sessions,
+			total_weight_lifted = EXCLUDED.total_weight_lifted,
+			current_streak = EXCLUDED.current_streak,
+			longest_streak = EXCLUDED.longest_streak,
+			last_workout_date = EXCLUDED.last_workout_date,
+			updated_at = EXCLUDED.updated_at
+		RETURNING id, created_at, updated_at
+	`
+
+	err := r.conn(ctx).QueryRow(ctx, query,
+		stats.UserID, stats.CompletedWorkouts, stats.CompletedSessions, stats.TotalWeightLifted,
+		stats.CurrentStreak, stats.LongestStreak, stats.LastWorkoutDate, time.Now(),
+	).Scan(&stats.ID, &stats.CreatedAt, &stats.UpdatedAt)
+
+	if err != nil {
+		return fmt.Errorf("failed to save user stats: %w", err)
+	}
+
+	return nil
 }
 
+// GetWorkoutTotals aggregates every completed session, exercise entry and set a user has logged
+func (r *userRepository) GetWorkoutTotals(ctx context.Context, userID string) (*WorkoutTotals, error) {
+	query := `
+		SELECT
+			COUNT(DISTINCT w.id),
+			COUNT(DISTINCT we.id),
+			COALESCE(SUM(CASE WHEN s.unit = 'lb' THEN s.weight * 0.45359237 ELSE s.weight END * s.reps), 0),
+			MAX(w.completed_at)
+		FROM workouts w
+		JOIN user_programs up ON w.user_program_id = up.id
+		LEFT JOIN workout_exercises we ON we.workout_id = w.id
+		LEFT JOIN workout_exercise_sets s ON s.workout_exercise_id = we.id
+		WHERE up.user_id = $1 AND w.status = 'completed'
+	`
+
+	var totals WorkoutTotals
+	err := r.conn(ctx).QueryRow(ctx, query, userID).Scan(
+		&totals.CompletedSessions, &totals.CompletedWorkouts,
+		&totals.TotalWeightLifted, &totals.LastWorkoutDate,
+	)
+
+	if err != nil {
+		return nil, fmt.Errorf("failed to aggregate workout totals: %w", err)
+	}
+
+	return &totals, nil
+}
+
+// GetCompletedWorkoutDates returns when each completed session happened, oldest first
+func (r *userRepository) GetCompletedWorkoutDates(ctx context.Context, userID string) ([]time.Time, error) {
+	query := `
+		SELECT w.completed_at
+		FROM workouts w
+		JOIN user_programs up ON w.user_program_id = up.id
+		WHERE up.user_id = $1 AND w.status = 'completed'
+		ORDER BY w.completed_at
+	`
+
+	rows, err := r.conn(ctx).Query(ctx, query, userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get workout dates: %w", err)
+	}
+	defer rows.Close()
+
+	var dates []time.Time
+	for rows.Next() {
+		var date time.Time
+		if err := rows.Scan(&date); err != nil {
+			return nil, fmt.Errorf("failed to scan workout date: %w", err)
+		}
+		dates = append(dates, date)
+	}
+
+	return dates, rows.Err()
+}
+
+// LockUserStats creates the user's stats row if it is missing and locks it FOR UPDATE, so
+// concurrent read-modify-write updates queue behind each other instead of losing increments
+func (r *userRepository) LockUserStats(ctx context.Context, userID string) (*models.UserStats, error) {
+	conn := r.conn(ctx)
+	if _, err := conn.Exec(ctx, `INSERT INTO user_stats (user_id) VALUES ($1) ON CONFLICT (user_id) DO NOTHING`, userID); err != nil {
+		return nil, fmt.Errorf("failed to create user stats: %w", err)
+	}
+
+	query := `
+		SELECT id, user_id, completed_workouts, completed_sessions,
+		       total_weight_lifted, current_streak, longest_streak,
+		       last_workout_date, created_at, updated_at
+		FROM user_stats
+		WHERE user_id = $1
+		FOR UPDATE
+	`
+
+	var stats models.UserStats
+	err := conn.QueryRow(ctx, query, userID).Scan(
+		&stats.ID, &stats.UserID, &stats.CompletedWorkouts, &stats.CompletedSessions,
+		&stats.TotalWeightLifted, &stats.CurrentStreak, &stats.LongestStreak,
+		&stats.LastWorkoutDate, &stats.CreatedAt, &stats.UpdatedAt,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to lock user stats: %w", err)
+	}
+	return &stats, nil
+}
 
 // GetUserStats retrieves user statistics
 func (r *userRepository) GetUserStats(ctx context.Context, userID string) (*models.UserStats, error) {
@@ -327,14 +509,14 @@ func (r *userRepository) GetUserStats(ctx context.Context, userID string) (*mode
     `
 
     var stats models.UserStats
-    err := r.db.QueryRow(ctx, query, userID).Scan(
+    err := r.conn(ctx).QueryRow(ctx, query, userID).Scan(
         &stats.ID, &stats.UserID, &stats.CompletedWorkouts, &stats.CompletedSessions,
         &stats.TotalWeightLifted, &stats.CurrentStreak, &stats.LongestStreak,
         &stats.LastWorkoutDate, &stats.CreatedAt, &stats.UpdatedAt,
     )
 
-    if err != nil {
-        // Return default stats if not found
+    if errors.Is(err, ErrNotFound) {
+        // Return default stats if the user has never completed a session
         return &models.UserStats{
             UserID:            userID,
             CompletedWorkouts: 0,
@@ -344,6 +526,9 @@ func (r *userRepository) GetUserStats(ctx context.Context, userID string) (*mode
             LongestStreak:     0,
         }, nil
     }
+    if err != nil {
+        return nil, fmt.Errorf("failed to get user stats: %w", err)
+    }
 
     return &stats, nil
 }
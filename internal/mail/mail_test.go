@@ -0,0 +1,79 @@
+package mail
+
+import (
+	"context"
+	"errors"
+	"os"
+	"strings"
+	"testing"
+	"time"
+)
+
+// flakyMailer fails a set number of times before delivering
+type flakyMailer struct {
+	failures  int
+	delivered chan Message
+}
+
+func (m *flakyMailer) Send(ctx context.Context, msg Message) error {
+	if m.failures > 0 {
+		m.failures--
+		return errors.New("connection refused")
+	}
+	m.delivered <- msg
+	return nil
+}
+
+func TestOutboxRetriesDelivery(t *testing.T) {
+	mailer := &flakyMailer{failures: 2, delivered: make(chan Message, 1)}
+	outbox := NewOutbox(mailer, 1)
+	outbox.backoff = time.Millisecond
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	if err := outbox.Send(ctx, Message{To: "lifter@example.com"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := outbox.Send(ctx, Message{To: "second@example.com"}); !errors.Is(err, ErrOutboxFull) {
+		t.Fatalf("expected a full outbox, got %v", err)
+	}
+
+	go outbox.Run(ctx)
+	select {
+	case msg := <-mailer.delivered:
+		if msg.To != "lifter@example.com" {
+			t.Errorf("delivered to %s", msg.To)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("message was not delivered")
+	}
+}
+
+func TestSMTPFormatStripsHeaderInjection(t *testing.T) {
+	mailer := NewSMTPMailer("localhost", 25, "", "", "noreply@example.com").(*smtpMailer)
+	raw := string(mailer.format(Message{To: "a@example.com\r\nBcc: victim@example.com", Subject: "Hi", Body: "line one\nline two"}))
+
+	if strings.Contains(raw, "\r\nBcc:") {
+		t.Errorf("header injected:\n%s", raw)
+	}
+	if !strings.Contains(raw, "\r\n\r\nline one\r\nline two") {
+		t.Errorf("body not CRLF encoded:\n%q", raw)
+	}
+}
+
+func TestFileMailer(t *testing.T) {
+	dir := t.TempDir()
+	mailer, err := NewFileMailer(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := mailer.Send(context.Background(), Message{To: "lifter@example.com", Subject: "Reset", Body: "link"}); err != nil {
+		t.Fatal(err)
+	}
+
+	entries, _ := os.ReadDir(dir)
+	if len(entries) != 1 || !strings.HasSuffix(entries[0].Name(), "lifter_at_example.com.eml") {
+		t.Fatalf("unexpected files: %v", entries)
+	}
+}
@@ -0,0 +1,71 @@
+package mail
+
+import (
+	"context"
+	"errors"
+	"log"
+	"time"
+)
+
+// ErrOutboxFull is returned when messages are queued faster than they can be delivered
+var ErrOutboxFull = errors.New("mail outbox is full")
+
+// outboxAttempts is how many times a message is tried before it is dropped
+const outboxAttempts = 3
+
+// Outbox is a Mailer that queues messages and delivers them in the background. Callers
+// return without waiting on the mail server, so response times do not depend on
+// whether a message was sent.
+type Outbox struct {
+	mailer  Mailer
+	queue   chan Message
+	backoff time.Duration
+}
+
+// NewOutbox queues up to size messages for delivery through mailer. Call Run to deliver them.
+func NewOutbox(mailer Mailer, size int) *Outbox {
+	return &Outbox{mailer: mailer, queue: make(chan Message, size), backoff: time.Second}
+}
+
+// Send queues msg without blocking
+func (o *Outbox) Send(ctx context.Context, msg Message) error {
+	select {
+	case o.queue <- msg:
+		return nil
+	default:
+		return ErrOutboxFull
+	}
+}
+
+// Run delivers queued messages until ctx is cancelled, retrying failures with backoff
+func (o *Outbox) Run(ctx context.Context) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case msg := <-o.queue:
+			o.deliver(ctx, msg)
+		}
+	}
+}
+
+func (o *Outbox) deliver(ctx context.Context, msg Message) {
+	wait := o.backoff
+	for attempt := 1; ; attempt++ {
+		err := o.mailer.Send(ctx, msg)
+		if err == nil {
+			return
+		}
+		if attempt == outboxAttempts {
+			log.Printf("Giving up on mail to %s after %d attempts: %v", msg.To, attempt, err)
+			return
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(wait):
+		}
+		wait *= 2
+	}
+}
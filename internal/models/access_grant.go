@@ -0,0 +1,18 @@
+package models
+
+import "time"
+
+// Access grant roles
+const (
+	GrantRoleCoach = "coach"
+	GrantRoleAdmin = "admin"
+)
+
+// AccessGrant allows the grantee to act on another user's data. A nil UserID covers every user.
+type AccessGrant struct {
+	ID        int       `json:"id"`
+	GranteeID string    `json:"grantee_id"`
+	UserID    *string   `json:"user_id,omitempty"`
+	Role      string    `json:"role"`
+	CreatedAt time.Time `json:"created_at"`
+}
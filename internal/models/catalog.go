@@ -0,0 +1,32 @@
+package models
+
+import "time"
+
+// ProgramVersion is a numbered, unchanging copy of a program's workouts and prescriptions. Each
+// program also has one draft version, numbered 0, which is the one the catalog edits.
+type ProgramVersion struct {
+	ID          int        `json:"id"`
+	ProgramID   int        `json:"program_id"`
+	Version     int        `json:"version"`
+	PublishedAt *time.Time `json:"published_at"`
+	CreatedAt   time.Time  `json:"created_at"`
+}
+
+// IsDraft reports whether the version can still be edited
+func (v *ProgramVersion) IsDraft() bool {
+	return v.Version == 0
+}
+
+// ProgramTree is a program with one version's workouts and their prescribed exercises, the unit
+// the catalog is edited in
+type ProgramTree struct {
+	Program
+	Version  ProgramVersion        `json:"version"`
+	Workouts []*ProgramWorkoutTree `json:"workouts"`
+}
+
+// ProgramWorkoutTree is a workout with its prescriptions in ExerciseOrder
+type ProgramWorkoutTree struct {
+	ProgramWorkout
+	Exercises []*ProgramWorkoutExercise `json:"exercises"`
+}
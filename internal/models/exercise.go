@@ -4,11 +4,117 @@ import (
 	"time"
 )
 
+// Movement patterns group exercises that train the body the same way
+const (
+	MovementSquat          = "squat"
+	MovementHinge          = "hinge"
+	MovementLunge          = "lunge"
+	MovementHorizontalPush = "horizontal_push"
+	MovementVerticalPush   = "vertical_push"
+	MovementHorizontalPull = "horizontal_pull"
+	MovementVerticalPull   = "vertical_pull"
+	MovementCarry          = "carry"
+	MovementCore           = "core"
+	MovementOther          = "other"
+)
+
+const (
+	LateralityBilateral  = "bilateral"
+	LateralityUnilateral = "unilateral"
+
+	MechanicsCompound  = "compound"
+	MechanicsIsolation = "isolation"
+
+	DifficultyBeginner     = "beginner"
+	DifficultyIntermediate = "intermediate"
+	DifficultyAdvanced     = "advanced"
+)
+
+// ValidMovementPattern reports whether pattern is a known movement pattern
+func ValidMovementPattern(pattern string) bool {
+	switch pattern {
+	case MovementSquat, MovementHinge, MovementLunge, MovementHorizontalPush, MovementVerticalPush,
+		MovementHorizontalPull, MovementVerticalPull, MovementCarry, MovementCore, MovementOther:
+		return true
+	}
+	return false
+}
+
+// Exercise is an entry in the exercise library. Muscle groups and equipment are lowercase;
+// the optional classification fields are empty when unknown.
 type Exercise struct {
-	ID                int       `json:"id"`
-	Name              string    `json:"name"`
-	Description       string    `json:"description"`
-	PrimaryMuscleGroup string    `json:"primary_muscle_group"`
-	Equipment         string    `json:"equipment"`
-	CreatedAt         time.Time `json:"created_at"`
+	ID                    int      `json:"id"`
+	Name                  string   `json:"name"`
+	Description           string   `json:"description"`
+	PrimaryMuscleGroup    string   `json:"primary_muscle_group"`
+	SecondaryMuscleGroups []string `json:"secondary_muscle_groups"`
+	Equipment             string   `json:"equipment"`
+	MovementPattern       string   `json:"movement_pattern"`
+	Laterality            string   `json:"laterality"`
+	Mechanics             string   `json:"mechanics"`
+	Difficulty            string   `json:"difficulty"`
+	// Aliases are other names the exercise is searched by
+	Aliases []string `json:"aliases"`
+	// Instructions are the steps to perform the exercise, in order
+	Instructions []string `json:"instructions"`
+	// MergedIntoID is set on a duplicate that was merged into another exercise. Merged
+	// exercises are not listed but stay for the history that points at them.
+	MergedIntoID *int      `json:"merged_into_id,omitempty"`
+	CreatedAt    time.Time `json:"created_at"`
+	UpdatedAt    time.Time `json:"updated_at"`
+}
+
+// ExerciseFilter narrows an exercise search. Empty fields match everything.
+type ExerciseFilter struct {
+	// Query is matched against names, aliases, muscles and descriptions
+	Query string
+	// Muscle matches the primary or a secondary muscle group
+	Muscle          string
+	Equipment       string
+	MovementPattern string
+	Mechanics       string
+	Difficulty      string
+	Limit           int
+	Offset          int
+}
+
+// ExercisePage is one page of search results. Facets count the matches for each muscle group
+// and piece of equipment, ignoring that facet's own filter so clients can offer alternatives.
+type ExercisePage struct {
+	Exercises []*Exercise     `json:"exercises"`
+	Total     int             `json:"total"`
+	Limit     int             `json:"limit"`
+	Offset    int             `json:"offset"`
+	Facets    *ExerciseFacets `json:"facets"`
+}
+
+type ExerciseFacets struct {
+	Muscles   map[string]int `json:"muscles"`
+	Equipment map[string]int `json:"equipment"`
+}
+
+// EquipmentBodyweight is the equipment of exercises that need none
+const EquipmentBodyweight = "bodyweight"
+
+// ExerciseOverride is a user's standing swap of one exercise for another within a program.
+// It applies wherever the program prescribes ExerciseID.
+type ExerciseOverride struct {
+	ID                   int       `json:"id"`
+	UserID               string    `json:"user_id"`
+	ProgramID            int       `json:"program_id"`
+	ExerciseID           int       `json:"exercise_id"`
+	SubstituteExerciseID int       `json:"substitute_exercise_id"`
+	CreatedAt            time.Time `json:"created_at"`
+	UpdatedAt            time.Time `json:"updated_at"`
+}
+
+// SubstituteSuggestion is an alternative to an exercise. Score runs from 0 to 1, higher being
+// the closer match.
+type SubstituteSuggestion struct {
+	Exercise            *Exercise `json:"exercise"`
+	Score               float64   `json:"score"`
+	SameMovementPattern bool      `json:"same_movement_pattern"`
+	// MuscleOverlap runs from 0 to 1 and weighs the primary muscle group most
+	MuscleOverlap      float64 `json:"muscle_overlap"`
+	EquipmentAvailable bool    `json:"equipment_available"`
 }
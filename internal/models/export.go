@@ -0,0 +1,18 @@
+package models
+
+import "time"
+
+// AccountExport is everything stored about a user, as handed to them on request
+type AccountExport struct {
+	ExportedAt      time.Time           `json:"exported_at"`
+	User            *User               `json:"user"`
+	Preferences     *UserPreferences    `json:"preferences"`
+	Stats           *UserStats          `json:"stats"`
+	Programs        []*UserProgram      `json:"programs"`
+	Workouts        []*WorkoutSession   `json:"workouts"` // with their exercise logs and sets
+	PersonalRecords []*PersonalRecord   `json:"personal_records"`
+	Sessions        []*Session          `json:"sessions"`
+	Identities      []*ExternalIdentity `json:"identities"`
+	Overrides       []*ExerciseOverride `json:"exercise_overrides"`
+	AccessGrants    []*AccessGrant      `json:"access_grants"` // held by the user or over their data
+}
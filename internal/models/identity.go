@@ -0,0 +1,41 @@
+package models
+
+import "time"
+
+// ExternalIdentity links a user to their account at an OpenID Connect provider
+type ExternalIdentity struct {
+	ID        string    `json:"id"`
+	UserID    string    `json:"user_id"`
+	Provider  string    `json:"provider"`
+	Subject   string    `json:"-"`
+	Email     string    `json:"email"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// SignupProfile is the profile a first-time social login needs to create an account.
+// It mirrors the registration fields other than email and password.
+type SignupProfile struct {
+	Name          string  `json:"name"`
+	Age           int     `json:"age"`
+	Sex           string  `json:"sex"`
+	Height        float64 `json:"height"`
+	Weight        float64 `json:"weight"`
+	ActivityLevel string  `json:"activity_level"`
+	Goal          string  `json:"goal"`
+	ProgramID     int     `json:"program_id"`
+	WeeklyBudget  float64 `json:"weekly_budget"`
+	Timezone      string  `json:"timezone"`
+}
+
+// OIDCAuthRequest is a pending authorization, stored until its callback arrives. UserID is
+// set when an existing user is linking a provider rather than logging in.
+type OIDCAuthRequest struct {
+	StateHash    string         `json:"-"`
+	Provider     string         `json:"provider"`
+	Nonce        string         `json:"-"`
+	CodeVerifier string         `json:"-"`
+	UserID       string         `json:"user_id,omitempty"`
+	Profile      *SignupProfile `json:"profile,omitempty"`
+	ExpiresAt    time.Time      `json:"expires_at"`
+	CreatedAt    time.Time      `json:"created_at"`
+}
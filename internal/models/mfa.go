@@ -0,0 +1,24 @@
+package models
+
+import "time"
+
+// MFASecret is a user's TOTP secret. EnabledAt stays nil until the user confirms enrollment
+// with a first code.
+type MFASecret struct {
+	UserID       string     `json:"user_id"`
+	Secret       []byte     `json:"-"` // encrypted
+	EnabledAt    *time.Time `json:"enabled_at,omitempty"`
+	LastUsedStep int64      `json:"-"`
+	CreatedAt    time.Time  `json:"created_at"`
+}
+
+// MFAChallenge is the second login step, issued after a correct password and redeemed with a code
+type MFAChallenge struct {
+	ID        string     `json:"id"`
+	UserID    string     `json:"user_id"`
+	TokenHash string     `json:"-"`
+	ExpiresAt time.Time  `json:"expires_at"`
+	Attempts  int        `json:"attempts"`
+	UsedAt    *time.Time `json:"used_at,omitempty"`
+	CreatedAt time.Time  `json:"created_at"`
+}
@@ -10,12 +10,18 @@ type Program struct {
     Description    string    `json:"description"`
     Goal           string    `json:"goal"`
     EstimatedWeeks int       `json:"estimated_weeks"`
+    ProgressionStrategy string `json:"progression_strategy"`
+    // PublishedAt is nil while the program is hidden from users
+    PublishedAt    *time.Time `json:"published_at"`
     CreatedAt      time.Time `json:"created_at"`
 }
 
 type ProgramWorkout struct {
     ID          int       `json:"id"`
     ProgramID   int       `json:"program_id"`
+    ProgramVersionID int  `json:"program_version_id"`
+    // LineageID is shared by this workout's copies in every version of the program
+    LineageID   string    `json:"lineage_id"`
     Name        string    `json:"name"`
     DayOfWeek   int       `json:"day_of_week"`
     Description string    `json:"description"`
@@ -25,29 +31,99 @@ type ProgramWorkout struct {
 type ProgramWorkoutExercise struct {
     ID                 int     `json:"id"`
     ProgramWorkoutID   int     `json:"program_workout_id"`
+    // LineageID is shared by this prescription's copies in every version of the program
+    LineageID          string  `json:"lineage_id"`
     ExerciseID         int     `json:"exercise_id"`
     Sets               int     `json:"sets"`
     Reps               int     `json:"reps"`
     TargetRIR          int     `json:"target_rir"`
-    PrescribedWeight   int     `json:"prescribed_weight,omitempty"`
+    PrescribedWeight   float64 `json:"prescribed_weight,omitempty"`
     ExerciseOrder      int     `json:"exercise_order"`
     Notes              string  `json:"notes"`
+    // Progression overrides; an empty strategy inherits the program's
+    ProgressionStrategy string `json:"progression_strategy,omitempty"`
+    RepRangeMax        int     `json:"rep_range_max,omitempty"`
+    WeightIncrement    float64 `json:"weight_increment,omitempty"`
+    TrainingMax        float64 `json:"training_max,omitempty"`
 }
 
+// Workout session states. A session starts in progress and ends exactly once,
+// either completed by the user or abandoned after a timeout.
+const (
+    WorkoutStatusInProgress = "in_progress"
+    WorkoutStatusCompleted  = "completed"
+    WorkoutStatusAbandoned  = "abandoned"
+)
+
 type WorkoutSession struct {
-    ID                int       `json:"id"`
-    UserProgramID     int       `json:"user_program_id"`
-    ProgramWorkoutID  int       `json:"program_workout_id"`
-    CompletedDate     time.Time `json:"completed_date"`
-    Notes             string    `json:"notes"`
-    CreatedAt         time.Time `json:"created_at"`
+    ID                int        `json:"id"`
+    UserProgramID     int        `json:"user_program_id"`
+    ProgramWorkoutID  int        `json:"program_workout_id"`
+    Status            string     `json:"status"`
+    StartedAt         time.Time  `json:"started_at"`
+    CompletedAt       *time.Time `json:"completed_at"`
+    AbandonedAt       *time.Time `json:"abandoned_at,omitempty"`
+    DurationSeconds   *int       `json:"duration_seconds"`
+    Notes             string     `json:"notes"`
+    CreatedAt         time.Time  `json:"created_at"`
+    Exercises         []*WorkoutExerciseLog `json:"exercises,omitempty"`
 }
 
 type WorkoutExerciseLog struct {
     ID                      int   `json:"id"`
     WorkoutID               int   `json:"workout_id"`
     ProgramWorkoutExerciseID int   `json:"program_workout_exercise_id"`
+    // ExerciseID is the exercise performed, which differs from the prescribed one when the
+    // user swapped it
+    ExerciseID              int   `json:"exercise_id"`
     ActualReps              []int `json:"actual_reps"`
     ActualRIR               []int `json:"actual_rir"`
+    Sets                    []*WorkoutSetLog `json:"sets"`
     CreatedAt               time.Time `json:"created_at"`
 }
+
+// Set types recorded against a WorkoutSetLog
+const (
+    SetTypeWarmUp  = "warm_up"
+    SetTypeWorking = "working"
+    SetTypeDrop    = "drop"
+    SetTypeFailure = "failure"
+)
+
+// Weight units accepted for a WorkoutSetLog
+const (
+    WeightUnitKg = "kg"
+    WeightUnitLb = "lb"
+)
+
+const kgPerLb = 0.45359237
+
+// WorkoutSetLog is a single performed set of an exercise within a workout
+type WorkoutSetLog struct {
+    ID                int       `json:"id"`
+    WorkoutExerciseID int       `json:"workout_exercise_id"`
+    SetNumber         int       `json:"set_number"`
+    Weight            float64   `json:"weight"`
+    Unit              string    `json:"unit"`
+    Reps              int       `json:"reps"`
+    RIR               *int      `json:"rir,omitempty"`
+    RPE               *float64  `json:"rpe,omitempty"`
+    SetType           string    `json:"set_type"`
+    PerformedAt       time.Time `json:"performed_at"`
+    // EstimatedOneRepMax is derived when reading history, in kilograms; it is not stored
+    EstimatedOneRepMax float64  `json:"estimated_1rm,omitempty"`
+    CreatedAt         time.Time `json:"created_at"`
+}
+
+// WeightKg returns the set's load normalised to kilograms
+func (s *WorkoutSetLog) WeightKg() float64 {
+    if s.Unit == WeightUnitLb {
+        return s.Weight * kgPerLb
+    }
+    return s.Weight
+}
+
+// IsWorkingSet reports whether the set counts towards progression
+func (s *WorkoutSetLog) IsWorkingSet() bool {
+    return s.SetType != SetTypeWarmUp
+}
@@ -0,0 +1,27 @@
+package models
+
+import "time"
+
+// Personal record types
+const (
+	RecordTypeE1RM   = "e1rm"
+	RecordTypeRepMax = "rep_max"
+)
+
+// PersonalRecord is a best-ever performance for an exercise, kept as a history of improvements
+type PersonalRecord struct {
+	ID                 int       `json:"id"`
+	UserID             string    `json:"user_id"`
+	ExerciseID         int       `json:"exercise_id"`
+	RecordType         string    `json:"record_type"`
+	Reps               int       `json:"reps"`
+	Weight             float64   `json:"weight"`
+	Unit               string    `json:"unit"`
+	WeightKg           float64   `json:"weight_kg"`
+	EstimatedOneRepMax float64   `json:"estimated_1rm"`
+	Formula            string    `json:"formula"`
+	WorkoutID          *int      `json:"workout_id,omitempty"`
+	WorkoutSetID       *int      `json:"workout_set_id,omitempty"`
+	AchievedAt         time.Time `json:"achieved_at"`
+	CreatedAt          time.Time `json:"created_at"`
+}
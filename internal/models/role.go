@@ -0,0 +1,71 @@
+package models
+
+// Account roles, stored on the user and embedded in access tokens
+const (
+	RoleUser  = "user"
+	RoleCoach = "coach"
+	RoleAdmin = "admin"
+)
+
+// Permission scopes. A user holds the scopes of their role plus any granted individually.
+// Changing roles is not a scope: it is reserved to the admin role so a scope can never be
+// used to grant itself more.
+const (
+	// PermissionUsersRead allows viewing any user's profile
+	PermissionUsersRead = "users:read"
+	// PermissionUsersWrite allows acting on any user's data without an access grant
+	PermissionUsersWrite = "users:write"
+	// PermissionGrantsWrite allows giving coaches access to users
+	PermissionGrantsWrite = "grants:write"
+	// PermissionCatalogWrite allows editing the program catalog
+	PermissionCatalogWrite = "catalog:write"
+)
+
+// RolePermissions are the scopes each role holds by default
+var RolePermissions = map[string][]string{
+	RoleUser:  {},
+	RoleCoach: {PermissionCatalogWrite},
+	RoleAdmin: {
+		PermissionUsersRead, PermissionUsersWrite, PermissionGrantsWrite, PermissionCatalogWrite,
+	},
+}
+
+// ValidRole reports whether role is a known role
+func ValidRole(role string) bool {
+	_, ok := RolePermissions[role]
+	return ok
+}
+
+// ValidPermission reports whether permission is a known scope
+func ValidPermission(permission string) bool {
+	switch permission {
+	case PermissionUsersRead, PermissionUsersWrite, PermissionGrantsWrite, PermissionCatalogWrite:
+		return true
+	}
+	return false
+}
+
+// EffectivePermissions returns the user's role scopes followed by their individual ones, without duplicates
+func (u *User) EffectivePermissions() []string {
+	seen := make(map[string]bool)
+	permissions := []string{}
+	for _, list := range [][]string{RolePermissions[u.Role], u.Permissions} {
+		for _, permission := range list {
+			if !seen[permission] {
+				seen[permission] = true
+				permissions = append(permissions, permission)
+			}
+		}
+	}
+	return permissions
+}
+
+// HasPermission reports whether the user holds permission through their role or individually
+func (u *User) HasPermission(permission string) bool {
+	for _, held := range u.EffectivePermissions() {
+		if held == permission {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,13 @@
+package models
+
+import "time"
+
+// SigningKey is an asymmetric key used to sign access tokens, identified in tokens by its KID.
+// The private key is stored encrypted; the public key is published in the JWKS.
+type SigningKey struct {
+	KID        string    `json:"kid"`
+	Algorithm  string    `json:"alg"`
+	PrivateKey []byte    `json:"-"` // encrypted PKCS#8 DER
+	PublicKey  []byte    `json:"-"` // PKIX DER
+	CreatedAt  time.Time `json:"created_at"`
+}
@@ -15,15 +15,34 @@ type User struct {
     Goal          string    `json:"goal"`
     ProgramID     int       `json:"program_id"`
     WeeklyBudget  float64   `json:"weekly_budget,omitempty"`
+    Timezone      string    `json:"timezone"` // IANA name, e.g. "Europe/London"
+    Role          string    `json:"role"`
+    Permissions   []string  `json:"permissions"` // granted in addition to the role's, see RolePermissions
+    TokenVersion  int       `json:"-"`        // bumped to revoke outstanding access tokens
+    EmailVerified bool      `json:"email_verified"`
     CreatedAt     time.Time `json:"created_at"`
     UpdatedAt     time.Time `json:"updated_at"`
 }
 
+// Location resolves the user's timezone, falling back to UTC if it is unset or unknown
+func (u *User) Location() *time.Location {
+    if u.Timezone == "" {
+        return time.UTC
+    }
+    loc, err := time.LoadLocation(u.Timezone)
+    if err != nil {
+        return time.UTC
+    }
+    return loc
+}
+
 
 type UserProgram struct {
     ID        int       `json:"id"`
     UserID    string    `json:"user_id"`
     ProgramID int       `json:"program_id"`
+    // ProgramVersionID is the version the user trains, fixed until they upgrade
+    ProgramVersionID int `json:"program_version_id"`
     StartDate time.Time `json:"start_date"`
     IsActive  bool      `json:"is_active"`
     CreatedAt time.Time `json:"created_at"`
@@ -34,8 +53,13 @@ type UserPreferences struct {
     Preferences []string `json:"preferences"`
     Allergies   []string `json:"allergies"`
     Dislikes    []string `json:"dislikes"`
+    // Equipment the user can train with; empty means a fully equipped gym
+    Equipment   []string `json:"equipment"`
 }
 
+// UserStats are a user's training totals. CompletedWorkouts counts logged exercise
+// entries, CompletedSessions counts finished workout sessions and TotalWeightLifted
+// is the tonnage (load x reps) in kilograms.
 type UserStats struct {
     ID                 string    `json:"id"`
     UserID             string    `json:"user_id"`
@@ -44,7 +68,7 @@ type UserStats struct {
     TotalWeightLifted  float64   `json:"total_weight_lifted"`
     CurrentStreak      int       `json:"current_streak"`
     LongestStreak      int       `json:"longest_streak"`
-    LastWorkoutDate    time.Time `json:"last_workout_date"`
+    LastWorkoutDate    *time.Time `json:"last_workout_date"`
     CreatedAt          time.Time `json:"created_at"`
     UpdatedAt          time.Time `json:"updated_at"`
 }
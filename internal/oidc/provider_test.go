@@ -0,0 +1,180 @@
+package oidc
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// mockIssuer is a minimal OpenID provider: discovery, a JWKS with one RSA key, and a token
+// endpoint that honours PKCE for a single pending authorization
+type mockIssuer struct {
+	server *httptest.Server
+	key    *rsa.PrivateKey
+
+	code, challenge, nonce string
+	claims                 jwt.MapClaims
+}
+
+func newMockIssuer(t *testing.T) *mockIssuer {
+	t.Helper()
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	m := &mockIssuer{key: key}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/.well-known/openid-configuration", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]string{
+			"issuer":                 m.server.URL,
+			"authorization_endpoint": m.server.URL + "/authorize",
+			"token_endpoint":         m.server.URL + "/token",
+			"jwks_uri":               m.server.URL + "/jwks",
+		})
+	})
+	mux.HandleFunc("/jwks", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]any{"keys": []map[string]string{{
+			"kty": "RSA", "kid": "k1", "use": "sig",
+			"n": base64.RawURLEncoding.EncodeToString(key.N.Bytes()),
+			"e": base64.RawURLEncoding.EncodeToString(big.NewInt(int64(key.E)).Bytes()),
+		}}})
+	})
+	mux.HandleFunc("/token", func(w http.ResponseWriter, r *http.Request) {
+		r.ParseForm()
+		if r.Form.Get("code") != m.code || CodeChallengeS256(r.Form.Get("code_verifier")) != m.challenge {
+			w.WriteHeader(http.StatusBadRequest)
+			json.NewEncoder(w).Encode(map[string]string{"error": "invalid_grant"})
+			return
+		}
+		json.NewEncoder(w).Encode(map[string]string{"id_token": m.sign(t, m.claims)})
+	})
+	m.server = httptest.NewServer(mux)
+	t.Cleanup(m.server.Close)
+	return m
+}
+
+func (m *mockIssuer) sign(t *testing.T, claims jwt.MapClaims) string {
+	t.Helper()
+	token := jwt.NewWithClaims(jwt.SigningMethodRS256, claims)
+	token.Header["kid"] = "k1"
+	signed, err := token.SignedString(m.key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return signed
+}
+
+// authorize stands in for the user signing in at the provider
+func (m *mockIssuer) authorize(t *testing.T, authCodeURL string, claims jwt.MapClaims) (code, state string) {
+	t.Helper()
+	parsed, err := url.Parse(authCodeURL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	query := parsed.Query()
+	if query.Get("code_challenge_method") != "S256" {
+		t.Fatalf("authorization request without PKCE: %s", authCodeURL)
+	}
+	m.code, m.challenge, m.nonce = "code-123", query.Get("code_challenge"), query.Get("nonce")
+	claims["nonce"] = m.nonce
+	m.claims = claims
+	return m.code, query.Get("state")
+}
+
+func (m *mockIssuer) provider() *Provider {
+	return NewProvider(ProviderConfig{
+		Name:        "mock",
+		Issuer:      m.server.URL,
+		ClientID:    "yoked",
+		RedirectURL: "http://localhost:3000/callback",
+		Scopes:      []string{"openid", "email"},
+	}, m.server.Client())
+}
+
+func (m *mockIssuer) claimsFor(subject string) jwt.MapClaims {
+	return jwt.MapClaims{
+		"iss":            m.server.URL,
+		"aud":            "yoked",
+		"sub":            subject,
+		"email":          "lifter@example.com",
+		"email_verified": "true",
+		"exp":            time.Now().Add(time.Minute).Unix(),
+		"iat":            time.Now().Unix(),
+	}
+}
+
+func TestAuthorizationCodeFlow(t *testing.T) {
+	ctx := context.Background()
+	issuer := newMockIssuer(t)
+	provider := issuer.provider()
+
+	verifier, _ := NewCodeVerifier()
+	authURL, err := provider.AuthCodeURL(ctx, "state-1", "nonce-1", CodeChallengeS256(verifier))
+	if err != nil {
+		t.Fatal(err)
+	}
+	code, state := issuer.authorize(t, authURL, issuer.claimsFor("user-1"))
+	if state != "state-1" {
+		t.Errorf("state %q", state)
+	}
+
+	claims, err := provider.Authenticate(ctx, code, verifier, "nonce-1")
+	if err != nil {
+		t.Fatalf("authenticate: %v", err)
+	}
+	if claims.Subject != "user-1" || claims.Email != "lifter@example.com" || !claims.EmailVerified {
+		t.Errorf("unexpected claims %+v", claims)
+	}
+
+	// Without the right verifier the code is useless
+	if _, err := provider.Authenticate(ctx, code, "wrong-verifier", "nonce-1"); err == nil {
+		t.Error("exchange succeeded with the wrong PKCE verifier")
+	}
+}
+
+func TestVerifyIDTokenRejections(t *testing.T) {
+	ctx := context.Background()
+	issuer := newMockIssuer(t)
+	provider := issuer.provider()
+
+	tests := map[string]func(jwt.MapClaims){
+		"wrong audience": func(c jwt.MapClaims) { c["aud"] = "someone-else" },
+		"wrong issuer":   func(c jwt.MapClaims) { c["iss"] = "https://evil.example.com" },
+		"expired":        func(c jwt.MapClaims) { c["exp"] = time.Now().Add(-time.Minute).Unix() },
+		"wrong nonce":    func(c jwt.MapClaims) { c["nonce"] = "replayed" },
+	}
+	for name, tamper := range tests {
+		t.Run(name, func(t *testing.T) {
+			claims := issuer.claimsFor("user-1")
+			claims["nonce"] = "nonce-1"
+			tamper(claims)
+			if _, err := provider.VerifyIDToken(ctx, issuer.sign(t, claims), "nonce-1"); !errors.Is(err, ErrInvalidIDToken) {
+				t.Errorf("got %v, want ErrInvalidIDToken", err)
+			}
+		})
+	}
+
+	t.Run("signed by another key", func(t *testing.T) {
+		other, _ := rsa.GenerateKey(rand.Reader, 2048)
+		claims := issuer.claimsFor("user-1")
+		claims["nonce"] = "nonce-1"
+		token := jwt.NewWithClaims(jwt.SigningMethodRS256, claims)
+		token.Header["kid"] = "k1"
+		signed, _ := token.SignedString(other)
+		if _, err := provider.VerifyIDToken(ctx, signed, "nonce-1"); !errors.Is(err, ErrInvalidIDToken) {
+			t.Errorf("got %v", err)
+		}
+	})
+}
@@ -0,0 +1,100 @@
+package services
+
+import (
+	"archive/zip"
+	"encoding/csv"
+	"encoding/json"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+
+	"yoked_backend/internal/models"
+)
+
+// WriteAccountArchive writes export as a zip: account.json holds everything, and the training
+// history is repeated as CSV files that open in a spreadsheet
+func WriteAccountArchive(w io.Writer, export *models.AccountExport) error {
+	archive := zip.NewWriter(w)
+
+	file, err := archive.Create("account.json")
+	if err != nil {
+		return err
+	}
+	encoder := json.NewEncoder(file)
+	encoder.SetIndent("", "  ")
+	if err := encoder.Encode(export); err != nil {
+		return err
+	}
+
+	workouts := [][]string{{"workout_id", "user_program_id", "program_workout_id", "status", "started_at", "completed_at", "abandoned_at", "duration_seconds", "notes"}}
+	sets := [][]string{{"workout_id", "workout_exercise_id", "program_workout_exercise_id", "set_number", "weight", "unit", "reps", "rir", "rpe", "set_type", "performed_at", "exercise_id"}}
+	for _, workout := range export.Workouts {
+		workouts = append(workouts, []string{
+			strconv.Itoa(workout.ID), strconv.Itoa(workout.UserProgramID), strconv.Itoa(workout.ProgramWorkoutID),
+			workout.Status, formatCSVTime(&workout.StartedAt), formatCSVTime(workout.CompletedAt),
+			formatCSVTime(workout.AbandonedAt), formatCSVInt(workout.DurationSeconds), csvText(workout.Notes),
+		})
+		for _, exercise := range workout.Exercises {
+			for _, set := range exercise.Sets {
+				rpe := ""
+				if set.RPE != nil {
+					rpe = strconv.FormatFloat(*set.RPE, 'f', -1, 64)
+				}
+				sets = append(sets, []string{
+					strconv.Itoa(workout.ID), strconv.Itoa(exercise.ID), strconv.Itoa(exercise.ProgramWorkoutExerciseID),
+					strconv.Itoa(set.SetNumber), strconv.FormatFloat(set.Weight, 'f', -1, 64), set.Unit,
+					strconv.Itoa(set.Reps), formatCSVInt(set.RIR), rpe, set.SetType, formatCSVTime(&set.PerformedAt),
+					strconv.Itoa(exercise.ExerciseID),
+				})
+			}
+		}
+	}
+
+	records := [][]string{{"exercise_id", "record_type", "reps", "weight", "unit", "weight_kg", "estimated_1rm", "formula", "workout_id", "achieved_at"}}
+	for _, record := range export.PersonalRecords {
+		records = append(records, []string{
+			strconv.Itoa(record.ExerciseID), record.RecordType, strconv.Itoa(record.Reps),
+			strconv.FormatFloat(record.Weight, 'f', -1, 64), record.Unit, strconv.FormatFloat(record.WeightKg, 'f', -1, 64),
+			strconv.FormatFloat(record.EstimatedOneRepMax, 'f', -1, 64), record.Formula,
+			formatCSVInt(record.WorkoutID), formatCSVTime(&record.AchievedAt),
+		})
+	}
+
+	for _, table := range []struct {
+		name string
+		rows [][]string
+	}{{"workouts.csv", workouts}, {"sets.csv", sets}, {"personal_records.csv", records}} {
+		file, err := archive.Create(table.name)
+		if err != nil {
+			return err
+		}
+		if err := csv.NewWriter(file).WriteAll(table.rows); err != nil {
+			return err
+		}
+	}
+
+	return archive.Close()
+}
+
+func formatCSVTime(t *time.Time) string {
+	if t == nil {
+		return ""
+	}
+	return t.UTC().Format(time.RFC3339)
+}
+
+func formatCSVInt(n *int) string {
+	if n == nil {
+		return ""
+	}
+	return strconv.Itoa(*n)
+}
+
+// csvText stops free text from being run as a formula when the file is opened in a spreadsheet
+func csvText(s string) string {
+	if s != "" && strings.ContainsRune("=+-@\t\r", rune(s[0])) {
+		return "'" + s
+	}
+	return s
+}
@@ -0,0 +1,154 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"time"
+
+	"yoked_backend/internal/db/repositories"
+	"yoked_backend/internal/models"
+)
+
+// DefaultAccountDeletionGracePeriod is how long a deleted account waits before it is purged
+const DefaultAccountDeletionGracePeriod = 30 * 24 * time.Hour
+
+// AccountDeletionGracePeriodFromEnv reads ACCOUNT_DELETION_GRACE_PERIOD as a Go duration,
+// e.g. "720h". Zero purges on the next sweep.
+func AccountDeletionGracePeriodFromEnv() (time.Duration, error) {
+	value := os.Getenv("ACCOUNT_DELETION_GRACE_PERIOD")
+	if value == "" {
+		return DefaultAccountDeletionGracePeriod, nil
+	}
+	period, err := time.ParseDuration(value)
+	if err != nil || period < 0 {
+		return 0, fmt.Errorf("invalid ACCOUNT_DELETION_GRACE_PERIOD %q", value)
+	}
+	return period, nil
+}
+
+// AccountService closes accounts and hands users their data. Deleting an account signs it out
+// everywhere at once; its data is only removed after the grace period, by PurgeDeletedAccounts.
+type AccountService interface {
+	// DeleteAccount schedules the account for purging and returns when that happens. Callers
+	// confirm the user's password first.
+	DeleteAccount(ctx context.Context, userID string) (time.Time, error)
+	PurgeDeletedAccounts(ctx context.Context) (int64, error)
+	Export(ctx context.Context, userID string) (*models.AccountExport, error)
+}
+
+type accountService struct {
+	userRepo      repositories.UserRepository
+	programRepo   repositories.ProgramRepository
+	recordRepo    repositories.RecordRepository
+	tokenRepo     repositories.TokenRepository
+	identityRepo  repositories.IdentityRepository
+	overrideRepo  repositories.ExerciseOverrideRepository
+	grantRepo     repositories.AccessGrantRepository
+	txManager     repositories.TxManager
+	tokenVersions TokenVersionStore
+	gracePeriod   time.Duration
+	now           func() time.Time
+}
+
+func NewAccountService(userRepo repositories.UserRepository, programRepo repositories.ProgramRepository, recordRepo repositories.RecordRepository, tokenRepo repositories.TokenRepository, identityRepo repositories.IdentityRepository, overrideRepo repositories.ExerciseOverrideRepository, grantRepo repositories.AccessGrantRepository, txManager repositories.TxManager, tokenVersions TokenVersionStore, gracePeriod time.Duration) AccountService {
+	return &accountService{
+		userRepo:      userRepo,
+		programRepo:   programRepo,
+		recordRepo:    recordRepo,
+		tokenRepo:     tokenRepo,
+		identityRepo:  identityRepo,
+		overrideRepo:  overrideRepo,
+		grantRepo:     grantRepo,
+		txManager:     txManager,
+		tokenVersions: tokenVersions,
+		gracePeriod:   gracePeriod,
+		now:           time.Now,
+	}
+}
+
+func (s *accountService) DeleteAccount(ctx context.Context, userID string) (time.Time, error) {
+	err := s.txManager.WithinTx(ctx, func(ctx context.Context) error {
+		// The soft delete bumps the token version, which kills outstanding access tokens
+		if err := s.userRepo.DeleteUser(ctx, userID); err != nil {
+			return err
+		}
+		return s.tokenRepo.RevokeUserRefreshTokens(ctx, userID)
+	})
+	if err != nil {
+		return time.Time{}, err
+	}
+	s.tokenVersions.Forget(userID)
+
+	purgeAt := s.now().Add(s.gracePeriod)
+	log.Printf("AUDIT account deletion: user %s deleted, data purged after %s", userID, purgeAt.Format(time.RFC3339))
+	return purgeAt, nil
+}
+
+// PurgeDeletedAccounts permanently removes accounts whose grace period has passed
+func (s *accountService) PurgeDeletedAccounts(ctx context.Context) (int64, error) {
+	return s.userRepo.PurgeDeletedUsers(ctx, s.now().Add(-s.gracePeriod))
+}
+
+// Export gathers everything stored against the user. Secrets such as the password hash,
+// token hashes and 2FA secrets are left out.
+func (s *accountService) Export(ctx context.Context, userID string) (*models.AccountExport, error) {
+	user, err := s.userRepo.GetUserByID(ctx, userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get user: %w", err)
+	}
+	user.PasswordHash = ""
+
+	export := &models.AccountExport{ExportedAt: s.now(), User: user}
+	if export.Preferences, err = s.userRepo.GetUserPreferences(ctx, userID); err != nil {
+		return nil, fmt.Errorf("failed to export preferences: %w", err)
+	}
+	if export.Stats, err = s.userRepo.GetUserStats(ctx, userID); err != nil {
+		return nil, fmt.Errorf("failed to export stats: %w", err)
+	}
+	if export.Programs, err = s.programRepo.GetUserPrograms(ctx, userID); err != nil {
+		return nil, fmt.Errorf("failed to export programs: %w", err)
+	}
+	if export.Workouts, err = s.programRepo.GetUserWorkoutHistory(ctx, userID); err != nil {
+		return nil, fmt.Errorf("failed to export workouts: %w", err)
+	}
+	if export.PersonalRecords, err = s.recordRepo.GetRecordHistoryByUser(ctx, userID); err != nil {
+		return nil, fmt.Errorf("failed to export personal records: %w", err)
+	}
+	if export.Sessions, err = s.tokenRepo.GetUserSessions(ctx, userID); err != nil {
+		return nil, fmt.Errorf("failed to export sessions: %w", err)
+	}
+	if export.Identities, err = s.identityRepo.GetUserIdentities(ctx, userID); err != nil {
+		return nil, fmt.Errorf("failed to export identities: %w", err)
+	}
+	if export.Overrides, err = s.overrideRepo.GetUserOverrides(ctx, userID); err != nil {
+		return nil, fmt.Errorf("failed to export exercise overrides: %w", err)
+	}
+	if export.AccessGrants, err = s.grantRepo.GetUserAccessGrants(ctx, userID); err != nil {
+		return nil, fmt.Errorf("failed to export access grants: %w", err)
+	}
+	return export, nil
+}
+
+// RunAccountPurge purges accounts past their grace period every interval until ctx is cancelled
+func RunAccountPurge(ctx context.Context, accounts AccountService, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			purged, err := accounts.PurgeDeletedAccounts(ctx)
+			if err != nil {
+				log.Printf("Failed to purge deleted accounts: %v", err)
+				continue
+			}
+			if purged > 0 {
+				log.Printf("AUDIT account purge: permanently removed %d deleted accounts", purged)
+			}
+		}
+	}
+}
@@ -0,0 +1,190 @@
+package services
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"testing"
+	"time"
+
+	"yoked_backend/internal/db/repositories"
+	"yoked_backend/internal/models"
+)
+
+func (f *fakeUserRepo) DeleteUser(ctx context.Context, id string) error {
+	user, ok := f.users[id]
+	if !ok {
+		return repositories.ErrNotFound
+	}
+	delete(f.users, id)
+	f.deleted = append(f.deleted, user)
+	return nil
+}
+
+func (f *fakeUserRepo) PurgeDeletedUsers(ctx context.Context, deletedBefore time.Time) (int64, error) {
+	f.purgedBefore = deletedBefore
+	return int64(len(f.deleted)), nil
+}
+
+func (f *fakeUserRepo) GetUserPreferences(ctx context.Context, userID string) (*models.UserPreferences, error) {
+	return &models.UserPreferences{UserID: userID}, nil
+}
+
+func (f *fakeUserRepo) GetUserStats(ctx context.Context, userID string) (*models.UserStats, error) {
+	return &models.UserStats{UserID: userID}, nil
+}
+
+func (f *fakeProgramRepo) GetUserPrograms(ctx context.Context, userID string) ([]*models.UserProgram, error) {
+	var userPrograms []*models.UserProgram
+	for _, userProgram := range f.userPrograms {
+		if userProgram.UserID == userID {
+			userPrograms = append(userPrograms, userProgram)
+		}
+	}
+	return userPrograms, nil
+}
+
+func (f *fakeProgramRepo) GetUserWorkoutHistory(ctx context.Context, userID string) ([]*models.WorkoutSession, error) {
+	var sessions []*models.WorkoutSession
+	for _, session := range f.sessions {
+		if userProgram := f.userPrograms[session.UserProgramID]; userProgram != nil && userProgram.UserID == userID {
+			sessions = append(sessions, session)
+		}
+	}
+	return sessions, nil
+}
+
+func (f *fakeRecordRepo) GetRecordHistoryByUser(ctx context.Context, userID string) ([]*models.PersonalRecord, error) {
+	return f.created, nil
+}
+
+func TestDeleteAccount(t *testing.T) {
+	ctx := context.Background()
+	clock := &fakeClock{now: time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)}
+	users := &fakeUserRepo{users: map[string]*models.User{"u1": {ID: "u1", Email: "lifter@example.com"}}}
+	tokens := newFakeTokenRepo()
+	auth := NewAuthService(users, tokens, passthroughTx{}, &recordingNotifier{}, NewSessionCache(tokens, time.Minute))
+	session, _ := auth.IssueRefreshToken(ctx, "u1", testDevice)
+
+	accounts := NewAccountService(users, nil, nil, tokens, nil, nil, nil, passthroughTx{}, NewTokenVersionCache(users, time.Minute), 30*24*time.Hour).(*accountService)
+	accounts.now = clock.Now
+
+	purgeAt, err := accounts.DeleteAccount(ctx, "u1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := clock.now.Add(30 * 24 * time.Hour); !purgeAt.Equal(want) {
+		t.Errorf("purge at %s, want %s", purgeAt, want)
+	}
+	if _, _, err := auth.RotateRefreshToken(ctx, session.Token, testDevice); !errors.Is(err, ErrInvalidRefreshToken) {
+		t.Errorf("deleted account kept its session: %v", err)
+	}
+	if _, err := accounts.DeleteAccount(ctx, "u1"); !errors.Is(err, repositories.ErrNotFound) {
+		t.Errorf("deleting twice: got %v", err)
+	}
+
+	// Only accounts deleted before the grace period began are purged
+	if _, err := accounts.PurgeDeletedAccounts(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if want := clock.now.Add(-30 * 24 * time.Hour); !users.purgedBefore.Equal(want) {
+		t.Errorf("purged accounts deleted before %s, want %s", users.purgedBefore, want)
+	}
+}
+
+func TestExportAccount(t *testing.T) {
+	ctx := context.Background()
+	_, programs, records := newSwappedProgram(t)
+	users := &fakeUserRepo{users: map[string]*models.User{"athlete": {ID: "athlete", Email: "athlete@example.com", PasswordHash: "hash"}}}
+	overrides := &fakeOverrideRepo{overrides: []*models.ExerciseOverride{
+		{ID: 1, UserID: "athlete", ProgramID: 7, ExerciseID: 1, SubstituteExerciseID: 2},
+		{ID: 2, UserID: "someone-else", ProgramID: 7, ExerciseID: 1, SubstituteExerciseID: 3},
+	}}
+	grants := &fakeGrantRepo{grants: map[[2]string]bool{{"coach", "athlete"}: true, {"coach", "someone-else"}: true}}
+	accounts := NewAccountService(users, programs, records, newFakeTokenRepo(), newFakeIdentityRepo(), overrides, grants, passthroughTx{}, NewTokenVersionCache(users, time.Minute), time.Hour)
+
+	export, err := accounts.Export(ctx, "athlete")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if export.User.PasswordHash != "" {
+		t.Error("password hash exported")
+	}
+	if len(export.Programs) != 1 || len(export.Workouts) != 1 {
+		t.Errorf("got %d programs and %d workouts", len(export.Programs), len(export.Workouts))
+	}
+	if len(export.Overrides) != 1 || export.Overrides[0].SubstituteExerciseID != 2 {
+		t.Errorf("unexpected exercise overrides %+v", export.Overrides)
+	}
+	if len(export.AccessGrants) != 1 || export.AccessGrants[0].GranteeID != "coach" {
+		t.Errorf("unexpected access grants %+v", export.AccessGrants)
+	}
+}
+
+func TestWriteAccountArchive(t *testing.T) {
+	completed := time.Date(2026, 3, 1, 13, 0, 0, 0, time.UTC)
+	rir := 2
+	export := &models.AccountExport{
+		ExportedAt: completed,
+		User:       &models.User{ID: "u1", Email: "lifter@example.com"},
+		Workouts: []*models.WorkoutSession{{
+			ID: 7, UserProgramID: 3, ProgramWorkoutID: 11, Status: "completed",
+			StartedAt: completed.Add(-time.Hour), CompletedAt: &completed, Notes: "=HYPERLINK(\"evil\")",
+			Exercises: []*models.WorkoutExerciseLog{{
+				ID: 21, WorkoutID: 7, ProgramWorkoutExerciseID: 5,
+				Sets: []*models.WorkoutSetLog{{SetNumber: 1, Weight: 100, Unit: "kg", Reps: 5, RIR: &rir, SetType: "working", PerformedAt: completed}},
+			}},
+		}},
+		Overrides: []*models.ExerciseOverride{{ID: 1, UserID: "u1", ProgramID: 3, ExerciseID: 1, SubstituteExerciseID: 2}},
+	}
+
+	var buf bytes.Buffer
+	if err := WriteAccountArchive(&buf, export); err != nil {
+		t.Fatal(err)
+	}
+	archive, err := zip.NewReader(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	files := map[string]*zip.File{}
+	for _, file := range archive.File {
+		files[file.Name] = file
+	}
+	for _, name := range []string{"account.json", "workouts.csv", "sets.csv", "personal_records.csv"} {
+		if files[name] == nil {
+			t.Fatalf("archive is missing %s", name)
+		}
+	}
+
+	readCSV := func(name string) [][]string {
+		file, _ := files[name].Open()
+		defer file.Close()
+		rows, err := csv.NewReader(file).ReadAll()
+		if err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		return rows
+	}
+	workouts := readCSV("workouts.csv")
+	if len(workouts) != 2 || workouts[1][0] != "7" || workouts[1][8] != "'=HYPERLINK(\"evil\")" {
+		t.Errorf("unexpected workouts.csv %q", workouts)
+	}
+	sets := readCSV("sets.csv")
+	if len(sets) != 2 || sets[1][4] != "100" || sets[1][7] != "2" || sets[1][8] != "" {
+		t.Errorf("unexpected sets.csv %q", sets)
+	}
+
+	file, _ := files["account.json"].Open()
+	defer file.Close()
+	var decoded models.AccountExport
+	if err := json.NewDecoder(file).Decode(&decoded); err != nil {
+		t.Fatal(err)
+	}
+	if decoded.User.Email != "lifter@example.com" || len(decoded.Workouts[0].Exercises[0].Sets) != 1 || len(decoded.Overrides) != 1 {
+		t.Errorf("unexpected account.json %+v", decoded)
+	}
+}
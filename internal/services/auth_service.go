@@ -0,0 +1,252 @@
+package services
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"yoked_backend/internal/db/repositories"
+	"yoked_backend/internal/models"
+)
+
+// RefreshTokenTTL is how long a refresh token stays usable if it is never rotated
+const RefreshTokenTTL = 30 * 24 * time.Hour
+
+var (
+	// ErrInvalidRefreshToken covers unknown, expired and revoked refresh tokens
+	ErrInvalidRefreshToken = errors.New("invalid or expired refresh token")
+	// ErrRefreshTokenReused means an already rotated token was presented again; its family is revoked
+	ErrRefreshTokenReused = errors.New("refresh token reuse detected, please log in again")
+)
+
+// IssuedRefreshToken is the opaque token handed to the client. Only its hash is stored.
+type IssuedRefreshToken struct {
+	Token     string    `json:"refresh_token"`
+	ExpiresAt time.Time `json:"refresh_token_expires_at"`
+	FamilyID  string    `json:"-"`
+}
+
+// DeviceInfo describes the client a session is used from
+type DeviceInfo struct {
+	Name      string // chosen by the client, e.g. "Alex's iPhone"
+	UserAgent string
+	IPAddress string
+}
+
+type AuthService interface {
+	// IssueRefreshToken starts a session on device, raising a new device event if the user
+	// has signed in before but never from this device
+	IssueRefreshToken(ctx context.Context, userID string, device DeviceInfo) (*IssuedRefreshToken, error)
+	RotateRefreshToken(ctx context.Context, refreshToken string, device DeviceInfo) (*models.User, *IssuedRefreshToken, error)
+	RevokeRefreshToken(ctx context.Context, userID, refreshToken string) error
+	RevokeAllRefreshTokens(ctx context.Context, userID string) error
+	ListSessions(ctx context.Context, userID string) ([]*models.Session, error)
+	RevokeSession(ctx context.Context, userID, sessionID string) error
+}
+
+type authService struct {
+	userRepo  repositories.UserRepository
+	tokenRepo repositories.TokenRepository
+	txManager repositories.TxManager
+	notifier  SecurityNotifier
+	sessions  RevokedSessionStore
+	now       func() time.Time
+}
+
+func NewAuthService(userRepo repositories.UserRepository, tokenRepo repositories.TokenRepository, txManager repositories.TxManager, notifier SecurityNotifier, sessions RevokedSessionStore) AuthService {
+	return &authService{userRepo: userRepo, tokenRepo: tokenRepo, txManager: txManager, notifier: notifier, sessions: sessions, now: time.Now}
+}
+
+// hashRefreshToken is the lookup key stored in place of the token itself
+func hashRefreshToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+func newOpaqueToken() (string, error) {
+	buf := make([]byte, 32)
+	if _, err := rand.Read(buf); err != nil {
+		return "", fmt.Errorf("failed to generate token: %w", err)
+	}
+	return base64.RawURLEncoding.EncodeToString(buf), nil
+}
+
+// issue stores a new token in familyID, or in a new family when familyID is empty
+func (s *authService) issue(ctx context.Context, userID, familyID string) (*IssuedRefreshToken, error) {
+	raw, err := newOpaqueToken()
+	if err != nil {
+		return nil, err
+	}
+
+	token := &models.RefreshToken{
+		UserID:    userID,
+		FamilyID:  familyID,
+		TokenHash: hashRefreshToken(raw),
+		ExpiresAt: s.now().Add(RefreshTokenTTL),
+	}
+	if err := s.tokenRepo.CreateRefreshToken(ctx, token); err != nil {
+		return nil, err
+	}
+
+	return &IssuedRefreshToken{Token: raw, ExpiresAt: token.ExpiresAt, FamilyID: token.FamilyID}, nil
+}
+
+// IssueRefreshToken records a session for a fresh login and starts its token family
+func (s *authService) IssueRefreshToken(ctx context.Context, userID string, device DeviceInfo) (*IssuedRefreshToken, error) {
+	session := &models.Session{
+		UserID:     userID,
+		DeviceName: device.Name,
+		UserAgent:  device.UserAgent,
+		IPAddress:  device.IPAddress,
+	}
+
+	var issued *IssuedRefreshToken
+	newDevice := false
+	err := s.txManager.WithinTx(ctx, func(ctx context.Context) error {
+		total, sameDevice, err := s.tokenRepo.CountUserSessions(ctx, userID, device.Name, device.UserAgent)
+		if err != nil {
+			return err
+		}
+		// The very first login is not news to anyone
+		newDevice = total > 0 && sameDevice == 0
+
+		if err := s.tokenRepo.CreateSession(ctx, session); err != nil {
+			return err
+		}
+		issued, err = s.issue(ctx, userID, session.ID)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if newDevice {
+		event := SecurityEvent{Type: SecurityEventNewDevice, UserID: userID, Session: session, OccurredAt: s.now()}
+		if err := s.notifier.Notify(ctx, event); err != nil {
+			log.Printf("Failed to send %s notification to user %s: %v", event.Type, userID, err)
+		}
+	}
+
+	return issued, nil
+}
+
+// lookup resolves a presented token, treating an unknown token as invalid
+func (s *authService) lookup(ctx context.Context, refreshToken string) (*models.RefreshToken, error) {
+	if refreshToken == "" {
+		return nil, ErrInvalidRefreshToken
+	}
+	stored, err := s.tokenRepo.GetRefreshTokenByHash(ctx, hashRefreshToken(refreshToken))
+	if errors.Is(err, repositories.ErrNotFound) {
+		return nil, ErrInvalidRefreshToken
+	}
+	return stored, err
+}
+
+// RotateRefreshToken exchanges a live refresh token for a new one in the same family, and
+// marks the session as seen from device. Presenting a token that was already rotated means
+// it leaked, so the family is revoked.
+func (s *authService) RotateRefreshToken(ctx context.Context, refreshToken string, device DeviceInfo) (*models.User, *IssuedRefreshToken, error) {
+	stored, err := s.lookup(ctx, refreshToken)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if stored.RotatedAt != nil {
+		if err := s.revokeFamily(ctx, stored.FamilyID); err != nil {
+			return nil, nil, err
+		}
+		return nil, nil, ErrRefreshTokenReused
+	}
+	if stored.RevokedAt != nil || !s.now().Before(stored.ExpiresAt) {
+		return nil, nil, ErrInvalidRefreshToken
+	}
+
+	user, err := s.userRepo.GetUserByID(ctx, stored.UserID)
+	if errors.Is(err, repositories.ErrNotFound) {
+		return nil, nil, ErrInvalidRefreshToken
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var issued *IssuedRefreshToken
+	err = s.txManager.WithinTx(ctx, func(ctx context.Context) error {
+		if err := s.tokenRepo.RotateRefreshToken(ctx, stored.ID); err != nil {
+			return err
+		}
+		if err := s.tokenRepo.TouchSession(ctx, stored.FamilyID, device.IPAddress, device.UserAgent); err != nil {
+			return err
+		}
+		issued, err = s.issue(ctx, stored.UserID, stored.FamilyID)
+		return err
+	})
+	if errors.Is(err, repositories.ErrNotFound) {
+		// Another request rotated the same token first
+		if err := s.revokeFamily(ctx, stored.FamilyID); err != nil {
+			return nil, nil, err
+		}
+		return nil, nil, ErrRefreshTokenReused
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return user, issued, nil
+}
+
+// RevokeRefreshToken logs out one device by revoking the token's whole family
+func (s *authService) RevokeRefreshToken(ctx context.Context, userID, refreshToken string) error {
+	stored, err := s.lookup(ctx, refreshToken)
+	if err != nil {
+		return err
+	}
+	if stored.UserID != userID {
+		return ErrInvalidRefreshToken
+	}
+	return s.revokeFamily(ctx, stored.FamilyID)
+}
+
+// revokeFamily ends the session the family belongs to, access tokens included
+func (s *authService) revokeFamily(ctx context.Context, familyID string) error {
+	if err := s.tokenRepo.RevokeTokenFamily(ctx, familyID); err != nil {
+		return err
+	}
+	s.sessions.MarkRevoked(familyID)
+	return nil
+}
+
+// RevokeAllRefreshTokens logs the user out everywhere
+func (s *authService) RevokeAllRefreshTokens(ctx context.Context, userID string) error {
+	sessions, err := s.tokenRepo.GetUserSessions(ctx, userID)
+	if err != nil {
+		return err
+	}
+	if err := s.tokenRepo.RevokeUserRefreshTokens(ctx, userID); err != nil {
+		return err
+	}
+	for _, session := range sessions {
+		s.sessions.MarkRevoked(session.ID)
+	}
+	return nil
+}
+
+// ListSessions returns the devices the user is signed in on
+func (s *authService) ListSessions(ctx context.Context, userID string) ([]*models.Session, error) {
+	return s.tokenRepo.GetUserSessions(ctx, userID)
+}
+
+// RevokeSession signs one device out remotely. Its access token is refused from then on by
+// this instance, and by the others once their cached answer expires.
+func (s *authService) RevokeSession(ctx context.Context, userID, sessionID string) error {
+	if err := s.tokenRepo.RevokeSession(ctx, userID, sessionID); err != nil {
+		return err
+	}
+	s.sessions.MarkRevoked(sessionID)
+	return nil
+}
@@ -0,0 +1,210 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"yoked_backend/internal/db/repositories"
+	"yoked_backend/internal/models"
+)
+
+// passthroughTx runs units of work directly; the fakes have no transactions to join
+type passthroughTx struct{}
+
+func (passthroughTx) WithinTx(ctx context.Context, fn func(ctx context.Context) error) error {
+	return fn(ctx)
+}
+
+// fakeUserRepo serves users from memory; methods a test does not need are left unimplemented
+type fakeUserRepo struct {
+	repositories.UserRepository
+	users   map[string]*models.User
+	lookups int
+	sentAt  map[string]time.Time // verification emails, by user
+	resetAt map[string]time.Time // password reset emails, by user
+
+	deleted      []*models.User
+	purgedBefore time.Time
+}
+
+func (f *fakeUserRepo) GetUserByID(ctx context.Context, id string) (*models.User, error) {
+	user, ok := f.users[id]
+	if !ok {
+		return nil, repositories.ErrNotFound
+	}
+	copied := *user
+	return &copied, nil
+}
+
+func (f *fakeUserRepo) GetTokenVersion(ctx context.Context, userID string) (int, error) {
+	f.lookups++
+	user, ok := f.users[userID]
+	if !ok {
+		return 0, repositories.ErrNotFound
+	}
+	return user.TokenVersion, nil
+}
+
+type fakeTokenRepo struct {
+	tokens         map[string]*models.RefreshToken // by hash
+	families       int
+	resets         map[string]*models.PasswordResetToken // by hash
+	sessions       []*models.Session
+	sessionLookups int
+}
+
+func newFakeTokenRepo() *fakeTokenRepo {
+	return &fakeTokenRepo{
+		tokens: make(map[string]*models.RefreshToken),
+		resets: make(map[string]*models.PasswordResetToken),
+	}
+}
+
+func (f *fakeTokenRepo) CreateRefreshToken(ctx context.Context, token *models.RefreshToken) error {
+	if token.FamilyID == "" {
+		f.families++
+		token.FamilyID = fmt.Sprintf("family-%d", f.families)
+	}
+	token.ID = fmt.Sprintf("token-%d", len(f.tokens)+1)
+	stored := *token
+	f.tokens[token.TokenHash] = &stored
+	return nil
+}
+
+func (f *fakeTokenRepo) GetRefreshTokenByHash(ctx context.Context, tokenHash string) (*models.RefreshToken, error) {
+	token, ok := f.tokens[tokenHash]
+	if !ok {
+		return nil, repositories.ErrNotFound
+	}
+	copied := *token
+	return &copied, nil
+}
+
+func (f *fakeTokenRepo) each(match func(*models.RefreshToken) bool, apply func(*models.RefreshToken)) {
+	for _, token := range f.tokens {
+		if match(token) {
+			apply(token)
+		}
+	}
+}
+
+func (f *fakeTokenRepo) RotateRefreshToken(ctx context.Context, id string) error {
+	for _, token := range f.tokens {
+		if token.ID == id && token.RotatedAt == nil && token.RevokedAt == nil {
+			now := time.Now()
+			token.RotatedAt = &now
+			return nil
+		}
+	}
+	return repositories.ErrNotFound
+}
+
+func revoke(token *models.RefreshToken) {
+	if token.RevokedAt == nil {
+		now := time.Now()
+		token.RevokedAt = &now
+	}
+}
+
+func (f *fakeTokenRepo) RevokeRefreshToken(ctx context.Context, id string) error {
+	f.each(func(t *models.RefreshToken) bool { return t.ID == id }, revoke)
+	return nil
+}
+
+func (f *fakeTokenRepo) RevokeTokenFamily(ctx context.Context, familyID string) error {
+	f.each(func(t *models.RefreshToken) bool { return t.FamilyID == familyID }, revoke)
+	return nil
+}
+
+func (f *fakeTokenRepo) RevokeUserRefreshTokens(ctx context.Context, userID string) error {
+	f.each(func(t *models.RefreshToken) bool { return t.UserID == userID }, revoke)
+	return nil
+}
+
+func newTestAuthService() (*authService, *fakeTokenRepo) {
+	tokens := newFakeTokenRepo()
+	users := &fakeUserRepo{users: map[string]*models.User{"u1": {ID: "u1", Email: "lifter@example.com"}}}
+	return NewAuthService(users, tokens, passthroughTx{}, &recordingNotifier{}, NewSessionCache(tokens, time.Minute)).(*authService), tokens
+}
+
+var testDevice = DeviceInfo{Name: "Pixel", UserAgent: "Yoked/1.0 (Android)", IPAddress: "203.0.113.7"}
+
+func TestRefreshTokenRotation(t *testing.T) {
+	ctx := context.Background()
+	svc, tokens := newTestAuthService()
+
+	first, err := svc.IssueRefreshToken(ctx, "u1", testDevice)
+	if err != nil {
+		t.Fatalf("issue: %v", err)
+	}
+	if _, ok := tokens.tokens[first.Token]; ok {
+		t.Fatal("refresh token stored in plain text")
+	}
+
+	user, second, err := svc.RotateRefreshToken(ctx, first.Token, testDevice)
+	if err != nil {
+		t.Fatalf("rotate: %v", err)
+	}
+	if user.ID != "u1" || second.Token == first.Token || second.FamilyID != first.FamilyID {
+		t.Fatalf("unexpected rotation result: user %s, family %s -> %s", user.ID, first.FamilyID, second.FamilyID)
+	}
+
+	// Replaying the first token is reuse: it fails and takes the live token down with it
+	if _, _, err := svc.RotateRefreshToken(ctx, first.Token, testDevice); !errors.Is(err, ErrRefreshTokenReused) {
+		t.Fatalf("replay: got %v, want ErrRefreshTokenReused", err)
+	}
+	if _, _, err := svc.RotateRefreshToken(ctx, second.Token, testDevice); !errors.Is(err, ErrInvalidRefreshToken) {
+		t.Fatalf("after reuse: got %v, want ErrInvalidRefreshToken", err)
+	}
+}
+
+func TestRefreshTokenRejections(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("unknown token", func(t *testing.T) {
+		svc, _ := newTestAuthService()
+		if _, _, err := svc.RotateRefreshToken(ctx, "nope", testDevice); !errors.Is(err, ErrInvalidRefreshToken) {
+			t.Errorf("got %v", err)
+		}
+	})
+
+	t.Run("expired token", func(t *testing.T) {
+		svc, _ := newTestAuthService()
+		issued, _ := svc.IssueRefreshToken(ctx, "u1", testDevice)
+		svc.now = func() time.Time { return time.Now().Add(RefreshTokenTTL + time.Minute) }
+		if _, _, err := svc.RotateRefreshToken(ctx, issued.Token, testDevice); !errors.Is(err, ErrInvalidRefreshToken) {
+			t.Errorf("got %v", err)
+		}
+	})
+
+	t.Run("logout revokes the device", func(t *testing.T) {
+		svc, _ := newTestAuthService()
+		issued, _ := svc.IssueRefreshToken(ctx, "u1", testDevice)
+		if err := svc.RevokeRefreshToken(ctx, "someone-else", issued.Token); !errors.Is(err, ErrInvalidRefreshToken) {
+			t.Errorf("another user's logout: got %v", err)
+		}
+		if err := svc.RevokeRefreshToken(ctx, "u1", issued.Token); err != nil {
+			t.Fatalf("logout: %v", err)
+		}
+		if _, _, err := svc.RotateRefreshToken(ctx, issued.Token, testDevice); !errors.Is(err, ErrInvalidRefreshToken) {
+			t.Errorf("after logout: got %v", err)
+		}
+	})
+
+	t.Run("logout everywhere", func(t *testing.T) {
+		svc, _ := newTestAuthService()
+		phone, _ := svc.IssueRefreshToken(ctx, "u1", testDevice)
+		laptop, _ := svc.IssueRefreshToken(ctx, "u1", testDevice)
+		if err := svc.RevokeAllRefreshTokens(ctx, "u1"); err != nil {
+			t.Fatalf("logout all: %v", err)
+		}
+		for _, token := range []string{phone.Token, laptop.Token} {
+			if _, _, err := svc.RotateRefreshToken(ctx, token, testDevice); !errors.Is(err, ErrInvalidRefreshToken) {
+				t.Errorf("after logout all: got %v", err)
+			}
+		}
+	})
+}
@@ -0,0 +1,82 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"yoked_backend/internal/db/repositories"
+	"yoked_backend/internal/models"
+)
+
+// ErrForbidden is returned when the caller may not act on the requested user's data
+var ErrForbidden = errors.New("you do not have access to this user's data")
+
+// Authorizer is the single policy for acting on user-scoped data. Users may always act on
+// their own data; acting on someone else's requires an access grant or the users:write scope.
+type Authorizer interface {
+	AuthorizeUser(ctx context.Context, actorID, userID string) error
+	GrantCoachAccess(ctx context.Context, coachID, userID string) (*models.AccessGrant, error)
+}
+
+type authorizer struct {
+	grantRepo repositories.AccessGrantRepository
+	userRepo  repositories.UserRepository
+}
+
+func NewAuthorizer(grantRepo repositories.AccessGrantRepository, userRepo repositories.UserRepository) Authorizer {
+	return &authorizer{grantRepo: grantRepo, userRepo: userRepo}
+}
+
+func (a *authorizer) AuthorizeUser(ctx context.Context, actorID, userID string) error {
+	if actorID == "" {
+		return ErrForbidden
+	}
+	if actorID == userID {
+		return nil
+	}
+
+	granted, err := a.grantRepo.HasAccessGrant(ctx, actorID, userID)
+	if err != nil {
+		return err
+	}
+	if granted {
+		return nil
+	}
+
+	actor, err := a.userRepo.GetUserByID(ctx, actorID)
+	if errors.Is(err, repositories.ErrNotFound) {
+		return ErrForbidden
+	}
+	if err != nil {
+		return err
+	}
+	if !actor.HasPermission(models.PermissionUsersWrite) {
+		return ErrForbidden
+	}
+	return nil
+}
+
+// GrantCoachAccess lets a coach act on one user's data
+func (a *authorizer) GrantCoachAccess(ctx context.Context, coachID, userID string) (*models.AccessGrant, error) {
+	if coachID == userID {
+		return nil, invalidInput("a user cannot be their own coach")
+	}
+
+	coach, err := a.userRepo.GetUserByID(ctx, coachID)
+	if err != nil {
+		return nil, fmt.Errorf("coach not found: %w", err)
+	}
+	if coach.Role != models.RoleCoach && coach.Role != models.RoleAdmin {
+		return nil, invalidInput("user %s does not have the coach role", coachID)
+	}
+	if _, err := a.userRepo.GetUserByID(ctx, userID); err != nil {
+		return nil, fmt.Errorf("user not found: %w", err)
+	}
+
+	grant := &models.AccessGrant{GranteeID: coachID, UserID: &userID, Role: models.GrantRoleCoach}
+	if err := a.grantRepo.CreateAccessGrant(ctx, grant); err != nil {
+		return nil, err
+	}
+	return grant, nil
+}
@@ -0,0 +1,96 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"yoked_backend/internal/models"
+)
+
+// fakeGrantRepo grants access for every grantee/user pair it holds
+type fakeGrantRepo struct {
+	grants map[[2]string]bool
+}
+
+func (f *fakeGrantRepo) CreateAccessGrant(ctx context.Context, grant *models.AccessGrant) error {
+	f.grants[[2]string{grant.GranteeID, *grant.UserID}] = true
+	return nil
+}
+
+func (f *fakeGrantRepo) HasAccessGrant(ctx context.Context, granteeID, userID string) (bool, error) {
+	return f.grants[[2]string{granteeID, userID}], nil
+}
+
+func (f *fakeGrantRepo) GetUserAccessGrants(ctx context.Context, userID string) ([]*models.AccessGrant, error) {
+	grants := []*models.AccessGrant{}
+	for pair := range f.grants {
+		if pair[0] == userID || pair[1] == userID {
+			subject := pair[1]
+			grants = append(grants, &models.AccessGrant{GranteeID: pair[0], UserID: &subject, Role: models.GrantRoleCoach})
+		}
+	}
+	return grants, nil
+}
+
+func newTestAuthorizer() Authorizer {
+	users := &fakeUserRepo{users: map[string]*models.User{
+		"athlete":  {ID: "athlete", Role: models.RoleUser},
+		"coach":    {ID: "coach", Role: models.RoleCoach},
+		"admin":    {ID: "admin", Role: models.RoleAdmin},
+		"support":  {ID: "support", Role: models.RoleUser, Permissions: []string{models.PermissionUsersWrite}},
+		"stranger": {ID: "stranger", Role: models.RoleUser},
+	}}
+	return NewAuthorizer(&fakeGrantRepo{grants: map[[2]string]bool{{"coach", "athlete"}: true}}, users)
+}
+
+func TestAuthorizeUser(t *testing.T) {
+	auth := newTestAuthorizer()
+
+	tests := []struct {
+		name    string
+		actor   string
+		user    string
+		wantErr error
+	}{
+		{name: "own data", actor: "athlete", user: "athlete"},
+		{name: "granted coach", actor: "coach", user: "athlete"},
+		{name: "other user without grant", actor: "stranger", user: "athlete", wantErr: ErrForbidden},
+		{name: "grant does not work in reverse", actor: "athlete", user: "coach", wantErr: ErrForbidden},
+		{name: "admin role", actor: "admin", user: "athlete"},
+		{name: "individual users:write scope", actor: "support", user: "athlete"},
+		{name: "coach role alone is not enough", actor: "coach", user: "stranger", wantErr: ErrForbidden},
+		{name: "anonymous caller", actor: "", user: "", wantErr: ErrForbidden},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := auth.AuthorizeUser(context.Background(), tt.actor, tt.user)
+			if !errors.Is(err, tt.wantErr) {
+				t.Errorf("got %v, want %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestGrantCoachAccess(t *testing.T) {
+	ctx := context.Background()
+	auth := newTestAuthorizer()
+
+	if _, err := auth.GrantCoachAccess(ctx, "stranger", "athlete"); !errors.Is(err, ErrInvalidInput) {
+		t.Errorf("non-coach grantee: got %v", err)
+	}
+	if _, err := auth.GrantCoachAccess(ctx, "coach", "coach"); !errors.Is(err, ErrInvalidInput) {
+		t.Errorf("self grant: got %v", err)
+	}
+
+	if err := auth.AuthorizeUser(ctx, "coach", "stranger"); !errors.Is(err, ErrForbidden) {
+		t.Fatalf("before grant: got %v", err)
+	}
+	if _, err := auth.GrantCoachAccess(ctx, "coach", "stranger"); err != nil {
+		t.Fatalf("grant: %v", err)
+	}
+	if err := auth.AuthorizeUser(ctx, "coach", "stranger"); err != nil {
+		t.Errorf("after grant: got %v", err)
+	}
+}
@@ -0,0 +1,67 @@
+package services
+
+import (
+	"time"
+
+	"yoked_backend/internal/models"
+)
+
+// localDay returns midnight of the calendar day t falls on in loc
+func localDay(t time.Time, loc *time.Location) time.Time {
+	t = t.In(loc)
+	return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, loc)
+}
+
+// weekStart returns midnight on the Monday of the local week containing t
+func weekStart(t time.Time, loc *time.Location) time.Time {
+	day := localDay(t, loc)
+	offset := (int(day.Weekday()) + 6) % 7 // Monday = 0
+	return day.AddDate(0, 0, -offset)
+}
+
+// TrainingSchedule is the set of weekdays a program trains on
+type TrainingSchedule map[time.Weekday]bool
+
+// scheduleFromWorkouts builds a schedule from ProgramWorkout.DayOfWeek, which uses
+// ISO numbering (1 = Monday ... 7 = Sunday). Out-of-range days are ignored.
+func scheduleFromWorkouts(workouts []*models.ProgramWorkout) TrainingSchedule {
+	schedule := make(TrainingSchedule)
+	for _, workout := range workouts {
+		if weekday, ok := isoWeekday(workout.DayOfWeek); ok {
+			schedule[weekday] = true
+		}
+	}
+	return schedule
+}
+
+func isoWeekday(dayOfWeek int) (time.Weekday, bool) {
+	if dayOfWeek < 1 || dayOfWeek > 7 {
+		return 0, false
+	}
+	return time.Weekday(dayOfWeek % 7), true
+}
+
+// isScheduled reports whether day is a training day. Without a program every day counts.
+func (s TrainingSchedule) isScheduled(day time.Time) bool {
+	if len(s) == 0 {
+		return true
+	}
+	return s[day.Weekday()]
+}
+
+// validateTimezone checks that name is a loadable IANA zone
+func validateTimezone(name string) error {
+	if name == "" || name == "Local" {
+		return invalidInput("unknown timezone %q", name)
+	}
+	if _, err := time.LoadLocation(name); err != nil {
+		return invalidInput("unknown timezone %q", name)
+	}
+	return nil
+}
+
+// calendarDate converts the local day of t into a UTC midnight suitable for DATE columns
+func calendarDate(t time.Time, loc *time.Location) time.Time {
+	t = t.In(loc)
+	return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC)
+}
@@ -0,0 +1,633 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"yoked_backend/internal/db/repositories"
+	"yoked_backend/internal/models"
+)
+
+// ErrCatalogInUse is returned when deleting a program someone enrolled in. Their history keeps
+// pointing at it, so it stays.
+var ErrCatalogInUse = errors.New("in use by users' training history")
+
+// CatalogService edits the program catalog. Edits change a program's draft: every edit loads
+// the whole draft tree, applies the change, validates the result and saves it in one
+// transaction, so a program is never left half edited. Edits return the saved draft.
+//
+// Users train published versions, which are copies of the draft taken by PublishProgram and
+// never change afterwards, so editing a program cannot rewrite anyone's logged history.
+type CatalogService interface {
+	ListPrograms(ctx context.Context) ([]*models.Program, error)
+	// GetProgram returns the program's draft
+	GetProgram(ctx context.Context, programID int) (*models.ProgramTree, error)
+	// CreateProgram adds a program with its workouts and exercises. It starts unpublished.
+	CreateProgram(ctx context.Context, tree *models.ProgramTree) (*models.ProgramTree, error)
+	// ReplaceProgram makes the program match tree: workouts and exercises with an id are
+	// updated, those without are added and any missing from tree are removed
+	ReplaceProgram(ctx context.Context, programID int, tree *models.ProgramTree) (*models.ProgramTree, error)
+	DeleteProgram(ctx context.Context, programID int) error
+	// PublishProgram lists the program and makes the draft its latest version, returning that
+	// version. A draft that matches the latest version is not published again.
+	PublishProgram(ctx context.Context, programID int) (*models.ProgramTree, error)
+	UnpublishProgram(ctx context.Context, programID int) (*models.Program, error)
+	// ListVersions returns the program's published versions, newest first
+	ListVersions(ctx context.Context, programID int) ([]*models.ProgramVersion, error)
+	GetVersion(ctx context.Context, programID, version int) (*models.ProgramTree, error)
+
+	AddWorkout(ctx context.Context, programID int, workout *models.ProgramWorkoutTree) (*models.ProgramTree, error)
+	UpdateWorkout(ctx context.Context, programID, workoutID int, workout *models.ProgramWorkout) (*models.ProgramTree, error)
+	DeleteWorkout(ctx context.Context, programID, workoutID int) (*models.ProgramTree, error)
+
+	// AddExercise inserts the prescription at its ExerciseOrder, or appends it when that is zero
+	AddExercise(ctx context.Context, programID, workoutID int, exercise *models.ProgramWorkoutExercise) (*models.ProgramTree, error)
+	// UpdateExercise replaces the prescription, moving it when ExerciseOrder is set
+	UpdateExercise(ctx context.Context, programID, workoutID, exerciseID int, exercise *models.ProgramWorkoutExercise) (*models.ProgramTree, error)
+	DeleteExercise(ctx context.Context, programID, workoutID, exerciseID int) (*models.ProgramTree, error)
+	// ReorderExercises puts the workout's prescriptions in the order of exerciseIDs, which must
+	// list each of them once
+	ReorderExercises(ctx context.Context, programID, workoutID int, exerciseIDs []int) (*models.ProgramTree, error)
+}
+
+type catalogService struct {
+	catalogRepo repositories.CatalogRepository
+	programRepo repositories.ProgramRepository
+	txManager   repositories.TxManager
+	now         func() time.Time
+}
+
+func NewCatalogService(catalogRepo repositories.CatalogRepository, programRepo repositories.ProgramRepository, txManager repositories.TxManager) CatalogService {
+	return &catalogService{
+		catalogRepo: catalogRepo,
+		programRepo: programRepo,
+		txManager:   txManager,
+		now:         time.Now,
+	}
+}
+
+func (s *catalogService) ListPrograms(ctx context.Context) ([]*models.Program, error) {
+	return s.programRepo.GetAllPrograms(ctx)
+}
+
+func (s *catalogService) GetProgram(ctx context.Context, programID int) (*models.ProgramTree, error) {
+	draft, err := s.catalogRepo.GetDraftVersion(ctx, programID)
+	if err != nil {
+		return nil, err
+	}
+	return s.catalogRepo.GetProgramTree(ctx, draft.ID)
+}
+
+func (s *catalogService) CreateProgram(ctx context.Context, tree *models.ProgramTree) (*models.ProgramTree, error) {
+	next := cloneProgramTree(tree)
+	next.ID, next.Version = 0, models.ProgramVersion{}
+
+	var saved *models.ProgramTree
+	err := s.txManager.WithinTx(ctx, func(ctx context.Context) error {
+		if err := s.validateTree(ctx, nil, next); err != nil {
+			return err
+		}
+		if err := s.saveTree(ctx, nil, next); err != nil {
+			return err
+		}
+		var err error
+		saved, err = s.catalogRepo.GetProgramTree(ctx, next.Version.ID)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return saved, nil
+}
+
+func (s *catalogService) ReplaceProgram(ctx context.Context, programID int, tree *models.ProgramTree) (*models.ProgramTree, error) {
+	return s.editTree(ctx, programID, func(next *models.ProgramTree) error {
+		replacement := cloneProgramTree(tree)
+		replacement.ID, replacement.PublishedAt, replacement.CreatedAt = next.ID, next.PublishedAt, next.CreatedAt
+		replacement.Version = next.Version
+		*next = *replacement
+		return nil
+	})
+}
+
+func (s *catalogService) DeleteProgram(ctx context.Context, programID int) error {
+	if err := s.catalogRepo.DeleteProgram(ctx, programID); err != nil {
+		return inUse(err, "program %d has enrolled users", programID)
+	}
+	return nil
+}
+
+// PublishProgram copies the draft into a new version when it differs from the latest one.
+// Only drafts with something to train can be published; publishing a listed program keeps its
+// original listing date.
+func (s *catalogService) PublishProgram(ctx context.Context, programID int) (*models.ProgramTree, error) {
+	var published *models.ProgramTree
+	err := s.txManager.WithinTx(ctx, func(ctx context.Context) error {
+		program, err := s.catalogRepo.LockProgram(ctx, programID)
+		if err != nil {
+			return err
+		}
+		draft, err := s.catalogRepo.GetDraftVersion(ctx, programID)
+		if err != nil {
+			return err
+		}
+		tree, err := s.catalogRepo.GetProgramTree(ctx, draft.ID)
+		if err != nil {
+			return err
+		}
+		if len(tree.Workouts) == 0 {
+			return invalidInput("a program needs at least one workout before it is published")
+		}
+		for _, workout := range tree.Workouts {
+			if len(workout.Exercises) == 0 {
+				return invalidInput("workout %q has no exercises", workout.Name)
+			}
+		}
+
+		now := s.now()
+		versions, err := s.catalogRepo.ListProgramVersions(ctx, programID)
+		if err != nil {
+			return err
+		}
+		var version *models.ProgramVersion
+		if len(versions) > 0 {
+			version = versions[0]
+			if published, err = s.catalogRepo.GetProgramTree(ctx, version.ID); err != nil {
+				return err
+			}
+		}
+		if version == nil || !sameProgramContent(tree, published) {
+			if version, err = s.catalogRepo.PublishDraft(ctx, programID, now); err != nil {
+				return err
+			}
+		}
+
+		if program.PublishedAt == nil {
+			if _, err := s.catalogRepo.SetProgramPublished(ctx, programID, &now); err != nil {
+				return err
+			}
+		}
+		published, err = s.catalogRepo.GetProgramTree(ctx, version.ID)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return published, nil
+}
+
+// UnpublishProgram hides the program from listings and new enrollments. Users already on it
+// keep training it.
+func (s *catalogService) UnpublishProgram(ctx context.Context, programID int) (*models.Program, error) {
+	return s.catalogRepo.SetProgramPublished(ctx, programID, nil)
+}
+
+func (s *catalogService) ListVersions(ctx context.Context, programID int) ([]*models.ProgramVersion, error) {
+	if _, err := s.GetProgram(ctx, programID); err != nil {
+		return nil, err
+	}
+	return s.catalogRepo.ListProgramVersions(ctx, programID)
+}
+
+func (s *catalogService) GetVersion(ctx context.Context, programID, number int) (*models.ProgramTree, error) {
+	version, err := s.catalogRepo.GetProgramVersionByNumber(ctx, programID, number)
+	if err != nil {
+		return nil, err
+	}
+	return s.catalogRepo.GetProgramTree(ctx, version.ID)
+}
+
+func (s *catalogService) AddWorkout(ctx context.Context, programID int, workout *models.ProgramWorkoutTree) (*models.ProgramTree, error) {
+	return s.editTree(ctx, programID, func(next *models.ProgramTree) error {
+		added := cloneWorkoutTree(workout)
+		added.ID = 0
+		for _, exercise := range added.Exercises {
+			if exercise != nil {
+				exercise.ID = 0
+			}
+		}
+		next.Workouts = append(next.Workouts, added)
+		return nil
+	})
+}
+
+func (s *catalogService) UpdateWorkout(ctx context.Context, programID, workoutID int, workout *models.ProgramWorkout) (*models.ProgramTree, error) {
+	return s.editTree(ctx, programID, func(next *models.ProgramTree) error {
+		existing, _, err := findWorkout(next, workoutID)
+		if err != nil {
+			return err
+		}
+		existing.Name, existing.DayOfWeek, existing.Description = workout.Name, workout.DayOfWeek, workout.Description
+		return nil
+	})
+}
+
+func (s *catalogService) DeleteWorkout(ctx context.Context, programID, workoutID int) (*models.ProgramTree, error) {
+	return s.editTree(ctx, programID, func(next *models.ProgramTree) error {
+		_, i, err := findWorkout(next, workoutID)
+		if err != nil {
+			return err
+		}
+		next.Workouts = append(next.Workouts[:i], next.Workouts[i+1:]...)
+		return nil
+	})
+}
+
+func (s *catalogService) AddExercise(ctx context.Context, programID, workoutID int, exercise *models.ProgramWorkoutExercise) (*models.ProgramTree, error) {
+	return s.editTree(ctx, programID, func(next *models.ProgramTree) error {
+		workout, _, err := findWorkout(next, workoutID)
+		if err != nil {
+			return err
+		}
+		added := *exercise
+		added.ID = 0
+		workout.Exercises = placeExercise(workout.Exercises, &added)
+		return nil
+	})
+}
+
+func (s *catalogService) UpdateExercise(ctx context.Context, programID, workoutID, exerciseID int, exercise *models.ProgramWorkoutExercise) (*models.ProgramTree, error) {
+	return s.editTree(ctx, programID, func(next *models.ProgramTree) error {
+		workout, _, err := findWorkout(next, workoutID)
+		if err != nil {
+			return err
+		}
+		i, err := findExercise(workout, exerciseID)
+		if err != nil {
+			return err
+		}
+
+		updated := *exercise
+		updated.ID = exerciseID
+		if updated.ExerciseOrder == 0 {
+			// Keep its place
+			updated.ExerciseOrder = i + 1
+		}
+		remaining := append(workout.Exercises[:i:i], workout.Exercises[i+1:]...)
+		workout.Exercises = placeExercise(remaining, &updated)
+		return nil
+	})
+}
+
+func (s *catalogService) DeleteExercise(ctx context.Context, programID, workoutID, exerciseID int) (*models.ProgramTree, error) {
+	return s.editTree(ctx, programID, func(next *models.ProgramTree) error {
+		workout, _, err := findWorkout(next, workoutID)
+		if err != nil {
+			return err
+		}
+		i, err := findExercise(workout, exerciseID)
+		if err != nil {
+			return err
+		}
+		workout.Exercises = append(workout.Exercises[:i], workout.Exercises[i+1:]...)
+		return nil
+	})
+}
+
+func (s *catalogService) ReorderExercises(ctx context.Context, programID, workoutID int, exerciseIDs []int) (*models.ProgramTree, error) {
+	return s.editTree(ctx, programID, func(next *models.ProgramTree) error {
+		workout, _, err := findWorkout(next, workoutID)
+		if err != nil {
+			return err
+		}
+		if len(exerciseIDs) != len(workout.Exercises) {
+			return invalidInput("the order must list each of the workout's %d exercises once", len(workout.Exercises))
+		}
+
+		byID := make(map[int]*models.ProgramWorkoutExercise, len(workout.Exercises))
+		for _, exercise := range workout.Exercises {
+			byID[exercise.ID] = exercise
+		}
+		reordered := make([]*models.ProgramWorkoutExercise, 0, len(exerciseIDs))
+		for _, id := range exerciseIDs {
+			exercise, ok := byID[id]
+			if !ok {
+				return invalidInput("the order must list each of the workout's %d exercises once", len(workout.Exercises))
+			}
+			delete(byID, id)
+			reordered = append(reordered, exercise)
+		}
+		workout.Exercises = reordered
+		return nil
+	})
+}
+
+// editTree locks the program, applies edit to a copy of its draft and saves the result if it is
+// valid. The lock makes concurrent edits to one program apply one after the other.
+func (s *catalogService) editTree(ctx context.Context, programID int, edit func(next *models.ProgramTree) error) (*models.ProgramTree, error) {
+	var saved *models.ProgramTree
+	err := s.txManager.WithinTx(ctx, func(ctx context.Context) error {
+		if _, err := s.catalogRepo.LockProgram(ctx, programID); err != nil {
+			return err
+		}
+		draft, err := s.catalogRepo.GetDraftVersion(ctx, programID)
+		if err != nil {
+			return err
+		}
+		current, err := s.catalogRepo.GetProgramTree(ctx, draft.ID)
+		if err != nil {
+			return err
+		}
+
+		next := cloneProgramTree(current)
+		if err := edit(next); err != nil {
+			return err
+		}
+		if err := s.validateTree(ctx, current, next); err != nil {
+			return err
+		}
+		if err := s.saveTree(ctx, current, next); err != nil {
+			return err
+		}
+
+		saved, err = s.catalogRepo.GetProgramTree(ctx, draft.ID)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return saved, nil
+}
+
+// validateTree checks next before it replaces current, which is nil for a new program. It
+// fills in defaults, ties children to their parents and numbers each workout's exercises in
+// list order.
+func (s *catalogService) validateTree(ctx context.Context, current, next *models.ProgramTree) error {
+	next.Name = strings.TrimSpace(next.Name)
+	if next.Name == "" {
+		return invalidInput("program name is required")
+	}
+	if next.EstimatedWeeks < 0 {
+		return invalidInput("estimated_weeks cannot be negative")
+	}
+	if next.ProgressionStrategy == "" {
+		next.ProgressionStrategy = DefaultProgressionStrategy
+	}
+	if _, err := GetProgressionStrategy(next.ProgressionStrategy); err != nil {
+		return invalidInput("%v", err)
+	}
+
+	// The prescriptions each existing workout may keep
+	existing := make(map[int]map[int]bool)
+	if current != nil {
+		for _, workout := range current.Workouts {
+			existing[workout.ID] = make(map[int]bool, len(workout.Exercises))
+			for _, exercise := range workout.Exercises {
+				existing[workout.ID][exercise.ID] = true
+			}
+		}
+	}
+
+	seenWorkouts := make(map[int]bool)
+	seenExercises := make(map[int]bool)
+	days := make(map[int]bool)
+	var exerciseIDs []int
+	for _, workout := range next.Workouts {
+		if workout == nil {
+			return invalidInput("workouts cannot be null")
+		}
+		if workout.ID != 0 {
+			if existing[workout.ID] == nil {
+				return invalidInput("workout %d is not part of this program", workout.ID)
+			}
+			if seenWorkouts[workout.ID] {
+				return invalidInput("workout %d is listed twice", workout.ID)
+			}
+			seenWorkouts[workout.ID] = true
+		}
+		workout.ProgramID = next.ID
+		workout.Name = strings.TrimSpace(workout.Name)
+		if workout.Name == "" {
+			return invalidInput("workout name is required")
+		}
+		if workout.DayOfWeek < 1 || workout.DayOfWeek > 7 {
+			return invalidInput("day_of_week must be from 1 (Monday) to 7 (Sunday), got %d", workout.DayOfWeek)
+		}
+		if days[workout.DayOfWeek] {
+			return invalidInput("more than one workout on day %d", workout.DayOfWeek)
+		}
+		days[workout.DayOfWeek] = true
+
+		inWorkout := make(map[int]bool)
+		for i, exercise := range workout.Exercises {
+			if exercise == nil {
+				return invalidInput("exercises cannot be null")
+			}
+			if exercise.ID != 0 {
+				if !existing[workout.ID][exercise.ID] {
+					return invalidInput("exercise %d is not part of workout %q", exercise.ID, workout.Name)
+				}
+				if seenExercises[exercise.ID] {
+					return invalidInput("exercise %d is listed twice", exercise.ID)
+				}
+				seenExercises[exercise.ID] = true
+			}
+			exercise.ProgramWorkoutID = workout.ID
+			exercise.ExerciseOrder = i + 1
+			if err := validatePrescription(exercise); err != nil {
+				return err
+			}
+			if inWorkout[exercise.ExerciseID] {
+				return invalidInput("exercise %d appears twice in workout %q", exercise.ExerciseID, workout.Name)
+			}
+			inWorkout[exercise.ExerciseID] = true
+			exerciseIDs = append(exerciseIDs, exercise.ExerciseID)
+		}
+	}
+
+	if len(exerciseIDs) == 0 {
+		return nil
+	}
+	missing, err := s.catalogRepo.MissingExerciseIDs(ctx, exerciseIDs)
+	if err != nil {
+		return err
+	}
+	if len(missing) > 0 {
+		return invalidInput("exercise %d does not exist", missing[0])
+	}
+	return nil
+}
+
+func validatePrescription(exercise *models.ProgramWorkoutExercise) error {
+	switch {
+	case exercise.ExerciseID <= 0:
+		return invalidInput("exercise_id is required")
+	case exercise.Sets <= 0:
+		return invalidInput("sets must be positive")
+	case exercise.Reps <= 0:
+		return invalidInput("reps must be positive")
+	case exercise.TargetRIR < 0:
+		return invalidInput("target_rir cannot be negative")
+	case exercise.PrescribedWeight < 0:
+		return invalidInput("prescribed_weight cannot be negative")
+	case exercise.RepRangeMax != 0 && exercise.RepRangeMax < exercise.Reps:
+		return invalidInput("rep_range_max cannot be below reps")
+	case exercise.WeightIncrement < 0:
+		return invalidInput("weight_increment cannot be negative")
+	case exercise.TrainingMax < 0:
+		return invalidInput("training_max cannot be negative")
+	}
+	if exercise.ProgressionStrategy != "" {
+		if _, err := GetProgressionStrategy(exercise.ProgressionStrategy); err != nil {
+			return invalidInput("%v", err)
+		}
+	}
+	return nil
+}
+
+// saveTree writes the difference between current and next. Removals go first; the uniqueness
+// of days and exercise orders is only checked at commit, so rows can swap places freely.
+func (s *catalogService) saveTree(ctx context.Context, current, next *models.ProgramTree) error {
+	if next.ID == 0 {
+		if err := s.catalogRepo.CreateProgram(ctx, &next.Program); err != nil {
+			return err
+		}
+		draft, err := s.catalogRepo.CreateDraftVersion(ctx, next.ID)
+		if err != nil {
+			return err
+		}
+		next.Version = *draft
+	} else if err := s.catalogRepo.UpdateProgram(ctx, &next.Program); err != nil {
+		return err
+	}
+
+	if current != nil {
+		kept := make(map[int]map[int]bool)
+		for _, workout := range next.Workouts {
+			if workout.ID != 0 {
+				kept[workout.ID] = make(map[int]bool)
+				for _, exercise := range workout.Exercises {
+					kept[workout.ID][exercise.ID] = true
+				}
+			}
+		}
+		for _, workout := range current.Workouts {
+			if kept[workout.ID] == nil {
+				if err := s.catalogRepo.DeleteProgramWorkout(ctx, workout.ID); err != nil {
+					return err
+				}
+				continue
+			}
+			for _, exercise := range workout.Exercises {
+				if !kept[workout.ID][exercise.ID] {
+					if err := s.catalogRepo.DeleteProgramWorkoutExercise(ctx, exercise.ID); err != nil {
+						return err
+					}
+				}
+			}
+		}
+	}
+
+	for _, workout := range next.Workouts {
+		workout.ProgramID, workout.ProgramVersionID = next.ID, next.Version.ID
+		if workout.ID == 0 {
+			if err := s.catalogRepo.CreateProgramWorkout(ctx, &workout.ProgramWorkout); err != nil {
+				return err
+			}
+		} else if err := s.catalogRepo.UpdateProgramWorkout(ctx, &workout.ProgramWorkout); err != nil {
+			return err
+		}
+
+		for _, exercise := range workout.Exercises {
+			exercise.ProgramWorkoutID = workout.ID
+			if exercise.ID == 0 {
+				if err := s.catalogRepo.CreateProgramWorkoutExercise(ctx, exercise); err != nil {
+					return err
+				}
+			} else if err := s.catalogRepo.UpdateProgramWorkoutExercise(ctx, exercise); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// inUse reports a delete blocked by history pointing at the row as ErrCatalogInUse
+func inUse(err error, format string, args ...any) error {
+	if errors.Is(err, repositories.ErrForeignKey) {
+		return fmt.Errorf("%s: %w", fmt.Sprintf(format, args...), ErrCatalogInUse)
+	}
+	return err
+}
+
+// sameProgramContent reports whether two versions prescribe the same training. Row ids differ
+// between versions, so workouts and prescriptions are matched by lineage.
+func sameProgramContent(a, b *models.ProgramTree) bool {
+	if len(a.Workouts) != len(b.Workouts) {
+		return false
+	}
+	workouts := make(map[string]*models.ProgramWorkoutTree, len(b.Workouts))
+	for _, workout := range b.Workouts {
+		workouts[workout.LineageID] = workout
+	}
+	for _, workout := range a.Workouts {
+		other, ok := workouts[workout.LineageID]
+		if !ok || workout.Name != other.Name || workout.DayOfWeek != other.DayOfWeek ||
+			workout.Description != other.Description || len(workout.Exercises) != len(other.Exercises) {
+			return false
+		}
+		for i, exercise := range workout.Exercises {
+			same := *other.Exercises[i]
+			same.ID, same.ProgramWorkoutID = exercise.ID, exercise.ProgramWorkoutID
+			if same != *exercise {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+func findWorkout(tree *models.ProgramTree, workoutID int) (*models.ProgramWorkoutTree, int, error) {
+	for i, workout := range tree.Workouts {
+		if workout.ID == workoutID {
+			return workout, i, nil
+		}
+	}
+	return nil, 0, fmt.Errorf("program workout %w", repositories.ErrNotFound)
+}
+
+func findExercise(workout *models.ProgramWorkoutTree, exerciseID int) (int, error) {
+	for i, exercise := range workout.Exercises {
+		if exercise.ID == exerciseID {
+			return i, nil
+		}
+	}
+	return 0, fmt.Errorf("program exercise %w", repositories.ErrNotFound)
+}
+
+// placeExercise inserts exercise at its ExerciseOrder, appending when that is zero or past the end
+func placeExercise(exercises []*models.ProgramWorkoutExercise, exercise *models.ProgramWorkoutExercise) []*models.ProgramWorkoutExercise {
+	at := exercise.ExerciseOrder - 1
+	if at < 0 || at > len(exercises) {
+		at = len(exercises)
+	}
+	placed := make([]*models.ProgramWorkoutExercise, 0, len(exercises)+1)
+	placed = append(placed, exercises[:at]...)
+	placed = append(placed, exercise)
+	return append(placed, exercises[at:]...)
+}
+
+func cloneProgramTree(tree *models.ProgramTree) *models.ProgramTree {
+	cloned := &models.ProgramTree{Program: tree.Program, Version: tree.Version, Workouts: make([]*models.ProgramWorkoutTree, len(tree.Workouts))}
+	for i, workout := range tree.Workouts {
+		cloned.Workouts[i] = cloneWorkoutTree(workout)
+	}
+	return cloned
+}
+
+func cloneWorkoutTree(workout *models.ProgramWorkoutTree) *models.ProgramWorkoutTree {
+	if workout == nil {
+		return nil
+	}
+	cloned := &models.ProgramWorkoutTree{ProgramWorkout: workout.ProgramWorkout, Exercises: make([]*models.ProgramWorkoutExercise, len(workout.Exercises))}
+	for i, exercise := range workout.Exercises {
+		if exercise != nil {
+			copied := *exercise
+			cloned.Exercises[i] = &copied
+		}
+	}
+	return cloned
+}
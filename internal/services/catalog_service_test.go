@@ -0,0 +1,443 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"testing"
+	"time"
+
+	"yoked_backend/internal/db/repositories"
+	"yoked_backend/internal/models"
+)
+
+// fakeCatalogRepo keeps catalog rows in memory. Like the database, it only lets drafts change.
+type fakeCatalogRepo struct {
+	programs  map[int]*models.Program
+	versions  map[int]*models.ProgramVersion
+	workouts  map[int]*models.ProgramWorkout
+	exercises map[int]*models.ProgramWorkoutExercise
+	known     map[int]bool // exercise library ids
+	nextID    int
+}
+
+func newFakeCatalogRepo(exerciseIDs ...int) *fakeCatalogRepo {
+	f := &fakeCatalogRepo{
+		programs:  make(map[int]*models.Program),
+		versions:  make(map[int]*models.ProgramVersion),
+		workouts:  make(map[int]*models.ProgramWorkout),
+		exercises: make(map[int]*models.ProgramWorkoutExercise),
+		known:     make(map[int]bool),
+	}
+	for _, id := range exerciseIDs {
+		f.known[id] = true
+	}
+	return f
+}
+
+func (f *fakeCatalogRepo) id() int {
+	f.nextID++
+	return f.nextID
+}
+
+func (f *fakeCatalogRepo) lineage() string {
+	return fmt.Sprintf("lineage-%d", f.id())
+}
+
+func (f *fakeCatalogRepo) inDraft(workoutID int) bool {
+	workout, ok := f.workouts[workoutID]
+	return ok && f.versions[workout.ProgramVersionID].IsDraft()
+}
+
+func (f *fakeCatalogRepo) LockProgram(ctx context.Context, id int) (*models.Program, error) {
+	program, ok := f.programs[id]
+	if !ok {
+		return nil, repositories.ErrNotFound
+	}
+	copied := *program
+	return &copied, nil
+}
+
+func (f *fakeCatalogRepo) GetProgramTree(ctx context.Context, programVersionID int) (*models.ProgramTree, error) {
+	version, ok := f.versions[programVersionID]
+	if !ok {
+		return nil, repositories.ErrNotFound
+	}
+	program := f.programs[version.ProgramID]
+	tree := &models.ProgramTree{Program: *program, Version: *version, Workouts: []*models.ProgramWorkoutTree{}}
+	for _, workout := range f.workouts {
+		if workout.ProgramVersionID != programVersionID {
+			continue
+		}
+		node := &models.ProgramWorkoutTree{ProgramWorkout: *workout, Exercises: []*models.ProgramWorkoutExercise{}}
+		for _, exercise := range f.exercises {
+			if exercise.ProgramWorkoutID == workout.ID {
+				copied := *exercise
+				node.Exercises = append(node.Exercises, &copied)
+			}
+		}
+		sort.Slice(node.Exercises, func(i, j int) bool { return node.Exercises[i].ExerciseOrder < node.Exercises[j].ExerciseOrder })
+		tree.Workouts = append(tree.Workouts, node)
+	}
+	sort.Slice(tree.Workouts, func(i, j int) bool { return tree.Workouts[i].DayOfWeek < tree.Workouts[j].DayOfWeek })
+	return tree, nil
+}
+
+func (f *fakeCatalogRepo) CreateDraftVersion(ctx context.Context, programID int) (*models.ProgramVersion, error) {
+	version := &models.ProgramVersion{ID: f.id(), ProgramID: programID, CreatedAt: time.Now()}
+	f.versions[version.ID] = version
+	copied := *version
+	return &copied, nil
+}
+
+func (f *fakeCatalogRepo) GetDraftVersion(ctx context.Context, programID int) (*models.ProgramVersion, error) {
+	return f.GetProgramVersionByNumber(ctx, programID, 0)
+}
+
+func (f *fakeCatalogRepo) GetProgramVersionByNumber(ctx context.Context, programID, number int) (*models.ProgramVersion, error) {
+	for _, version := range f.versions {
+		if version.ProgramID == programID && version.Version == number {
+			copied := *version
+			return &copied, nil
+		}
+	}
+	return nil, repositories.ErrNotFound
+}
+
+func (f *fakeCatalogRepo) ListProgramVersions(ctx context.Context, programID int) ([]*models.ProgramVersion, error) {
+	versions := []*models.ProgramVersion{}
+	for _, version := range f.versions {
+		if version.ProgramID == programID && !version.IsDraft() {
+			copied := *version
+			versions = append(versions, &copied)
+		}
+	}
+	sort.Slice(versions, func(i, j int) bool { return versions[i].Version > versions[j].Version })
+	return versions, nil
+}
+
+func (f *fakeCatalogRepo) PublishDraft(ctx context.Context, programID int, publishedAt time.Time) (*models.ProgramVersion, error) {
+	draft, err := f.GetDraftVersion(ctx, programID)
+	if err != nil {
+		return nil, err
+	}
+	versions, _ := f.ListProgramVersions(ctx, programID)
+	version := &models.ProgramVersion{ID: f.id(), ProgramID: programID, Version: len(versions) + 1, PublishedAt: &publishedAt, CreatedAt: publishedAt}
+	f.versions[version.ID] = version
+
+	tree, _ := f.GetProgramTree(ctx, draft.ID)
+	for _, workout := range tree.Workouts {
+		copiedWorkout := workout.ProgramWorkout
+		copiedWorkout.ID, copiedWorkout.ProgramVersionID = f.id(), version.ID
+		f.workouts[copiedWorkout.ID] = &copiedWorkout
+		for _, exercise := range workout.Exercises {
+			copiedExercise := *exercise
+			copiedExercise.ID, copiedExercise.ProgramWorkoutID = f.id(), copiedWorkout.ID
+			f.exercises[copiedExercise.ID] = &copiedExercise
+		}
+	}
+	copied := *version
+	return &copied, nil
+}
+
+func (f *fakeCatalogRepo) CreateProgram(ctx context.Context, program *models.Program) error {
+	program.ID, program.CreatedAt = f.id(), time.Now()
+	copied := *program
+	f.programs[program.ID] = &copied
+	return nil
+}
+
+func (f *fakeCatalogRepo) UpdateProgram(ctx context.Context, program *models.Program) error {
+	existing, ok := f.programs[program.ID]
+	if !ok {
+		return repositories.ErrNotFound
+	}
+	copied := *program
+	copied.PublishedAt, copied.CreatedAt = existing.PublishedAt, existing.CreatedAt
+	f.programs[program.ID] = &copied
+	return nil
+}
+
+func (f *fakeCatalogRepo) SetProgramPublished(ctx context.Context, id int, publishedAt *time.Time) (*models.Program, error) {
+	program, ok := f.programs[id]
+	if !ok {
+		return nil, repositories.ErrNotFound
+	}
+	program.PublishedAt = publishedAt
+	copied := *program
+	return &copied, nil
+}
+
+func (f *fakeCatalogRepo) DeleteProgram(ctx context.Context, id int) error {
+	delete(f.programs, id)
+	return nil
+}
+
+func (f *fakeCatalogRepo) CreateProgramWorkout(ctx context.Context, workout *models.ProgramWorkout) error {
+	if !f.versions[workout.ProgramVersionID].IsDraft() {
+		return repositories.ErrNotFound
+	}
+	workout.ID, workout.LineageID = f.id(), f.lineage()
+	copied := *workout
+	f.workouts[workout.ID] = &copied
+	return nil
+}
+
+func (f *fakeCatalogRepo) UpdateProgramWorkout(ctx context.Context, workout *models.ProgramWorkout) error {
+	existing, ok := f.workouts[workout.ID]
+	if !ok || !f.inDraft(workout.ID) {
+		return repositories.ErrNotFound
+	}
+	copied := *workout
+	copied.LineageID = existing.LineageID
+	f.workouts[workout.ID] = &copied
+	return nil
+}
+
+func (f *fakeCatalogRepo) DeleteProgramWorkout(ctx context.Context, id int) error {
+	if !f.inDraft(id) {
+		return repositories.ErrNotFound
+	}
+	for _, exercise := range f.exercises {
+		if exercise.ProgramWorkoutID == id {
+			delete(f.exercises, exercise.ID)
+		}
+	}
+	delete(f.workouts, id)
+	return nil
+}
+
+func (f *fakeCatalogRepo) CreateProgramWorkoutExercise(ctx context.Context, exercise *models.ProgramWorkoutExercise) error {
+	if !f.inDraft(exercise.ProgramWorkoutID) {
+		return repositories.ErrNotFound
+	}
+	exercise.ID, exercise.LineageID = f.id(), f.lineage()
+	copied := *exercise
+	f.exercises[exercise.ID] = &copied
+	return nil
+}
+
+func (f *fakeCatalogRepo) UpdateProgramWorkoutExercise(ctx context.Context, exercise *models.ProgramWorkoutExercise) error {
+	existing, ok := f.exercises[exercise.ID]
+	if !ok || !f.inDraft(existing.ProgramWorkoutID) {
+		return repositories.ErrNotFound
+	}
+	copied := *exercise
+	copied.LineageID = existing.LineageID
+	f.exercises[exercise.ID] = &copied
+	return nil
+}
+
+func (f *fakeCatalogRepo) DeleteProgramWorkoutExercise(ctx context.Context, id int) error {
+	existing, ok := f.exercises[id]
+	if !ok || !f.inDraft(existing.ProgramWorkoutID) {
+		return repositories.ErrNotFound
+	}
+	delete(f.exercises, id)
+	return nil
+}
+
+func (f *fakeCatalogRepo) MissingExerciseIDs(ctx context.Context, ids []int) ([]int, error) {
+	var missing []int
+	for _, id := range ids {
+		if !f.known[id] {
+			missing = append(missing, id)
+		}
+	}
+	return missing, nil
+}
+
+func testProgramTree() *models.ProgramTree {
+	return &models.ProgramTree{
+		Program: models.Program{Name: "Upper Lower"},
+		Workouts: []*models.ProgramWorkoutTree{
+			{
+				ProgramWorkout: models.ProgramWorkout{Name: "Upper", DayOfWeek: 1},
+				Exercises: []*models.ProgramWorkoutExercise{
+					{ExerciseID: 1, Sets: 3, Reps: 8},
+					{ExerciseID: 2, Sets: 3, Reps: 10},
+				},
+			},
+			{
+				ProgramWorkout: models.ProgramWorkout{Name: "Lower", DayOfWeek: 3},
+				Exercises:      []*models.ProgramWorkoutExercise{{ExerciseID: 3, Sets: 5, Reps: 5}},
+			},
+		},
+	}
+}
+
+func exerciseOrder(workout *models.ProgramWorkoutTree) []int {
+	var ids []int
+	for i, exercise := range workout.Exercises {
+		if exercise.ExerciseOrder != i+1 {
+			return nil
+		}
+		ids = append(ids, exercise.ExerciseID)
+	}
+	return ids
+}
+
+func TestCreateProgramTree(t *testing.T) {
+	ctx := context.Background()
+	catalog := NewCatalogService(newFakeCatalogRepo(1, 2, 3), nil, passthroughTx{})
+
+	tree, err := catalog.CreateProgram(ctx, testProgramTree())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if tree.ID == 0 || tree.PublishedAt != nil || tree.ProgressionStrategy != DefaultProgressionStrategy {
+		t.Errorf("unexpected program %+v", tree.Program)
+	}
+	if len(tree.Workouts) != 2 || tree.Workouts[0].ProgramID != tree.ID {
+		t.Fatalf("unexpected workouts %+v", tree.Workouts)
+	}
+	if order := exerciseOrder(tree.Workouts[0]); len(order) != 2 || order[0] != 1 || order[1] != 2 {
+		t.Errorf("exercises not numbered in list order: %+v", tree.Workouts[0].Exercises)
+	}
+}
+
+func TestCatalogValidation(t *testing.T) {
+	ctx := context.Background()
+	catalog := NewCatalogService(newFakeCatalogRepo(1, 2, 3), nil, passthroughTx{})
+
+	tests := []struct {
+		name string
+		edit func(tree *models.ProgramTree)
+	}{
+		{"missing name", func(tree *models.ProgramTree) { tree.Name = " " }},
+		{"unknown strategy", func(tree *models.ProgramTree) { tree.ProgressionStrategy = "vibes" }},
+		{"day out of range", func(tree *models.ProgramTree) { tree.Workouts[1].DayOfWeek = 8 }},
+		{"two workouts on a day", func(tree *models.ProgramTree) { tree.Workouts[1].DayOfWeek = 1 }},
+		{"unknown exercise", func(tree *models.ProgramTree) { tree.Workouts[0].Exercises[0].ExerciseID = 99 }},
+		{"exercise twice", func(tree *models.ProgramTree) { tree.Workouts[0].Exercises[1].ExerciseID = 1 }},
+		{"no sets", func(tree *models.ProgramTree) { tree.Workouts[0].Exercises[0].Sets = 0 }},
+		{"rep range below reps", func(tree *models.ProgramTree) { tree.Workouts[0].Exercises[0].RepRangeMax = 6 }},
+		{"foreign workout", func(tree *models.ProgramTree) { tree.Workouts[0].ID = 42 }},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tree := testProgramTree()
+			tt.edit(tree)
+			if _, err := catalog.CreateProgram(ctx, tree); !errors.Is(err, ErrInvalidInput) {
+				t.Errorf("got %v, want invalid input", err)
+			}
+		})
+	}
+}
+
+func TestEditProgramTree(t *testing.T) {
+	ctx := context.Background()
+	repo := newFakeCatalogRepo(1, 2, 3, 4)
+	catalog := NewCatalogService(repo, nil, passthroughTx{})
+	tree, _ := catalog.CreateProgram(ctx, testProgramTree())
+	upper := tree.Workouts[0]
+
+	// Swapping the training days is one edit even though the days collide midway
+	swapped := *tree
+	swapped.Workouts = []*models.ProgramWorkoutTree{cloneWorkoutTree(tree.Workouts[0]), cloneWorkoutTree(tree.Workouts[1])}
+	swapped.Workouts[0].DayOfWeek, swapped.Workouts[1].DayOfWeek = 3, 1
+	tree, err := catalog.ReplaceProgram(ctx, tree.ID, &swapped)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if tree.Workouts[0].Name != "Lower" || tree.Workouts[1].ID != upper.ID {
+		t.Errorf("days not swapped: %+v %+v", tree.Workouts[0].ProgramWorkout, tree.Workouts[1].ProgramWorkout)
+	}
+
+	tree, err = catalog.AddExercise(ctx, tree.ID, upper.ID, &models.ProgramWorkoutExercise{ExerciseID: 4, Sets: 3, Reps: 12, ExerciseOrder: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	upper = tree.Workouts[1]
+	if order := exerciseOrder(upper); len(order) != 3 || order[0] != 4 {
+		t.Fatalf("exercise not inserted first: %v", order)
+	}
+
+	reversed := []int{upper.Exercises[2].ID, upper.Exercises[1].ID, upper.Exercises[0].ID}
+	tree, err = catalog.ReorderExercises(ctx, tree.ID, upper.ID, reversed)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if order := exerciseOrder(tree.Workouts[1]); len(order) != 3 || order[0] != 2 || order[2] != 4 {
+		t.Errorf("unexpected order after reorder: %v", order)
+	}
+	if _, err := catalog.ReorderExercises(ctx, tree.ID, upper.ID, reversed[:2]); !errors.Is(err, ErrInvalidInput) {
+		t.Errorf("partial order: got %v", err)
+	}
+	if _, err := catalog.UpdateWorkout(ctx, tree.ID, 999, &models.ProgramWorkout{Name: "Nope", DayOfWeek: 5}); !errors.Is(err, repositories.ErrNotFound) {
+		t.Errorf("unknown workout: got %v", err)
+	}
+}
+
+func TestProgramVersions(t *testing.T) {
+	ctx := context.Background()
+	catalog := NewCatalogService(newFakeCatalogRepo(1, 2, 3), nil, passthroughTx{})
+	tree, _ := catalog.CreateProgram(ctx, testProgramTree())
+
+	v1, err := catalog.PublishProgram(ctx, tree.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if v1.Version.Version != 1 || v1.Workouts[0].ID == tree.Workouts[0].ID || v1.Workouts[0].LineageID != tree.Workouts[0].LineageID {
+		t.Fatalf("unexpected first version %+v %+v", v1.Version, v1.Workouts[0].ProgramWorkout)
+	}
+
+	// Publishing an unchanged draft keeps the current version
+	if again, err := catalog.PublishProgram(ctx, tree.ID); err != nil || again.Version.ID != v1.Version.ID {
+		t.Errorf("republishing an unchanged draft: %+v %v", again, err)
+	}
+
+	// Edits change the draft only
+	upper := tree.Workouts[0]
+	if _, err := catalog.DeleteExercise(ctx, tree.ID, upper.ID, upper.Exercises[0].ID); err != nil {
+		t.Fatal(err)
+	}
+	if published, _ := catalog.GetVersion(ctx, tree.ID, 1); len(published.Workouts[0].Exercises) != 2 {
+		t.Errorf("editing the draft changed version 1: %+v", published.Workouts[0].Exercises)
+	}
+	if _, err := catalog.DeleteWorkout(ctx, tree.ID, v1.Workouts[0].ID); !errors.Is(err, repositories.ErrNotFound) {
+		t.Errorf("editing a published workout: got %v", err)
+	}
+
+	v2, err := catalog.PublishProgram(ctx, tree.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if v2.Version.Version != 2 || len(v2.Workouts[0].Exercises) != 1 || v2.Workouts[0].LineageID != upper.LineageID {
+		t.Errorf("unexpected second version %+v %+v", v2.Version, v2.Workouts[0])
+	}
+	if versions, _ := catalog.ListVersions(ctx, tree.ID); len(versions) != 2 || versions[0].Version != 2 {
+		t.Errorf("unexpected versions %+v", versions)
+	}
+}
+
+func TestPublishProgram(t *testing.T) {
+	ctx := context.Background()
+	clock := &fakeClock{now: time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)}
+	catalog := NewCatalogService(newFakeCatalogRepo(1, 2, 3), nil, passthroughTx{}).(*catalogService)
+	catalog.now = clock.Now
+
+	empty, _ := catalog.CreateProgram(ctx, &models.ProgramTree{Program: models.Program{Name: "Empty"}})
+	if _, err := catalog.PublishProgram(ctx, empty.ID); !errors.Is(err, ErrInvalidInput) {
+		t.Errorf("publishing an empty program: got %v", err)
+	}
+
+	tree, _ := catalog.CreateProgram(ctx, testProgramTree())
+	published, err := catalog.PublishProgram(ctx, tree.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if program := published.Program; program.PublishedAt == nil || !program.PublishedAt.Equal(clock.now) {
+		t.Errorf("published at %v, want %s", program.PublishedAt, clock.now)
+	}
+
+	// Editing a published program keeps it published
+	tree.Description = "Four days a week"
+	if edited, err := catalog.ReplaceProgram(ctx, tree.ID, tree); err != nil || edited.PublishedAt == nil {
+		t.Errorf("edit unpublished the program: %v", err)
+	}
+	if program, err := catalog.UnpublishProgram(ctx, tree.ID); err != nil || program.PublishedAt != nil {
+		t.Errorf("unpublish: %+v %v", program, err)
+	}
+}
@@ -0,0 +1,243 @@
+package services
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"yoked_backend/internal/db/repositories"
+	"yoked_backend/internal/mail"
+	"yoked_backend/internal/models"
+)
+
+const (
+	// EmailVerificationTTL is how long a verification link stays usable
+	EmailVerificationTTL = 48 * time.Hour
+	// VerificationResendInterval is the minimum gap between verification emails to one user
+	VerificationResendInterval = 5 * time.Minute
+)
+
+// devEmailVerificationURL is the verification page used when EMAIL_VERIFICATION_URL is unset in development
+const devEmailVerificationURL = "http://localhost:3000/verify-email"
+
+// Features an unverified account can be kept out of, named in REQUIRE_VERIFIED_EMAIL
+const (
+	VerifiedFeaturePrograms = "programs" // assigning a program
+	VerifiedFeatureWorkouts = "workouts" // starting and finishing workout sessions
+)
+
+var (
+	// ErrInvalidVerificationToken covers forged, expired and out of date verification links
+	ErrInvalidVerificationToken = errors.New("invalid or expired email verification link")
+	// ErrVerificationThrottled means a verification email was sent too recently to send another
+	ErrVerificationThrottled = errors.New("a verification email was sent recently, please wait before asking again")
+)
+
+// EmailVerificationURLFromEnv returns EMAIL_VERIFICATION_URL, the page that receives the token
+// as ?token=. It is required unless APP_ENV=development.
+func EmailVerificationURLFromEnv() (string, error) {
+	return linkURLFromEnv("EMAIL_VERIFICATION_URL", devEmailVerificationURL)
+}
+
+// EmailVerificationPolicy lists the features unverified accounts are kept out of
+type EmailVerificationPolicy struct {
+	restricted map[string]bool
+}
+
+// NewEmailVerificationPolicy restricts the given features to verified accounts
+func NewEmailVerificationPolicy(features ...string) EmailVerificationPolicy {
+	policy := EmailVerificationPolicy{restricted: make(map[string]bool)}
+	for _, feature := range features {
+		policy.restricted[feature] = true
+	}
+	return policy
+}
+
+// EmailVerificationPolicyFromEnv reads REQUIRE_VERIFIED_EMAIL, a comma separated list of
+// features (programs, workouts) or "none". Program assignment is restricted by default.
+func EmailVerificationPolicyFromEnv() (EmailVerificationPolicy, error) {
+	value, ok := os.LookupEnv("REQUIRE_VERIFIED_EMAIL")
+	if !ok {
+		return NewEmailVerificationPolicy(VerifiedFeaturePrograms), nil
+	}
+	if value = strings.TrimSpace(value); value == "" || value == "none" {
+		return NewEmailVerificationPolicy(), nil
+	}
+
+	var features []string
+	for _, feature := range strings.Split(value, ",") {
+		feature = strings.TrimSpace(feature)
+		if feature != VerifiedFeaturePrograms && feature != VerifiedFeatureWorkouts {
+			return EmailVerificationPolicy{}, fmt.Errorf("unknown REQUIRE_VERIFIED_EMAIL feature %q (want %s or %s)", feature, VerifiedFeaturePrograms, VerifiedFeatureWorkouts)
+		}
+		features = append(features, feature)
+	}
+	return NewEmailVerificationPolicy(features...), nil
+}
+
+// Restricts reports whether feature needs a verified email
+func (p EmailVerificationPolicy) Restricts(feature string) bool {
+	return p.restricted[feature]
+}
+
+type EmailVerificationService interface {
+	SendVerification(ctx context.Context, user *models.User) error
+	ResendVerification(ctx context.Context, userID string) error
+	VerifyEmail(ctx context.Context, token string) error
+	IsEmailVerified(ctx context.Context, userID string) (bool, error)
+}
+
+type emailVerificationService struct {
+	userRepo  repositories.UserRepository
+	txManager repositories.TxManager
+	mailer    mail.Mailer
+	verifyURL string
+	key       []byte
+	now       func() time.Time
+}
+
+// NewEmailVerificationService signs links with a key derived from secret, so they need no storage
+func NewEmailVerificationService(userRepo repositories.UserRepository, txManager repositories.TxManager, mailer mail.Mailer, verifyURL string, secret []byte) EmailVerificationService {
+	mac := hmac.New(sha256.New, secret)
+	mac.Write([]byte("email-verification"))
+	return &emailVerificationService{
+		userRepo:  userRepo,
+		txManager: txManager,
+		mailer:    mailer,
+		verifyURL: verifyURL,
+		key:       mac.Sum(nil),
+		now:       time.Now,
+	}
+}
+
+// verificationClaims are signed into the link. Carrying the email means a link stops
+// working once the account's email changes.
+type verificationClaims struct {
+	UserID    string `json:"sub"`
+	Email     string `json:"email"`
+	ExpiresAt int64  `json:"exp"`
+}
+
+func (s *emailVerificationService) sign(payload string) string {
+	mac := hmac.New(sha256.New, s.key)
+	mac.Write([]byte(payload))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+// issueToken returns payload.signature, both base64url encoded
+func (s *emailVerificationService) issueToken(user *models.User) (string, error) {
+	claims, err := json.Marshal(verificationClaims{
+		UserID:    user.ID,
+		Email:     user.Email,
+		ExpiresAt: s.now().Add(EmailVerificationTTL).Unix(),
+	})
+	if err != nil {
+		return "", fmt.Errorf("failed to encode verification token: %w", err)
+	}
+	payload := base64.RawURLEncoding.EncodeToString(claims)
+	return payload + "." + s.sign(payload), nil
+}
+
+func (s *emailVerificationService) parseToken(token string) (*verificationClaims, error) {
+	payload, signature, ok := strings.Cut(token, ".")
+	if !ok || !hmac.Equal([]byte(signature), []byte(s.sign(payload))) {
+		return nil, ErrInvalidVerificationToken
+	}
+	decoded, err := base64.RawURLEncoding.DecodeString(payload)
+	if err != nil {
+		return nil, ErrInvalidVerificationToken
+	}
+	var claims verificationClaims
+	if err := json.Unmarshal(decoded, &claims); err != nil {
+		return nil, ErrInvalidVerificationToken
+	}
+	if !s.now().Before(time.Unix(claims.ExpiresAt, 0)) {
+		return nil, ErrInvalidVerificationToken
+	}
+	return &claims, nil
+}
+
+// SendVerification mails a verification link unless one was sent within VerificationResendInterval
+func (s *emailVerificationService) SendVerification(ctx context.Context, user *models.User) error {
+	if user.EmailVerified {
+		return invalidInput("email is already verified")
+	}
+
+	token, err := s.issueToken(user)
+	if err != nil {
+		return err
+	}
+	link, err := linkWithToken(s.verifyURL, token)
+	if err != nil {
+		return err
+	}
+
+	// The send is only recorded once the mail is handed over, and the row stays locked until
+	// then so concurrent resends still wait for it and get throttled
+	return s.txManager.WithinTx(ctx, func(ctx context.Context) error {
+		sent, err := s.userRepo.MarkVerificationSent(ctx, user.ID, s.now().Add(-VerificationResendInterval))
+		if err != nil {
+			return err
+		}
+		if !sent {
+			return ErrVerificationThrottled
+		}
+
+		return s.mailer.Send(ctx, mail.Message{
+			To:      user.Email,
+			Subject: "Verify your email address",
+			Body: fmt.Sprintf("Hi %s,\n\nPlease confirm this is your email address by opening the link below. It expires in %d hours.\n\n%s\n",
+				user.Name, int(EmailVerificationTTL.Hours()), link),
+		})
+	})
+}
+
+// ResendVerification sends the signed-in user a fresh verification link
+func (s *emailVerificationService) ResendVerification(ctx context.Context, userID string) error {
+	user, err := s.userRepo.GetUserByID(ctx, userID)
+	if err != nil {
+		return err
+	}
+	return s.SendVerification(ctx, user)
+}
+
+// VerifyEmail marks the account verified. Verifying twice is not an error.
+func (s *emailVerificationService) VerifyEmail(ctx context.Context, token string) error {
+	claims, err := s.parseToken(token)
+	if err != nil {
+		return err
+	}
+
+	user, err := s.userRepo.GetUserByID(ctx, claims.UserID)
+	if errors.Is(err, repositories.ErrNotFound) {
+		return ErrInvalidVerificationToken
+	}
+	if err != nil {
+		return err
+	}
+	if user.Email != claims.Email {
+		return ErrInvalidVerificationToken
+	}
+	if user.EmailVerified {
+		return nil
+	}
+
+	return s.userRepo.MarkEmailVerified(ctx, user.ID)
+}
+
+// IsEmailVerified reads the flag from the database rather than the access token, so a
+// user who has just verified does not have to wait for their token to be refreshed
+func (s *emailVerificationService) IsEmailVerified(ctx context.Context, userID string) (bool, error) {
+	user, err := s.userRepo.GetUserByID(ctx, userID)
+	if err != nil {
+		return false, err
+	}
+	return user.EmailVerified, nil
+}
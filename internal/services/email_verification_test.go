@@ -0,0 +1,177 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"maps"
+	"strings"
+	"testing"
+	"time"
+
+	"yoked_backend/internal/db/repositories"
+	"yoked_backend/internal/mail"
+	"yoked_backend/internal/models"
+)
+
+func (f *fakeUserRepo) MarkEmailVerified(ctx context.Context, userID string) error {
+	user, ok := f.users[userID]
+	if !ok {
+		return repositories.ErrNotFound
+	}
+	user.EmailVerified = true
+	return nil
+}
+
+func (f *fakeUserRepo) MarkVerificationSent(ctx context.Context, userID string, since time.Time) (bool, error) {
+	if last, ok := f.sentAt[userID]; ok && !last.Before(since) {
+		return false, nil
+	}
+	if f.sentAt == nil {
+		f.sentAt = make(map[string]time.Time)
+	}
+	f.sentAt[userID] = since.Add(VerificationResendInterval)
+	return true, nil
+}
+
+// sendTimesTx rolls back the verification send times when a unit of work fails
+type sendTimesTx struct {
+	users *fakeUserRepo
+}
+
+func (tx sendTimesTx) WithinTx(ctx context.Context, fn func(ctx context.Context) error) error {
+	saved := maps.Clone(tx.users.sentAt)
+	if err := fn(ctx); err != nil {
+		tx.users.sentAt = saved
+		return err
+	}
+	return nil
+}
+
+func newTestEmailVerificationService() (*emailVerificationService, *fakeUserRepo, *recordingMailer) {
+	users := &fakeUserRepo{users: map[string]*models.User{"u1": {ID: "u1", Email: "lifter@example.com"}}}
+	mailer := &recordingMailer{}
+	svc := NewEmailVerificationService(users, sendTimesTx{users}, mailer, devEmailVerificationURL, []byte("secret"))
+	return svc.(*emailVerificationService), users, mailer
+}
+
+// verificationTokenFromMail pulls the token back out of the link in a verification email
+func verificationTokenFromMail(t *testing.T, mailer *recordingMailer) string {
+	t.Helper()
+	if len(mailer.sent) == 0 {
+		t.Fatal("no verification email sent")
+	}
+	body := mailer.sent[len(mailer.sent)-1].Body
+	_, link, ok := strings.Cut(body, devEmailVerificationURL+"?token=")
+	if !ok {
+		t.Fatalf("no verification link in mail:\n%s", body)
+	}
+	return strings.Fields(link)[0]
+}
+
+func TestEmailVerification(t *testing.T) {
+	ctx := context.Background()
+	svc, _, mailer := newTestEmailVerificationService()
+
+	if err := svc.ResendVerification(ctx, "u1"); err != nil {
+		t.Fatalf("send: %v", err)
+	}
+	token := verificationTokenFromMail(t, mailer)
+
+	if verified, _ := svc.IsEmailVerified(ctx, "u1"); verified {
+		t.Fatal("verified before the link was used")
+	}
+	if err := svc.VerifyEmail(ctx, token); err != nil {
+		t.Fatalf("verify: %v", err)
+	}
+	if verified, _ := svc.IsEmailVerified(ctx, "u1"); !verified {
+		t.Fatal("not verified after the link was used")
+	}
+	if err := svc.VerifyEmail(ctx, token); err != nil {
+		t.Errorf("verifying twice: %v", err)
+	}
+	if err := svc.ResendVerification(ctx, "u1"); !errors.Is(err, ErrInvalidInput) {
+		t.Errorf("resend once verified: got %v", err)
+	}
+}
+
+func TestEmailVerificationRejections(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("resends are throttled", func(t *testing.T) {
+		svc, _, mailer := newTestEmailVerificationService()
+		now := time.Now()
+		svc.now = func() time.Time { return now }
+		svc.ResendVerification(ctx, "u1")
+		if err := svc.ResendVerification(ctx, "u1"); !errors.Is(err, ErrVerificationThrottled) {
+			t.Errorf("got %v, want ErrVerificationThrottled", err)
+		}
+		now = now.Add(VerificationResendInterval + time.Second)
+		if err := svc.ResendVerification(ctx, "u1"); err != nil {
+			t.Errorf("after the interval: %v", err)
+		}
+		if len(mailer.sent) != 2 {
+			t.Errorf("sent %d emails, want 2", len(mailer.sent))
+		}
+	})
+
+	t.Run("failed sends are not throttled", func(t *testing.T) {
+		svc, _, mailer := newTestEmailVerificationService()
+		mailer.err = mail.ErrOutboxFull
+		if err := svc.ResendVerification(ctx, "u1"); !errors.Is(err, mail.ErrOutboxFull) {
+			t.Fatalf("got %v, want the mailer's error", err)
+		}
+		mailer.err = nil
+		if err := svc.ResendVerification(ctx, "u1"); err != nil {
+			t.Errorf("retry after a failed send: %v", err)
+		}
+	})
+
+	t.Run("tampered token", func(t *testing.T) {
+		svc, _, mailer := newTestEmailVerificationService()
+		svc.ResendVerification(ctx, "u1")
+		token := verificationTokenFromMail(t, mailer)
+		forged, _ := svc.issueToken(&models.User{ID: "u2", Email: "lifter@example.com"})
+		payload, _, _ := strings.Cut(forged, ".")
+		_, signature, _ := strings.Cut(token, ".")
+		if err := svc.VerifyEmail(ctx, payload+"."+signature); !errors.Is(err, ErrInvalidVerificationToken) {
+			t.Errorf("got %v", err)
+		}
+	})
+
+	t.Run("expired token", func(t *testing.T) {
+		svc, _, mailer := newTestEmailVerificationService()
+		svc.ResendVerification(ctx, "u1")
+		token := verificationTokenFromMail(t, mailer)
+		svc.now = func() time.Time { return time.Now().Add(EmailVerificationTTL + time.Minute) }
+		if err := svc.VerifyEmail(ctx, token); !errors.Is(err, ErrInvalidVerificationToken) {
+			t.Errorf("got %v", err)
+		}
+	})
+
+	t.Run("email changed since the link was sent", func(t *testing.T) {
+		svc, users, mailer := newTestEmailVerificationService()
+		svc.ResendVerification(ctx, "u1")
+		users.users["u1"].Email = "new@example.com"
+		if err := svc.VerifyEmail(ctx, verificationTokenFromMail(t, mailer)); !errors.Is(err, ErrInvalidVerificationToken) {
+			t.Errorf("got %v", err)
+		}
+	})
+}
+
+func TestEmailVerificationPolicyFromEnv(t *testing.T) {
+	t.Setenv("REQUIRE_VERIFIED_EMAIL", "programs, workouts")
+	policy, err := EmailVerificationPolicyFromEnv()
+	if err != nil || !policy.Restricts(VerifiedFeaturePrograms) || !policy.Restricts(VerifiedFeatureWorkouts) {
+		t.Errorf("got %+v, %v", policy, err)
+	}
+
+	t.Setenv("REQUIRE_VERIFIED_EMAIL", "none")
+	if policy, _ := EmailVerificationPolicyFromEnv(); policy.Restricts(VerifiedFeaturePrograms) {
+		t.Error("none should restrict nothing")
+	}
+
+	t.Setenv("REQUIRE_VERIFIED_EMAIL", "nutrition")
+	if _, err := EmailVerificationPolicyFromEnv(); err == nil {
+		t.Error("expected an unknown feature to be rejected")
+	}
+}
@@ -0,0 +1,14 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+)
+
+// ErrInvalidInput marks errors caused by a bad request rather than a failure on our side
+var ErrInvalidInput = errors.New("invalid input")
+
+// invalidInput formats a validation error that matches ErrInvalidInput
+func invalidInput(format string, args ...any) error {
+	return fmt.Errorf("%w: %s", ErrInvalidInput, fmt.Sprintf(format, args...))
+}
@@ -0,0 +1,235 @@
+package services
+
+import (
+	"context"
+	"strings"
+
+	"yoked_backend/internal/db/repositories"
+	"yoked_backend/internal/models"
+)
+
+const (
+	// DefaultExercisePageSize is the page size of searches that do not ask for one
+	DefaultExercisePageSize = 20
+	MaxExercisePageSize     = 100
+)
+
+// ExerciseService serves the exercise library. Anyone signed in can search it; creating,
+// updating and merging exercises is for catalog editors.
+type ExerciseService interface {
+	SearchExercises(ctx context.Context, filter models.ExerciseFilter) (*models.ExercisePage, error)
+	GetExercise(ctx context.Context, id int) (*models.Exercise, error)
+	CreateExercise(ctx context.Context, exercise *models.Exercise) (*models.Exercise, error)
+	UpdateExercise(ctx context.Context, id int, exercise *models.Exercise) (*models.Exercise, error)
+	// MergeExercise folds the duplicate sourceID into targetID and returns the target, which
+	// takes over the duplicate's name as an alias and any details it was missing
+	MergeExercise(ctx context.Context, sourceID, targetID int) (*models.Exercise, error)
+}
+
+type exerciseService struct {
+	exerciseRepo repositories.ExerciseRepository
+	txManager    repositories.TxManager
+}
+
+func NewExerciseService(exerciseRepo repositories.ExerciseRepository, txManager repositories.TxManager) ExerciseService {
+	return &exerciseService{exerciseRepo: exerciseRepo, txManager: txManager}
+}
+
+func (s *exerciseService) SearchExercises(ctx context.Context, filter models.ExerciseFilter) (*models.ExercisePage, error) {
+	filter.Query = strings.TrimSpace(filter.Query)
+	filter.Muscle = normalizeTerm(filter.Muscle)
+	filter.Equipment = normalizeTerm(filter.Equipment)
+	if err := validateClassification(filter.MovementPattern, filter.Mechanics, filter.Difficulty, ""); err != nil {
+		return nil, err
+	}
+	switch {
+	case filter.Limit == 0:
+		filter.Limit = DefaultExercisePageSize
+	case filter.Limit < 0 || filter.Limit > MaxExercisePageSize:
+		return nil, invalidInput("limit must be from 1 to %d", MaxExercisePageSize)
+	}
+	if filter.Offset < 0 {
+		return nil, invalidInput("offset cannot be negative")
+	}
+
+	exercises, total, err := s.exerciseRepo.SearchExercises(ctx, &filter)
+	if err != nil {
+		return nil, err
+	}
+	facets, err := s.exerciseRepo.CountExerciseFacets(ctx, &filter)
+	if err != nil {
+		return nil, err
+	}
+	return &models.ExercisePage{
+		Exercises: exercises,
+		Total:     total,
+		Limit:     filter.Limit,
+		Offset:    filter.Offset,
+		Facets:    facets,
+	}, nil
+}
+
+func (s *exerciseService) GetExercise(ctx context.Context, id int) (*models.Exercise, error) {
+	return s.exerciseRepo.GetExercise(ctx, id)
+}
+
+func (s *exerciseService) CreateExercise(ctx context.Context, exercise *models.Exercise) (*models.Exercise, error) {
+	created := *exercise
+	if err := normalizeExercise(&created); err != nil {
+		return nil, err
+	}
+	if err := s.exerciseRepo.CreateExercise(ctx, &created); err != nil {
+		return nil, err
+	}
+	return &created, nil
+}
+
+// UpdateExercise replaces the exercise's details. Merged exercises can no longer be changed.
+func (s *exerciseService) UpdateExercise(ctx context.Context, id int, exercise *models.Exercise) (*models.Exercise, error) {
+	updated := *exercise
+	updated.ID = id
+	if err := normalizeExercise(&updated); err != nil {
+		return nil, err
+	}
+
+	err := s.txManager.WithinTx(ctx, func(ctx context.Context) error {
+		existing, err := s.exerciseRepo.LockExercise(ctx, id)
+		if err != nil {
+			return err
+		}
+		if existing.MergedIntoID != nil {
+			return invalidInput("exercise %d was merged into exercise %d", id, *existing.MergedIntoID)
+		}
+		return s.exerciseRepo.UpdateExercise(ctx, &updated)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return s.exerciseRepo.GetExercise(ctx, id)
+}
+
+func (s *exerciseService) MergeExercise(ctx context.Context, sourceID, targetID int) (*models.Exercise, error) {
+	if sourceID == targetID {
+		return nil, invalidInput("an exercise cannot be merged into itself")
+	}
+
+	err := s.txManager.WithinTx(ctx, func(ctx context.Context) error {
+		// Lock in id order so opposite merges of the same pair cannot deadlock
+		locked := make(map[int]*models.Exercise, 2)
+		for _, id := range []int{min(sourceID, targetID), max(sourceID, targetID)} {
+			exercise, err := s.exerciseRepo.LockExercise(ctx, id)
+			if err != nil {
+				return err
+			}
+			if exercise.MergedIntoID != nil {
+				return invalidInput("exercise %d was already merged into exercise %d", id, *exercise.MergedIntoID)
+			}
+			locked[id] = exercise
+		}
+		source, target := locked[sourceID], locked[targetID]
+
+		target.Aliases = append(append(target.Aliases, source.Name), source.Aliases...)
+		if target.Description == "" {
+			target.Description = source.Description
+		}
+		if len(target.Instructions) == 0 {
+			target.Instructions = source.Instructions
+		}
+		for _, field := range []struct{ into, from *string }{
+			{&target.PrimaryMuscleGroup, &source.PrimaryMuscleGroup},
+			{&target.Equipment, &source.Equipment},
+			{&target.MovementPattern, &source.MovementPattern},
+			{&target.Laterality, &source.Laterality},
+			{&target.Mechanics, &source.Mechanics},
+			{&target.Difficulty, &source.Difficulty},
+		} {
+			if *field.into == "" {
+				*field.into = *field.from
+			}
+		}
+		if err := normalizeExercise(target); err != nil {
+			return err
+		}
+		if err := s.exerciseRepo.UpdateExercise(ctx, target); err != nil {
+			return err
+		}
+		return s.exerciseRepo.MergeExercise(ctx, sourceID, targetID)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return s.exerciseRepo.GetExercise(ctx, targetID)
+}
+
+// normalizeExercise validates the exercise, lowercases its muscle groups and equipment and
+// drops blank or repeated list entries
+func normalizeExercise(exercise *models.Exercise) error {
+	exercise.Name = strings.TrimSpace(exercise.Name)
+	if exercise.Name == "" {
+		return invalidInput("exercise name is required")
+	}
+	exercise.Description = strings.TrimSpace(exercise.Description)
+	exercise.PrimaryMuscleGroup = normalizeTerm(exercise.PrimaryMuscleGroup)
+	exercise.Equipment = normalizeTerm(exercise.Equipment)
+	if err := validateClassification(exercise.MovementPattern, exercise.Mechanics, exercise.Difficulty, exercise.Laterality); err != nil {
+		return err
+	}
+
+	secondary := make([]string, 0, len(exercise.SecondaryMuscleGroups))
+	for _, muscle := range exercise.SecondaryMuscleGroups {
+		secondary = append(secondary, normalizeTerm(muscle))
+	}
+	exercise.SecondaryMuscleGroups = distinct(secondary, exercise.PrimaryMuscleGroup)
+	exercise.Aliases = distinct(exercise.Aliases, exercise.Name)
+
+	instructions := make([]string, 0, len(exercise.Instructions))
+	for _, step := range exercise.Instructions {
+		if step = strings.TrimSpace(step); step != "" {
+			instructions = append(instructions, step)
+		}
+	}
+	exercise.Instructions = instructions
+	return nil
+}
+
+func validateClassification(pattern, mechanics, difficulty, laterality string) error {
+	if pattern != "" && !models.ValidMovementPattern(pattern) {
+		return invalidInput("unknown movement_pattern %q", pattern)
+	}
+	switch mechanics {
+	case "", models.MechanicsCompound, models.MechanicsIsolation:
+	default:
+		return invalidInput("mechanics must be %q or %q", models.MechanicsCompound, models.MechanicsIsolation)
+	}
+	switch difficulty {
+	case "", models.DifficultyBeginner, models.DifficultyIntermediate, models.DifficultyAdvanced:
+	default:
+		return invalidInput("difficulty must be %q, %q or %q", models.DifficultyBeginner, models.DifficultyIntermediate, models.DifficultyAdvanced)
+	}
+	switch laterality {
+	case "", models.LateralityBilateral, models.LateralityUnilateral:
+	default:
+		return invalidInput("laterality must be %q or %q", models.LateralityBilateral, models.LateralityUnilateral)
+	}
+	return nil
+}
+
+// normalizeTerm puts a muscle group or piece of equipment in the form facets are stored in
+func normalizeTerm(term string) string {
+	return strings.ToLower(strings.TrimSpace(term))
+}
+
+// distinct trims values and drops blank ones, repeats and any equal to exclude, ignoring case.
+// It never returns nil, since the lists are stored as non-null arrays.
+func distinct(values []string, exclude string) []string {
+	seen := map[string]bool{strings.ToLower(exclude): true, "": true}
+	kept := make([]string, 0, len(values))
+	for _, value := range values {
+		value = strings.TrimSpace(value)
+		if key := strings.ToLower(value); !seen[key] {
+			seen[key] = true
+			kept = append(kept, value)
+		}
+	}
+	return kept
+}
@@ -0,0 +1,255 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"slices"
+	"testing"
+
+	"yoked_backend/internal/db/repositories"
+	"yoked_backend/internal/models"
+)
+
+// fakeExerciseRepo keeps the library in memory. Searches only record the filter they were given.
+type fakeExerciseRepo struct {
+	exercises map[int]*models.Exercise
+	// drafts are the draft prescriptions merges move to the surviving exercise
+	drafts   []*models.ProgramWorkoutExercise
+	searched *models.ExerciseFilter
+	nextID   int
+}
+
+func newFakeExerciseRepo(exercises ...*models.Exercise) *fakeExerciseRepo {
+	f := &fakeExerciseRepo{exercises: make(map[int]*models.Exercise)}
+	for _, exercise := range exercises {
+		f.CreateExercise(context.Background(), exercise)
+	}
+	return f
+}
+
+func (f *fakeExerciseRepo) SearchExercises(ctx context.Context, filter *models.ExerciseFilter) ([]*models.Exercise, int, error) {
+	copied := *filter
+	f.searched = &copied
+	return []*models.Exercise{}, 0, nil
+}
+
+func (f *fakeExerciseRepo) CountExerciseFacets(ctx context.Context, filter *models.ExerciseFilter) (*models.ExerciseFacets, error) {
+	return &models.ExerciseFacets{Muscles: map[string]int{}, Equipment: map[string]int{}}, nil
+}
+
+func (f *fakeExerciseRepo) GetExercise(ctx context.Context, id int) (*models.Exercise, error) {
+	exercise, ok := f.exercises[id]
+	if !ok {
+		return nil, repositories.ErrNotFound
+	}
+	copied := *exercise
+	return &copied, nil
+}
+
+func (f *fakeExerciseRepo) LockExercise(ctx context.Context, id int) (*models.Exercise, error) {
+	return f.GetExercise(ctx, id)
+}
+
+func (f *fakeExerciseRepo) CreateExercise(ctx context.Context, exercise *models.Exercise) error {
+	f.nextID++
+	exercise.ID = f.nextID
+	copied := *exercise
+	f.exercises[exercise.ID] = &copied
+	return nil
+}
+
+func (f *fakeExerciseRepo) UpdateExercise(ctx context.Context, exercise *models.Exercise) error {
+	if _, ok := f.exercises[exercise.ID]; !ok {
+		return repositories.ErrNotFound
+	}
+	copied := *exercise
+	f.exercises[exercise.ID] = &copied
+	return nil
+}
+
+func (f *fakeExerciseRepo) MergeExercise(ctx context.Context, sourceID, targetID int) error {
+	for _, exercise := range f.exercises {
+		if exercise.ID == sourceID || (exercise.MergedIntoID != nil && *exercise.MergedIntoID == sourceID) {
+			exercise.MergedIntoID = &targetID
+		}
+	}
+
+	kept := make(map[int]bool)
+	for _, prescription := range f.drafts {
+		if prescription.ExerciseID == targetID {
+			kept[prescription.ProgramWorkoutID] = true
+		}
+	}
+	drafts := f.drafts[:0]
+	for _, prescription := range f.drafts {
+		if prescription.ExerciseID == sourceID {
+			if kept[prescription.ProgramWorkoutID] {
+				continue
+			}
+			prescription.ExerciseID = targetID
+		}
+		drafts = append(drafts, prescription)
+	}
+	f.drafts = drafts
+
+	// unique_exercise_in_workout is checked when the transaction commits
+	type workoutExercise struct{ workoutID, exerciseID int }
+	seen := make(map[workoutExercise]bool)
+	for _, prescription := range f.drafts {
+		key := workoutExercise{prescription.ProgramWorkoutID, prescription.ExerciseID}
+		if seen[key] {
+			return repositories.ErrConflict
+		}
+		seen[key] = true
+	}
+	return nil
+}
+
+func (f *fakeExerciseRepo) GetMergedExercises(ctx context.Context, ids []int) (map[int]int, error) {
+	merged := make(map[int]int)
+	for _, exercise := range f.exercises {
+		if exercise.MergedIntoID != nil && slices.Contains(ids, *exercise.MergedIntoID) {
+			merged[exercise.ID] = *exercise.MergedIntoID
+		}
+	}
+	return merged, nil
+}
+
+func (f *fakeExerciseRepo) ListSubstituteCandidates(ctx context.Context, exercise *models.Exercise) ([]*models.Exercise, error) {
+	muscles := append([]string{exercise.PrimaryMuscleGroup}, exercise.SecondaryMuscleGroups...)
+	candidates := []*models.Exercise{}
+	for _, candidate := range f.exercises {
+		if candidate.ID == exercise.ID || candidate.MergedIntoID != nil {
+			continue
+		}
+		if (exercise.MovementPattern != "" && candidate.MovementPattern == exercise.MovementPattern) ||
+			slices.Contains(muscles, candidate.PrimaryMuscleGroup) ||
+			slices.ContainsFunc(candidate.SecondaryMuscleGroups, func(m string) bool { return slices.Contains(muscles, m) }) {
+			copied := *candidate
+			candidates = append(candidates, &copied)
+		}
+	}
+	return candidates, nil
+}
+
+func TestCreateExerciseNormalizes(t *testing.T) {
+	exercises := NewExerciseService(newFakeExerciseRepo(), passthroughTx{})
+
+	created, err := exercises.CreateExercise(context.Background(), &models.Exercise{
+		Name:                  " Bench Press ",
+		PrimaryMuscleGroup:    "Chest",
+		SecondaryMuscleGroups: []string{"Triceps", " triceps", "chest", ""},
+		Equipment:             " Barbell",
+		MovementPattern:       models.MovementHorizontalPush,
+		Aliases:               []string{"bench press", "Flat Bench", " "},
+		Instructions:          []string{"Lie on the bench", "  "},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if created.Name != "Bench Press" || created.PrimaryMuscleGroup != "chest" || created.Equipment != "barbell" {
+		t.Errorf("unexpected exercise %+v", created)
+	}
+	if !reflect.DeepEqual(created.SecondaryMuscleGroups, []string{"triceps"}) ||
+		!reflect.DeepEqual(created.Aliases, []string{"Flat Bench"}) ||
+		!reflect.DeepEqual(created.Instructions, []string{"Lie on the bench"}) {
+		t.Errorf("lists not cleaned up: %q %q %q", created.SecondaryMuscleGroups, created.Aliases, created.Instructions)
+	}
+
+	for name, exercise := range map[string]*models.Exercise{
+		"no name":         {Name: " "},
+		"unknown pattern": {Name: "Curl", MovementPattern: "curl"},
+		"bad mechanics":   {Name: "Curl", Mechanics: "simple"},
+		"bad difficulty":  {Name: "Curl", Difficulty: "easy"},
+		"bad laterality":  {Name: "Curl", Laterality: "left"},
+	} {
+		if _, err := exercises.CreateExercise(context.Background(), exercise); !errors.Is(err, ErrInvalidInput) {
+			t.Errorf("%s: got %v, want invalid input", name, err)
+		}
+	}
+}
+
+func TestSearchExercisesFilter(t *testing.T) {
+	ctx := context.Background()
+	repo := newFakeExerciseRepo()
+	exercises := NewExerciseService(repo, passthroughTx{})
+
+	page, err := exercises.SearchExercises(ctx, models.ExerciseFilter{Query: " press ", Muscle: "Chest", Equipment: "Dumbbell"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := models.ExerciseFilter{Query: "press", Muscle: "chest", Equipment: "dumbbell", Limit: DefaultExercisePageSize}
+	if *repo.searched != want || page.Limit != DefaultExercisePageSize {
+		t.Errorf("searched with %+v, want %+v", *repo.searched, want)
+	}
+
+	for name, filter := range map[string]models.ExerciseFilter{
+		"limit too large": {Limit: MaxExercisePageSize + 1},
+		"negative offset": {Offset: -1},
+		"unknown pattern": {MovementPattern: "push"},
+	} {
+		if _, err := exercises.SearchExercises(ctx, filter); !errors.Is(err, ErrInvalidInput) {
+			t.Errorf("%s: got %v, want invalid input", name, err)
+		}
+	}
+}
+
+func TestMergeExercise(t *testing.T) {
+	ctx := context.Background()
+	repo := newFakeExerciseRepo(
+		&models.Exercise{Name: "Bench Press", PrimaryMuscleGroup: "chest", Aliases: []string{"Flat Bench"}},
+		&models.Exercise{Name: "Barbell Bench", Equipment: "barbell", Aliases: []string{"flat bench", "BB Bench"}},
+		&models.Exercise{Name: "Incline Bench"},
+	)
+	exercises := NewExerciseService(repo, passthroughTx{})
+
+	merged, err := exercises.MergeExercise(ctx, 2, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(merged.Aliases, []string{"Flat Bench", "Barbell Bench", "BB Bench"}) || merged.Equipment != "barbell" {
+		t.Errorf("target did not take over the duplicate: %+v", merged)
+	}
+	if duplicate, _ := repo.GetExercise(ctx, 2); duplicate.MergedIntoID == nil || *duplicate.MergedIntoID != 1 {
+		t.Errorf("duplicate not marked merged: %+v", duplicate)
+	}
+
+	if _, err := exercises.MergeExercise(ctx, 3, 2); !errors.Is(err, ErrInvalidInput) {
+		t.Errorf("merging into a merged exercise: got %v", err)
+	}
+	if _, err := exercises.MergeExercise(ctx, 1, 1); !errors.Is(err, ErrInvalidInput) {
+		t.Errorf("merging into itself: got %v", err)
+	}
+	if _, err := exercises.UpdateExercise(ctx, 2, &models.Exercise{Name: "Barbell Bench"}); !errors.Is(err, ErrInvalidInput) {
+		t.Errorf("updating a merged exercise: got %v", err)
+	}
+	if _, err := exercises.MergeExercise(ctx, 3, 99); !errors.Is(err, repositories.ErrNotFound) {
+		t.Errorf("merging into a missing exercise: got %v", err)
+	}
+}
+
+func TestMergeExerciseFoldsDraftPrescriptions(t *testing.T) {
+	ctx := context.Background()
+	repo := newFakeExerciseRepo(&models.Exercise{Name: "Bench Press"}, &models.Exercise{Name: "Barbell Bench"})
+	repo.drafts = []*models.ProgramWorkoutExercise{
+		// Workout 1 prescribes both, workout 2 only the duplicate
+		{ID: 1, ProgramWorkoutID: 1, ExerciseID: 1, Sets: 3},
+		{ID: 2, ProgramWorkoutID: 1, ExerciseID: 2, Sets: 5},
+		{ID: 3, ProgramWorkoutID: 2, ExerciseID: 2, Sets: 4},
+	}
+
+	if _, err := NewExerciseService(repo, passthroughTx{}).MergeExercise(ctx, 2, 1); err != nil {
+		t.Fatal(err)
+	}
+	var kept []int
+	for _, prescription := range repo.drafts {
+		if prescription.ExerciseID != 1 {
+			t.Errorf("prescription %d still on exercise %d", prescription.ID, prescription.ExerciseID)
+		}
+		kept = append(kept, prescription.ID)
+	}
+	if !reflect.DeepEqual(kept, []int{1, 3}) {
+		t.Errorf("got prescriptions %v, want the target's in workout 1 and the moved one in workout 2", kept)
+	}
+}
@@ -0,0 +1,338 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"sort"
+	"strings"
+	"time"
+
+	"yoked_backend/internal/db/repositories"
+	"yoked_backend/internal/models"
+	"yoked_backend/internal/oidc"
+)
+
+// OIDCAuthRequestTTL is how long the user has to sign in at the provider and come back
+const OIDCAuthRequestTTL = 10 * time.Minute
+
+var (
+	// ErrUnknownProvider is returned for a provider name that is not configured
+	ErrUnknownProvider = errors.New("unknown sign-in provider")
+	// ErrInvalidOIDCState covers unknown, expired, used and mismatched state parameters
+	ErrInvalidOIDCState = errors.New("invalid or expired sign-in request, please start again")
+	// ErrOIDCAuthFailed is returned when the provider rejects the code or its ID token does not verify
+	ErrOIDCAuthFailed = errors.New("sign-in with the provider failed")
+	// ErrOIDCEmailUnverified is returned when the provider does not vouch for an email we could use
+	ErrOIDCEmailUnverified = errors.New("the provider did not return a verified email")
+	// ErrSignupProfileRequired is returned when a first-time login has no profile to create the account with
+	ErrSignupProfileRequired = errors.New("no account exists for this login yet, start again with a profile to sign up")
+	// ErrIdentityConflict is returned when the email belongs to an account that must link the provider itself
+	ErrIdentityConflict = errors.New("an account with this email already exists, log in and link the provider from your profile")
+	// ErrLastLoginMethod is returned when unlinking would leave the account with no way to log in
+	ErrLastLoginMethod = errors.New("cannot unlink the only way to log in, set a password first")
+)
+
+// OIDCProvider is the relying party for one provider, see oidc.Provider
+type OIDCProvider interface {
+	Name() string
+	AuthCodeURL(ctx context.Context, state, nonce, codeChallenge string) (string, error)
+	Authenticate(ctx context.Context, code, codeVerifier, nonce string) (*oidc.Claims, error)
+}
+
+// OIDCAuthorization is where to send the user, and the state that will come back with the code
+type OIDCAuthorization struct {
+	AuthorizationURL string    `json:"authorization_url"`
+	State            string    `json:"state"`
+	ExpiresAt        time.Time `json:"expires_at"`
+}
+
+// IdentityService logs users in through OpenID Connect providers and manages the providers
+// linked to an account. A login is matched by the provider's subject, then by verified email;
+// with no match a new account is created from the profile given when the login started.
+type IdentityService interface {
+	Providers() []string
+	StartLogin(ctx context.Context, provider string, profile *models.SignupProfile) (*OIDCAuthorization, error)
+	// CompleteLogin returns the user and whether the account was created by this login
+	CompleteLogin(ctx context.Context, provider, code, state string) (*models.User, bool, error)
+	StartLink(ctx context.Context, provider, userID string) (*OIDCAuthorization, error)
+	CompleteLink(ctx context.Context, provider, userID, code, state string) (*models.ExternalIdentity, error)
+	ListIdentities(ctx context.Context, userID string) ([]*models.ExternalIdentity, error)
+	Unlink(ctx context.Context, userID, provider string) error
+	// StartReauthentication and Reauthenticate have a signed-in user prove again that they own
+	// a linked provider account, for sensitive actions on accounts without a password
+	StartReauthentication(ctx context.Context, provider, userID string) (*OIDCAuthorization, error)
+	Reauthenticate(ctx context.Context, provider, userID, code, state string) error
+}
+
+type identityService struct {
+	identityRepo repositories.IdentityRepository
+	userRepo     repositories.UserRepository
+	userService  UserService
+	txManager    repositories.TxManager
+	providers    map[string]OIDCProvider
+	now          func() time.Time
+}
+
+func NewIdentityService(identityRepo repositories.IdentityRepository, userRepo repositories.UserRepository, userService UserService, txManager repositories.TxManager, providers []OIDCProvider) IdentityService {
+	byName := make(map[string]OIDCProvider, len(providers))
+	for _, provider := range providers {
+		byName[provider.Name()] = provider
+	}
+	return &identityService{
+		identityRepo: identityRepo,
+		userRepo:     userRepo,
+		userService:  userService,
+		txManager:    txManager,
+		providers:    byName,
+		now:          time.Now,
+	}
+}
+
+func (s *identityService) Providers() []string {
+	names := make([]string, 0, len(s.providers))
+	for name := range s.providers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func (s *identityService) provider(name string) (OIDCProvider, error) {
+	provider, ok := s.providers[name]
+	if !ok {
+		return nil, fmt.Errorf("%w %q", ErrUnknownProvider, name)
+	}
+	return provider, nil
+}
+
+// start stores a pending request and builds the authorization URL. Only the state's hash is
+// stored; the nonce and PKCE verifier never leave the server.
+func (s *identityService) start(ctx context.Context, providerName, userID string, profile *models.SignupProfile) (*OIDCAuthorization, error) {
+	provider, err := s.provider(providerName)
+	if err != nil {
+		return nil, err
+	}
+
+	state, err := newOpaqueToken()
+	if err != nil {
+		return nil, err
+	}
+	nonce, err := newOpaqueToken()
+	if err != nil {
+		return nil, err
+	}
+	verifier, err := oidc.NewCodeVerifier()
+	if err != nil {
+		return nil, err
+	}
+
+	authURL, err := provider.AuthCodeURL(ctx, state, nonce, oidc.CodeChallengeS256(verifier))
+	if err != nil {
+		return nil, fmt.Errorf("failed to build authorization url: %w", err)
+	}
+
+	req := &models.OIDCAuthRequest{
+		StateHash:    hashRefreshToken(state),
+		Provider:     providerName,
+		Nonce:        nonce,
+		CodeVerifier: verifier,
+		UserID:       userID,
+		Profile:      profile,
+		ExpiresAt:    s.now().Add(OIDCAuthRequestTTL),
+	}
+	if err := s.identityRepo.CreateOIDCAuthRequest(ctx, req); err != nil {
+		return nil, err
+	}
+
+	return &OIDCAuthorization{AuthorizationURL: authURL, State: state, ExpiresAt: req.ExpiresAt}, nil
+}
+
+// finish redeems the state and code for verified claims. The request must have been started
+// for the same provider and the same user (none, for logins), so a state cannot be replayed
+// into a different flow.
+func (s *identityService) finish(ctx context.Context, providerName, userID, code, state string) (*models.OIDCAuthRequest, *oidc.Claims, error) {
+	provider, err := s.provider(providerName)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	req, err := s.identityRepo.ConsumeOIDCAuthRequest(ctx, hashRefreshToken(state))
+	if err != nil {
+		if errors.Is(err, repositories.ErrNotFound) {
+			return nil, nil, ErrInvalidOIDCState
+		}
+		return nil, nil, err
+	}
+	if req.Provider != providerName || req.UserID != userID {
+		return nil, nil, ErrInvalidOIDCState
+	}
+
+	claims, err := provider.Authenticate(ctx, code, req.CodeVerifier, req.Nonce)
+	if err != nil {
+		log.Printf("OIDC authentication with %s failed: %v", providerName, err)
+		return nil, nil, ErrOIDCAuthFailed
+	}
+	return req, claims, nil
+}
+
+func (s *identityService) StartLogin(ctx context.Context, provider string, profile *models.SignupProfile) (*OIDCAuthorization, error) {
+	return s.start(ctx, provider, "", profile)
+}
+
+func (s *identityService) CompleteLogin(ctx context.Context, providerName, code, state string) (*models.User, bool, error) {
+	req, claims, err := s.finish(ctx, providerName, "", code, state)
+	if err != nil {
+		return nil, false, err
+	}
+
+	identity, err := s.identityRepo.GetIdentity(ctx, providerName, claims.Subject)
+	if err == nil {
+		user, err := s.userRepo.GetUserByID(ctx, identity.UserID)
+		return user, false, err
+	}
+	if !errors.Is(err, repositories.ErrNotFound) {
+		return nil, false, err
+	}
+
+	// Matching or creating by email is only safe when the provider has verified it
+	email := strings.TrimSpace(claims.Email)
+	if email == "" || !claims.EmailVerified {
+		return nil, false, ErrOIDCEmailUnverified
+	}
+
+	var user *models.User
+	created := false
+	err = s.txManager.WithinTx(ctx, func(ctx context.Context) error {
+		existing, err := s.userRepo.GetUserByEmail(ctx, email)
+		switch {
+		case err == nil:
+			// An unverified local account may have been registered by someone else to
+			// hijack this email later, so it has to link the provider after logging in
+			if !existing.EmailVerified {
+				return ErrIdentityConflict
+			}
+			user = existing
+		case errors.Is(err, repositories.ErrNotFound):
+			if req.Profile == nil {
+				return ErrSignupProfileRequired
+			}
+			user = newUserFromProfile(email, req.Profile)
+			if _, err := s.userService.RegisterUser(ctx, user, req.Profile.ProgramID); err != nil {
+				return err
+			}
+			// The provider vouched for the email, so there is nothing to send a link for
+			if err := s.userRepo.MarkEmailVerified(ctx, user.ID); err != nil {
+				return err
+			}
+			user.EmailVerified = true
+			created = true
+		default:
+			return err
+		}
+
+		return s.identityRepo.CreateIdentity(ctx, &models.ExternalIdentity{
+			UserID:   user.ID,
+			Provider: providerName,
+			Subject:  claims.Subject,
+			Email:    email,
+		})
+	})
+	if err != nil {
+		return nil, false, err
+	}
+
+	return user, created, nil
+}
+
+// newUserFromProfile builds an account with no password; it logs in through its providers
+// until the user sets one with a password reset
+func newUserFromProfile(email string, profile *models.SignupProfile) *models.User {
+	return &models.User{
+		Email:         email,
+		Name:          profile.Name,
+		Age:           profile.Age,
+		Sex:           profile.Sex,
+		Height:        profile.Height,
+		Weight:        profile.Weight,
+		ActivityLevel: profile.ActivityLevel,
+		Goal:          profile.Goal,
+		ProgramID:     profile.ProgramID,
+		WeeklyBudget:  profile.WeeklyBudget,
+		Timezone:      profile.Timezone,
+	}
+}
+
+func (s *identityService) StartLink(ctx context.Context, provider, userID string) (*OIDCAuthorization, error) {
+	return s.start(ctx, provider, userID, nil)
+}
+
+// CompleteLink attaches the provider account to the signed-in user. The email does not need
+// to match: the user proved they own both accounts by signing in to each.
+func (s *identityService) CompleteLink(ctx context.Context, providerName, userID, code, state string) (*models.ExternalIdentity, error) {
+	_, claims, err := s.finish(ctx, providerName, userID, code, state)
+	if err != nil {
+		return nil, err
+	}
+
+	identity := &models.ExternalIdentity{
+		UserID:   userID,
+		Provider: providerName,
+		Subject:  claims.Subject,
+		Email:    claims.Email,
+	}
+	if err := s.identityRepo.CreateIdentity(ctx, identity); err != nil {
+		return nil, err
+	}
+	return identity, nil
+}
+
+func (s *identityService) StartReauthentication(ctx context.Context, provider, userID string) (*OIDCAuthorization, error) {
+	return s.start(ctx, provider, userID, nil)
+}
+
+// Reauthenticate accepts a login to the provider that just happened, as the request it
+// redeems expires after OIDCAuthRequestTTL, and only with a provider account linked to the user
+func (s *identityService) Reauthenticate(ctx context.Context, providerName, userID, code, state string) error {
+	_, claims, err := s.finish(ctx, providerName, userID, code, state)
+	if err != nil {
+		return err
+	}
+
+	identity, err := s.identityRepo.GetIdentity(ctx, providerName, claims.Subject)
+	if errors.Is(err, repositories.ErrNotFound) || (err == nil && identity.UserID != userID) {
+		return ErrOIDCAuthFailed
+	}
+	return err
+}
+
+func (s *identityService) ListIdentities(ctx context.Context, userID string) ([]*models.ExternalIdentity, error) {
+	return s.identityRepo.GetUserIdentities(ctx, userID)
+}
+
+// Unlink removes a provider, unless the account has no password and no other provider left
+func (s *identityService) Unlink(ctx context.Context, userID, provider string) error {
+	return s.txManager.WithinTx(ctx, func(ctx context.Context) error {
+		user, err := s.userRepo.GetUserByID(ctx, userID)
+		if err != nil {
+			return err
+		}
+		if user.PasswordHash == "" {
+			identities, err := s.identityRepo.GetUserIdentities(ctx, userID)
+			if err != nil {
+				return err
+			}
+			others := 0
+			for _, identity := range identities {
+				if identity.Provider != provider {
+					others++
+				}
+			}
+			if others == 0 {
+				return ErrLastLoginMethod
+			}
+		}
+		return s.identityRepo.DeleteIdentity(ctx, userID, provider)
+	})
+}
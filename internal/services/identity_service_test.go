@@ -0,0 +1,282 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/url"
+	"testing"
+	"time"
+
+	"yoked_backend/internal/db/repositories"
+	"yoked_backend/internal/models"
+	"yoked_backend/internal/oidc"
+)
+
+func (f *fakeUserRepo) CreateUser(ctx context.Context, user *models.User) error {
+	for _, existing := range f.users {
+		if existing.Email == user.Email {
+			return repositories.ErrConflict
+		}
+	}
+	user.ID = fmt.Sprintf("user-%d", len(f.users)+1)
+	copied := *user
+	f.users[user.ID] = &copied
+	return nil
+}
+
+func (f *fakeUserRepo) CreateUserProgram(ctx context.Context, userProgram *models.UserProgram) error {
+	return nil
+}
+
+type fakeIdentityRepo struct {
+	requests   map[string]*models.OIDCAuthRequest // by state hash
+	identities []*models.ExternalIdentity
+}
+
+func newFakeIdentityRepo() *fakeIdentityRepo {
+	return &fakeIdentityRepo{requests: make(map[string]*models.OIDCAuthRequest)}
+}
+
+func (f *fakeIdentityRepo) CreateOIDCAuthRequest(ctx context.Context, req *models.OIDCAuthRequest) error {
+	f.requests[req.StateHash] = req
+	return nil
+}
+
+func (f *fakeIdentityRepo) ConsumeOIDCAuthRequest(ctx context.Context, stateHash string) (*models.OIDCAuthRequest, error) {
+	req, ok := f.requests[stateHash]
+	if !ok {
+		return nil, repositories.ErrNotFound
+	}
+	delete(f.requests, stateHash)
+	return req, nil
+}
+
+func (f *fakeIdentityRepo) CreateIdentity(ctx context.Context, identity *models.ExternalIdentity) error {
+	for _, existing := range f.identities {
+		if existing.Provider == identity.Provider && (existing.Subject == identity.Subject || existing.UserID == identity.UserID) {
+			return repositories.ErrConflict
+		}
+	}
+	identity.ID = fmt.Sprintf("identity-%d", len(f.identities)+1)
+	f.identities = append(f.identities, identity)
+	return nil
+}
+
+func (f *fakeIdentityRepo) GetIdentity(ctx context.Context, provider, subject string) (*models.ExternalIdentity, error) {
+	for _, identity := range f.identities {
+		if identity.Provider == provider && identity.Subject == subject {
+			return identity, nil
+		}
+	}
+	return nil, repositories.ErrNotFound
+}
+
+func (f *fakeIdentityRepo) GetUserIdentities(ctx context.Context, userID string) ([]*models.ExternalIdentity, error) {
+	var identities []*models.ExternalIdentity
+	for _, identity := range f.identities {
+		if identity.UserID == userID {
+			identities = append(identities, identity)
+		}
+	}
+	return identities, nil
+}
+
+func (f *fakeIdentityRepo) DeleteIdentity(ctx context.Context, userID, provider string) error {
+	for i, identity := range f.identities {
+		if identity.UserID == userID && identity.Provider == provider {
+			f.identities = append(f.identities[:i], f.identities[i+1:]...)
+			return nil
+		}
+	}
+	return repositories.ErrNotFound
+}
+
+// fakeOIDCProvider signs in whoever the test says, checking the nonce and PKCE verifier the
+// way a real provider would
+type fakeOIDCProvider struct {
+	name      string
+	claims    oidc.Claims
+	nonce     string
+	challenge string
+}
+
+func (p *fakeOIDCProvider) Name() string { return p.name }
+
+func (p *fakeOIDCProvider) AuthCodeURL(ctx context.Context, state, nonce, codeChallenge string) (string, error) {
+	p.nonce, p.challenge = nonce, codeChallenge
+	return "https://" + p.name + ".example.com/authorize?state=" + url.QueryEscape(state), nil
+}
+
+func (p *fakeOIDCProvider) Authenticate(ctx context.Context, code, codeVerifier, nonce string) (*oidc.Claims, error) {
+	if code != "good-code" || oidc.CodeChallengeS256(codeVerifier) != p.challenge || nonce != p.nonce {
+		return nil, oidc.ErrInvalidIDToken
+	}
+	claims := p.claims
+	return &claims, nil
+}
+
+func newIdentityFixture() (*identityService, *fakeUserRepo, *fakeIdentityRepo, *fakeOIDCProvider) {
+	users := &fakeUserRepo{users: map[string]*models.User{}}
+	identities := newFakeIdentityRepo()
+	google := &fakeOIDCProvider{name: "google"}
+	published := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	programs := &fakeProgramRepo{programs: map[int]*models.Program{1: {ID: 1, Name: "Full body", PublishedAt: &published}}}
+	userService := NewUserService(users, programs, newFakeTokenRepo(), passthroughTx{}, nil)
+	service := NewIdentityService(identities, users, userService, passthroughTx{}, []OIDCProvider{google}).(*identityService)
+	return service, users, identities, google
+}
+
+var testProfile = &models.SignupProfile{
+	Name: "Lifter", Age: 30, Sex: "other", Height: 180, Weight: 80,
+	ActivityLevel: "very_active", Goal: "muscle_gain", ProgramID: 1,
+}
+
+func TestOIDCLoginCreatesAccountThenFindsIt(t *testing.T) {
+	ctx := context.Background()
+	service, users, _, google := newIdentityFixture()
+	google.claims = oidc.Claims{Subject: "g-1", Email: "lifter@example.com", EmailVerified: true}
+
+	auth, err := service.StartLogin(ctx, "google", testProfile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	user, created, err := service.CompleteLogin(ctx, "google", "good-code", auth.State)
+	if err != nil {
+		t.Fatalf("complete login: %v", err)
+	}
+	if !created || user.Email != "lifter@example.com" || user.PasswordHash != "" {
+		t.Errorf("unexpected new account %+v (created %v)", user, created)
+	}
+	if !users.users[user.ID].EmailVerified {
+		t.Error("account created from a verified provider email is not verified")
+	}
+
+	// The state is single use
+	if _, _, err := service.CompleteLogin(ctx, "google", "good-code", auth.State); !errors.Is(err, ErrInvalidOIDCState) {
+		t.Errorf("replayed state: got %v", err)
+	}
+
+	// A returning login needs no profile and finds the same account by subject
+	auth, _ = service.StartLogin(ctx, "google", nil)
+	again, created, err := service.CompleteLogin(ctx, "google", "good-code", auth.State)
+	if err != nil || created || again.ID != user.ID {
+		t.Errorf("returning login: user %+v created %v err %v", again, created, err)
+	}
+}
+
+func TestOIDCLoginLinksByVerifiedEmail(t *testing.T) {
+	ctx := context.Background()
+	service, users, identities, google := newIdentityFixture()
+	users.users["u1"] = &models.User{ID: "u1", Email: "lifter@example.com", PasswordHash: "hash", EmailVerified: true}
+	google.claims = oidc.Claims{Subject: "g-1", Email: "lifter@example.com", EmailVerified: true}
+
+	auth, _ := service.StartLogin(ctx, "google", nil)
+	user, created, err := service.CompleteLogin(ctx, "google", "good-code", auth.State)
+	if err != nil || created || user.ID != "u1" {
+		t.Fatalf("user %+v created %v err %v", user, created, err)
+	}
+	if len(identities.identities) != 1 || identities.identities[0].UserID != "u1" {
+		t.Errorf("identity not linked: %+v", identities.identities)
+	}
+}
+
+func TestOIDCLoginRefusals(t *testing.T) {
+	ctx := context.Background()
+
+	tests := map[string]struct {
+		local   *models.User
+		claims  oidc.Claims
+		profile *models.SignupProfile
+		code    string
+		want    error
+	}{
+		"unverified provider email": {
+			claims: oidc.Claims{Subject: "g-1", Email: "lifter@example.com"},
+			want:   ErrOIDCEmailUnverified,
+		},
+		"unverified local account": {
+			local:  &models.User{ID: "u1", Email: "lifter@example.com", PasswordHash: "hash"},
+			claims: oidc.Claims{Subject: "g-1", Email: "lifter@example.com", EmailVerified: true},
+			want:   ErrIdentityConflict,
+		},
+		"first login without a profile": {
+			claims: oidc.Claims{Subject: "g-1", Email: "lifter@example.com", EmailVerified: true},
+			want:   ErrSignupProfileRequired,
+		},
+		"code rejected by provider": {
+			claims:  oidc.Claims{Subject: "g-1", Email: "lifter@example.com", EmailVerified: true},
+			profile: testProfile,
+			code:    "bad-code",
+			want:    ErrOIDCAuthFailed,
+		},
+	}
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			service, users, _, google := newIdentityFixture()
+			if tt.local != nil {
+				users.users[tt.local.ID] = tt.local
+			}
+			google.claims = tt.claims
+			code := tt.code
+			if code == "" {
+				code = "good-code"
+			}
+
+			auth, _ := service.StartLogin(ctx, "google", tt.profile)
+			if _, _, err := service.CompleteLogin(ctx, "google", code, auth.State); !errors.Is(err, tt.want) {
+				t.Errorf("got %v, want %v", err, tt.want)
+			}
+		})
+	}
+
+	t.Run("unknown provider", func(t *testing.T) {
+		service, _, _, _ := newIdentityFixture()
+		if _, err := service.StartLogin(ctx, "myspace", nil); !errors.Is(err, ErrUnknownProvider) {
+			t.Errorf("got %v", err)
+		}
+	})
+}
+
+func TestOIDCStateCannotCrossFlows(t *testing.T) {
+	ctx := context.Background()
+	service, users, _, google := newIdentityFixture()
+	users.users["u1"] = &models.User{ID: "u1", Email: "lifter@example.com", PasswordHash: "hash"}
+	google.claims = oidc.Claims{Subject: "g-1", Email: "attacker@example.com", EmailVerified: true}
+
+	// A link started by one user cannot be completed as a login, nor by another user
+	link, _ := service.StartLink(ctx, "google", "u1")
+	if _, _, err := service.CompleteLogin(ctx, "google", "good-code", link.State); !errors.Is(err, ErrInvalidOIDCState) {
+		t.Errorf("link state used for login: got %v", err)
+	}
+	link, _ = service.StartLink(ctx, "google", "u1")
+	if _, err := service.CompleteLink(ctx, "google", "u2", "good-code", link.State); !errors.Is(err, ErrInvalidOIDCState) {
+		t.Errorf("link state used by another user: got %v", err)
+	}
+}
+
+func TestLinkAndUnlink(t *testing.T) {
+	ctx := context.Background()
+	service, users, _, google := newIdentityFixture()
+	users.users["u1"] = &models.User{ID: "u1", Email: "lifter@example.com"}
+	google.claims = oidc.Claims{Subject: "g-1", Email: "other@example.com"}
+
+	// Linking needs no email match: the user signed in to both accounts
+	link, _ := service.StartLink(ctx, "google", "u1")
+	if _, err := service.CompleteLink(ctx, "google", "u1", "good-code", link.State); err != nil {
+		t.Fatalf("link: %v", err)
+	}
+
+	// Without a password the only provider cannot be removed
+	if err := service.Unlink(ctx, "u1", "google"); !errors.Is(err, ErrLastLoginMethod) {
+		t.Errorf("unlink last login method: got %v", err)
+	}
+
+	users.users["u1"].PasswordHash = "hash"
+	if err := service.Unlink(ctx, "u1", "google"); err != nil {
+		t.Errorf("unlink with a password set: %v", err)
+	}
+	if identities, _ := service.ListIdentities(ctx, "u1"); len(identities) != 0 {
+		t.Errorf("identities left after unlink: %+v", identities)
+	}
+}
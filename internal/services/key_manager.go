@@ -0,0 +1,353 @@
+package services
+
+import (
+	"context"
+	"crypto"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log"
+	"math/big"
+	"os"
+	"sync"
+	"time"
+
+	"yoked_backend/internal/db/repositories"
+	"yoked_backend/internal/models"
+)
+
+const (
+	SigningAlgorithmRS256 = "RS256"
+	SigningAlgorithmEdDSA = "EdDSA"
+
+	DefaultKeyRotationInterval = 30 * 24 * time.Hour
+
+	// KeyPropagationDelay is how long a new key is published before anything signs with it, so
+	// every instance has reloaded it and JWKS consumers have had a chance to refetch
+	KeyPropagationDelay = 10 * time.Minute
+
+	// DefaultKeyGracePeriod is how long a superseded key keeps verifying. It must outlive
+	// the access tokens it signed.
+	DefaultKeyGracePeriod = time.Hour
+
+	// devJWTSecret is only accepted when APP_ENV=development
+	devJWTSecret = "your-default-super-secret-key-change-in-production"
+)
+
+// ErrUnknownSigningKey is returned when a token names a kid that is not loaded
+var ErrUnknownSigningKey = errors.New("unknown signing key")
+
+// SigningKeyConfig controls access-token signing. Secret encrypts private keys at rest.
+type SigningKeyConfig struct {
+	Algorithm        string
+	RotationInterval time.Duration
+	GracePeriod      time.Duration
+	Secret           []byte
+}
+
+// SigningKeyConfigFromEnv reads JWT_SECRET, JWT_SIGNING_ALG (RS256 or EdDSA) and
+// JWT_KEY_ROTATION_INTERVAL. A missing or default JWT_SECRET is refused unless APP_ENV=development.
+func SigningKeyConfigFromEnv() (SigningKeyConfig, error) {
+	cfg := SigningKeyConfig{
+		Algorithm:        SigningAlgorithmEdDSA,
+		RotationInterval: DefaultKeyRotationInterval,
+		GracePeriod:      DefaultKeyGracePeriod,
+	}
+
+	devMode := os.Getenv("APP_ENV") == "development"
+	secret := os.Getenv("JWT_SECRET")
+	switch {
+	case secret == "" && devMode:
+		log.Printf("JWT_SECRET is not set, using the development default")
+		secret = devJWTSecret
+	case secret == "":
+		return cfg, fmt.Errorf("JWT_SECRET must be set (or APP_ENV=development)")
+	case secret == devJWTSecret && !devMode:
+		return cfg, fmt.Errorf("JWT_SECRET is the development default, set a real secret")
+	}
+	cfg.Secret = []byte(secret)
+
+	if alg := os.Getenv("JWT_SIGNING_ALG"); alg != "" {
+		if alg != SigningAlgorithmRS256 && alg != SigningAlgorithmEdDSA {
+			return cfg, fmt.Errorf("unsupported JWT_SIGNING_ALG %q (want %s or %s)", alg, SigningAlgorithmRS256, SigningAlgorithmEdDSA)
+		}
+		cfg.Algorithm = alg
+	}
+
+	if value := os.Getenv("JWT_KEY_ROTATION_INTERVAL"); value != "" {
+		interval, err := time.ParseDuration(value)
+		if err != nil || interval <= KeyPropagationDelay {
+			return cfg, fmt.Errorf("invalid JWT_KEY_ROTATION_INTERVAL %q, must be longer than %s", value, KeyPropagationDelay)
+		}
+		cfg.RotationInterval = interval
+	}
+
+	return cfg, nil
+}
+
+// JSONWebKey is the public half of a signing key in RFC 7517 form
+type JSONWebKey struct {
+	KeyType   string `json:"kty"`
+	Use       string `json:"use"`
+	Algorithm string `json:"alg"`
+	KID       string `json:"kid"`
+	Curve     string `json:"crv,omitempty"`
+	X         string `json:"x,omitempty"`
+	N         string `json:"n,omitempty"`
+	E         string `json:"e,omitempty"`
+}
+
+type JSONWebKeySet struct {
+	Keys []JSONWebKey `json:"keys"`
+}
+
+// KeyManager holds the shared signing keys in memory. Refresh reloads them, rotating when the
+// newest key is older than the rotation interval and pruning keys past their grace period.
+type KeyManager interface {
+	SigningKey() (kid, alg string, key crypto.PrivateKey, err error)
+	VerificationKey(kid string) (alg string, key crypto.PublicKey, err error)
+	JWKS() JSONWebKeySet
+	Refresh(ctx context.Context) error
+}
+
+type loadedKey struct {
+	kid       string
+	alg       string
+	private   crypto.PrivateKey
+	public    crypto.PublicKey
+	createdAt time.Time
+}
+
+type keyManager struct {
+	keyRepo repositories.SigningKeyRepository
+	cfg     SigningKeyConfig
+	aead    cipher.AEAD
+	now     func() time.Time
+
+	mu   sync.RWMutex
+	keys []*loadedKey // oldest first
+}
+
+func NewKeyManager(keyRepo repositories.SigningKeyRepository, cfg SigningKeyConfig) (KeyManager, error) {
+	// The configured secret may be any length; its digest is the AES-256 key
+	digest := sha256.Sum256(cfg.Secret)
+	block, err := aes.NewCipher(digest[:])
+	if err != nil {
+		return nil, fmt.Errorf("failed to initialise key encryption: %w", err)
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, fmt.Errorf("failed to initialise key encryption: %w", err)
+	}
+	return &keyManager{keyRepo: keyRepo, cfg: cfg, aead: aead, now: time.Now}, nil
+}
+
+// SigningKey returns the newest key that has finished propagating. On a fresh database no key
+// has yet, and the newest one is used straight away.
+func (m *keyManager) SigningKey() (string, string, crypto.PrivateKey, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	if len(m.keys) == 0 {
+		return "", "", nil, fmt.Errorf("no signing keys loaded")
+	}
+	cutoff := m.now().Add(-KeyPropagationDelay)
+	for i := len(m.keys) - 1; i >= 0; i-- {
+		if !m.keys[i].createdAt.After(cutoff) {
+			return m.keys[i].kid, m.keys[i].alg, m.keys[i].private, nil
+		}
+	}
+	newest := m.keys[len(m.keys)-1]
+	return newest.kid, newest.alg, newest.private, nil
+}
+
+func (m *keyManager) VerificationKey(kid string) (string, crypto.PublicKey, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	for _, key := range m.keys {
+		if key.kid == kid {
+			return key.alg, key.public, nil
+		}
+	}
+	return "", nil, ErrUnknownSigningKey
+}
+
+// JWKS lists every loaded public key, including ones not yet used for signing
+func (m *keyManager) JWKS() JSONWebKeySet {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	set := JSONWebKeySet{Keys: make([]JSONWebKey, 0, len(m.keys))}
+	for _, key := range m.keys {
+		jwk := JSONWebKey{Use: "sig", Algorithm: key.alg, KID: key.kid}
+		switch public := key.public.(type) {
+		case ed25519.PublicKey:
+			jwk.KeyType, jwk.Curve = "OKP", "Ed25519"
+			jwk.X = base64.RawURLEncoding.EncodeToString(public)
+		case *rsa.PublicKey:
+			jwk.KeyType = "RSA"
+			jwk.N = base64.RawURLEncoding.EncodeToString(public.N.Bytes())
+			jwk.E = base64.RawURLEncoding.EncodeToString(big.NewInt(int64(public.E)).Bytes())
+		default:
+			continue
+		}
+		set.Keys = append(set.Keys, jwk)
+	}
+	return set
+}
+
+func (m *keyManager) Refresh(ctx context.Context) error {
+	now := m.now()
+
+	stored, err := m.keyRepo.GetSigningKeys(ctx)
+	if err != nil {
+		return err
+	}
+
+	if len(stored) == 0 || now.Sub(stored[len(stored)-1].CreatedAt) >= m.cfg.RotationInterval {
+		key, err := m.generate()
+		if err != nil {
+			return err
+		}
+		created, err := m.keyRepo.CreateSigningKeyIfStale(ctx, key, now.Add(-m.cfg.RotationInterval))
+		if err != nil {
+			return err
+		}
+		if created {
+			log.Printf("Published signing key %s (%s)", key.KID, key.Algorithm)
+		}
+		// Reload either way: if another instance won the race its key is the one to use
+		if stored, err = m.keyRepo.GetSigningKeys(ctx); err != nil {
+			return err
+		}
+	}
+
+	// A key stops signing once its successor has propagated and stops verifying a grace period later
+	var live []*models.SigningKey
+	var expired []string
+	for i, key := range stored {
+		if i+1 < len(stored) && !now.Before(stored[i+1].CreatedAt.Add(KeyPropagationDelay+m.cfg.GracePeriod)) {
+			expired = append(expired, key.KID)
+			continue
+		}
+		live = append(live, key)
+	}
+	if err := m.keyRepo.DeleteSigningKeys(ctx, expired); err != nil {
+		return err
+	}
+
+	keys := make([]*loadedKey, 0, len(live))
+	for _, key := range live {
+		loaded, err := m.load(key)
+		if err != nil {
+			return err
+		}
+		keys = append(keys, loaded)
+	}
+
+	m.mu.Lock()
+	m.keys = keys
+	m.mu.Unlock()
+	return nil
+}
+
+// generate creates a key pair for the configured algorithm with its private half encrypted
+func (m *keyManager) generate() (*models.SigningKey, error) {
+	var private crypto.PrivateKey
+	var public crypto.PublicKey
+	switch m.cfg.Algorithm {
+	case SigningAlgorithmEdDSA:
+		pub, priv, err := ed25519.GenerateKey(rand.Reader)
+		if err != nil {
+			return nil, fmt.Errorf("failed to generate signing key: %w", err)
+		}
+		private, public = priv, pub
+	case SigningAlgorithmRS256:
+		priv, err := rsa.GenerateKey(rand.Reader, 2048)
+		if err != nil {
+			return nil, fmt.Errorf("failed to generate signing key: %w", err)
+		}
+		private, public = priv, &priv.PublicKey
+	default:
+		return nil, fmt.Errorf("unsupported signing algorithm %q", m.cfg.Algorithm)
+	}
+
+	privateDER, err := x509.MarshalPKCS8PrivateKey(private)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode signing key: %w", err)
+	}
+	publicDER, err := x509.MarshalPKIXPublicKey(public)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode signing key: %w", err)
+	}
+
+	id := make([]byte, 8)
+	if _, err := rand.Read(id); err != nil {
+		return nil, fmt.Errorf("failed to generate key id: %w", err)
+	}
+	kid := hex.EncodeToString(id)
+
+	nonce := make([]byte, m.aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, fmt.Errorf("failed to encrypt signing key: %w", err)
+	}
+	// The kid is bound as additional data so encrypted keys cannot be swapped between rows
+	sealed := m.aead.Seal(nonce, nonce, privateDER, []byte(kid))
+
+	return &models.SigningKey{
+		KID:        kid,
+		Algorithm:  m.cfg.Algorithm,
+		PrivateKey: sealed,
+		PublicKey:  publicDER,
+	}, nil
+}
+
+// load decrypts and parses a stored key
+func (m *keyManager) load(key *models.SigningKey) (*loadedKey, error) {
+	nonceSize := m.aead.NonceSize()
+	if len(key.PrivateKey) < nonceSize {
+		return nil, fmt.Errorf("signing key %s is corrupt", key.KID)
+	}
+	privateDER, err := m.aead.Open(nil, key.PrivateKey[:nonceSize], key.PrivateKey[nonceSize:], []byte(key.KID))
+	if err != nil {
+		return nil, fmt.Errorf("failed to decrypt signing key %s, has JWT_SECRET changed? %w", key.KID, err)
+	}
+
+	private, err := x509.ParsePKCS8PrivateKey(privateDER)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse signing key %s: %w", key.KID, err)
+	}
+	public, err := x509.ParsePKIXPublicKey(key.PublicKey)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse signing key %s: %w", key.KID, err)
+	}
+
+	return &loadedKey{kid: key.KID, alg: key.Algorithm, private: private, public: public, createdAt: key.CreatedAt}, nil
+}
+
+// RunKeyRotation refreshes the signing keys every interval until ctx is cancelled. The interval
+// must be well under KeyPropagationDelay so every instance sees a new key before it signs.
+func RunKeyRotation(ctx context.Context, keys KeyManager, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := keys.Refresh(ctx); err != nil {
+				log.Printf("Failed to refresh signing keys: %v", err)
+			}
+		}
+	}
+}
@@ -0,0 +1,159 @@
+package services
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"yoked_backend/internal/api/middleware"
+	"yoked_backend/internal/models"
+)
+
+// fakeSigningKeyRepo stamps keys with the test clock instead of the database's
+type fakeSigningKeyRepo struct {
+	keys []*models.SigningKey
+	now  func() time.Time
+}
+
+func (f *fakeSigningKeyRepo) CreateSigningKeyIfStale(ctx context.Context, key *models.SigningKey, newerThan time.Time) (bool, error) {
+	for _, existing := range f.keys {
+		if existing.CreatedAt.After(newerThan) {
+			return false, nil
+		}
+	}
+	key.CreatedAt = f.now()
+	stored := *key
+	f.keys = append(f.keys, &stored)
+	return true, nil
+}
+
+func (f *fakeSigningKeyRepo) GetSigningKeys(ctx context.Context) ([]*models.SigningKey, error) {
+	keys := make([]*models.SigningKey, len(f.keys))
+	copy(keys, f.keys)
+	return keys, nil
+}
+
+func (f *fakeSigningKeyRepo) DeleteSigningKeys(ctx context.Context, kids []string) error {
+	remove := make(map[string]bool)
+	for _, kid := range kids {
+		remove[kid] = true
+	}
+	kept := f.keys[:0]
+	for _, key := range f.keys {
+		if !remove[key.KID] {
+			kept = append(kept, key)
+		}
+	}
+	f.keys = kept
+	return nil
+}
+
+func newTestKeyManager(t *testing.T, alg string, repo *fakeSigningKeyRepo, now *time.Time) *keyManager {
+	t.Helper()
+	repo.now = func() time.Time { return *now }
+	cfg := SigningKeyConfig{Algorithm: alg, RotationInterval: 24 * time.Hour, GracePeriod: time.Hour, Secret: []byte("test-secret")}
+	manager, err := NewKeyManager(repo, cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	km := manager.(*keyManager)
+	km.now = func() time.Time { return *now }
+	return km
+}
+
+func TestKeyManagerRotation(t *testing.T) {
+	ctx := context.Background()
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	repo := &fakeSigningKeyRepo{}
+	km := newTestKeyManager(t, SigningAlgorithmEdDSA, repo, &now)
+
+	if err := km.Refresh(ctx); err != nil {
+		t.Fatal(err)
+	}
+	first, _, _, err := km.SigningKey()
+	if err != nil {
+		t.Fatalf("fresh database: %v", err)
+	}
+
+	// A second instance reuses the stored key rather than adding its own
+	other := newTestKeyManager(t, SigningAlgorithmEdDSA, repo, &now)
+	if err := other.Refresh(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if len(repo.keys) != 1 {
+		t.Fatalf("expected one stored key, got %d", len(repo.keys))
+	}
+
+	// Rotation publishes a new key, but the old one keeps signing until it has propagated
+	now = now.Add(24 * time.Hour)
+	if err := km.Refresh(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if len(km.JWKS().Keys) != 2 {
+		t.Fatalf("expected both keys in the JWKS, got %d", len(km.JWKS().Keys))
+	}
+	if kid, _, _, _ := km.SigningKey(); kid != first {
+		t.Errorf("new key signed before propagating")
+	}
+
+	now = now.Add(KeyPropagationDelay)
+	second, _, _, _ := km.SigningKey()
+	if second == first {
+		t.Fatal("new key not used after propagating")
+	}
+
+	// The old key verifies through the grace period and is pruned after it
+	now = now.Add(time.Hour - time.Second)
+	if err := km.Refresh(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := km.VerificationKey(first); err != nil {
+		t.Errorf("old key dropped during grace period: %v", err)
+	}
+	now = now.Add(time.Second)
+	if err := km.Refresh(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := km.VerificationKey(first); err != ErrUnknownSigningKey {
+		t.Errorf("old key still loaded after grace period: %v", err)
+	}
+	if len(repo.keys) != 1 || repo.keys[0].KID != second {
+		t.Errorf("expected only the new key to remain stored")
+	}
+}
+
+func TestKeyManagerSignsAndVerifies(t *testing.T) {
+	for _, alg := range []string{SigningAlgorithmEdDSA, SigningAlgorithmRS256} {
+		t.Run(alg, func(t *testing.T) {
+			now := time.Now()
+			repo := &fakeSigningKeyRepo{}
+			km := newTestKeyManager(t, alg, repo, &now)
+			if err := km.Refresh(context.Background()); err != nil {
+				t.Fatal(err)
+			}
+
+			user := &models.User{ID: "u1", Email: "lifter@example.com", Role: models.RoleCoach, TokenVersion: 1}
+			token, _, err := middleware.GenerateJWT(km, user, "")
+			if err != nil {
+				t.Fatal(err)
+			}
+			claims, err := middleware.ValidateJWT(km, token)
+			if err != nil || claims.UserID != "u1" || claims.Role != models.RoleCoach || len(claims.Permissions) != 1 {
+				t.Fatalf("got %+v, %v", claims, err)
+			}
+
+			jwk := km.JWKS().Keys[0]
+			if jwk.Algorithm != alg || jwk.KID == "" || (jwk.X == "" && jwk.N == "") {
+				t.Errorf("incomplete JWK: %+v", jwk)
+			}
+
+			// Keys written under one secret cannot be loaded with another
+			cfg := km.cfg
+			cfg.Secret = []byte("another-secret")
+			rekeyed, _ := NewKeyManager(repo, cfg)
+			if err := rekeyed.Refresh(context.Background()); err == nil {
+				t.Error("expected decryption to fail with a different secret")
+			}
+		})
+	}
+}
@@ -0,0 +1,35 @@
+package services
+
+import (
+	"fmt"
+	"net/url"
+	"os"
+)
+
+// linkURLFromEnv reads the page an emailed link points at from the named variable. It is
+// required unless APP_ENV=development, where devDefault is used.
+func linkURLFromEnv(name, devDefault string) (string, error) {
+	value := os.Getenv(name)
+	if value == "" {
+		if os.Getenv("APP_ENV") != "development" {
+			return "", fmt.Errorf("%s must be set (or APP_ENV=development)", name)
+		}
+		return devDefault, nil
+	}
+	if parsed, err := url.Parse(value); err != nil || parsed.Scheme == "" || parsed.Host == "" {
+		return "", fmt.Errorf("invalid %s %q", name, value)
+	}
+	return value, nil
+}
+
+// linkWithToken appends token to base as ?token=
+func linkWithToken(base, token string) (string, error) {
+	link, err := url.Parse(base)
+	if err != nil {
+		return "", fmt.Errorf("invalid link URL: %w", err)
+	}
+	query := link.Query()
+	query.Set("token", token)
+	link.RawQuery = query.Encode()
+	return link.String(), nil
+}
@@ -0,0 +1,387 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	DefaultLoginMaxFailures   = 5
+	DefaultLoginIPMaxFailures = 20
+	DefaultLoginLockout       = time.Minute
+	DefaultLoginMaxLockout    = time.Hour
+)
+
+var (
+	// ErrLoginLocked is returned while an account or address is locked out after failed logins
+	ErrLoginLocked = errors.New("too many failed login attempts, please try again later")
+	// ErrTooManyRequests is returned while an address is locked out of a rate limited action
+	ErrTooManyRequests = errors.New("too many requests, please try again later")
+)
+
+// LoginThrottleConfig sets when repeated failures lock logins out. The first lockout lasts
+// Lockout and each further failure doubles it, up to MaxLockout. Failures are forgotten once
+// MaxLockout has passed without another.
+type LoginThrottleConfig struct {
+	MaxFailures   int // per account
+	IPMaxFailures int // per client address, across accounts
+	Lockout       time.Duration
+	MaxLockout    time.Duration
+}
+
+// LoginThrottleConfigFromEnv reads LOGIN_MAX_FAILURES, LOGIN_IP_MAX_FAILURES, LOGIN_LOCKOUT and
+// LOGIN_MAX_LOCKOUT, falling back to the defaults
+func LoginThrottleConfigFromEnv() (LoginThrottleConfig, error) {
+	cfg := LoginThrottleConfig{
+		MaxFailures:   DefaultLoginMaxFailures,
+		IPMaxFailures: DefaultLoginIPMaxFailures,
+		Lockout:       DefaultLoginLockout,
+		MaxLockout:    DefaultLoginMaxLockout,
+	}
+
+	for name, target := range map[string]*int{"LOGIN_MAX_FAILURES": &cfg.MaxFailures, "LOGIN_IP_MAX_FAILURES": &cfg.IPMaxFailures} {
+		if value := os.Getenv(name); value != "" {
+			parsed, err := strconv.Atoi(value)
+			if err != nil || parsed < 1 {
+				return cfg, fmt.Errorf("invalid %s %q", name, value)
+			}
+			*target = parsed
+		}
+	}
+	for name, target := range map[string]*time.Duration{"LOGIN_LOCKOUT": &cfg.Lockout, "LOGIN_MAX_LOCKOUT": &cfg.MaxLockout} {
+		if value := os.Getenv(name); value != "" {
+			parsed, err := time.ParseDuration(value)
+			if err != nil || parsed <= 0 {
+				return cfg, fmt.Errorf("invalid %s %q", name, value)
+			}
+			*target = parsed
+		}
+	}
+	if cfg.MaxLockout < cfg.Lockout {
+		return cfg, fmt.Errorf("LOGIN_MAX_LOCKOUT must not be shorter than LOGIN_LOCKOUT")
+	}
+	return cfg, nil
+}
+
+// LoginAttempts is the failure history kept for one account or address
+type LoginAttempts struct {
+	Failures    int
+	LastFailure time.Time
+	Pending     int // attempts claimed but not yet found right or wrong
+	LastClaim   time.Time
+}
+
+// LoginAttemptStore keeps failure counts. The in-memory store suits a single instance;
+// with several, plug in a shared implementation so an attacker cannot spread attempts.
+type LoginAttemptStore interface {
+	Get(ctx context.Context, key string) (LoginAttempts, error)
+	// Claim adds a pending attempt at at unless wait, given the key's attempts so far, asks it to
+	// wait. It returns the attempts and the wait. The check and the claim must be one operation,
+	// so parallel attempts cannot all pass the check before any is counted. Failures older than
+	// window are forgotten, as are claims never settled within it.
+	Claim(ctx context.Context, key string, at time.Time, window time.Duration, wait func(LoginAttempts) time.Duration) (LoginAttempts, time.Duration, error)
+	// RecordFailure settles a pending attempt as a failure at at
+	RecordFailure(ctx context.Context, key string, at time.Time) (LoginAttempts, error)
+	// Forgive settles a pending attempt without counting it
+	Forgive(ctx context.Context, key string) error
+	Reset(ctx context.Context, key string) error
+}
+
+type memoryLoginAttemptStore struct {
+	mu        sync.Mutex
+	attempts  map[string]LoginAttempts
+	lastSweep time.Time
+}
+
+func NewMemoryLoginAttemptStore() LoginAttemptStore {
+	return &memoryLoginAttemptStore{attempts: make(map[string]LoginAttempts)}
+}
+
+func (s *memoryLoginAttemptStore) Get(ctx context.Context, key string) (LoginAttempts, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.attempts[key], nil
+}
+
+func (s *memoryLoginAttemptStore) Claim(ctx context.Context, key string, at time.Time, window time.Duration, wait func(LoginAttempts) time.Duration) (LoginAttempts, time.Duration, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	// Drop stale entries now and then so addresses that stop trying do not pile up
+	if at.Sub(s.lastSweep) > window {
+		for k, attempts := range s.attempts {
+			if at.Sub(attempts.LastFailure) > window && at.Sub(attempts.LastClaim) > window {
+				delete(s.attempts, k)
+			}
+		}
+		s.lastSweep = at
+	}
+
+	attempts := s.attempts[key]
+	if at.Sub(attempts.LastFailure) > window {
+		attempts.Failures = 0
+	}
+	if at.Sub(attempts.LastClaim) > window {
+		attempts.Pending = 0
+	}
+	if wait := wait(attempts); wait > 0 {
+		return attempts, wait, nil
+	}
+	attempts.Pending++
+	attempts.LastClaim = at
+	s.attempts[key] = attempts
+	return attempts, 0, nil
+}
+
+func (s *memoryLoginAttemptStore) RecordFailure(ctx context.Context, key string, at time.Time) (LoginAttempts, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	attempts := s.attempts[key]
+	attempts.Pending = max(attempts.Pending-1, 0)
+	attempts.Failures++
+	attempts.LastFailure = at
+	s.attempts[key] = attempts
+	return attempts, nil
+}
+
+func (s *memoryLoginAttemptStore) Forgive(ctx context.Context, key string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if attempts, ok := s.attempts[key]; ok {
+		attempts.Pending = max(attempts.Pending-1, 0)
+		s.attempts[key] = attempts
+	}
+	return nil
+}
+
+func (s *memoryLoginAttemptStore) Reset(ctx context.Context, key string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.attempts, key)
+	return nil
+}
+
+// LoginThrottle tracks failed logins per account and per client address. Attempt runs before
+// the password is compared, so a locked out attacker does not cost a bcrypt comparison.
+type LoginThrottle interface {
+	// Attempt returns ErrLoginLocked and how long to wait while either key is locked out.
+	// Otherwise it claims the attempt, which RecordFailure, RecordSuccess or Forgive settles.
+	// Claimed attempts count towards the lockout, so parallel guesses cannot slip past it.
+	Attempt(ctx context.Context, email, ip string) (time.Duration, error)
+	RecordFailure(ctx context.Context, email, ip string) error
+	RecordSuccess(ctx context.Context, email, ip string) error
+	// Forgive settles an attempt that proved nothing either way, such as a right password that
+	// still needs its two-factor code
+	Forgive(ctx context.Context, email, ip string) error
+}
+
+type loginThrottle struct {
+	store LoginAttemptStore
+	cfg   LoginThrottleConfig
+	now   func() time.Time
+}
+
+func NewLoginThrottle(store LoginAttemptStore, cfg LoginThrottleConfig) LoginThrottle {
+	return &loginThrottle{store: store, cfg: cfg, now: time.Now}
+}
+
+// Accounts are keyed by email whether or not one exists, so lockouts do not reveal which do
+func accountKey(email string) string {
+	return "account:" + strings.ToLower(strings.TrimSpace(email))
+}
+
+func ipKey(ip string) string {
+	return "ip:" + ip
+}
+
+// lockout is how long a key with failures failures stays locked after its last one
+func (t *loginThrottle) lockout(failures, threshold int) time.Duration {
+	if failures < threshold {
+		return 0
+	}
+	lockout := t.cfg.Lockout
+	for i := threshold; i < failures && lockout < t.cfg.MaxLockout; i++ {
+		lockout *= 2
+	}
+	return min(lockout, t.cfg.MaxLockout)
+}
+
+// remaining is how much of the lockout for attempts is left at now
+func (t *loginThrottle) remaining(attempts LoginAttempts, threshold int, now time.Time) time.Duration {
+	lockout := t.lockout(attempts.Failures, threshold)
+	if lockout == 0 {
+		return 0
+	}
+	return max(attempts.LastFailure.Add(lockout).Sub(now), 0)
+}
+
+// pendingAttemptWait is roughly how long an attempt takes to be checked, for callers turned
+// away because the attempts already in flight could lock them out
+const pendingAttemptWait = time.Second
+
+// wait is how long an attempt against attempts has to wait. Pending attempts count as failures
+// until settled; once a lockout is over, one attempt at a time is let through.
+func (t *loginThrottle) wait(attempts LoginAttempts, threshold int, now time.Time) time.Duration {
+	if wait := t.remaining(attempts, threshold, now); wait > 0 {
+		return wait
+	}
+	if attempts.Failures+attempts.Pending >= max(threshold, attempts.Failures+1) {
+		return pendingAttemptWait
+	}
+	return 0
+}
+
+// throttleKey is a key to count attempts against, with the failures that lock it
+type throttleKey struct {
+	key       string
+	threshold int
+}
+
+func (t *loginThrottle) keys(email, ip string) []throttleKey {
+	return []throttleKey{{accountKey(email), t.cfg.MaxFailures}, {ipKey(ip), t.cfg.IPMaxFailures}}
+}
+
+// claim claims an attempt against every key, or against none of them if any is locked out
+func (t *loginThrottle) claim(ctx context.Context, keys []throttleKey) (time.Duration, error) {
+	now := t.now()
+	for i, k := range keys {
+		_, wait, err := t.store.Claim(ctx, k.key, now, t.cfg.MaxLockout, func(attempts LoginAttempts) time.Duration {
+			return t.wait(attempts, k.threshold, now)
+		})
+		if err == nil && wait == 0 {
+			continue
+		}
+		// Take back the attempt from the keys already claimed
+		if forgiveErr := t.forgive(ctx, keys[:i]); forgiveErr != nil {
+			log.Printf("Failed to take back login attempt: %v", forgiveErr)
+		}
+		if err != nil {
+			return 0, err
+		}
+		return wait, ErrLoginLocked
+	}
+	return 0, nil
+}
+
+func (t *loginThrottle) recordFailure(ctx context.Context, keys []throttleKey, ip string) error {
+	now := t.now()
+	for _, k := range keys {
+		attempts, err := t.store.RecordFailure(ctx, k.key, now)
+		if err != nil {
+			return err
+		}
+		if lockout := t.lockout(attempts.Failures, k.threshold); lockout > 0 && ip != "" {
+			log.Printf("AUDIT login lockout: %s locked for %s after %d failed attempts (ip %s)", k.key, lockout, attempts.Failures, ip)
+		} else if lockout > 0 {
+			log.Printf("AUDIT login lockout: %s locked for %s after %d failed attempts", k.key, lockout, attempts.Failures)
+		}
+	}
+	return nil
+}
+
+func (t *loginThrottle) forgive(ctx context.Context, keys []throttleKey) error {
+	for _, k := range keys {
+		if err := t.store.Forgive(ctx, k.key); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (t *loginThrottle) Attempt(ctx context.Context, email, ip string) (time.Duration, error) {
+	return t.claim(ctx, t.keys(email, ip))
+}
+
+func (t *loginThrottle) RecordFailure(ctx context.Context, email, ip string) error {
+	return t.recordFailure(ctx, t.keys(email, ip), ip)
+}
+
+// RecordSuccess clears the account's failures. The address only has the attempt settled, so
+// one valid account cannot be used to reset a password spraying run.
+func (t *loginThrottle) RecordSuccess(ctx context.Context, email, ip string) error {
+	if err := t.store.Reset(ctx, accountKey(email)); err != nil {
+		return err
+	}
+	return t.store.Forgive(ctx, ipKey(ip))
+}
+
+func (t *loginThrottle) Forgive(ctx context.Context, email, ip string) error {
+	return t.forgive(ctx, t.keys(email, ip))
+}
+
+// UserThrottle limits how often a signed-in user can get a two-factor code or their password
+// wrong, so a stolen access token is not enough to guess them. It works like LoginThrottle,
+// keyed by user ID, and shares its settings.
+type UserThrottle interface {
+	Attempt(ctx context.Context, userID string) (time.Duration, error)
+	RecordFailure(ctx context.Context, userID string) error
+	RecordSuccess(ctx context.Context, userID string) error
+	Forgive(ctx context.Context, userID string) error
+}
+
+type userThrottle struct {
+	logins *loginThrottle
+}
+
+func NewUserThrottle(store LoginAttemptStore, cfg LoginThrottleConfig) UserThrottle {
+	return &userThrottle{logins: &loginThrottle{store: store, cfg: cfg, now: time.Now}}
+}
+
+func (t *userThrottle) keys(userID string) []throttleKey {
+	return []throttleKey{{"user:" + userID, t.logins.cfg.MaxFailures}}
+}
+
+func (t *userThrottle) Attempt(ctx context.Context, userID string) (time.Duration, error) {
+	return t.logins.claim(ctx, t.keys(userID))
+}
+
+func (t *userThrottle) RecordFailure(ctx context.Context, userID string) error {
+	return t.logins.recordFailure(ctx, t.keys(userID), "")
+}
+
+func (t *userThrottle) RecordSuccess(ctx context.Context, userID string) error {
+	return t.logins.store.Reset(ctx, t.keys(userID)[0].key)
+}
+
+func (t *userThrottle) Forgive(ctx context.Context, userID string) error {
+	return t.logins.forgive(ctx, t.keys(userID))
+}
+
+// RequestThrottle limits how often one client address may take an action that costs something
+// even when it succeeds, such as mailing a password reset link. Every request counts, and past
+// the limit the address is locked out like a failing login.
+type RequestThrottle interface {
+	// Allow counts a request from ip, or returns ErrTooManyRequests and how long to wait
+	Allow(ctx context.Context, ip string) (time.Duration, error)
+}
+
+type requestThrottle struct {
+	limits *loginThrottle
+	action string
+	limit  int
+}
+
+// NewRequestThrottle lets each address take action limit times before the lockouts in cfg apply
+func NewRequestThrottle(store LoginAttemptStore, cfg LoginThrottleConfig, action string, limit int) RequestThrottle {
+	return &requestThrottle{limits: &loginThrottle{store: store, cfg: cfg, now: time.Now}, action: action, limit: limit}
+}
+
+func (t *requestThrottle) Allow(ctx context.Context, ip string) (time.Duration, error) {
+	key := throttleKey{t.action + ":" + ipKey(ip), t.limit}
+	wait, err := t.limits.claim(ctx, []throttleKey{key})
+	if errors.Is(err, ErrLoginLocked) {
+		return wait, ErrTooManyRequests
+	}
+	if err != nil {
+		return 0, err
+	}
+	_, err = t.limits.store.RecordFailure(ctx, key.key, t.limits.now())
+	return 0, err
+}
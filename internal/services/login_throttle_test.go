@@ -0,0 +1,182 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func newTestLoginThrottle() (*loginThrottle, *fakeClock) {
+	cfg := LoginThrottleConfig{MaxFailures: 3, IPMaxFailures: 5, Lockout: time.Minute, MaxLockout: 10 * time.Minute}
+	throttle := NewLoginThrottle(NewMemoryLoginAttemptStore(), cfg).(*loginThrottle)
+	clock := &fakeClock{now: time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)}
+	throttle.now = clock.Now
+	return throttle, clock
+}
+
+// fail makes a login attempt with a wrong password
+func fail(t *testing.T, throttle LoginThrottle, email, ip string) {
+	t.Helper()
+	ctx := context.Background()
+	if _, err := throttle.Attempt(ctx, email, ip); err != nil {
+		t.Fatalf("attempt for %s from %s: %v", email, ip, err)
+	}
+	throttle.RecordFailure(ctx, email, ip)
+}
+
+// probe reports whether a login would be let through without counting it
+func probe(throttle LoginThrottle, email, ip string) (time.Duration, error) {
+	ctx := context.Background()
+	wait, err := throttle.Attempt(ctx, email, ip)
+	if err == nil {
+		throttle.Forgive(ctx, email, ip)
+	}
+	return wait, err
+}
+
+func TestLoginThrottleBacksOffPerAccount(t *testing.T) {
+	ctx := context.Background()
+	throttle, clock := newTestLoginThrottle()
+
+	for i := 0; i < 2; i++ {
+		fail(t, throttle, "lifter@example.com", "10.0.0.1")
+	}
+	if _, err := probe(throttle, "lifter@example.com", "10.0.0.1"); err != nil {
+		t.Fatalf("locked below the threshold: %v", err)
+	}
+
+	fail(t, throttle, "Lifter@Example.com", "10.0.0.2")
+	wait, err := probe(throttle, "lifter@example.com", "10.0.0.3")
+	if !errors.Is(err, ErrLoginLocked) || wait != time.Minute {
+		t.Fatalf("after threshold: got %s, %v", wait, err)
+	}
+
+	// Each failure after the lockout doubles the next one
+	clock.Advance(time.Minute)
+	if _, err := probe(throttle, "lifter@example.com", "10.0.0.3"); err != nil {
+		t.Fatalf("lockout did not expire: %v", err)
+	}
+	fail(t, throttle, "lifter@example.com", "10.0.0.3")
+	if wait, _ := probe(throttle, "lifter@example.com", "10.0.0.3"); wait != 2*time.Minute {
+		t.Errorf("second lockout: got %s, want 2m", wait)
+	}
+	for i := 0; i < 4; i++ {
+		wait, _ := probe(throttle, "lifter@example.com", "10.0.0.3")
+		clock.Advance(wait)
+		fail(t, throttle, "lifter@example.com", fmt.Sprintf("10.0.1.%d", i))
+	}
+	if wait, _ := probe(throttle, "lifter@example.com", "10.0.0.5"); wait != 10*time.Minute {
+		t.Errorf("capped lockout: got %s, want 10m", wait)
+	}
+
+	// Other accounts are unaffected, and success clears the account
+	if _, err := probe(throttle, "other@example.com", "10.0.0.9"); err != nil {
+		t.Errorf("other account locked: %v", err)
+	}
+	clock.Advance(10 * time.Minute)
+	if _, err := throttle.Attempt(ctx, "lifter@example.com", "10.0.0.3"); err != nil {
+		t.Fatalf("lockout did not expire: %v", err)
+	}
+	throttle.RecordSuccess(ctx, "lifter@example.com", "10.0.0.3")
+	for i := 0; i < 2; i++ {
+		fail(t, throttle, "lifter@example.com", "10.0.0.4")
+	}
+	if _, err := probe(throttle, "lifter@example.com", "10.0.0.4"); err != nil {
+		t.Errorf("after success: %v", err)
+	}
+}
+
+func TestLoginThrottleLocksOutSprayingAddress(t *testing.T) {
+	throttle, clock := newTestLoginThrottle()
+
+	for _, email := range []string{"a@example.com", "b@example.com", "c@example.com", "d@example.com", "e@example.com"} {
+		fail(t, throttle, email, "10.0.0.1")
+	}
+	if _, err := probe(throttle, "f@example.com", "10.0.0.1"); !errors.Is(err, ErrLoginLocked) {
+		t.Errorf("spraying address: got %v", err)
+	}
+	// The refused attempts were not counted against the account
+	for i := 0; i < 5; i++ {
+		probe(throttle, "a@example.com", "10.0.0.1")
+	}
+	fail(t, throttle, "a@example.com", "10.0.0.2")
+	if _, err := probe(throttle, "a@example.com", "10.0.0.2"); err != nil {
+		t.Errorf("other address: %v", err)
+	}
+
+	// Failures are forgotten after a quiet period
+	clock.Advance(11 * time.Minute)
+	if _, err := probe(throttle, "f@example.com", "10.0.0.1"); err != nil {
+		t.Errorf("after quiet period: %v", err)
+	}
+}
+
+func TestLoginThrottleParallelAttempts(t *testing.T) {
+	ctx := context.Background()
+	throttle, _ := newTestLoginThrottle()
+
+	// Wrong passwords racing each other still only get MaxFailures guesses
+	const requests = 50
+	var allowed atomic.Int32
+	var wg sync.WaitGroup
+	for i := 0; i < requests; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if _, err := throttle.Attempt(ctx, "lifter@example.com", fmt.Sprintf("10.0.0.%d", i)); err == nil {
+				allowed.Add(1)
+				throttle.RecordFailure(ctx, "lifter@example.com", fmt.Sprintf("10.0.0.%d", i))
+			} else if !errors.Is(err, ErrLoginLocked) {
+				t.Errorf("unexpected error %v", err)
+			}
+		}()
+	}
+	wg.Wait()
+
+	if got := allowed.Load(); got != int32(throttle.cfg.MaxFailures) {
+		t.Errorf("%d attempts got through, want %d", got, throttle.cfg.MaxFailures)
+	}
+}
+
+func TestRequestThrottle(t *testing.T) {
+	ctx := context.Background()
+	cfg := LoginThrottleConfig{MaxFailures: 3, IPMaxFailures: 5, Lockout: time.Minute, MaxLockout: 10 * time.Minute}
+	throttle := NewRequestThrottle(NewMemoryLoginAttemptStore(), cfg, "password-reset", 2).(*requestThrottle)
+	clock := &fakeClock{now: time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)}
+	throttle.limits.now = clock.Now
+
+	for i := 0; i < 2; i++ {
+		if _, err := throttle.Allow(ctx, "10.0.0.1"); err != nil {
+			t.Fatalf("request %d: %v", i+1, err)
+		}
+	}
+	if wait, err := throttle.Allow(ctx, "10.0.0.1"); !errors.Is(err, ErrTooManyRequests) || wait != time.Minute {
+		t.Errorf("past the limit: got %s, %v", wait, err)
+	}
+	if _, err := throttle.Allow(ctx, "10.0.0.2"); err != nil {
+		t.Errorf("other address: %v", err)
+	}
+
+	clock.Advance(time.Minute)
+	if _, err := throttle.Allow(ctx, "10.0.0.1"); err != nil {
+		t.Errorf("after the lockout: %v", err)
+	}
+}
+
+func TestLoginThrottleConfigFromEnv(t *testing.T) {
+	t.Setenv("LOGIN_MAX_FAILURES", "10")
+	t.Setenv("LOGIN_LOCKOUT", "30s")
+	cfg, err := LoginThrottleConfigFromEnv()
+	if err != nil || cfg.MaxFailures != 10 || cfg.Lockout != 30*time.Second || cfg.IPMaxFailures != DefaultLoginIPMaxFailures {
+		t.Errorf("got %+v, %v", cfg, err)
+	}
+
+	t.Setenv("LOGIN_MAX_FAILURES", "0")
+	if _, err := LoginThrottleConfigFromEnv(); err == nil {
+		t.Error("expected zero failures to be rejected")
+	}
+}
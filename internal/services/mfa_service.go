@@ -0,0 +1,395 @@
+package services
+
+import (
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"yoked_backend/internal/db/repositories"
+	"yoked_backend/internal/models"
+)
+
+const (
+	// MFAIssuer names the account in authenticator apps
+	MFAIssuer = "Yoked"
+	// MFAChallengeTTL is how long the second login step stays open after a correct password
+	MFAChallengeTTL = 5 * time.Minute
+	// MFAChallengeAttempts is how many wrong codes a challenge absorbs before it is dead
+	MFAChallengeAttempts = 5
+	// RecoveryCodeCount is how many recovery codes are issued at a time
+	RecoveryCodeCount = 10
+)
+
+var (
+	// ErrInvalidMFACode is returned for a wrong, replayed or already spent code
+	ErrInvalidMFACode = errors.New("invalid two-factor code")
+	// ErrInvalidMFAChallenge covers unknown, expired, used and exhausted login challenges
+	ErrInvalidMFAChallenge = errors.New("invalid or expired two-factor challenge, please log in again")
+	// ErrMFAAlreadyEnabled is returned when enrolling an account that already has 2FA
+	ErrMFAAlreadyEnabled = errors.New("two-factor authentication is already enabled")
+)
+
+// MFAEnrollment is what the client needs to add the account to an authenticator app
+type MFAEnrollment struct {
+	Secret          string `json:"secret"`           // base32, for manual entry
+	ProvisioningURI string `json:"provisioning_uri"` // otpauth:// URI, rendered as a QR code
+}
+
+// IssuedMFAChallenge is the opaque token returned instead of a session when 2FA is on
+type IssuedMFAChallenge struct {
+	Token     string    `json:"mfa_token"`
+	ExpiresAt time.Time `json:"mfa_token_expires_at"`
+}
+
+type MFAService interface {
+	BeginEnrollment(ctx context.Context, user *models.User) (*MFAEnrollment, error)
+	ConfirmEnrollment(ctx context.Context, userID, code string) ([]string, error)
+	Disable(ctx context.Context, userID, code string) error
+	RegenerateRecoveryCodes(ctx context.Context, userID, code string) ([]string, error)
+	IsEnabled(ctx context.Context, userID string) (bool, error)
+	// VerifyCode confirms a sensitive action with a current code or a recovery code, which is
+	// then spent
+	VerifyCode(ctx context.Context, userID, code string) error
+	IssueChallenge(ctx context.Context, userID string) (*IssuedMFAChallenge, error)
+	// ChallengeUser returns the user a live challenge was issued to, so a login can be
+	// throttled before its code is checked
+	ChallengeUser(ctx context.Context, challengeToken string) (string, error)
+	VerifyChallenge(ctx context.Context, challengeToken, code string) (string, error)
+}
+
+type mfaService struct {
+	mfaRepo   repositories.MFARepository
+	txManager repositories.TxManager
+	throttle  UserThrottle
+	aead      cipher.AEAD
+	now       func() time.Time
+}
+
+// NewMFAService encrypts TOTP secrets with a key derived from secret. Wrong codes count towards
+// the user's lockout in throttle.
+func NewMFAService(mfaRepo repositories.MFARepository, txManager repositories.TxManager, throttle UserThrottle, secret []byte) (MFAService, error) {
+	// Domain separated from the signing key encryption, which derives from the same secret
+	digest := sha256.Sum256(append([]byte("mfa-secrets:"), secret...))
+	block, err := aes.NewCipher(digest[:])
+	if err != nil {
+		return nil, fmt.Errorf("failed to initialise mfa encryption: %w", err)
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, fmt.Errorf("failed to initialise mfa encryption: %w", err)
+	}
+	return &mfaService{mfaRepo: mfaRepo, txManager: txManager, throttle: throttle, aead: aead, now: time.Now}, nil
+}
+
+// seal encrypts a TOTP secret, binding it to the user so rows cannot be swapped
+func (s *mfaService) seal(userID string, secret []byte) ([]byte, error) {
+	nonce := make([]byte, s.aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, fmt.Errorf("failed to encrypt totp secret: %w", err)
+	}
+	return s.aead.Seal(nonce, nonce, secret, []byte(userID)), nil
+}
+
+func (s *mfaService) open(stored *models.MFASecret) ([]byte, error) {
+	nonceSize := s.aead.NonceSize()
+	if len(stored.Secret) < nonceSize {
+		return nil, fmt.Errorf("totp secret for user %s is corrupt", stored.UserID)
+	}
+	secret, err := s.aead.Open(nil, stored.Secret[:nonceSize], stored.Secret[nonceSize:], []byte(stored.UserID))
+	if err != nil {
+		return nil, fmt.Errorf("failed to decrypt totp secret, has JWT_SECRET changed? %w", err)
+	}
+	return secret, nil
+}
+
+// enabledSecret loads the user's secret, treating a pending enrollment as no 2FA at all
+func (s *mfaService) enabledSecret(ctx context.Context, userID string) (*models.MFASecret, error) {
+	stored, err := s.mfaRepo.GetMFASecret(ctx, userID)
+	if errors.Is(err, repositories.ErrNotFound) || (err == nil && stored.EnabledAt == nil) {
+		return nil, invalidInput("two-factor authentication is not enabled")
+	}
+	return stored, err
+}
+
+// BeginEnrollment generates a new secret for the user to add to their authenticator. 2FA is not
+// on until ConfirmEnrollment sees a code from it; beginning again replaces the pending secret.
+func (s *mfaService) BeginEnrollment(ctx context.Context, user *models.User) (*MFAEnrollment, error) {
+	secret, err := newTOTPSecret()
+	if err != nil {
+		return nil, err
+	}
+	sealed, err := s.seal(user.ID, secret)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := s.mfaRepo.SavePendingMFASecret(ctx, user.ID, sealed); err != nil {
+		if errors.Is(err, repositories.ErrConflict) {
+			return nil, ErrMFAAlreadyEnabled
+		}
+		return nil, err
+	}
+
+	return &MFAEnrollment{
+		Secret:          totpEncoding.EncodeToString(secret),
+		ProvisioningURI: totpProvisioningURI(MFAIssuer, user.Email, secret),
+	}, nil
+}
+
+// ConfirmEnrollment turns 2FA on once the user proves their authenticator works, returning
+// the recovery codes. They are only ever shown here.
+func (s *mfaService) ConfirmEnrollment(ctx context.Context, userID, code string) ([]string, error) {
+	stored, err := s.mfaRepo.GetMFASecret(ctx, userID)
+	if errors.Is(err, repositories.ErrNotFound) {
+		return nil, invalidInput("no two-factor enrollment in progress")
+	}
+	if err != nil {
+		return nil, err
+	}
+	if stored.EnabledAt != nil {
+		return nil, ErrMFAAlreadyEnabled
+	}
+
+	secret, err := s.open(stored)
+	if err != nil {
+		return nil, err
+	}
+	step, ok := matchTOTP(secret, code, s.now())
+	if !ok {
+		return nil, ErrInvalidMFACode
+	}
+
+	codes, hashes, err := newRecoveryCodes()
+	if err != nil {
+		return nil, err
+	}
+	err = s.txManager.WithinTx(ctx, func(ctx context.Context) error {
+		if err := s.mfaRepo.EnableMFA(ctx, userID, step); err != nil {
+			return err
+		}
+		return s.mfaRepo.ReplaceRecoveryCodes(ctx, userID, hashes)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return codes, nil
+}
+
+// Disable turns 2FA off. It needs a current code or a recovery code, not just a session.
+func (s *mfaService) Disable(ctx context.Context, userID, code string) error {
+	if err := s.checkCode(ctx, userID, code); err != nil {
+		return err
+	}
+	return s.txManager.WithinTx(ctx, func(ctx context.Context) error {
+		return s.mfaRepo.DeleteMFA(ctx, userID)
+	})
+}
+
+// RegenerateRecoveryCodes replaces every recovery code, used or not
+func (s *mfaService) RegenerateRecoveryCodes(ctx context.Context, userID, code string) ([]string, error) {
+	if err := s.checkCode(ctx, userID, code); err != nil {
+		return nil, err
+	}
+
+	codes, hashes, err := newRecoveryCodes()
+	if err != nil {
+		return nil, err
+	}
+	err = s.txManager.WithinTx(ctx, func(ctx context.Context) error {
+		return s.mfaRepo.ReplaceRecoveryCodes(ctx, userID, hashes)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return codes, nil
+}
+
+// IsEnabled reports whether logins for the user need a second step
+func (s *mfaService) IsEnabled(ctx context.Context, userID string) (bool, error) {
+	stored, err := s.mfaRepo.GetMFASecret(ctx, userID)
+	if errors.Is(err, repositories.ErrNotFound) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	return stored.EnabledAt != nil, nil
+}
+
+func (s *mfaService) VerifyCode(ctx context.Context, userID, code string) error {
+	return s.checkCode(ctx, userID, code)
+}
+
+// checkCode accepts a TOTP code from the authenticator or, failing that, spends a recovery code.
+// Every caller goes through the user's throttle, so codes cannot be guessed through any of them.
+func (s *mfaService) checkCode(ctx context.Context, userID, code string) error {
+	stored, err := s.enabledSecret(ctx, userID)
+	if err != nil {
+		return err
+	}
+	if _, err := s.throttle.Attempt(ctx, userID); err != nil {
+		return err
+	}
+
+	err = s.matchCode(ctx, stored, code)
+	var settleErr error
+	switch {
+	case err == nil:
+		settleErr = s.throttle.RecordSuccess(ctx, userID)
+	case errors.Is(err, ErrInvalidMFACode):
+		settleErr = s.throttle.RecordFailure(ctx, userID)
+	default:
+		settleErr = s.throttle.Forgive(ctx, userID)
+	}
+	if settleErr != nil {
+		log.Printf("Failed to record two-factor attempt for user %s: %v", userID, settleErr)
+	}
+	return err
+}
+
+// matchCode checks code against the user's secret and unspent recovery codes
+func (s *mfaService) matchCode(ctx context.Context, stored *models.MFASecret, code string) error {
+	userID := stored.UserID
+	code = strings.TrimSpace(code)
+	if len(code) == totpDigits {
+		secret, err := s.open(stored)
+		if err != nil {
+			return err
+		}
+		step, ok := matchTOTP(secret, code, s.now())
+		if !ok {
+			return ErrInvalidMFACode
+		}
+		fresh, err := s.mfaRepo.UseMFAStep(ctx, userID, step)
+		if err != nil {
+			return err
+		}
+		if !fresh {
+			return ErrInvalidMFACode
+		}
+		return nil
+	}
+
+	spent, err := s.mfaRepo.UseRecoveryCode(ctx, userID, hashRecoveryCode(code))
+	if err != nil {
+		return err
+	}
+	if !spent {
+		return ErrInvalidMFACode
+	}
+	return nil
+}
+
+// IssueChallenge starts the second login step for a user whose password was correct
+func (s *mfaService) IssueChallenge(ctx context.Context, userID string) (*IssuedMFAChallenge, error) {
+	raw, err := newOpaqueToken()
+	if err != nil {
+		return nil, err
+	}
+
+	challenge := &models.MFAChallenge{
+		UserID:    userID,
+		TokenHash: hashRefreshToken(raw),
+		ExpiresAt: s.now().Add(MFAChallengeTTL),
+	}
+	if err := s.mfaRepo.CreateMFAChallenge(ctx, challenge); err != nil {
+		return nil, err
+	}
+
+	return &IssuedMFAChallenge{Token: raw, ExpiresAt: challenge.ExpiresAt}, nil
+}
+
+func (s *mfaService) ChallengeUser(ctx context.Context, challengeToken string) (string, error) {
+	challenge, err := s.liveChallenge(ctx, challengeToken)
+	if err != nil {
+		return "", err
+	}
+	return challenge.UserID, nil
+}
+
+// liveChallenge looks up a challenge that can still be redeemed
+func (s *mfaService) liveChallenge(ctx context.Context, challengeToken string) (*models.MFAChallenge, error) {
+	if challengeToken == "" {
+		return nil, ErrInvalidMFAChallenge
+	}
+	challenge, err := s.mfaRepo.GetMFAChallengeByHash(ctx, hashRefreshToken(challengeToken))
+	if errors.Is(err, repositories.ErrNotFound) {
+		return nil, ErrInvalidMFAChallenge
+	}
+	if err != nil {
+		return nil, err
+	}
+	if challenge.UsedAt != nil || challenge.Attempts >= MFAChallengeAttempts || !s.now().Before(challenge.ExpiresAt) {
+		return nil, ErrInvalidMFAChallenge
+	}
+	return challenge, nil
+}
+
+// VerifyChallenge redeems a challenge with a code and returns the user to start a session for.
+// Every attempt is counted against the challenge before the code is checked, so it cannot be
+// used to brute force the code, not even with parallel requests.
+func (s *mfaService) VerifyChallenge(ctx context.Context, challengeToken, code string) (string, error) {
+	challenge, err := s.liveChallenge(ctx, challengeToken)
+	if err != nil {
+		return "", err
+	}
+
+	claimed, err := s.mfaRepo.ClaimMFAChallengeAttempt(ctx, challenge.ID, MFAChallengeAttempts, s.now())
+	if err != nil {
+		return "", err
+	}
+	if !claimed {
+		return "", ErrInvalidMFAChallenge
+	}
+
+	if err := s.checkCode(ctx, challenge.UserID, code); err != nil {
+		return "", err
+	}
+
+	if err := s.mfaRepo.ConsumeMFAChallenge(ctx, challenge.ID); err != nil {
+		if errors.Is(err, repositories.ErrNotFound) {
+			return "", ErrInvalidMFAChallenge
+		}
+		return "", err
+	}
+	return challenge.UserID, nil
+}
+
+// recoveryCodeAlphabet leaves out characters that are easy to misread. It has 32 characters,
+// so each random byte maps onto it without bias.
+const recoveryCodeAlphabet = "abcdefghjkmnpqrstuvwxyz023456789"
+
+// newRecoveryCodes returns codes formatted for display alongside the hashes to store
+func newRecoveryCodes() ([]string, []string, error) {
+	codes := make([]string, RecoveryCodeCount)
+	hashes := make([]string, RecoveryCodeCount)
+	buf := make([]byte, 16)
+	for i := range codes {
+		if _, err := rand.Read(buf); err != nil {
+			return nil, nil, fmt.Errorf("failed to generate recovery code: %w", err)
+		}
+		var b strings.Builder
+		for j, c := range buf {
+			if j > 0 && j%4 == 0 {
+				b.WriteByte('-')
+			}
+			b.WriteByte(recoveryCodeAlphabet[c%32])
+		}
+		codes[i] = b.String()
+		hashes[i] = hashRecoveryCode(codes[i])
+	}
+	return codes, hashes, nil
+}
+
+// hashRecoveryCode ignores case, spaces and dashes so codes can be typed loosely
+func hashRecoveryCode(code string) string {
+	normalized := strings.NewReplacer("-", "", " ", "").Replace(strings.ToLower(code))
+	return hashRefreshToken(normalized)
+}
@@ -0,0 +1,370 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"yoked_backend/internal/db/repositories"
+	"yoked_backend/internal/models"
+)
+
+// fakeMFARepo keeps secrets, recovery codes and challenges in memory. It is safe for
+// concurrent use, like the database it stands in for.
+type fakeMFARepo struct {
+	mu         sync.Mutex
+	secrets    map[string]*models.MFASecret
+	recovery   map[string]map[string]bool // user -> code hash -> used
+	challenges map[string]*models.MFAChallenge
+}
+
+func newFakeMFARepo() *fakeMFARepo {
+	return &fakeMFARepo{
+		secrets:    make(map[string]*models.MFASecret),
+		recovery:   make(map[string]map[string]bool),
+		challenges: make(map[string]*models.MFAChallenge),
+	}
+}
+
+func (f *fakeMFARepo) SavePendingMFASecret(ctx context.Context, userID string, secret []byte) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if existing, ok := f.secrets[userID]; ok && existing.EnabledAt != nil {
+		return repositories.ErrConflict
+	}
+	f.secrets[userID] = &models.MFASecret{UserID: userID, Secret: secret}
+	return nil
+}
+
+func (f *fakeMFARepo) GetMFASecret(ctx context.Context, userID string) (*models.MFASecret, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	secret, ok := f.secrets[userID]
+	if !ok {
+		return nil, repositories.ErrNotFound
+	}
+	copied := *secret
+	return &copied, nil
+}
+
+func (f *fakeMFARepo) EnableMFA(ctx context.Context, userID string, step int64) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	secret, ok := f.secrets[userID]
+	if !ok || secret.EnabledAt != nil {
+		return repositories.ErrNotFound
+	}
+	now := time.Now()
+	secret.EnabledAt, secret.LastUsedStep = &now, step
+	return nil
+}
+
+func (f *fakeMFARepo) UseMFAStep(ctx context.Context, userID string, step int64) (bool, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	secret := f.secrets[userID]
+	if secret.LastUsedStep >= step {
+		return false, nil
+	}
+	secret.LastUsedStep = step
+	return true, nil
+}
+
+func (f *fakeMFARepo) DeleteMFA(ctx context.Context, userID string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	delete(f.secrets, userID)
+	delete(f.recovery, userID)
+	return nil
+}
+
+func (f *fakeMFARepo) ReplaceRecoveryCodes(ctx context.Context, userID string, codeHashes []string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.recovery[userID] = make(map[string]bool)
+	for _, hash := range codeHashes {
+		f.recovery[userID][hash] = false
+	}
+	return nil
+}
+
+func (f *fakeMFARepo) UseRecoveryCode(ctx context.Context, userID, codeHash string) (bool, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	used, ok := f.recovery[userID][codeHash]
+	if !ok || used {
+		return false, nil
+	}
+	f.recovery[userID][codeHash] = true
+	return true, nil
+}
+
+func (f *fakeMFARepo) CreateMFAChallenge(ctx context.Context, challenge *models.MFAChallenge) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	challenge.ID = fmt.Sprintf("challenge-%d", len(f.challenges)+1)
+	stored := *challenge
+	f.challenges[challenge.TokenHash] = &stored
+	return nil
+}
+
+func (f *fakeMFARepo) GetMFAChallengeByHash(ctx context.Context, tokenHash string) (*models.MFAChallenge, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	challenge, ok := f.challenges[tokenHash]
+	if !ok {
+		return nil, repositories.ErrNotFound
+	}
+	copied := *challenge
+	return &copied, nil
+}
+
+func (f *fakeMFARepo) byID(id string) *models.MFAChallenge {
+	for _, challenge := range f.challenges {
+		if challenge.ID == id {
+			return challenge
+		}
+	}
+	return nil
+}
+
+func (f *fakeMFARepo) ClaimMFAChallengeAttempt(ctx context.Context, id string, maxAttempts int, now time.Time) (bool, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	challenge := f.byID(id)
+	if challenge.UsedAt != nil || challenge.Attempts >= maxAttempts || !now.Before(challenge.ExpiresAt) {
+		return false, nil
+	}
+	challenge.Attempts++
+	return true, nil
+}
+
+func (f *fakeMFARepo) ConsumeMFAChallenge(ctx context.Context, id string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	challenge := f.byID(id)
+	if challenge.UsedAt != nil {
+		return repositories.ErrNotFound
+	}
+	now := time.Now()
+	challenge.UsedAt = &now
+	return nil
+}
+
+// fakeClock is a settable clock for the service's now
+type fakeClock struct {
+	now time.Time
+}
+
+func (c *fakeClock) Now() time.Time          { return c.now }
+func (c *fakeClock) Advance(d time.Duration) { c.now = c.now.Add(d) }
+
+func newTestUserThrottle() UserThrottle {
+	return NewUserThrottle(NewMemoryLoginAttemptStore(), LoginThrottleConfig{
+		MaxFailures: DefaultLoginMaxFailures, IPMaxFailures: DefaultLoginIPMaxFailures, Lockout: time.Minute, MaxLockout: time.Hour,
+	})
+}
+
+// enrolledMFAService returns a service with 2FA enabled for u1, the TOTP secret and recovery codes
+func enrolledMFAService(t *testing.T) (*mfaService, *fakeClock, []byte, []string) {
+	t.Helper()
+	ctx := context.Background()
+	svc, err := NewMFAService(newFakeMFARepo(), passthroughTx{}, newTestUserThrottle(), []byte("secret"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	mfa := svc.(*mfaService)
+	clock := &fakeClock{now: time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)}
+	mfa.now = clock.Now
+	mfa.throttle.(*userThrottle).logins.now = clock.Now
+
+	enrollment, err := mfa.BeginEnrollment(ctx, &models.User{ID: "u1", Email: "lifter@example.com"})
+	if err != nil {
+		t.Fatalf("enroll: %v", err)
+	}
+	secret, err := totpEncoding.DecodeString(enrollment.Secret)
+	if err != nil {
+		t.Fatal(err)
+	}
+	codes, err := mfa.ConfirmEnrollment(ctx, "u1", totpCode(secret, totpStep(clock.now)))
+	if err != nil {
+		t.Fatalf("confirm: %v", err)
+	}
+	if len(codes) != RecoveryCodeCount {
+		t.Fatalf("got %d recovery codes", len(codes))
+	}
+	return mfa, clock, secret, codes
+}
+
+func TestMFAEnrollment(t *testing.T) {
+	ctx := context.Background()
+	svc, _ := NewMFAService(newFakeMFARepo(), passthroughTx{}, newTestUserThrottle(), []byte("secret"))
+	user := &models.User{ID: "u1", Email: "lifter@example.com"}
+
+	enrollment, err := svc.BeginEnrollment(ctx, user)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if enabled, _ := svc.IsEnabled(ctx, "u1"); enabled {
+		t.Fatal("enabled before confirmation")
+	}
+	if _, err := svc.ConfirmEnrollment(ctx, "u1", "000000"); !errors.Is(err, ErrInvalidMFACode) {
+		t.Errorf("wrong code: got %v", err)
+	}
+
+	secret, _ := totpEncoding.DecodeString(enrollment.Secret)
+	if _, err := svc.ConfirmEnrollment(ctx, "u1", totpCode(secret, totpStep(time.Now()))); err != nil {
+		t.Fatalf("confirm: %v", err)
+	}
+	if enabled, _ := svc.IsEnabled(ctx, "u1"); !enabled {
+		t.Fatal("not enabled after confirmation")
+	}
+	if _, err := svc.BeginEnrollment(ctx, user); !errors.Is(err, ErrMFAAlreadyEnabled) {
+		t.Errorf("re-enroll: got %v", err)
+	}
+}
+
+func TestMFAChallenge(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("totp code", func(t *testing.T) {
+		mfa, clock, secret, _ := enrolledMFAService(t)
+		clock.Advance(time.Minute)
+		challenge, _ := mfa.IssueChallenge(ctx, "u1")
+		userID, err := mfa.VerifyChallenge(ctx, challenge.Token, totpCode(secret, totpStep(clock.now)))
+		if err != nil || userID != "u1" {
+			t.Fatalf("got %q, %v", userID, err)
+		}
+		if _, err := mfa.VerifyChallenge(ctx, challenge.Token, totpCode(secret, totpStep(clock.now))); !errors.Is(err, ErrInvalidMFAChallenge) {
+			t.Errorf("challenge reused: got %v", err)
+		}
+	})
+
+	t.Run("replayed code", func(t *testing.T) {
+		mfa, clock, secret, _ := enrolledMFAService(t)
+		// The confirming code's step is spent, so the same code cannot log in
+		challenge, _ := mfa.IssueChallenge(ctx, "u1")
+		if _, err := mfa.VerifyChallenge(ctx, challenge.Token, totpCode(secret, totpStep(clock.now))); !errors.Is(err, ErrInvalidMFACode) {
+			t.Errorf("got %v", err)
+		}
+	})
+
+	t.Run("recovery codes are single use", func(t *testing.T) {
+		mfa, _, _, codes := enrolledMFAService(t)
+		challenge, _ := mfa.IssueChallenge(ctx, "u1")
+		if _, err := mfa.VerifyChallenge(ctx, challenge.Token, " "+codes[0]+" "); err != nil {
+			t.Fatalf("recovery code: %v", err)
+		}
+		challenge, _ = mfa.IssueChallenge(ctx, "u1")
+		if _, err := mfa.VerifyChallenge(ctx, challenge.Token, codes[0]); !errors.Is(err, ErrInvalidMFACode) {
+			t.Errorf("spent recovery code: got %v", err)
+		}
+	})
+
+	t.Run("expired challenge", func(t *testing.T) {
+		mfa, clock, secret, _ := enrolledMFAService(t)
+		challenge, _ := mfa.IssueChallenge(ctx, "u1")
+		clock.Advance(MFAChallengeTTL + time.Second)
+		if _, err := mfa.VerifyChallenge(ctx, challenge.Token, totpCode(secret, totpStep(clock.now))); !errors.Is(err, ErrInvalidMFAChallenge) {
+			t.Errorf("got %v", err)
+		}
+	})
+
+	t.Run("too many wrong codes", func(t *testing.T) {
+		mfa, clock, secret, _ := enrolledMFAService(t)
+		clock.Advance(time.Minute)
+		challenge, _ := mfa.IssueChallenge(ctx, "u1")
+		for i := 0; i < MFAChallengeAttempts; i++ {
+			mfa.VerifyChallenge(ctx, challenge.Token, "not-a-code")
+		}
+		if _, err := mfa.VerifyChallenge(ctx, challenge.Token, totpCode(secret, totpStep(clock.now))); !errors.Is(err, ErrInvalidMFAChallenge) {
+			t.Errorf("got %v", err)
+		}
+	})
+
+	t.Run("parallel wrong codes", func(t *testing.T) {
+		mfa, clock, secret, _ := enrolledMFAService(t)
+		clock.Advance(time.Minute)
+		challenge, _ := mfa.IssueChallenge(ctx, "u1")
+
+		// Requests racing on one challenge still only get MFAChallengeAttempts guesses
+		const requests = 20
+		results := make(chan error, requests)
+		var wg sync.WaitGroup
+		for i := 0; i < requests; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				_, err := mfa.VerifyChallenge(ctx, challenge.Token, "not-a-code")
+				results <- err
+			}()
+		}
+		wg.Wait()
+		close(results)
+
+		checked := 0
+		for err := range results {
+			if errors.Is(err, ErrInvalidMFACode) {
+				checked++
+			} else if !errors.Is(err, ErrInvalidMFAChallenge) {
+				t.Fatalf("unexpected error %v", err)
+			}
+		}
+		if checked != MFAChallengeAttempts {
+			t.Errorf("%d codes were checked, want %d", checked, MFAChallengeAttempts)
+		}
+		if _, err := mfa.VerifyChallenge(ctx, challenge.Token, totpCode(secret, totpStep(clock.now))); !errors.Is(err, ErrInvalidMFAChallenge) {
+			t.Errorf("right code after the attempts ran out: got %v", err)
+		}
+	})
+}
+
+func TestMFADisable(t *testing.T) {
+	ctx := context.Background()
+	mfa, clock, secret, _ := enrolledMFAService(t)
+
+	if err := mfa.Disable(ctx, "u1", "000000"); !errors.Is(err, ErrInvalidMFACode) {
+		t.Errorf("wrong code: got %v", err)
+	}
+	clock.Advance(totpPeriod)
+	if err := mfa.Disable(ctx, "u1", totpCode(secret, totpStep(clock.now))); err != nil {
+		t.Fatalf("disable: %v", err)
+	}
+	if enabled, _ := mfa.IsEnabled(ctx, "u1"); enabled {
+		t.Error("still enabled")
+	}
+}
+
+func TestMFACodeGuessingLocksTheUser(t *testing.T) {
+	ctx := context.Background()
+	mfa, clock, secret, codes := enrolledMFAService(t)
+	clock.Advance(totpPeriod)
+
+	for i := 0; i < DefaultLoginMaxFailures; i++ {
+		if err := mfa.Disable(ctx, "u1", fmt.Sprintf("%06d", i)); !errors.Is(err, ErrInvalidMFACode) {
+			t.Fatalf("wrong code %d: got %v", i+1, err)
+		}
+	}
+
+	// Once locked out, not even the right code is checked, whichever action asks for it
+	if err := mfa.Disable(ctx, "u1", totpCode(secret, totpStep(clock.now))); !errors.Is(err, ErrLoginLocked) {
+		t.Errorf("right code while locked: got %v", err)
+	}
+	if _, err := mfa.RegenerateRecoveryCodes(ctx, "u1", codes[0]); !errors.Is(err, ErrLoginLocked) {
+		t.Errorf("recovery code while locked: got %v", err)
+	}
+	if err := mfa.VerifyCode(ctx, "u1", codes[1]); !errors.Is(err, ErrLoginLocked) {
+		t.Errorf("verify while locked: got %v", err)
+	}
+	if enabled, _ := mfa.IsEnabled(ctx, "u1"); !enabled {
+		t.Fatal("2FA was turned off during the lockout")
+	}
+
+	clock.Advance(time.Minute)
+	if _, err := mfa.RegenerateRecoveryCodes(ctx, "u1", codes[0]); err != nil {
+		t.Errorf("after the lockout: %v", err)
+	}
+}
@@ -0,0 +1,68 @@
+package services
+
+import (
+	"fmt"
+	"os"
+)
+
+// Estimated one-rep-max formulas
+const (
+	FormulaEpley       = "epley"
+	FormulaBrzycki     = "brzycki"
+	FormulaRIRAdjusted = "rir_adjusted"
+
+	DefaultOneRepMaxFormula = FormulaEpley
+)
+
+// maxEstimableReps caps the rep count fed into a formula; estimates past this are noise
+const maxEstimableReps = 20
+
+// EstimateOneRepMax estimates a one-rep max from a set using the named formula.
+// The RIR-adjusted formula counts reps left in reserve as if they had been performed.
+func EstimateOneRepMax(formula string, weight float64, reps int, rir *int) (float64, error) {
+	if reps <= 0 || weight <= 0 {
+		return 0, nil
+	}
+
+	switch formula {
+	case FormulaEpley:
+		return epley(weight, reps), nil
+	case FormulaBrzycki:
+		if reps == 1 {
+			return weight, nil
+		}
+		if reps > maxEstimableReps {
+			reps = maxEstimableReps
+		}
+		return weight * 36 / float64(37-reps), nil
+	case FormulaRIRAdjusted:
+		if rir != nil && *rir > 0 {
+			reps += *rir
+		}
+		return epley(weight, reps), nil
+	default:
+		return 0, fmt.Errorf("unknown one-rep max formula %q", formula)
+	}
+}
+
+func epley(weight float64, reps int) float64 {
+	if reps == 1 {
+		return weight
+	}
+	if reps > maxEstimableReps {
+		reps = maxEstimableReps
+	}
+	return weight * (1 + float64(reps)/30)
+}
+
+// OneRepMaxFormulaFromEnv returns the formula configured in E1RM_FORMULA, or the default
+func OneRepMaxFormulaFromEnv() (string, error) {
+	formula := os.Getenv("E1RM_FORMULA")
+	if formula == "" {
+		return DefaultOneRepMaxFormula, nil
+	}
+	if _, err := EstimateOneRepMax(formula, 1, 1, nil); err != nil {
+		return "", err
+	}
+	return formula, nil
+}
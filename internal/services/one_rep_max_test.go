@@ -0,0 +1,46 @@
+package services
+
+import (
+	"math"
+	"testing"
+)
+
+func TestEstimateOneRepMax(t *testing.T) {
+	tests := []struct {
+		name    string
+		formula string
+		weight  float64
+		reps    int
+		rir     *int
+		want    float64
+		wantErr bool
+	}{
+		{name: "epley single is the lift itself", formula: FormulaEpley, weight: 100, reps: 1, want: 100},
+		{name: "epley five reps", formula: FormulaEpley, weight: 100, reps: 5, want: 116.67},
+		{name: "epley caps high reps", formula: FormulaEpley, weight: 50, reps: 40, want: 83.33},
+		{name: "brzycki single is the lift itself", formula: FormulaBrzycki, weight: 100, reps: 1, want: 100},
+		{name: "brzycki five reps", formula: FormulaBrzycki, weight: 100, reps: 5, want: 112.5},
+		{name: "rir adjusted adds reps in reserve", formula: FormulaRIRAdjusted, weight: 100, reps: 5, rir: intPtr(2), want: 123.33},
+		{name: "rir adjusted without rir matches epley", formula: FormulaRIRAdjusted, weight: 100, reps: 5, want: 116.67},
+		{name: "zero reps estimates nothing", formula: FormulaEpley, weight: 100, reps: 0, want: 0},
+		{name: "unknown formula errors", formula: "lombardi", weight: 100, reps: 5, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := EstimateOneRepMax(tt.formula, tt.weight, tt.reps, tt.rir)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatal("expected an error")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if math.Abs(got-tt.want) > 0.01 {
+				t.Errorf("got %.2f, want %.2f", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,155 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"yoked_backend/internal/db/repositories"
+	"yoked_backend/internal/mail"
+	"yoked_backend/internal/models"
+)
+
+const (
+	// PasswordResetTTL is how long a reset link stays usable
+	PasswordResetTTL = time.Hour
+	// PasswordResetInterval is the minimum gap between reset emails to one account
+	PasswordResetInterval = 5 * time.Minute
+	// PasswordResetIPMaxRequests is how many resets one client address may ask for before it is
+	// locked out like a failing login
+	PasswordResetIPMaxRequests = 10
+)
+
+// devPasswordResetURL is the reset page used when PASSWORD_RESET_URL is unset in development
+const devPasswordResetURL = "http://localhost:3000/reset-password"
+
+var (
+	// ErrInvalidResetToken covers unknown, expired and already used reset tokens
+	ErrInvalidResetToken = errors.New("invalid or expired password reset token")
+	// ErrPasswordResetThrottled means a reset email went to the account too recently to send another
+	ErrPasswordResetThrottled = errors.New("a password reset email was sent recently")
+)
+
+// PasswordResetURLFromEnv returns PASSWORD_RESET_URL, the page that receives the token as
+// ?token=. It is required unless APP_ENV=development.
+func PasswordResetURLFromEnv() (string, error) {
+	return linkURLFromEnv("PASSWORD_RESET_URL", devPasswordResetURL)
+}
+
+type PasswordResetService interface {
+	RequestPasswordReset(ctx context.Context, email string) error
+	ResetPassword(ctx context.Context, token, passwordHash string) error
+}
+
+type passwordResetService struct {
+	userRepo      repositories.UserRepository
+	tokenRepo     repositories.TokenRepository
+	txManager     repositories.TxManager
+	tokenVersions TokenVersionStore
+	mailer        mail.Mailer
+	resetURL      string
+	now           func() time.Time
+}
+
+func NewPasswordResetService(userRepo repositories.UserRepository, tokenRepo repositories.TokenRepository, txManager repositories.TxManager, tokenVersions TokenVersionStore, mailer mail.Mailer, resetURL string) PasswordResetService {
+	return &passwordResetService{
+		userRepo:      userRepo,
+		tokenRepo:     tokenRepo,
+		txManager:     txManager,
+		tokenVersions: tokenVersions,
+		mailer:        mailer,
+		resetURL:      resetURL,
+		now:           time.Now,
+	}
+}
+
+// RequestPasswordReset mails a reset link to the account with this email. An unknown email
+// is not an error, so callers cannot tell whether an account exists. Requesting a new link
+// invalidates any earlier ones, at most once every PasswordResetInterval; until then it returns
+// ErrPasswordResetThrottled and the earlier link keeps working.
+func (s *passwordResetService) RequestPasswordReset(ctx context.Context, email string) error {
+	user, err := s.userRepo.GetUserByEmail(ctx, email)
+	if errors.Is(err, repositories.ErrNotFound) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	raw, err := newOpaqueToken()
+	if err != nil {
+		return err
+	}
+	link, err := linkWithToken(s.resetURL, raw)
+	if err != nil {
+		return err
+	}
+
+	// As with verification emails, the send is only recorded once the mail is handed over
+	return s.txManager.WithinTx(ctx, func(ctx context.Context) error {
+		sent, err := s.userRepo.MarkPasswordResetSent(ctx, user.ID, s.now().Add(-PasswordResetInterval))
+		if err != nil {
+			return err
+		}
+		if !sent {
+			return ErrPasswordResetThrottled
+		}
+
+		if err := s.tokenRepo.InvalidatePasswordResetTokens(ctx, user.ID); err != nil {
+			return err
+		}
+		err = s.tokenRepo.CreatePasswordResetToken(ctx, &models.PasswordResetToken{
+			UserID:    user.ID,
+			TokenHash: hashRefreshToken(raw),
+			ExpiresAt: s.now().Add(PasswordResetTTL),
+		})
+		if err != nil {
+			return err
+		}
+
+		return s.mailer.Send(ctx, mail.Message{
+			To:      user.Email,
+			Subject: "Reset your password",
+			Body: fmt.Sprintf("Hi %s,\n\nUse the link below to choose a new password. It expires in %d minutes and can only be used once.\n\n%s\n\nIf you did not ask to reset your password you can ignore this email.\n",
+				user.Name, int(PasswordResetTTL.Minutes()), link),
+		})
+	})
+}
+
+// ResetPassword redeems a reset token and sets the new password. Like a password change it
+// signs the user out everywhere, and any other outstanding reset links stop working.
+func (s *passwordResetService) ResetPassword(ctx context.Context, token, passwordHash string) error {
+	if token == "" {
+		return ErrInvalidResetToken
+	}
+
+	var userID string
+	err := s.txManager.WithinTx(ctx, func(ctx context.Context) error {
+		var err error
+		userID, err = s.tokenRepo.ConsumePasswordResetToken(ctx, hashRefreshToken(token))
+		if errors.Is(err, repositories.ErrNotFound) {
+			return ErrInvalidResetToken
+		}
+		if err != nil {
+			return err
+		}
+
+		if err := s.userRepo.UpdateUserPassword(ctx, userID, passwordHash); err != nil {
+			if errors.Is(err, repositories.ErrNotFound) {
+				return ErrInvalidResetToken
+			}
+			return err
+		}
+		if err := s.tokenRepo.RevokeUserRefreshTokens(ctx, userID); err != nil {
+			return err
+		}
+		return s.tokenRepo.InvalidatePasswordResetTokens(ctx, userID)
+	})
+	if err != nil {
+		return err
+	}
+
+	s.tokenVersions.Forget(userID)
+	return nil
+}
@@ -0,0 +1,195 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"yoked_backend/internal/db/repositories"
+	"yoked_backend/internal/mail"
+	"yoked_backend/internal/models"
+)
+
+func (f *fakeUserRepo) GetUserByEmail(ctx context.Context, email string) (*models.User, error) {
+	for _, user := range f.users {
+		if user.Email == email {
+			copied := *user
+			return &copied, nil
+		}
+	}
+	return nil, repositories.ErrNotFound
+}
+
+func (f *fakeUserRepo) UpdateUserPassword(ctx context.Context, userID, passwordHash string) error {
+	user, ok := f.users[userID]
+	if !ok {
+		return repositories.ErrNotFound
+	}
+	user.PasswordHash = passwordHash
+	user.TokenVersion++
+	return nil
+}
+
+func (f *fakeUserRepo) MarkPasswordResetSent(ctx context.Context, userID string, since time.Time) (bool, error) {
+	if last, ok := f.resetAt[userID]; ok && !last.Before(since) {
+		return false, nil
+	}
+	if f.resetAt == nil {
+		f.resetAt = make(map[string]time.Time)
+	}
+	f.resetAt[userID] = since.Add(PasswordResetInterval)
+	return true, nil
+}
+
+func (f *fakeTokenRepo) CreatePasswordResetToken(ctx context.Context, token *models.PasswordResetToken) error {
+	stored := *token
+	f.resets[token.TokenHash] = &stored
+	return nil
+}
+
+func (f *fakeTokenRepo) ConsumePasswordResetToken(ctx context.Context, tokenHash string) (string, error) {
+	token, ok := f.resets[tokenHash]
+	if !ok || token.UsedAt != nil || !time.Now().Before(token.ExpiresAt) {
+		return "", repositories.ErrNotFound
+	}
+	now := time.Now()
+	token.UsedAt = &now
+	return token.UserID, nil
+}
+
+func (f *fakeTokenRepo) InvalidatePasswordResetTokens(ctx context.Context, userID string) error {
+	for _, token := range f.resets {
+		if token.UserID == userID && token.UsedAt == nil {
+			now := time.Now()
+			token.UsedAt = &now
+		}
+	}
+	return nil
+}
+
+// recordingMailer keeps every message it is asked to send
+type recordingMailer struct {
+	sent []mail.Message
+	err  error // returned instead of sending when set
+}
+
+func (m *recordingMailer) Send(ctx context.Context, msg mail.Message) error {
+	if m.err != nil {
+		return m.err
+	}
+	m.sent = append(m.sent, msg)
+	return nil
+}
+
+// tokenFromMail pulls the reset token back out of the link in a reset email
+func tokenFromMail(t *testing.T, msg mail.Message) string {
+	t.Helper()
+	start := strings.Index(msg.Body, devPasswordResetURL)
+	if start < 0 {
+		t.Fatalf("no reset link in mail:\n%s", msg.Body)
+	}
+	link, err := url.Parse(strings.Fields(msg.Body[start:])[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	return link.Query().Get("token")
+}
+
+func newTestPasswordResetService() (*passwordResetService, *fakeUserRepo, *fakeTokenRepo, *recordingMailer) {
+	users := &fakeUserRepo{users: map[string]*models.User{"u1": {ID: "u1", Email: "lifter@example.com", PasswordHash: "old"}}}
+	tokens := newFakeTokenRepo()
+	mailer := &recordingMailer{}
+	versions := NewTokenVersionCache(users, time.Minute)
+	svc := NewPasswordResetService(users, tokens, passthroughTx{}, versions, mailer, devPasswordResetURL)
+	return svc.(*passwordResetService), users, tokens, mailer
+}
+
+func TestPasswordReset(t *testing.T) {
+	ctx := context.Background()
+	svc, users, tokens, mailer := newTestPasswordResetService()
+	auth := NewAuthService(users, tokens, passthroughTx{}, &recordingNotifier{}, NewSessionCache(tokens, time.Minute))
+	session, _ := auth.IssueRefreshToken(ctx, "u1", testDevice)
+
+	if err := svc.RequestPasswordReset(ctx, "lifter@example.com"); err != nil {
+		t.Fatalf("request: %v", err)
+	}
+	if len(mailer.sent) != 1 || mailer.sent[0].To != "lifter@example.com" {
+		t.Fatalf("unexpected mail: %+v", mailer.sent)
+	}
+	token := tokenFromMail(t, mailer.sent[0])
+	if _, ok := tokens.resets[token]; ok {
+		t.Fatal("reset token stored in plain text")
+	}
+
+	if err := svc.ResetPassword(ctx, token, "new"); err != nil {
+		t.Fatalf("reset: %v", err)
+	}
+	if user := users.users["u1"]; user.PasswordHash != "new" || user.TokenVersion != 1 {
+		t.Errorf("password not updated: %+v", user)
+	}
+	if _, _, err := auth.RotateRefreshToken(ctx, session.Token, testDevice); !errors.Is(err, ErrInvalidRefreshToken) {
+		t.Errorf("refresh token survived the reset: %v", err)
+	}
+
+	// Tokens are single use
+	if err := svc.ResetPassword(ctx, token, "again"); !errors.Is(err, ErrInvalidResetToken) {
+		t.Errorf("reuse: got %v, want ErrInvalidResetToken", err)
+	}
+}
+
+func TestPasswordResetRejections(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("unknown email sends nothing", func(t *testing.T) {
+		svc, _, _, mailer := newTestPasswordResetService()
+		if err := svc.RequestPasswordReset(ctx, "nobody@example.com"); err != nil {
+			t.Errorf("unknown email should not be an error, got %v", err)
+		}
+		if len(mailer.sent) != 0 {
+			t.Errorf("mailed an unknown address: %+v", mailer.sent)
+		}
+	})
+
+	t.Run("expired token", func(t *testing.T) {
+		svc, _, _, mailer := newTestPasswordResetService()
+		svc.now = func() time.Time { return time.Now().Add(-PasswordResetTTL - time.Minute) }
+		svc.RequestPasswordReset(ctx, "lifter@example.com")
+		if err := svc.ResetPassword(ctx, tokenFromMail(t, mailer.sent[0]), "new"); !errors.Is(err, ErrInvalidResetToken) {
+			t.Errorf("got %v", err)
+		}
+	})
+
+	t.Run("a new request supersedes the old link", func(t *testing.T) {
+		svc, _, _, mailer := newTestPasswordResetService()
+		clock := &fakeClock{now: time.Now()}
+		svc.now = clock.Now
+		svc.RequestPasswordReset(ctx, "lifter@example.com")
+		clock.Advance(PasswordResetInterval + time.Second)
+		svc.RequestPasswordReset(ctx, "lifter@example.com")
+		if err := svc.ResetPassword(ctx, tokenFromMail(t, mailer.sent[0]), "new"); !errors.Is(err, ErrInvalidResetToken) {
+			t.Errorf("old link: got %v", err)
+		}
+		if err := svc.ResetPassword(ctx, tokenFromMail(t, mailer.sent[1]), "new"); err != nil {
+			t.Errorf("new link: %v", err)
+		}
+	})
+
+	t.Run("repeated requests are throttled", func(t *testing.T) {
+		svc, _, _, mailer := newTestPasswordResetService()
+		if err := svc.RequestPasswordReset(ctx, "lifter@example.com"); err != nil {
+			t.Fatal(err)
+		}
+		if err := svc.RequestPasswordReset(ctx, "lifter@example.com"); !errors.Is(err, ErrPasswordResetThrottled) {
+			t.Errorf("second request: got %v", err)
+		}
+		if len(mailer.sent) != 1 {
+			t.Fatalf("sent %d emails, want 1", len(mailer.sent))
+		}
+		if err := svc.ResetPassword(ctx, tokenFromMail(t, mailer.sent[0]), "new"); err != nil {
+			t.Errorf("first link should survive a throttled request: %v", err)
+		}
+	})
+}
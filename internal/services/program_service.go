@@ -2,6 +2,7 @@ package services
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"math"
 	"time"
@@ -11,49 +12,98 @@ import (
 	"yoked_backend/internal/db/repositories"
 )
 
+// ErrProgramUpToDate is returned when upgrading a user who already trains the latest version
+var ErrProgramUpToDate = errors.New("already on the latest version of the program")
+
 type ProgramService interface {
 	GetProgramByID(ctx context.Context, programID int) (*models.Program, error)
 	GetProgramsByGoal(ctx context.Context, goal string) ([]*models.Program, error)
-	GetAllExercises(ctx context.Context) ([]*models.Exercise, error)
-	GetExerciseByID(ctx context.Context, id int) (*models.Exercise, error)
 	AssignProgramToUser(ctx context.Context, userID string, programID int) error
+	// UpgradeUserProgram moves the user's active program to its latest published version.
+	// Their history stays attached to the version it was logged against.
+	UpgradeUserProgram(ctx context.Context, userID string) (*UserProgramDetail, error)
 	GetUserProgramWithWorkouts(ctx context.Context, userID string) (*UserProgramDetail, error)
-	CalculateInitialWeights(ctx context.Context, user *models.User, programID int) (map[int]int, error)
+	CalculateInitialWeights(ctx context.Context, user *models.User, programID int) (map[int]float64, error)
 	StartWorkoutSession(ctx context.Context, userID string, programWorkoutID int) (*models.WorkoutSession, error)
-	CompleteWorkoutSession(ctx context.Context, sessionID int, exercises []ExerciseLogRequest) error
+	CompleteWorkoutSession(ctx context.Context, actorID string, sessionID int, exercises []ExerciseLogRequest) (*models.WorkoutSession, []*models.PersonalRecord, error)
+	GetActiveWorkoutSession(ctx context.Context, userID string) (*models.WorkoutSession, error)
+	AbandonWorkoutSession(ctx context.Context, actorID string, sessionID int) (*models.WorkoutSession, error)
+	AbandonStaleWorkoutSessions(ctx context.Context) (int64, error)
 	GetWorkoutHistory(ctx context.Context, userID string, limit int) ([]*models.WorkoutSession, error)
-	CalculateNextWorkoutWeights(ctx context.Context, userID string, programWorkoutID int) (map[int]int, error)
+	CalculateNextWorkoutWeights(ctx context.Context, userID string, programWorkoutID int) ([]*ProgressionSuggestion, error)
 }
 
 type programService struct {
-	programRepo repositories.ProgramRepository
-	userRepo    repositories.UserRepository
+	programRepo   repositories.ProgramRepository
+	userRepo      repositories.UserRepository
+	txManager     repositories.TxManager
+	recordService RecordService
+	statsService  StatsService
+	authorizer    Authorizer
+	substitutions SubstitutionService
+	// sessionTimeout is how long a session may stay open before it is abandoned; zero disables it
+	sessionTimeout time.Duration
 }
 
-func NewProgramService(programRepo repositories.ProgramRepository, userRepo repositories.UserRepository) ProgramService {
-	return &programService{programRepo: programRepo, userRepo: userRepo}
+func NewProgramService(programRepo repositories.ProgramRepository, userRepo repositories.UserRepository, txManager repositories.TxManager, recordService RecordService, statsService StatsService, authorizer Authorizer, sessionTimeout time.Duration, substitutions SubstitutionService) ProgramService {
+	return &programService{
+		programRepo:    programRepo,
+		userRepo:       userRepo,
+		txManager:      txManager,
+		recordService:  recordService,
+		statsService:   statsService,
+		authorizer:     authorizer,
+		substitutions:  substitutions,
+		sessionTimeout: sessionTimeout,
+	}
 }
 
 // Request/Response structures
 type ExerciseLogRequest struct {
-	ProgramWorkoutExerciseID int   `json:"program_workout_exercise_id"`
-	ActualReps               []int `json:"actual_reps"`
-	ActualRIR                []int `json:"actual_rir"`
+	ProgramWorkoutExerciseID int             `json:"program_workout_exercise_id"`
+	// ExerciseID is the exercise performed when it is not the planned one; by default the
+	// user's override applies, or else the prescription
+	ExerciseID               int             `json:"exercise_id"`
+	ActualReps               []int           `json:"actual_reps"`
+	ActualRIR                []int           `json:"actual_rir"`
+	Sets                     []SetLogRequest `json:"sets"`
+}
+
+type SetLogRequest struct {
+	Weight      float64    `json:"weight"`
+	Unit        string     `json:"unit"`
+	Reps        int        `json:"reps"`
+	RIR         *int       `json:"rir"`
+	RPE         *float64   `json:"rpe"`
+	SetType     string     `json:"set_type"`
+	PerformedAt *time.Time `json:"performed_at"`
 }
 
 type UserProgramDetail struct {
-	UserProgram *models.UserProgram   `json:"user_program"`
-	Program     *models.Program       `json:"program"`
-	Workouts    []*WorkoutDetail      `json:"workouts"`
+	UserProgram   *models.UserProgram    `json:"user_program"`
+	Program       *models.Program        `json:"program"`
+	// Version is the version the user trains; LatestVersion is the newest one they can upgrade to
+	Version       *models.ProgramVersion `json:"version"`
+	LatestVersion int                    `json:"latest_version"`
+	Workouts      []*WorkoutDetail       `json:"workouts"`
+	// Today and WeekStart are dates in the user's timezone
+	Today       string                `json:"today"`
+	WeekStart   string                `json:"week_start"`
 }
 
 type WorkoutDetail struct {
-	ProgramWorkout *models.ProgramWorkout  `json:"program_workout"`
-	Exercises      []*ExerciseWithWeight   `json:"exercises"`
+	ProgramWorkout    *models.ProgramWorkout  `json:"program_workout"`
+	Exercises         []*ExerciseWithWeight   `json:"exercises"`
+	ScheduledToday    bool                    `json:"scheduled_today"`
+	CompletedThisWeek bool                    `json:"completed_this_week"`
 }
 
 type ExerciseWithWeight struct {
 	ProgramExercise *models.ProgramWorkoutExercise `json:"program_exercise"`
+	// ExerciseID is the exercise to perform: the user's substitute when Substituted, otherwise
+	// the prescribed one
+	ExerciseID      int                            `json:"exercise_id"`
+	Substituted     bool                           `json:"substituted"`
 	SuggestedWeight float64                        `json:"suggested_weight"`
 }
 
@@ -66,37 +116,53 @@ func (s *programService) GetProgramsByGoal(ctx context.Context, goal string) ([]
 	return s.programRepo.GetProgramsByGoal(ctx, goal)
 }
 
-func (s *programService) GetAllExercises(ctx context.Context) ([]*models.Exercise, error) {
-	return s.programRepo.GetAllExercises(ctx)
-}
-
-func (s *programService) GetExerciseByID(ctx context.Context, id int) (*models.Exercise, error) {
-	return s.programRepo.GetExerciseByID(ctx, id)
-}
-
+// AssignProgramToUser swaps the user's active program in one transaction so they are never
+// left with zero or two active programs
 func (s *programService) AssignProgramToUser(ctx context.Context, userID string, programID int) error {
-	// Deactivate any current active program
-	currentProgram, err := s.programRepo.GetUserActiveProgram(ctx, userID)
-	if err != nil && err.Error() != "sql: no rows in result set" {
+	program, err := s.programRepo.GetProgramByID(ctx, programID)
+	if err != nil {
+		return fmt.Errorf("program %d: %w", programID, err)
+	}
+	// Unpublished programs are invisible to users
+	if program.PublishedAt == nil {
+		return fmt.Errorf("program %d: %w", programID, repositories.ErrNotFound)
+	}
+	// New enrollments train the latest version
+	version, err := s.programRepo.GetLatestProgramVersion(ctx, programID)
+	if err != nil {
+		return fmt.Errorf("program %d: %w", programID, err)
+	}
+
+	user, err := s.userRepo.GetUserByID(ctx, userID)
+	if err != nil {
 		return err
 	}
 
-	if currentProgram != nil {
-		currentProgram.IsActive = false
-		if err := s.programRepo.UpdateUserProgram(ctx, currentProgram); err != nil {
+	return s.txManager.WithinTx(ctx, func(ctx context.Context) error {
+		// Deactivate any current active program
+		currentProgram, err := s.programRepo.GetUserActiveProgram(ctx, userID)
+		if err != nil && !errors.Is(err, repositories.ErrNotFound) {
 			return err
 		}
-	}
 
-	// Create new user program
-	userProgram := &models.UserProgram{
-		UserID:    userID,
-		ProgramID: programID,
-		StartDate: time.Now(),
-		IsActive:  true,
-	}
+		if currentProgram != nil {
+			currentProgram.IsActive = false
+			if err := s.programRepo.UpdateUserProgram(ctx, currentProgram); err != nil {
+				return err
+			}
+		}
+
+		// Create new user program
+		userProgram := &models.UserProgram{
+			UserID:           userID,
+			ProgramID:        programID,
+			ProgramVersionID: version.ID,
+			StartDate:        calendarDate(time.Now(), user.Location()),
+			IsActive:         true,
+		}
 
-	return s.programRepo.CreateUserProgram(ctx, userProgram)
+		return s.programRepo.CreateUserProgram(ctx, userProgram)
+	})
 }
 
 func (s *programService) GetUserProgramWithWorkouts(ctx context.Context, userID string) (*UserProgramDetail, error) {
@@ -115,11 +181,53 @@ func (s *programService) GetUserProgramWithWorkouts(ctx context.Context, userID
 		return nil, err
 	}
 
-	// Get program workouts
-	workouts, err := s.programRepo.GetProgramWorkouts(ctx, userProgram.ProgramID)
+	version, err := s.programRepo.GetProgramVersion(ctx, userProgram.ProgramVersionID)
+	if err != nil {
+		return nil, err
+	}
+	latest, err := s.programRepo.GetLatestProgramVersion(ctx, userProgram.ProgramID)
+	if err != nil {
+		return nil, err
+	}
+
+	// Get the workouts of the version the user trains
+	workouts, err := s.programRepo.GetProgramWorkouts(ctx, userProgram.ProgramVersionID)
+	if err != nil {
+		return nil, err
+	}
+
+	// "Today" and "this week" follow the user's local calendar
+	user, err := s.userRepo.GetUserByID(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	loc := user.Location()
+	now := time.Now()
+	startOfWeek := weekStart(now, loc)
+
+	weekSessions, err := s.programRepo.GetWorkoutSessionsSince(ctx, userProgram.ID, startOfWeek)
 	if err != nil {
 		return nil, err
 	}
+	// Sessions this week may have been logged against an earlier version, so they are matched
+	// to workouts by lineage
+	lineages := make(map[int]string, len(workouts))
+	for _, workout := range workouts {
+		lineages[workout.ID] = workout.LineageID
+	}
+	completedThisWeek := make(map[string]bool, len(weekSessions))
+	for _, session := range weekSessions {
+		lineage, ok := lineages[session.ProgramWorkoutID]
+		if !ok {
+			logged, err := s.programRepo.GetProgramWorkout(ctx, session.ProgramWorkoutID)
+			if err != nil {
+				return nil, err
+			}
+			lineage = logged.LineageID
+			lineages[session.ProgramWorkoutID] = lineage
+		}
+		completedThisWeek[lineage] = true
+	}
 
 	// Get user for weight calculation
 	//user, err := s.userRepo.GetUserByID(ctx, userID)
@@ -133,6 +241,11 @@ func (s *programService) GetUserProgramWithWorkouts(ctx context.Context, userID
 	//	return nil, err
 	//}
 
+	substitutes, err := s.substitutions.ProgramSubstitutes(ctx, userID, userProgram.ProgramID)
+	if err != nil {
+		return nil, err
+	}
+
 	// Build workout details with weight
 	log.Printf("Starting the looop")
 	workoutDetails := make([]*WorkoutDetail, len(workouts))
@@ -144,32 +257,95 @@ func (s *programService) GetUserProgramWithWorkouts(ctx context.Context, userID
 
 		exerciseDetails := make([]*ExerciseWithWeight, len(exercises))
 		for j, exercise := range exercises {
+			substitute, substituted := substitutes[exercise.ExerciseID]
 			exerciseDetails[j] = &ExerciseWithWeight{
 				ProgramExercise: exercise,
+				ExerciseID:      exercise.ExerciseID,
+				Substituted:     substituted,
 				//SuggestedWeight: weights[exercise.ID],
 			}
+			if substituted {
+				exerciseDetails[j].ExerciseID = substitute
+			}
 		}
 
+		weekday, scheduled := isoWeekday(workout.DayOfWeek)
 		workoutDetails[i] = &WorkoutDetail{
-			ProgramWorkout: workout,
-			Exercises:      exerciseDetails,
+			ProgramWorkout:    workout,
+			Exercises:         exerciseDetails,
+			ScheduledToday:    scheduled && weekday == now.In(loc).Weekday(),
+			CompletedThisWeek: completedThisWeek[workout.LineageID],
 		}
 	}
 
 	return &UserProgramDetail{
-		UserProgram: userProgram,
-		Program:     program,
-		Workouts:    workoutDetails,
+		UserProgram:   userProgram,
+		Program:       program,
+		Version:       version,
+		LatestVersion: latest.Version,
+		Workouts:      workoutDetails,
+		Today:         localDay(now, loc).Format(time.DateOnly),
+		WeekStart:     startOfWeek.Format(time.DateOnly),
 	}, nil
 }
 
-func (s *programService) CalculateInitialWeights(ctx context.Context, user *models.User, programID int) (map[int]int, error) {
-	workouts, err := s.programRepo.GetProgramWorkouts(ctx, programID)
+// UpgradeUserProgram refuses while a session is open, so a session never spans two versions
+func (s *programService) UpgradeUserProgram(ctx context.Context, userID string) (*UserProgramDetail, error) {
+	err := s.txManager.WithinTx(ctx, func(ctx context.Context) error {
+		userProgram, err := s.programRepo.GetUserActiveProgram(ctx, userID)
+		if err != nil {
+			return err
+		}
+		latest, err := s.programRepo.GetLatestProgramVersion(ctx, userProgram.ProgramID)
+		if err != nil {
+			return err
+		}
+		if userProgram.ProgramVersionID == latest.ID {
+			return ErrProgramUpToDate
+		}
+
+		active, err := s.GetActiveWorkoutSession(ctx, userID)
+		if err != nil {
+			return err
+		}
+		if active != nil {
+			return ErrWorkoutInProgress
+		}
+
+		userProgram.ProgramVersionID = latest.ID
+		return s.programRepo.UpdateUserProgram(ctx, userProgram)
+	})
 	if err != nil {
 		return nil, err
 	}
+	return s.GetUserProgramWithWorkouts(ctx, userID)
+}
+
+// programWorkoutInVersion returns the program workout when it belongs to the version the user
+// trains; workouts of other versions are rejected as bad input
+func (s *programService) programWorkoutInVersion(ctx context.Context, userProgram *models.UserProgram, programWorkoutID int) (*models.ProgramWorkout, error) {
+	workout, err := s.programRepo.GetProgramWorkout(ctx, programWorkoutID)
+	if err != nil && !errors.Is(err, repositories.ErrNotFound) {
+		return nil, err
+	}
+	if workout == nil || workout.ProgramVersionID != userProgram.ProgramVersionID {
+		return nil, invalidInput("workout %d is not part of your program", programWorkoutID)
+	}
+	return workout, nil
+}
 
-	weightMap := make(map[int]int)
+// CalculateInitialWeights suggests weights for the latest version of the program
+func (s *programService) CalculateInitialWeights(ctx context.Context, user *models.User, programID int) (map[int]float64, error) {
+	version, err := s.programRepo.GetLatestProgramVersion(ctx, programID)
+	if err != nil {
+		return nil, err
+	}
+	workouts, err := s.programRepo.GetProgramWorkouts(ctx, version.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	weightMap := make(map[int]float64)
 
 	for _, workout := range workouts {
 		exercises, err := s.programRepo.GetProgramWorkoutExercises(ctx, workout.ID)
@@ -194,7 +370,7 @@ func (s *programService) CalculateInitialWeights(ctx context.Context, user *mode
 	return weightMap, nil
 }
 
-func (s *programService) calculateBaseStrength(user *models.User) int {
+func (s *programService) calculateBaseStrength(user *models.User) float64 {
 	base := user.Weight * 0.6
 
 	if user.Sex == "male" {
@@ -202,16 +378,16 @@ func (s *programService) calculateBaseStrength(user *models.User) int {
 	}
 
 	if user.Age < 25 {
-		base *= 0.9 + (user.Age-13)/120
+		base *= 0.9 + float64(user.Age-13)/120
 	} else if user.Age > 35 {
-		base *= 1.1 - (user.Age-35)/100
+		base *= 1.1 - float64(user.Age-35)/100
 	}
 
 	return base
 }
 
-func (s *programService) getExerciseModifier(exerciseID int) int {
-	modifiers := map[int]int{
+func (s *programService) getExerciseModifier(exerciseID int) float64 {
+	modifiers := map[int]float64{
 		1: 1.0,  // Bench press
 		2: 0.8,  // Shoulder press
 		3: 1.2,  // Squat
@@ -230,10 +406,20 @@ func (s *programService) StartWorkoutSession(ctx context.Context, userID string,
 		return nil, fmt.Errorf("no active program found for user")
 	}
 
+	active, err := s.GetActiveWorkoutSession(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	if active != nil {
+		return nil, ErrWorkoutInProgress
+	}
+	if _, err := s.programWorkoutInVersion(ctx, userProgram, programWorkoutID); err != nil {
+		return nil, err
+	}
+
 	session := &models.WorkoutSession{
 		UserProgramID:    userProgram.ID,
 		ProgramWorkoutID: programWorkoutID,
-		CompletedDate:    time.Now(),
 	}
 
 	sessionID, err := s.programRepo.CreateWorkoutSession(ctx, session)
@@ -245,20 +431,209 @@ func (s *programService) StartWorkoutSession(ctx context.Context, userID string,
 	return session, nil
 }
 
-func (s *programService) CompleteWorkoutSession(ctx context.Context, sessionID int, exercises []ExerciseLogRequest) error {
-	for _, exercise := range exercises {
-		log := &models.WorkoutExerciseLog{
-			WorkoutID:               sessionID,
-			ProgramWorkoutExerciseID: exercise.ProgramWorkoutExerciseID,
-			ActualReps:              exercise.ActualReps,
-			ActualRIR:               exercise.ActualRIR,
+// CompleteWorkoutSession ends an in-progress session, stores its exercise logs and returns
+// the completed session with any personal records set. A session can only be completed once,
+// by its owner or someone with a grant for them.
+func (s *programService) CompleteWorkoutSession(ctx context.Context, actorID string, sessionID int, exercises []ExerciseLogRequest) (*models.WorkoutSession, []*models.PersonalRecord, error) {
+	session, userProgram, err := s.authorizeWorkoutSession(ctx, actorID, sessionID)
+	if err != nil {
+		return nil, nil, err
+	}
+	if session.Status != models.WorkoutStatusInProgress {
+		return nil, nil, ErrWorkoutNotInProgress
+	}
+	now := time.Now()
+	if s.expired(session, now) {
+		if _, err := s.programRepo.AbandonWorkoutSession(ctx, sessionID, now); err != nil && !errors.Is(err, repositories.ErrNotFound) {
+			return nil, nil, err
+		}
+		return nil, nil, ErrWorkoutNotInProgress
+	}
+
+	// Logs may only point at the session's own prescriptions
+	prescriptions, err := s.programRepo.GetProgramWorkoutExercises(ctx, session.ProgramWorkoutID)
+	if err != nil {
+		return nil, nil, err
+	}
+	prescribed := make(map[int]*models.ProgramWorkoutExercise, len(prescriptions))
+	for _, prescription := range prescriptions {
+		prescribed[prescription.ID] = prescription
+	}
+	substitutes, err := s.substitutions.ProgramSubstitutes(ctx, userProgram.UserID, userProgram.ProgramID)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	logs := make([]*models.WorkoutExerciseLog, len(exercises))
+	for i, exercise := range exercises {
+		prescription, ok := prescribed[exercise.ProgramWorkoutExerciseID]
+		if !ok {
+			return nil, nil, invalidInput("exercise %d is not part of this workout", exercise.ProgramWorkoutExerciseID)
+		}
+		log, err := buildExerciseLog(sessionID, exercise)
+		if err != nil {
+			return nil, nil, err
+		}
+		if log.ExerciseID, err = s.performedExercise(ctx, prescription, exercise.ExerciseID, substitutes); err != nil {
+			return nil, nil, err
+		}
+		logs[i] = log
+	}
+
+	// Marking the session, its logs, the stats and any records commit together
+	var records []*models.PersonalRecord
+	err = s.txManager.WithinTx(ctx, func(ctx context.Context) error {
+		// The conditional update is what rejects a concurrent second completion
+		completed, err := s.programRepo.CompleteWorkoutSession(ctx, sessionID, now)
+		if errors.Is(err, repositories.ErrNotFound) {
+			return ErrWorkoutNotInProgress
+		}
+		if err != nil {
+			return err
+		}
+		session = completed
+
+		for _, log := range logs {
+			if err := s.programRepo.CreateWorkoutExerciseLog(ctx, log); err != nil {
+				return err
+			}
 		}
+		session.Exercises = logs
 
-		if err := s.programRepo.CreateWorkoutExerciseLog(ctx, log); err != nil {
+		if err := s.statsService.RecordCompletedSession(ctx, userProgram.UserID, &CompletedSession{
+			ExerciseCount: len(logs),
+			Tonnage:       sessionTonnage(logs),
+			CompletedAt:   *session.CompletedAt,
+		}); err != nil {
 			return err
 		}
+
+		records, err = s.recordService.DetectPersonalRecords(ctx, userProgram.UserID, sessionID)
+		return err
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+	return session, records, nil
+}
+
+// performedExercise resolves the exercise a log is attributed to: the one the user says they
+// performed, else their override of the prescribed exercise, else the prescribed exercise
+func (s *programService) performedExercise(ctx context.Context, prescription *models.ProgramWorkoutExercise, requested int, substitutes map[int]int) (int, error) {
+	planned := prescription.ExerciseID
+	if substitute, ok := substitutes[planned]; ok {
+		planned = substitute
+	}
+	if requested == 0 {
+		return planned, nil
+	}
+	if requested == planned || requested == prescription.ExerciseID {
+		return requested, nil
+	}
+
+	exercise, err := s.programRepo.GetExerciseByID(ctx, requested)
+	if errors.Is(err, repositories.ErrNotFound) {
+		return 0, invalidInput("exercise %d does not exist", requested)
+	}
+	if err != nil {
+		return 0, err
+	}
+	if exercise.MergedIntoID != nil {
+		return 0, invalidInput("exercise %d was merged into exercise %d", requested, *exercise.MergedIntoID)
+	}
+	return requested, nil
+}
+
+// buildExerciseLog validates a logged exercise and converts it into its model form.
+// When per-set records are supplied the legacy reps/RIR arrays are derived from them.
+func buildExerciseLog(sessionID int, exercise ExerciseLogRequest) (*models.WorkoutExerciseLog, error) {
+	log := &models.WorkoutExerciseLog{
+		WorkoutID:                sessionID,
+		ProgramWorkoutExerciseID: exercise.ProgramWorkoutExerciseID,
+		ActualReps:               exercise.ActualReps,
+		ActualRIR:                exercise.ActualRIR,
+		Sets:                     make([]*models.WorkoutSetLog, 0, len(exercise.Sets)),
+	}
+
+	now := time.Now()
+	for i, set := range exercise.Sets {
+		setLog, err := buildSetLog(i+1, set, now)
+		if err != nil {
+			return nil, fmt.Errorf("exercise %d set %d: %w", exercise.ProgramWorkoutExerciseID, i+1, err)
+		}
+		log.Sets = append(log.Sets, setLog)
+	}
+
+	if len(log.Sets) > 0 && len(log.ActualReps) == 0 {
+		log.ActualReps = make([]int, len(log.Sets))
+		log.ActualRIR = make([]int, len(log.Sets))
+		for i, set := range log.Sets {
+			log.ActualReps[i] = set.Reps
+			if set.RIR != nil {
+				log.ActualRIR[i] = *set.RIR
+			} else if set.RPE != nil {
+				log.ActualRIR[i] = int(math.Max(0, math.Round(10-*set.RPE)))
+			}
+		}
+	}
+
+	if len(log.ActualReps) == 0 {
+		return nil, invalidInput("exercise %d: at least one set is required", exercise.ProgramWorkoutExerciseID)
+	}
+	if len(log.ActualReps) != len(log.ActualRIR) {
+		return nil, invalidInput("exercise %d: actual_reps and actual_rir must have the same length", exercise.ProgramWorkoutExerciseID)
 	}
-	return nil
+
+	return log, nil
+}
+
+func buildSetLog(setNumber int, set SetLogRequest, now time.Time) (*models.WorkoutSetLog, error) {
+	setLog := &models.WorkoutSetLog{
+		SetNumber:   setNumber,
+		Weight:      set.Weight,
+		Unit:        set.Unit,
+		Reps:        set.Reps,
+		RIR:         set.RIR,
+		RPE:         set.RPE,
+		SetType:     set.SetType,
+		PerformedAt: now,
+	}
+	if set.PerformedAt != nil {
+		setLog.PerformedAt = *set.PerformedAt
+	}
+	if setLog.Unit == "" {
+		setLog.Unit = models.WeightUnitKg
+	}
+	if setLog.SetType == "" {
+		setLog.SetType = models.SetTypeWorking
+	}
+
+	switch setLog.Unit {
+	case models.WeightUnitKg, models.WeightUnitLb:
+	default:
+		return nil, invalidInput("invalid unit %q", setLog.Unit)
+	}
+
+	switch setLog.SetType {
+	case models.SetTypeWarmUp, models.SetTypeWorking, models.SetTypeDrop, models.SetTypeFailure:
+	default:
+		return nil, invalidInput("invalid set type %q", setLog.SetType)
+	}
+
+	if setLog.Weight < 0 {
+		return nil, invalidInput("weight cannot be negative")
+	}
+	if setLog.Reps < 0 {
+		return nil, invalidInput("reps cannot be negative")
+	}
+	if setLog.RIR != nil && *setLog.RIR < 0 {
+		return nil, invalidInput("rir cannot be negative")
+	}
+	if setLog.RPE != nil && (*setLog.RPE < 1 || *setLog.RPE > 10) {
+		return nil, invalidInput("rpe must be between 1 and 10")
+	}
+
+	return setLog, nil
 }
 
 func (s *programService) GetWorkoutHistory(ctx context.Context, userID string, limit int) ([]*models.WorkoutSession, error) {
@@ -270,67 +645,85 @@ func (s *programService) GetWorkoutHistory(ctx context.Context, userID string, l
 		return nil, fmt.Errorf("no active program found for user")
 	}
 
-	return s.programRepo.GetWorkoutSessionsByUserProgram(ctx, userProgram.ID, limit)
+	sessions, err := s.programRepo.GetWorkoutSessionsByUserProgram(ctx, userProgram.ID, limit)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, session := range sessions {
+		logs, err := s.programRepo.GetExerciseLogsByWorkout(ctx, session.ID)
+		if err != nil {
+			return nil, err
+		}
+		for _, log := range logs {
+			for _, set := range log.Sets {
+				set.EstimatedOneRepMax = s.recordService.EstimateSet(set)
+			}
+		}
+		session.Exercises = logs
+	}
+
+	return sessions, nil
 }
 
-func (s *programService) CalculateNextWorkoutWeights(ctx context.Context, userID string, programWorkoutID int) (map[int]float64, error) {
-	// Get the last workout session of this type
-	lastSession, err := s.programRepo.GetLastWorkoutSessionByType(ctx, userID, programWorkoutID)
+func (s *programService) CalculateNextWorkoutWeights(ctx context.Context, userID string, programWorkoutID int) ([]*ProgressionSuggestion, error) {
+	userProgram, err := s.programRepo.GetUserActiveProgram(ctx, userID)
 	if err != nil {
 		return nil, err
 	}
-	if lastSession == nil {
-		return nil, fmt.Errorf("no previous workout session found")
+	if userProgram == nil {
+		return nil, fmt.Errorf("no active program found for user")
 	}
 
-	// Get exercise logs for the last session
-	exerciseLogs, err := s.programRepo.GetExerciseLogsByWorkout(ctx, lastSession.ID)
+	program, err := s.programRepo.GetProgramByID(ctx, userProgram.ProgramID)
 	if err != nil {
 		return nil, err
 	}
+	if _, err := s.programWorkoutInVersion(ctx, userProgram, programWorkoutID); err != nil {
+		return nil, err
+	}
 
-	weightMap := make(map[int]float64)
+	prescriptions, err := s.programRepo.GetProgramWorkoutExercises(ctx, programWorkoutID)
+	if err != nil {
+		return nil, err
+	}
+
+	completedSessions, err := s.programRepo.CountWorkoutSessionsByType(ctx, userProgram.ID, programWorkoutID)
+	if err != nil {
+		return nil, err
+	}
+	substitutes, err := s.substitutions.ProgramSubstitutes(ctx, userID, userProgram.ProgramID)
+	if err != nil {
+		return nil, err
+	}
 
-	for _, exerciseLog := range exerciseLogs {
-		programExercise, err := s.programRepo.GetProgramWorkoutExercise(ctx, exerciseLog.ProgramWorkoutExerciseID)
+	suggestions := make([]*ProgressionSuggestion, 0, len(prescriptions))
+	for _, prescription := range prescriptions {
+		strategy, err := resolveProgressionStrategy(program, prescription)
 		if err != nil {
 			return nil, err
 		}
 
-		avgRIR := calculateAverageRIR(exerciseLog.ActualRIR)
-		weightAdjustment := s.calculateWeightAdjustment(avgRIR, float64(programExercise.TargetRIR))
-
-		// Get current weight (this would need to be stored somewhere)
-		currentWeight := 50.0 // Default, should come from previous session or calculation
-		newWeight := currentWeight * weightAdjustment
-
-		weightMap[exerciseLog.ProgramWorkoutExerciseID] = math.Round(newWeight/2.5)*2.5
-	}
+		if substitute, ok := substitutes[prescription.ExerciseID]; ok {
+			// Loads set for the prescribed exercise do not carry over to its substitute
+			swapped := *prescription
+			swapped.ExerciseID = substitute
+			swapped.PrescribedWeight = 0
+			swapped.TrainingMax = 0
+			prescription = &swapped
+		}
 
-	return weightMap, nil
-}
+		lastLog, err := s.programRepo.GetLastExerciseLog(ctx, userID, prescription.ID, prescription.ExerciseID)
+		if err != nil {
+			return nil, err
+		}
 
-func calculateAverageRIR(rirArray []int) float64 {
-	sum := 0
-	for _, rir := range rirArray {
-		sum += rir
+		suggestions = append(suggestions, strategy.Suggest(ProgressionInput{
+			Prescription:      prescription,
+			LastLog:           lastLog,
+			CompletedSessions: completedSessions,
+		}))
 	}
-	return float64(sum) / float64(len(rirArray))
-}
 
-func (s *programService) calculateWeightAdjustment(actualRIR, targetRIR float64) float64 {
-	difference := targetRIR - actualRIR
-
-	switch {
-	case difference >= 2:
-		return 0.9 // 10% decrease
-	case difference <= -2:
-		return 1.1 // 10% increase
-	case difference >= 1:
-		return 0.95 // 5% decrease
-	case difference <= -1:
-		return 1.05 // 5% increase
-	default:
-		return 1.0 // Keep same weight
-	}
+	return suggestions, nil
 }
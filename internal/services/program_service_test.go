@@ -0,0 +1,290 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"yoked_backend/internal/db/repositories"
+	"yoked_backend/internal/models"
+)
+
+// fakeProgramRepo holds programs, enrollments, sessions and logs in memory. Exercises are
+// looked up in the library.
+type fakeProgramRepo struct {
+	repositories.ProgramRepository
+	library       *fakeExerciseRepo
+	programs      map[int]*models.Program
+	versions      map[int]*models.ProgramVersion
+	workouts      map[int]*models.ProgramWorkout
+	prescriptions []*models.ProgramWorkoutExercise
+	userPrograms  map[int]*models.UserProgram
+	sessions      map[int]*models.WorkoutSession
+	logs          []*models.WorkoutExerciseLog
+}
+
+func (f *fakeProgramRepo) GetProgramByID(ctx context.Context, id int) (*models.Program, error) {
+	program, ok := f.programs[id]
+	if !ok {
+		return nil, repositories.ErrNotFound
+	}
+	copied := *program
+	return &copied, nil
+}
+
+func (f *fakeProgramRepo) GetProgramVersion(ctx context.Context, id int) (*models.ProgramVersion, error) {
+	version, ok := f.versions[id]
+	if !ok {
+		return nil, repositories.ErrNotFound
+	}
+	copied := *version
+	return &copied, nil
+}
+
+func (f *fakeProgramRepo) GetLatestProgramVersion(ctx context.Context, programID int) (*models.ProgramVersion, error) {
+	var latest *models.ProgramVersion
+	for _, version := range f.versions {
+		if version.ProgramID == programID && !version.IsDraft() && (latest == nil || version.Version > latest.Version) {
+			latest = version
+		}
+	}
+	if latest == nil {
+		return nil, repositories.ErrNotFound
+	}
+	copied := *latest
+	return &copied, nil
+}
+
+func (f *fakeProgramRepo) GetProgramWorkouts(ctx context.Context, versionID int) ([]*models.ProgramWorkout, error) {
+	var workouts []*models.ProgramWorkout
+	for _, workout := range f.workouts {
+		if workout.ProgramVersionID == versionID {
+			copied := *workout
+			workouts = append(workouts, &copied)
+		}
+	}
+	return workouts, nil
+}
+
+func (f *fakeProgramRepo) GetProgramWorkout(ctx context.Context, id int) (*models.ProgramWorkout, error) {
+	workout, ok := f.workouts[id]
+	if !ok {
+		return nil, repositories.ErrNotFound
+	}
+	copied := *workout
+	return &copied, nil
+}
+
+func (f *fakeProgramRepo) GetProgramWorkoutExercises(ctx context.Context, workoutID int) ([]*models.ProgramWorkoutExercise, error) {
+	var prescriptions []*models.ProgramWorkoutExercise
+	for _, prescription := range f.prescriptions {
+		if prescription.ProgramWorkoutID == workoutID {
+			copied := *prescription
+			prescriptions = append(prescriptions, &copied)
+		}
+	}
+	return prescriptions, nil
+}
+
+func (f *fakeProgramRepo) GetExerciseByID(ctx context.Context, id int) (*models.Exercise, error) {
+	return f.library.GetExercise(ctx, id)
+}
+
+func (f *fakeProgramRepo) GetUserActiveProgram(ctx context.Context, userID string) (*models.UserProgram, error) {
+	for _, userProgram := range f.userPrograms {
+		if userProgram.UserID == userID && userProgram.IsActive {
+			copied := *userProgram
+			return &copied, nil
+		}
+	}
+	return nil, repositories.ErrNotFound
+}
+
+func (f *fakeProgramRepo) GetUserProgramByID(ctx context.Context, id int) (*models.UserProgram, error) {
+	userProgram, ok := f.userPrograms[id]
+	if !ok {
+		return nil, repositories.ErrNotFound
+	}
+	copied := *userProgram
+	return &copied, nil
+}
+
+func (f *fakeProgramRepo) GetWorkoutSessionsSince(ctx context.Context, userProgramID int, since time.Time) ([]*models.WorkoutSession, error) {
+	return []*models.WorkoutSession{}, nil
+}
+
+func (f *fakeProgramRepo) GetWorkoutSessionByID(ctx context.Context, id int) (*models.WorkoutSession, error) {
+	session, ok := f.sessions[id]
+	if !ok {
+		return nil, repositories.ErrNotFound
+	}
+	copied := *session
+	return &copied, nil
+}
+
+func (f *fakeProgramRepo) CompleteWorkoutSession(ctx context.Context, id int, completedAt time.Time) (*models.WorkoutSession, error) {
+	session, ok := f.sessions[id]
+	if !ok || session.Status != models.WorkoutStatusInProgress {
+		return nil, repositories.ErrNotFound
+	}
+	session.Status = models.WorkoutStatusCompleted
+	session.CompletedAt = &completedAt
+	copied := *session
+	return &copied, nil
+}
+
+func (f *fakeProgramRepo) CreateWorkoutExerciseLog(ctx context.Context, log *models.WorkoutExerciseLog) error {
+	log.ID = len(f.logs) + 1
+	f.logs = append(f.logs, log)
+	return nil
+}
+
+func (f *fakeProgramRepo) GetExerciseLogsByWorkout(ctx context.Context, workoutID int) ([]*models.WorkoutExerciseLog, error) {
+	var logs []*models.WorkoutExerciseLog
+	for _, log := range f.logs {
+		if log.WorkoutID == workoutID {
+			logs = append(logs, log)
+		}
+	}
+	return logs, nil
+}
+
+// fakeRecordRepo starts every exercise without records and keeps the ones created
+type fakeRecordRepo struct {
+	repositories.RecordRepository
+	created []*models.PersonalRecord
+}
+
+func (f *fakeRecordRepo) GetBestEstimatedOneRepMax(ctx context.Context, userID string, exerciseID int, formula string) (float64, error) {
+	return 0, nil
+}
+
+func (f *fakeRecordRepo) GetBestRepMaxes(ctx context.Context, userID string, exerciseID int) (map[int]float64, error) {
+	return map[int]float64{}, nil
+}
+
+func (f *fakeRecordRepo) CreatePersonalRecord(ctx context.Context, record *models.PersonalRecord) error {
+	f.created = append(f.created, record)
+	return nil
+}
+
+// discardStats accepts completed sessions without keeping stats
+type discardStats struct {
+	StatsService
+}
+
+func (discardStats) RecordCompletedSession(ctx context.Context, userID string, completed *CompletedSession) error {
+	return nil
+}
+
+// newSwappedProgram enrolls the athlete in a push day of bench press and triceps pushdowns,
+// with bench press swapped for dumbbell press, and opens a session of it. Cable fly was merged
+// into push-ups.
+func newSwappedProgram(t *testing.T) (ProgramService, *fakeProgramRepo, *fakeRecordRepo) {
+	t.Helper()
+	library := substitutionLibrary()
+	pushUps := 3
+	library.exercises[4].MergedIntoID = &pushUps
+
+	published := time.Now().Add(-24 * time.Hour)
+	programs := &fakeProgramRepo{
+		library:  library,
+		programs: map[int]*models.Program{7: {ID: 7, Name: "Push", PublishedAt: &published}},
+		versions: map[int]*models.ProgramVersion{70: {ID: 70, ProgramID: 7, Version: 1, PublishedAt: &published}},
+		workouts: map[int]*models.ProgramWorkout{700: {ID: 700, ProgramID: 7, ProgramVersionID: 70, LineageID: "push", DayOfWeek: 1}},
+		prescriptions: []*models.ProgramWorkoutExercise{
+			{ID: 7001, ProgramWorkoutID: 700, ExerciseID: 1, Sets: 3, Reps: 5},
+			{ID: 7002, ProgramWorkoutID: 700, ExerciseID: 5, Sets: 3, Reps: 12},
+		},
+		userPrograms: map[int]*models.UserProgram{1: {ID: 1, UserID: "athlete", ProgramID: 7, ProgramVersionID: 70, IsActive: true}},
+		sessions: map[int]*models.WorkoutSession{
+			10: {ID: 10, UserProgramID: 1, ProgramWorkoutID: 700, Status: models.WorkoutStatusInProgress, StartedAt: time.Now()},
+		},
+	}
+	overrides := &fakeOverrideRepo{overrides: []*models.ExerciseOverride{
+		{ID: 1, UserID: "athlete", ProgramID: 7, ExerciseID: 1, SubstituteExerciseID: 2},
+	}}
+	users := &fakeUserRepo{users: map[string]*models.User{"athlete": {ID: "athlete", Role: models.RoleUser}}}
+	records := &fakeRecordRepo{}
+
+	substitutions := NewSubstitutionService(library, overrides, programs, &fakePreferencesRepo{})
+	service := NewProgramService(programs, users, passthroughTx{}, NewRecordService(records, programs, ""),
+		discardStats{}, newTestAuthorizer(), 0, substitutions)
+	return service, programs, records
+}
+
+func TestUserProgramShowsSubstitutes(t *testing.T) {
+	service, _, _ := newSwappedProgram(t)
+
+	detail, err := service.GetUserProgramWithWorkouts(context.Background(), "athlete")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(detail.Workouts) != 1 || len(detail.Workouts[0].Exercises) != 2 {
+		t.Fatalf("unexpected plan %+v", detail.Workouts)
+	}
+	bench, pushdown := detail.Workouts[0].Exercises[0], detail.Workouts[0].Exercises[1]
+	if !bench.Substituted || bench.ExerciseID != 2 || bench.ProgramExercise.ExerciseID != 1 {
+		t.Errorf("bench press should be swapped for dumbbell press: %+v", bench)
+	}
+	if pushdown.Substituted || pushdown.ExerciseID != 5 {
+		t.Errorf("pushdowns were not swapped: %+v", pushdown)
+	}
+}
+
+func TestCompleteWorkoutSessionCreditsPerformedExercise(t *testing.T) {
+	for _, tc := range []struct {
+		name      string
+		requested int
+		want      int
+	}{
+		{"override", 0, 2},
+		{"prescribed after all", 1, 1},
+		{"another exercise", 6, 6},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			service, _, records := newSwappedProgram(t)
+
+			session, found, err := service.CompleteWorkoutSession(context.Background(), "athlete", 10, []ExerciseLogRequest{{
+				ProgramWorkoutExerciseID: 7001,
+				ExerciseID:               tc.requested,
+				Sets:                     []SetLogRequest{{Weight: 30, Reps: 5}, {Weight: 32.5, Reps: 5}},
+			}})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := session.Exercises[0].ExerciseID; got != tc.want {
+				t.Errorf("logged as exercise %d, want %d", got, tc.want)
+			}
+			if len(found) == 0 || len(found) != len(records.created) {
+				t.Fatalf("got records %+v", found)
+			}
+			for _, record := range found {
+				if record.ExerciseID != tc.want {
+					t.Errorf("record credited to exercise %d, want %d", record.ExerciseID, tc.want)
+				}
+			}
+		})
+	}
+}
+
+func TestCompleteWorkoutSessionRejectsUnknownExercises(t *testing.T) {
+	for name, requested := range map[string]int{"merged": 4, "missing": 99} {
+		t.Run(name, func(t *testing.T) {
+			service, programs, records := newSwappedProgram(t)
+
+			_, _, err := service.CompleteWorkoutSession(context.Background(), "athlete", 10, []ExerciseLogRequest{{
+				ProgramWorkoutExerciseID: 7001,
+				ExerciseID:               requested,
+				Sets:                     []SetLogRequest{{Weight: 30, Reps: 5}},
+			}})
+			if !errors.Is(err, ErrInvalidInput) {
+				t.Fatalf("got %v, want invalid input", err)
+			}
+			if programs.sessions[10].Status != models.WorkoutStatusInProgress || len(programs.logs) != 0 || len(records.created) != 0 {
+				t.Error("a rejected log should leave the session open")
+			}
+		})
+	}
+}
@@ -0,0 +1,368 @@
+package services
+
+import (
+	"fmt"
+	"math"
+
+	"yoked_backend/internal/models"
+)
+
+// Progression strategy identifiers, stored on programs and program workout exercises
+const (
+	ProgressionLinear         = "linear"
+	ProgressionDouble         = "double_progression"
+	ProgressionAutoregulation = "rir_autoregulation"
+	ProgressionTrainingMax    = "training_max"
+
+	DefaultProgressionStrategy = ProgressionAutoregulation
+)
+
+// ProgressionInput is everything a strategy needs to prescribe the next session of an exercise
+type ProgressionInput struct {
+	Prescription *models.ProgramWorkoutExercise
+	// LastLog is the most recent log of this exercise, or nil if it has never been performed
+	LastLog *models.WorkoutExerciseLog
+	// CompletedSessions is how many times the user has performed the parent program workout
+	CompletedSessions int
+}
+
+// SuggestedSet is a single set within a multi-set scheme (e.g. 5/3/1 waves)
+type SuggestedSet struct {
+	Weight float64 `json:"weight"`
+	Reps   int     `json:"reps"`
+}
+
+// ProgressionSuggestion is the load and reps recommended for the next session of an exercise
+type ProgressionSuggestion struct {
+	ProgramWorkoutExerciseID int            `json:"program_workout_exercise_id"`
+	ExerciseID               int            `json:"exercise_id"`
+	Strategy                 string         `json:"strategy"`
+	Weight                   float64        `json:"weight"`
+	Unit                     string         `json:"unit"`
+	Sets                     int            `json:"sets"`
+	Reps                     int            `json:"reps"`
+	Scheme                   []SuggestedSet `json:"scheme,omitempty"`
+	Reason                   string         `json:"reason"`
+}
+
+// ProgressionStrategy decides how an exercise's load and reps evolve between sessions
+type ProgressionStrategy interface {
+	Name() string
+	Suggest(input ProgressionInput) *ProgressionSuggestion
+}
+
+var progressionStrategies = map[string]ProgressionStrategy{
+	ProgressionLinear:         linearProgression{},
+	ProgressionDouble:         doubleProgression{},
+	ProgressionAutoregulation: autoregulatedProgression{},
+	ProgressionTrainingMax:    trainingMaxProgression{},
+}
+
+// GetProgressionStrategy looks up a strategy by its identifier
+func GetProgressionStrategy(name string) (ProgressionStrategy, error) {
+	strategy, ok := progressionStrategies[name]
+	if !ok {
+		return nil, fmt.Errorf("unknown progression strategy %q", name)
+	}
+	return strategy, nil
+}
+
+// resolveProgressionStrategy picks the exercise-level strategy, then the program's, then the default
+func resolveProgressionStrategy(program *models.Program, prescription *models.ProgramWorkoutExercise) (ProgressionStrategy, error) {
+	name := prescription.ProgressionStrategy
+	if name == "" && program != nil {
+		name = program.ProgressionStrategy
+	}
+	if name == "" {
+		name = DefaultProgressionStrategy
+	}
+	return GetProgressionStrategy(name)
+}
+
+// linearProgression adds a fixed increment every time all prescribed reps are completed
+type linearProgression struct{}
+
+func (linearProgression) Name() string { return ProgressionLinear }
+
+func (p linearProgression) Suggest(in ProgressionInput) *ProgressionSuggestion {
+	suggestion := newSuggestion(p.Name(), in)
+	if in.LastLog == nil {
+		return startingSuggestion(suggestion, in.Prescription)
+	}
+
+	weight, unit := lastWorkingLoad(in.LastLog)
+	if weight == 0 {
+		return startingSuggestion(suggestion, in.Prescription)
+	}
+	suggestion.Unit = unit
+	increment := weightIncrement(in.Prescription, unit)
+	target := in.Prescription.Reps
+
+	switch {
+	case minWorkingReps(in.LastLog) >= target:
+		suggestion.Weight = roundLoad(weight+increment, unit)
+		suggestion.Reason = fmt.Sprintf("All sets reached %d reps at %.1f %s; adding %.1f %s", target, weight, unit, increment, unit)
+	case minWorkingReps(in.LastLog) <= target-3:
+		suggestion.Weight = roundLoad(weight*0.9, unit)
+		suggestion.Reason = fmt.Sprintf("Missed the rep target by 3 or more at %.1f %s; deloading 10%%", weight, unit)
+	default:
+		suggestion.Weight = roundLoad(weight, unit)
+		suggestion.Reason = fmt.Sprintf("Not every set reached %d reps; repeating %.1f %s", target, weight, unit)
+	}
+	return suggestion
+}
+
+// doubleProgression climbs the rep range first and only adds load once the top of the range is hit
+type doubleProgression struct{}
+
+func (doubleProgression) Name() string { return ProgressionDouble }
+
+func (p doubleProgression) Suggest(in ProgressionInput) *ProgressionSuggestion {
+	suggestion := newSuggestion(p.Name(), in)
+	if in.LastLog == nil {
+		return startingSuggestion(suggestion, in.Prescription)
+	}
+
+	weight, unit := lastWorkingLoad(in.LastLog)
+	if weight == 0 {
+		return startingSuggestion(suggestion, in.Prescription)
+	}
+	suggestion.Unit = unit
+	bottom, top := repRange(in.Prescription)
+	achieved := minWorkingReps(in.LastLog)
+
+	if achieved >= top {
+		increment := weightIncrement(in.Prescription, unit)
+		suggestion.Weight = roundLoad(weight+increment, unit)
+		suggestion.Reps = bottom
+		suggestion.Reason = fmt.Sprintf("Top of the %d-%d rep range reached; adding %.1f %s and resetting to %d reps", bottom, top, increment, unit, bottom)
+		return suggestion
+	}
+
+	suggestion.Weight = roundLoad(weight, unit)
+	suggestion.Reps = achieved + 1
+	if suggestion.Reps < bottom {
+		suggestion.Reps = bottom
+	}
+	suggestion.Reason = fmt.Sprintf("Working up the %d-%d rep range at %.1f %s; aim for %d reps on every set", bottom, top, weight, unit, suggestion.Reps)
+	return suggestion
+}
+
+// autoregulatedProgression adjusts load by how far the logged RIR was from the target RIR
+type autoregulatedProgression struct{}
+
+func (autoregulatedProgression) Name() string { return ProgressionAutoregulation }
+
+func (p autoregulatedProgression) Suggest(in ProgressionInput) *ProgressionSuggestion {
+	suggestion := newSuggestion(p.Name(), in)
+	if in.LastLog == nil || len(in.LastLog.ActualRIR) == 0 {
+		return startingSuggestion(suggestion, in.Prescription)
+	}
+
+	weight, unit := lastWorkingLoad(in.LastLog)
+	if weight == 0 {
+		return startingSuggestion(suggestion, in.Prescription)
+	}
+	suggestion.Unit = unit
+
+	avgRIR := calculateAverageRIR(in.LastLog.ActualRIR)
+	adjustment := calculateWeightAdjustment(avgRIR, float64(in.Prescription.TargetRIR))
+	suggestion.Weight = roundLoad(weight*adjustment, unit)
+
+	switch {
+	case adjustment > 1:
+		suggestion.Reason = fmt.Sprintf("Average RIR %.1f was above the target of %d; increasing load %.0f%%", avgRIR, in.Prescription.TargetRIR, (adjustment-1)*100)
+	case adjustment < 1:
+		suggestion.Reason = fmt.Sprintf("Average RIR %.1f was below the target of %d; reducing load %.0f%%", avgRIR, in.Prescription.TargetRIR, (1-adjustment)*100)
+	default:
+		suggestion.Reason = fmt.Sprintf("Average RIR %.1f matched the target of %d; keeping the load", avgRIR, in.Prescription.TargetRIR)
+	}
+	return suggestion
+}
+
+// trainingMaxProgression runs 5/3/1 style four-week waves off a training max
+type trainingMaxProgression struct{}
+
+func (trainingMaxProgression) Name() string { return ProgressionTrainingMax }
+
+// trainingMaxWaves holds the percentage of training max and reps for each set, per week of the cycle
+var trainingMaxWaves = [4][3]struct {
+	percent float64
+	reps    int
+}{
+	{{0.65, 5}, {0.75, 5}, {0.85, 5}},
+	{{0.70, 3}, {0.80, 3}, {0.90, 3}},
+	{{0.75, 5}, {0.85, 3}, {0.95, 1}},
+	{{0.40, 5}, {0.50, 5}, {0.60, 5}},
+}
+
+func (p trainingMaxProgression) Suggest(in ProgressionInput) *ProgressionSuggestion {
+	suggestion := newSuggestion(p.Name(), in)
+
+	unit := models.WeightUnitKg
+	trainingMax := in.Prescription.TrainingMax
+	source := "configured training max"
+	if trainingMax == 0 && in.LastLog != nil {
+		var e1RM float64
+		e1RM, unit = bestEstimatedOneRepMax(in.LastLog)
+		trainingMax = e1RM * 0.9
+		source = "90% of last estimated 1RM"
+	}
+	if trainingMax == 0 {
+		return startingSuggestion(suggestion, in.Prescription)
+	}
+	suggestion.Unit = unit
+
+	cycle := in.CompletedSessions / len(trainingMaxWaves)
+	week := in.CompletedSessions % len(trainingMaxWaves)
+	if in.Prescription.TrainingMax > 0 {
+		// A configured training max grows by one increment per completed cycle
+		trainingMax += float64(cycle) * weightIncrement(in.Prescription, unit)
+	}
+
+	wave := trainingMaxWaves[week]
+	suggestion.Scheme = make([]SuggestedSet, len(wave))
+	for i, set := range wave {
+		suggestion.Scheme[i] = SuggestedSet{Weight: roundLoad(trainingMax*set.percent, unit), Reps: set.reps}
+	}
+	top := suggestion.Scheme[len(suggestion.Scheme)-1]
+	suggestion.Weight = top.Weight
+	suggestion.Reps = top.Reps
+	suggestion.Sets = len(suggestion.Scheme)
+
+	if week == len(trainingMaxWaves)-1 {
+		suggestion.Reason = fmt.Sprintf("Deload week of cycle %d from a %.1f %s training max (%s)", cycle+1, trainingMax, unit, source)
+	} else {
+		suggestion.Reason = fmt.Sprintf("Week %d of cycle %d from a %.1f %s training max (%s)", week+1, cycle+1, trainingMax, unit, source)
+	}
+	return suggestion
+}
+
+func newSuggestion(strategy string, in ProgressionInput) *ProgressionSuggestion {
+	return &ProgressionSuggestion{
+		ProgramWorkoutExerciseID: in.Prescription.ID,
+		ExerciseID:               in.Prescription.ExerciseID,
+		Strategy:                 strategy,
+		Unit:                     models.WeightUnitKg,
+		Sets:                     in.Prescription.Sets,
+		Reps:                     in.Prescription.Reps,
+	}
+}
+
+func startingSuggestion(suggestion *ProgressionSuggestion, prescription *models.ProgramWorkoutExercise) *ProgressionSuggestion {
+	suggestion.Weight = prescription.PrescribedWeight
+	if prescription.PrescribedWeight > 0 {
+		suggestion.Reason = "No logged working sets yet; starting at the prescribed weight"
+	} else {
+		suggestion.Reason = "No logged working sets yet; pick a weight you can lift for the prescribed reps"
+	}
+	return suggestion
+}
+
+// lastWorkingLoad returns the heaviest non warm-up load in the unit it was logged in. Sets
+// are compared in kilograms, so a log mixing units picks the truly heaviest.
+func lastWorkingLoad(log *models.WorkoutExerciseLog) (float64, string) {
+	var top *models.WorkoutSetLog
+	for _, set := range log.Sets {
+		if set.IsWorkingSet() && set.Weight > 0 && (top == nil || set.WeightKg() > top.WeightKg()) {
+			top = set
+		}
+	}
+	if top == nil {
+		return 0, models.WeightUnitKg
+	}
+	return top.Weight, top.Unit
+}
+
+// minWorkingReps returns the fewest reps achieved across the working sets of a log
+func minWorkingReps(log *models.WorkoutExerciseLog) int {
+	reps := make([]int, 0, len(log.Sets))
+	for _, set := range log.Sets {
+		if set.IsWorkingSet() {
+			reps = append(reps, set.Reps)
+		}
+	}
+	if len(reps) == 0 {
+		reps = log.ActualReps
+	}
+	if len(reps) == 0 {
+		return 0
+	}
+
+	lowest := reps[0]
+	for _, r := range reps[1:] {
+		if r < lowest {
+			lowest = r
+		}
+	}
+	return lowest
+}
+
+// bestEstimatedOneRepMax returns the highest Epley estimate across the working sets of a log
+func bestEstimatedOneRepMax(log *models.WorkoutExerciseLog) (float64, string) {
+	best, unit := 0.0, models.WeightUnitKg
+	for _, set := range log.Sets {
+		if !set.IsWorkingSet() || set.Reps == 0 {
+			continue
+		}
+		if e1RM := epley(set.Weight, set.Reps); e1RM > best {
+			best, unit = e1RM, set.Unit
+		}
+	}
+	return best, unit
+}
+
+func repRange(prescription *models.ProgramWorkoutExercise) (int, int) {
+	top := prescription.RepRangeMax
+	if top < prescription.Reps {
+		top = prescription.Reps + 4
+	}
+	return prescription.Reps, top
+}
+
+func weightIncrement(prescription *models.ProgramWorkoutExercise, unit string) float64 {
+	if prescription.WeightIncrement > 0 {
+		return prescription.WeightIncrement
+	}
+	if unit == models.WeightUnitLb {
+		return 5
+	}
+	return 2.5
+}
+
+// roundLoad rounds to the smallest plate jump available in the unit
+func roundLoad(weight float64, unit string) float64 {
+	step := 2.5
+	if unit == models.WeightUnitLb {
+		step = 5
+	}
+	return math.Round(weight/step) * step
+}
+
+func calculateAverageRIR(rirArray []int) float64 {
+	if len(rirArray) == 0 {
+		return 0
+	}
+	sum := 0
+	for _, rir := range rirArray {
+		sum += rir
+	}
+	return float64(sum) / float64(len(rirArray))
+}
+
+func calculateWeightAdjustment(actualRIR, targetRIR float64) float64 {
+	difference := targetRIR - actualRIR
+
+	switch {
+	case difference >= 2:
+		return 0.9 // 10% decrease
+	case difference <= -2:
+		return 1.1 // 10% increase
+	case difference >= 1:
+		return 0.95 // 5% decrease
+	case difference <= -1:
+		return 1.05 // 5% increase
+	default:
+		return 1.0 // Keep same weight
+	}
+}
@@ -0,0 +1,234 @@
+package services
+
+import (
+	"testing"
+
+	"yoked_backend/internal/models"
+)
+
+func intPtr(v int) *int { return &v }
+
+// workingLog builds a log with one working set per reps entry, all at the same load
+func workingLog(weight float64, unit string, rir int, reps ...int) *models.WorkoutExerciseLog {
+	log := &models.WorkoutExerciseLog{}
+	for i, r := range reps {
+		log.ActualReps = append(log.ActualReps, r)
+		log.ActualRIR = append(log.ActualRIR, rir)
+		log.Sets = append(log.Sets, &models.WorkoutSetLog{
+			SetNumber: i + 1,
+			Weight:    weight,
+			Unit:      unit,
+			Reps:      r,
+			RIR:       intPtr(rir),
+			SetType:   models.SetTypeWorking,
+		})
+	}
+	return log
+}
+
+func TestLinearProgression(t *testing.T) {
+	prescription := &models.ProgramWorkoutExercise{ID: 1, Sets: 3, Reps: 5, PrescribedWeight: 60}
+
+	tests := []struct {
+		name       string
+		lastLog    *models.WorkoutExerciseLog
+		increment  float64
+		wantWeight float64
+		wantUnit   string
+	}{
+		{name: "no history starts at prescription", lastLog: nil, wantWeight: 60, wantUnit: models.WeightUnitKg},
+		{name: "all reps hit adds default increment", lastLog: workingLog(100, models.WeightUnitKg, 1, 5, 5, 5), wantWeight: 102.5, wantUnit: models.WeightUnitKg},
+		{name: "all reps hit adds configured increment", lastLog: workingLog(100, models.WeightUnitKg, 1, 5, 5, 5), increment: 5, wantWeight: 105, wantUnit: models.WeightUnitKg},
+		{name: "pounds use a 5 lb jump", lastLog: workingLog(225, models.WeightUnitLb, 1, 5, 5, 5), wantWeight: 230, wantUnit: models.WeightUnitLb},
+		{name: "small miss repeats the load", lastLog: workingLog(100, models.WeightUnitKg, 0, 5, 5, 4), wantWeight: 100, wantUnit: models.WeightUnitKg},
+		{name: "big miss deloads ten percent", lastLog: workingLog(100, models.WeightUnitKg, 0, 5, 3, 2), wantWeight: 90, wantUnit: models.WeightUnitKg},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := *prescription
+			p.WeightIncrement = tt.increment
+			got := linearProgression{}.Suggest(ProgressionInput{Prescription: &p, LastLog: tt.lastLog})
+			if got.Weight != tt.wantWeight || got.Unit != tt.wantUnit {
+				t.Errorf("got %.1f %s, want %.1f %s", got.Weight, got.Unit, tt.wantWeight, tt.wantUnit)
+			}
+			if got.Reason == "" {
+				t.Error("expected a reason")
+			}
+		})
+	}
+}
+
+func TestLastWorkingLoadComparesInKilograms(t *testing.T) {
+	// 200 lb is about 90.7 kg, lighter than the 100 kg sets despite the bigger number
+	log := workingLog(100, models.WeightUnitKg, 1, 5, 5)
+	log.Sets = append(log.Sets,
+		&models.WorkoutSetLog{SetNumber: 3, Weight: 200, Unit: models.WeightUnitLb, Reps: 5, SetType: models.SetTypeWorking},
+		&models.WorkoutSetLog{SetNumber: 4, Weight: 150, Unit: models.WeightUnitKg, Reps: 5, SetType: models.SetTypeWarmUp},
+	)
+	if weight, unit := lastWorkingLoad(log); weight != 100 || unit != models.WeightUnitKg {
+		t.Errorf("got %.1f %s, want 100.0 kg", weight, unit)
+	}
+
+	log.Sets[2].Weight = 225 // about 102 kg
+	if weight, unit := lastWorkingLoad(log); weight != 225 || unit != models.WeightUnitLb {
+		t.Errorf("got %.1f %s, want 225.0 lb", weight, unit)
+	}
+}
+
+func TestDoubleProgression(t *testing.T) {
+	tests := []struct {
+		name       string
+		repMax     int
+		lastLog    *models.WorkoutExerciseLog
+		wantWeight float64
+		wantReps   int
+	}{
+		{name: "no history starts at bottom of range", repMax: 12, lastLog: nil, wantWeight: 20, wantReps: 8},
+		{name: "mid range adds a rep", repMax: 12, lastLog: workingLog(30, models.WeightUnitKg, 2, 10, 9, 9), wantWeight: 30, wantReps: 10},
+		{name: "below range targets bottom", repMax: 12, lastLog: workingLog(30, models.WeightUnitKg, 0, 7, 6, 6), wantWeight: 30, wantReps: 8},
+		{name: "top of range adds load and resets reps", repMax: 12, lastLog: workingLog(30, models.WeightUnitKg, 2, 12, 12, 12), wantWeight: 32.5, wantReps: 8},
+		{name: "missing range max defaults to reps plus four", repMax: 0, lastLog: workingLog(30, models.WeightUnitKg, 2, 12, 12, 12), wantWeight: 32.5, wantReps: 8},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := &models.ProgramWorkoutExercise{ID: 1, Sets: 3, Reps: 8, RepRangeMax: tt.repMax, PrescribedWeight: 20}
+			got := doubleProgression{}.Suggest(ProgressionInput{Prescription: p, LastLog: tt.lastLog})
+			if got.Weight != tt.wantWeight || got.Reps != tt.wantReps {
+				t.Errorf("got %.1f x %d, want %.1f x %d", got.Weight, got.Reps, tt.wantWeight, tt.wantReps)
+			}
+		})
+	}
+}
+
+func TestAutoregulatedProgression(t *testing.T) {
+	tests := []struct {
+		name       string
+		lastLog    *models.WorkoutExerciseLog
+		wantWeight float64
+	}{
+		{name: "no history starts at prescription", lastLog: nil, wantWeight: 50},
+		{name: "on target keeps load", lastLog: workingLog(100, models.WeightUnitKg, 2, 8, 8, 8), wantWeight: 100},
+		{name: "one rep easier adds five percent", lastLog: workingLog(100, models.WeightUnitKg, 3, 8, 8, 8), wantWeight: 105},
+		{name: "two reps easier adds ten percent", lastLog: workingLog(100, models.WeightUnitKg, 4, 8, 8, 8), wantWeight: 110},
+		{name: "one rep harder drops five percent", lastLog: workingLog(100, models.WeightUnitKg, 1, 8, 8, 8), wantWeight: 95},
+		{name: "two reps harder drops ten percent", lastLog: workingLog(100, models.WeightUnitKg, 0, 8, 8, 8), wantWeight: 90},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := &models.ProgramWorkoutExercise{ID: 1, Sets: 3, Reps: 8, TargetRIR: 2, PrescribedWeight: 50}
+			got := autoregulatedProgression{}.Suggest(ProgressionInput{Prescription: p, LastLog: tt.lastLog})
+			if got.Weight != tt.wantWeight {
+				t.Errorf("got %.1f, want %.1f", got.Weight, tt.wantWeight)
+			}
+		})
+	}
+}
+
+func TestAutoregulatedProgressionIgnoresWarmUps(t *testing.T) {
+	log := workingLog(100, models.WeightUnitKg, 2, 8, 8)
+	log.Sets = append([]*models.WorkoutSetLog{{SetNumber: 0, Weight: 140, Unit: models.WeightUnitKg, Reps: 1, SetType: models.SetTypeWarmUp}}, log.Sets...)
+
+	p := &models.ProgramWorkoutExercise{ID: 1, Sets: 2, Reps: 8, TargetRIR: 2}
+	got := autoregulatedProgression{}.Suggest(ProgressionInput{Prescription: p, LastLog: log})
+	if got.Weight != 100 {
+		t.Errorf("got %.1f, want 100.0", got.Weight)
+	}
+}
+
+func TestTrainingMaxProgression(t *testing.T) {
+	tests := []struct {
+		name              string
+		trainingMax       float64
+		lastLog           *models.WorkoutExerciseLog
+		completedSessions int
+		wantScheme        []SuggestedSet
+	}{
+		{
+			name:        "week one from configured max",
+			trainingMax: 100,
+			wantScheme:  []SuggestedSet{{65, 5}, {75, 5}, {85, 5}},
+		},
+		{
+			name:              "week three top set is a single",
+			trainingMax:       100,
+			completedSessions: 2,
+			wantScheme:        []SuggestedSet{{75, 5}, {85, 3}, {95, 1}},
+		},
+		{
+			name:              "week four deloads",
+			trainingMax:       100,
+			completedSessions: 3,
+			wantScheme:        []SuggestedSet{{40, 5}, {50, 5}, {60, 5}},
+		},
+		{
+			name:              "second cycle bumps the configured max",
+			trainingMax:       100,
+			completedSessions: 4,
+			wantScheme:        []SuggestedSet{{67.5, 5}, {77.5, 5}, {87.5, 5}},
+		},
+		{
+			name:       "derives max from last estimated 1RM",
+			lastLog:    workingLog(100, models.WeightUnitKg, 0, 3),
+			wantScheme: []SuggestedSet{{65, 5}, {75, 5}, {85, 5}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := &models.ProgramWorkoutExercise{ID: 1, Sets: 3, Reps: 5, TrainingMax: tt.trainingMax}
+			got := trainingMaxProgression{}.Suggest(ProgressionInput{
+				Prescription:      p,
+				LastLog:           tt.lastLog,
+				CompletedSessions: tt.completedSessions,
+			})
+			if len(got.Scheme) != len(tt.wantScheme) {
+				t.Fatalf("got %d sets, want %d", len(got.Scheme), len(tt.wantScheme))
+			}
+			for i, want := range tt.wantScheme {
+				if got.Scheme[i] != want {
+					t.Errorf("set %d: got %+v, want %+v", i+1, got.Scheme[i], want)
+				}
+			}
+			top := tt.wantScheme[len(tt.wantScheme)-1]
+			if got.Weight != top.Weight || got.Reps != top.Reps {
+				t.Errorf("headline got %.1f x %d, want %.1f x %d", got.Weight, got.Reps, top.Weight, top.Reps)
+			}
+		})
+	}
+}
+
+func TestResolveProgressionStrategy(t *testing.T) {
+	tests := []struct {
+		name     string
+		program  *models.Program
+		exercise string
+		want     string
+		wantErr  bool
+	}{
+		{name: "defaults to autoregulation", program: &models.Program{}, want: ProgressionAutoregulation},
+		{name: "inherits program strategy", program: &models.Program{ProgressionStrategy: ProgressionLinear}, want: ProgressionLinear},
+		{name: "exercise overrides program", program: &models.Program{ProgressionStrategy: ProgressionLinear}, exercise: ProgressionTrainingMax, want: ProgressionTrainingMax},
+		{name: "unknown strategy errors", program: &models.Program{ProgressionStrategy: "bogus"}, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := resolveProgressionStrategy(tt.program, &models.ProgramWorkoutExercise{ProgressionStrategy: tt.exercise})
+			if tt.wantErr {
+				if err == nil {
+					t.Fatal("expected an error")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if got.Name() != tt.want {
+				t.Errorf("got %s, want %s", got.Name(), tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,174 @@
+package services
+
+import (
+	"context"
+	"fmt"
+
+	"yoked_backend/internal/db/repositories"
+	"yoked_backend/internal/models"
+)
+
+type RecordService interface {
+	DetectPersonalRecords(ctx context.Context, userID string, sessionID int) ([]*models.PersonalRecord, error)
+	GetUserRecords(ctx context.Context, userID string) ([]*models.PersonalRecord, error)
+	GetExerciseRecords(ctx context.Context, userID string, exerciseID int) (*ExerciseRecords, error)
+	EstimateSet(set *models.WorkoutSetLog) float64
+}
+
+type recordService struct {
+	recordRepo  repositories.RecordRepository
+	programRepo repositories.ProgramRepository
+	formula     string
+}
+
+func NewRecordService(recordRepo repositories.RecordRepository, programRepo repositories.ProgramRepository, formula string) RecordService {
+	if formula == "" {
+		formula = DefaultOneRepMaxFormula
+	}
+	return &recordService{recordRepo: recordRepo, programRepo: programRepo, formula: formula}
+}
+
+// ExerciseRecords is the standing records for an exercise alongside every record ever set
+type ExerciseRecords struct {
+	ExerciseID int                      `json:"exercise_id"`
+	Current    []*models.PersonalRecord `json:"current"`
+	History    []*models.PersonalRecord `json:"history"`
+}
+
+// EstimateSet returns the e1RM of a set in kilograms using the configured formula
+func (s *recordService) EstimateSet(set *models.WorkoutSetLog) float64 {
+	e1RM, err := EstimateOneRepMax(s.formula, set.WeightKg(), set.Reps, set.RIR)
+	if err != nil {
+		return 0
+	}
+	return e1RM
+}
+
+// DetectPersonalRecords compares every working set of a session against the user's
+// standing records and persists the ones that beat them. Only the best set per record
+// is kept, so a session produces at most one e1RM PR and one rep-max PR per rep count.
+func (s *recordService) DetectPersonalRecords(ctx context.Context, userID string, sessionID int) ([]*models.PersonalRecord, error) {
+	logs, err := s.programRepo.GetExerciseLogsByWorkout(ctx, sessionID)
+	if err != nil {
+		return nil, err
+	}
+
+	setsByExercise := make(map[int][]*models.WorkoutSetLog)
+	var exerciseOrder []int
+	for _, log := range logs {
+		// Records belong to the exercise performed, which may be a substitute for the prescribed one
+		if _, seen := setsByExercise[log.ExerciseID]; !seen {
+			exerciseOrder = append(exerciseOrder, log.ExerciseID)
+		}
+		setsByExercise[log.ExerciseID] = append(setsByExercise[log.ExerciseID], log.Sets...)
+	}
+
+	records := []*models.PersonalRecord{}
+	for _, exerciseID := range exerciseOrder {
+		found, err := s.detectExerciseRecords(ctx, userID, sessionID, exerciseID, setsByExercise[exerciseID])
+		if err != nil {
+			return nil, err
+		}
+		records = append(records, found...)
+	}
+
+	return records, nil
+}
+
+func (s *recordService) detectExerciseRecords(ctx context.Context, userID string, sessionID, exerciseID int, sets []*models.WorkoutSetLog) ([]*models.PersonalRecord, error) {
+	bestE1RM, err := s.recordRepo.GetBestEstimatedOneRepMax(ctx, userID, exerciseID, s.formula)
+	if err != nil {
+		return nil, err
+	}
+	bestRepMaxes, err := s.recordRepo.GetBestRepMaxes(ctx, userID, exerciseID)
+	if err != nil {
+		return nil, err
+	}
+
+	var e1RMSet *models.WorkoutSetLog
+	repMaxSets := make(map[int]*models.WorkoutSetLog)
+	for _, set := range sets {
+		if !set.IsWorkingSet() || set.Reps <= 0 || set.Weight <= 0 {
+			continue
+		}
+
+		if e1RM := s.EstimateSet(set); e1RM > bestE1RM {
+			bestE1RM = e1RM
+			e1RMSet = set
+		}
+		if set.Reps <= maxEstimableReps && set.WeightKg() > bestRepMaxes[set.Reps] {
+			bestRepMaxes[set.Reps] = set.WeightKg()
+			repMaxSets[set.Reps] = set
+		}
+	}
+
+	var records []*models.PersonalRecord
+	if e1RMSet != nil {
+		records = append(records, s.newRecord(userID, sessionID, exerciseID, models.RecordTypeE1RM, e1RMSet))
+	}
+	for reps := 1; reps <= maxEstimableReps; reps++ {
+		if set, ok := repMaxSets[reps]; ok {
+			records = append(records, s.newRecord(userID, sessionID, exerciseID, models.RecordTypeRepMax, set))
+		}
+	}
+
+	for _, record := range records {
+		if err := s.recordRepo.CreatePersonalRecord(ctx, record); err != nil {
+			return nil, err
+		}
+	}
+	return records, nil
+}
+
+func (s *recordService) newRecord(userID string, sessionID, exerciseID int, recordType string, set *models.WorkoutSetLog) *models.PersonalRecord {
+	setID := set.ID
+	return &models.PersonalRecord{
+		UserID:             userID,
+		ExerciseID:         exerciseID,
+		RecordType:         recordType,
+		Reps:               set.Reps,
+		Weight:             set.Weight,
+		Unit:               set.Unit,
+		WeightKg:           set.WeightKg(),
+		EstimatedOneRepMax: s.EstimateSet(set),
+		Formula:            s.formula,
+		WorkoutID:          &sessionID,
+		WorkoutSetID:       &setID,
+		AchievedAt:         set.PerformedAt,
+	}
+}
+
+func (s *recordService) GetUserRecords(ctx context.Context, userID string) ([]*models.PersonalRecord, error) {
+	records, err := s.recordRepo.GetCurrentRecordsByUser(ctx, userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get user records: %w", err)
+	}
+	return records, nil
+}
+
+func (s *recordService) GetExerciseRecords(ctx context.Context, userID string, exerciseID int) (*ExerciseRecords, error) {
+	if _, err := s.programRepo.GetExerciseByID(ctx, exerciseID); err != nil {
+		return nil, fmt.Errorf("exercise not found: %w", err)
+	}
+
+	history, err := s.recordRepo.GetRecordHistoryByExercise(ctx, userID, exerciseID)
+	if err != nil {
+		return nil, err
+	}
+
+	// History is newest first, so the first record of each kind is the standing one
+	current := []*models.PersonalRecord{}
+	seen := make(map[string]bool)
+	for _, record := range history {
+		key := fmt.Sprintf("%s/%s/%d", record.RecordType, record.Formula, record.Reps)
+		if record.RecordType == models.RecordTypeE1RM {
+			key = fmt.Sprintf("%s/%s", record.RecordType, record.Formula)
+		}
+		if !seen[key] {
+			seen[key] = true
+			current = append(current, record)
+		}
+	}
+
+	return &ExerciseRecords{ExerciseID: exerciseID, Current: current, History: history}, nil
+}
@@ -0,0 +1,50 @@
+package services
+
+import (
+	"context"
+	"time"
+
+	"yoked_backend/internal/db/repositories"
+)
+
+// DefaultSessionCacheTTL bounds how long another instance may keep accepting access tokens
+// of a session after it is signed out; the instance that signed it out stops straight away
+const DefaultSessionCacheTTL = 30 * time.Second
+
+// RevokedSessionStore answers whether the session an access token was issued for has been
+// signed out. AuthMiddleware consults it on every request, so lookups are cached in process.
+type RevokedSessionStore interface {
+	SessionRevoked(ctx context.Context, sessionID string) (bool, error)
+	MarkRevoked(sessionIDs ...string)
+}
+
+type sessionCache struct {
+	tokenRepo repositories.TokenRepository
+	revoked   *ttlCache[bool]
+}
+
+func NewSessionCache(tokenRepo repositories.TokenRepository, ttl time.Duration) RevokedSessionStore {
+	return &sessionCache{tokenRepo: tokenRepo, revoked: newTTLCache[bool](ttl, ttlCacheMaxEntries)}
+}
+
+func (c *sessionCache) SessionRevoked(ctx context.Context, sessionID string) (bool, error) {
+	if revoked, ok := c.revoked.get(sessionID); ok {
+		return revoked, nil
+	}
+
+	active, err := c.tokenRepo.IsSessionActive(ctx, sessionID)
+	if err != nil {
+		return false, err
+	}
+
+	c.revoked.set(sessionID, !active)
+	return !active, nil
+}
+
+// MarkRevoked records sessions this instance signed out, so their access tokens stop working
+// without waiting for the cached answer to expire
+func (c *sessionCache) MarkRevoked(sessionIDs ...string) {
+	for _, id := range sessionIDs {
+		c.revoked.set(id, true)
+	}
+}
@@ -0,0 +1,59 @@
+package services
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestSessionCache(t *testing.T) {
+	ctx := context.Background()
+	svc, tokens := newTestAuthService()
+	issued, err := svc.IssueRefreshToken(ctx, "u1", testDevice)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Another instance, which only learns of sign-outs from the database
+	cache := NewSessionCache(tokens, time.Minute).(*sessionCache)
+	now := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	cache.revoked.now = func() time.Time { return now }
+
+	for i := 0; i < 3; i++ {
+		if revoked, err := cache.SessionRevoked(ctx, issued.FamilyID); err != nil || revoked {
+			t.Fatalf("got %v, %v", revoked, err)
+		}
+	}
+	if tokens.sessionLookups != 1 {
+		t.Fatalf("expected one lookup while cached, got %d", tokens.sessionLookups)
+	}
+
+	// A sign-out elsewhere is picked up once the entry expires
+	if err := svc.RevokeSession(ctx, "u1", issued.FamilyID); err != nil {
+		t.Fatal(err)
+	}
+	if revoked, _ := cache.SessionRevoked(ctx, issued.FamilyID); revoked {
+		t.Error("before ttl: expected the cached answer")
+	}
+	now = now.Add(time.Minute)
+	if revoked, _ := cache.SessionRevoked(ctx, issued.FamilyID); !revoked {
+		t.Error("after ttl: expected the session to be revoked")
+	}
+
+	// A local sign-out is picked up immediately
+	other, _ := svc.IssueRefreshToken(ctx, "u1", testDevice)
+	if revoked, _ := cache.SessionRevoked(ctx, other.FamilyID); revoked {
+		t.Fatal("new session reported revoked")
+	}
+	cache.MarkRevoked(other.FamilyID)
+	if revoked, _ := cache.SessionRevoked(ctx, other.FamilyID); !revoked {
+		t.Error("after mark: expected the session to be revoked")
+	}
+
+	// Answers are dropped once expired, so sessions do not pile up in memory
+	now = now.Add(time.Minute)
+	cache.MarkRevoked("session-3")
+	if cache.revoked.len() != 1 {
+		t.Errorf("expired answers kept: %d entries", cache.revoked.len())
+	}
+}
@@ -0,0 +1,65 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"time"
+
+	"yoked_backend/internal/db/repositories"
+	"yoked_backend/internal/mail"
+	"yoked_backend/internal/models"
+)
+
+// SecurityEventNewDevice is raised when an account logs in from a device it has not used before
+const SecurityEventNewDevice = "new_device_login"
+
+// SecurityEvent is something the account owner should hear about
+type SecurityEvent struct {
+	Type       string
+	UserID     string
+	Session    *models.Session
+	OccurredAt time.Time
+}
+
+// SecurityNotifier delivers security events. Delivery failures are the notifier's to report;
+// they never fail the action that raised the event.
+type SecurityNotifier interface {
+	Notify(ctx context.Context, event SecurityEvent) error
+}
+
+type mailSecurityNotifier struct {
+	userRepo repositories.UserRepository
+	mailer   mail.Mailer
+}
+
+// NewMailSecurityNotifier writes each event to the audit log and emails the account owner
+func NewMailSecurityNotifier(userRepo repositories.UserRepository, mailer mail.Mailer) SecurityNotifier {
+	return &mailSecurityNotifier{userRepo: userRepo, mailer: mailer}
+}
+
+func (n *mailSecurityNotifier) Notify(ctx context.Context, event SecurityEvent) error {
+	log.Printf("AUDIT security event: %s for user %s (session %s, ip %s)", event.Type, event.UserID, event.Session.ID, event.Session.IPAddress)
+
+	if event.Type != SecurityEventNewDevice {
+		return nil
+	}
+	user, err := n.userRepo.GetUserByID(ctx, event.UserID)
+	if err != nil {
+		return err
+	}
+
+	device := event.Session.DeviceName
+	if device == "" {
+		device = event.Session.UserAgent
+	}
+	if device == "" {
+		device = "an unknown device"
+	}
+	return n.mailer.Send(ctx, mail.Message{
+		To:      user.Email,
+		Subject: "New sign-in to your account",
+		Body: fmt.Sprintf("Hi %s,\n\nYour account was just signed in to from %s (IP address %s) at %s.\n\nIf this was you, there is nothing to do. If not, sign that session out from your account's device list and change your password.\n",
+			user.Name, device, event.Session.IPAddress, event.OccurredAt.UTC().Format(time.RFC1123)),
+	})
+}
@@ -0,0 +1,169 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"yoked_backend/internal/db/repositories"
+	"yoked_backend/internal/models"
+)
+
+func (f *fakeTokenRepo) CreateSession(ctx context.Context, session *models.Session) error {
+	session.ID = fmt.Sprintf("session-%d", len(f.sessions)+1)
+	session.CreatedAt, session.LastSeenAt = time.Now(), time.Now()
+	stored := *session
+	f.sessions = append(f.sessions, &stored)
+	return nil
+}
+
+func (f *fakeTokenRepo) TouchSession(ctx context.Context, id, ipAddress, userAgent string) error {
+	for _, session := range f.sessions {
+		if session.ID == id {
+			session.LastSeenAt, session.IPAddress, session.UserAgent = time.Now(), ipAddress, userAgent
+		}
+	}
+	return nil
+}
+
+func (f *fakeTokenRepo) IsSessionActive(ctx context.Context, id string) (bool, error) {
+	f.sessionLookups++
+	return f.live(id), nil
+}
+
+// live reports whether the session still has a token that can be refreshed
+func (f *fakeTokenRepo) live(id string) bool {
+	live := false
+	f.each(func(t *models.RefreshToken) bool { return t.FamilyID == id }, func(t *models.RefreshToken) {
+		live = live || (t.RotatedAt == nil && t.RevokedAt == nil)
+	})
+	return live
+}
+
+func (f *fakeTokenRepo) GetUserSessions(ctx context.Context, userID string) ([]*models.Session, error) {
+	var sessions []*models.Session
+	for _, session := range f.sessions {
+		if session.UserID == userID && f.live(session.ID) {
+			copied := *session
+			sessions = append(sessions, &copied)
+		}
+	}
+	return sessions, nil
+}
+
+func (f *fakeTokenRepo) CountUserSessions(ctx context.Context, userID, deviceName, userAgent string) (int, int, error) {
+	total, sameDevice := 0, 0
+	for _, session := range f.sessions {
+		if session.UserID == userID {
+			total++
+			if session.DeviceName == deviceName && session.UserAgent == userAgent {
+				sameDevice++
+			}
+		}
+	}
+	return total, sameDevice, nil
+}
+
+func (f *fakeTokenRepo) RevokeSession(ctx context.Context, userID, id string) error {
+	revoked := false
+	f.each(func(t *models.RefreshToken) bool {
+		return t.FamilyID == id && t.UserID == userID && t.RevokedAt == nil
+	}, func(t *models.RefreshToken) {
+		revoke(t)
+		revoked = true
+	})
+	if !revoked {
+		return repositories.ErrNotFound
+	}
+	return nil
+}
+
+// recordingNotifier keeps security events instead of delivering them
+type recordingNotifier struct {
+	events []SecurityEvent
+}
+
+func (n *recordingNotifier) Notify(ctx context.Context, event SecurityEvent) error {
+	n.events = append(n.events, event)
+	return nil
+}
+
+func TestSessionsRecordDevices(t *testing.T) {
+	ctx := context.Background()
+	svc, tokens := newTestAuthService()
+
+	issued, err := svc.IssueRefreshToken(ctx, "u1", testDevice)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sessions, _ := svc.ListSessions(ctx, "u1")
+	if len(sessions) != 1 || sessions[0].ID != issued.FamilyID || sessions[0].DeviceName != "Pixel" || sessions[0].IPAddress != "203.0.113.7" {
+		t.Fatalf("unexpected sessions %+v", sessions)
+	}
+
+	// Refreshing from a new address moves the session there
+	moved := testDevice
+	moved.IPAddress = "198.51.100.2"
+	if _, _, err := svc.RotateRefreshToken(ctx, issued.Token, moved); err != nil {
+		t.Fatal(err)
+	}
+	if tokens.sessions[0].IPAddress != "198.51.100.2" {
+		t.Errorf("session not touched on refresh: %+v", tokens.sessions[0])
+	}
+	if sessions, _ := svc.ListSessions(ctx, "u1"); len(sessions) != 1 {
+		t.Errorf("rotation should keep one session, got %d", len(sessions))
+	}
+}
+
+func TestRevokeSession(t *testing.T) {
+	ctx := context.Background()
+	svc, _ := newTestAuthService()
+	phone, _ := svc.IssueRefreshToken(ctx, "u1", testDevice)
+	laptop, _ := svc.IssueRefreshToken(ctx, "u1", DeviceInfo{Name: "MacBook", UserAgent: "Mozilla/5.0"})
+
+	if err := svc.RevokeSession(ctx, "someone-else", phone.FamilyID); !errors.Is(err, repositories.ErrNotFound) {
+		t.Errorf("another user's session: got %v", err)
+	}
+	if err := svc.RevokeSession(ctx, "u1", phone.FamilyID); err != nil {
+		t.Fatalf("revoke: %v", err)
+	}
+	if _, _, err := svc.RotateRefreshToken(ctx, phone.Token, testDevice); !errors.Is(err, ErrInvalidRefreshToken) {
+		t.Errorf("revoked session refreshed: %v", err)
+	}
+	if _, _, err := svc.RotateRefreshToken(ctx, laptop.Token, testDevice); err != nil {
+		t.Errorf("other session affected: %v", err)
+	}
+	if sessions, _ := svc.ListSessions(ctx, "u1"); len(sessions) != 1 || sessions[0].DeviceName != "MacBook" {
+		t.Errorf("unexpected sessions after revoke: %+v", sessions)
+	}
+	if revoked, _ := svc.sessions.SessionRevoked(ctx, phone.FamilyID); !revoked {
+		t.Error("access tokens of the revoked session should be refused")
+	}
+	if revoked, _ := svc.sessions.SessionRevoked(ctx, laptop.FamilyID); revoked {
+		t.Error("access tokens of the other session should still be accepted")
+	}
+}
+
+func TestNewDeviceNotification(t *testing.T) {
+	ctx := context.Background()
+	svc, _ := newTestAuthService()
+	notifier := svc.notifier.(*recordingNotifier)
+
+	// Neither the first login nor a repeat from the same device is news
+	svc.IssueRefreshToken(ctx, "u1", testDevice)
+	svc.IssueRefreshToken(ctx, "u1", testDevice)
+	if len(notifier.events) != 0 {
+		t.Fatalf("unexpected events %+v", notifier.events)
+	}
+
+	svc.IssueRefreshToken(ctx, "u1", DeviceInfo{Name: "Unknown tablet", UserAgent: "curl/8.0", IPAddress: "192.0.2.1"})
+	if len(notifier.events) != 1 {
+		t.Fatalf("got %d events, want 1", len(notifier.events))
+	}
+	event := notifier.events[0]
+	if event.Type != SecurityEventNewDevice || event.UserID != "u1" || event.Session.IPAddress != "192.0.2.1" {
+		t.Errorf("unexpected event %+v", event)
+	}
+}
@@ -0,0 +1,149 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"yoked_backend/internal/db/repositories"
+	"yoked_backend/internal/models"
+)
+
+type StatsService interface {
+	GetUserStats(ctx context.Context, userID string) (*models.UserStats, error)
+	RecomputeUserStats(ctx context.Context, userID string) (*models.UserStats, error)
+	RecordCompletedSession(ctx context.Context, userID string, completed *CompletedSession) error
+}
+
+type statsService struct {
+	userRepo    repositories.UserRepository
+	programRepo repositories.ProgramRepository
+}
+
+func NewStatsService(userRepo repositories.UserRepository, programRepo repositories.ProgramRepository) StatsService {
+	return &statsService{userRepo: userRepo, programRepo: programRepo}
+}
+
+// CompletedSession summarises a finished session for incremental stats updates
+type CompletedSession struct {
+	ExerciseCount int
+	Tonnage       float64
+	CompletedAt   time.Time
+}
+
+// sessionTonnage sums load x reps in kilograms across every set in the logs
+func sessionTonnage(logs []*models.WorkoutExerciseLog) float64 {
+	total := 0.0
+	for _, log := range logs {
+		for _, set := range log.Sets {
+			total += set.WeightKg() * float64(set.Reps)
+		}
+	}
+	return total
+}
+
+// trainingCalendar returns the user's timezone and the weekdays their active program trains on
+func (s *statsService) trainingCalendar(ctx context.Context, userID string) (TrainingSchedule, *time.Location, error) {
+	user, err := s.userRepo.GetUserByID(ctx, userID)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	userProgram, err := s.programRepo.GetUserActiveProgram(ctx, userID)
+	if errors.Is(err, repositories.ErrNotFound) {
+		return TrainingSchedule{}, user.Location(), nil
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+
+	workouts, err := s.programRepo.GetProgramWorkouts(ctx, userProgram.ProgramVersionID)
+	if err != nil {
+		return nil, nil, err
+	}
+	return scheduleFromWorkouts(workouts), user.Location(), nil
+}
+
+func (s *statsService) GetUserStats(ctx context.Context, userID string) (*models.UserStats, error) {
+	stats, err := s.userRepo.GetUserStats(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	if stats.LastWorkoutDate == nil {
+		return stats, nil
+	}
+
+	// A stored streak goes stale once a scheduled day is missed, so re-check it against today
+	schedule, loc, err := s.trainingCalendar(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	if missedScheduledDay(*stats.LastWorkoutDate, time.Now(), schedule, loc) {
+		stats.CurrentStreak = 0
+	}
+	return stats, nil
+}
+
+// RecomputeUserStats rebuilds a user's stats from scratch using their workout logs
+func (s *statsService) RecomputeUserStats(ctx context.Context, userID string) (*models.UserStats, error) {
+	totals, err := s.userRepo.GetWorkoutTotals(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	dates, err := s.userRepo.GetCompletedWorkoutDates(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	schedule, loc, err := s.trainingCalendar(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	current, longest := computeStreaks(dates, schedule, time.Now(), loc)
+
+	stats := &models.UserStats{
+		UserID:            userID,
+		CompletedWorkouts: totals.CompletedWorkouts,
+		CompletedSessions: totals.CompletedSessions,
+		TotalWeightLifted: totals.TotalWeightLifted,
+		CurrentStreak:     current,
+		LongestStreak:     longest,
+		LastWorkoutDate:   totals.LastWorkoutDate,
+	}
+
+	if err := s.userRepo.SaveUserStats(ctx, stats); err != nil {
+		return nil, fmt.Errorf("failed to recompute user stats: %w", err)
+	}
+	return stats, nil
+}
+
+// RecordCompletedSession folds a single finished session into the stored stats. It must run
+// inside a transaction: the stats row stays locked until commit so concurrent completions
+// apply one after the other.
+func (s *statsService) RecordCompletedSession(ctx context.Context, userID string, completed *CompletedSession) error {
+	stats, err := s.userRepo.LockUserStats(ctx, userID)
+	if err != nil {
+		return err
+	}
+
+	schedule, loc, err := s.trainingCalendar(ctx, userID)
+	if err != nil {
+		return err
+	}
+
+	stats.UserID = userID
+	stats.CompletedSessions++
+	stats.CompletedWorkouts += completed.ExerciseCount
+	stats.TotalWeightLifted += completed.Tonnage
+	stats.CurrentStreak = advanceStreak(stats.CurrentStreak, stats.LastWorkoutDate, completed.CompletedAt, schedule, loc)
+	if stats.CurrentStreak > stats.LongestStreak {
+		stats.LongestStreak = stats.CurrentStreak
+	}
+
+	if stats.LastWorkoutDate == nil || completed.CompletedAt.After(*stats.LastWorkoutDate) {
+		stats.LastWorkoutDate = &completed.CompletedAt
+	}
+
+	return s.userRepo.SaveUserStats(ctx, stats)
+}
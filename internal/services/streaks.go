@@ -0,0 +1,69 @@
+package services
+
+import (
+	"time"
+)
+
+// computeStreaks walks the user's local calendar from their first session to today.
+// A day with a session extends the streak, an unscheduled rest day is skipped, and a
+// scheduled day without a session breaks it. Today never breaks the streak since the
+// user may still train.
+func computeStreaks(dates []time.Time, schedule TrainingSchedule, now time.Time, loc *time.Location) (current, longest int) {
+	if len(dates) == 0 {
+		return 0, 0
+	}
+
+	trained := make(map[string]bool, len(dates))
+	first := localDay(dates[0], loc)
+	for _, date := range dates {
+		day := localDay(date, loc)
+		trained[day.Format(time.DateOnly)] = true
+		if day.Before(first) {
+			first = day
+		}
+	}
+
+	today := localDay(now, loc)
+	run := 0
+	for day := first; !day.After(today); day = day.AddDate(0, 0, 1) {
+		switch {
+		case trained[day.Format(time.DateOnly)]:
+			run++
+			if run > longest {
+				longest = run
+			}
+		case schedule.isScheduled(day) && day.Before(today):
+			run = 0
+		}
+	}
+
+	return run, longest
+}
+
+// missedScheduledDay reports whether a scheduled day passed without a session strictly
+// between the last session and until
+func missedScheduledDay(lastWorkout, until time.Time, schedule TrainingSchedule, loc *time.Location) bool {
+	end := localDay(until, loc)
+	for day := localDay(lastWorkout, loc).AddDate(0, 0, 1); day.Before(end); day = day.AddDate(0, 0, 1) {
+		if schedule.isScheduled(day) {
+			return true
+		}
+	}
+	return false
+}
+
+// advanceStreak extends or restarts a streak with a newly completed session
+func advanceStreak(current int, lastWorkout *time.Time, completedAt time.Time, schedule TrainingSchedule, loc *time.Location) int {
+	if lastWorkout == nil || current == 0 {
+		return 1
+	}
+
+	switch {
+	case !localDay(completedAt, loc).After(localDay(*lastWorkout, loc)):
+		return current
+	case missedScheduledDay(*lastWorkout, completedAt, schedule, loc):
+		return 1
+	default:
+		return current + 1
+	}
+}
@@ -0,0 +1,126 @@
+package services
+
+import (
+	"testing"
+	"time"
+)
+
+func mustLocation(t *testing.T, name string) *time.Location {
+	t.Helper()
+	loc, err := time.LoadLocation(name)
+	if err != nil {
+		t.Skipf("timezone data unavailable: %v", err)
+	}
+	return loc
+}
+
+func TestComputeStreaks(t *testing.T) {
+	utc := time.UTC
+	day := func(d int) time.Time { return time.Date(2024, time.March, d, 18, 0, 0, 0, utc) }
+	// Mon/Wed/Fri; March 4 2024 is a Monday
+	mwf := TrainingSchedule{time.Monday: true, time.Wednesday: true, time.Friday: true}
+
+	tests := []struct {
+		name        string
+		dates       []time.Time
+		schedule    TrainingSchedule
+		now         time.Time
+		wantCurrent int
+		wantLongest int
+	}{
+		{name: "no sessions", now: day(10), wantCurrent: 0, wantLongest: 0},
+		{
+			name:        "rest days do not break the streak",
+			dates:       []time.Time{day(4), day(6), day(8), day(11)},
+			schedule:    mwf,
+			now:         day(11),
+			wantCurrent: 4,
+			wantLongest: 4,
+		},
+		{
+			name:        "missed scheduled day breaks the streak",
+			dates:       []time.Time{day(4), day(6), day(11), day(13)},
+			schedule:    mwf,
+			now:         day(13),
+			wantCurrent: 2,
+			wantLongest: 2,
+		},
+		{
+			name:        "today is still open",
+			dates:       []time.Time{day(4), day(6), day(8)},
+			schedule:    mwf,
+			now:         day(11),
+			wantCurrent: 3,
+			wantLongest: 3,
+		},
+		{
+			name:        "no schedule treats every day as a training day",
+			dates:       []time.Time{day(4), day(5), day(7)},
+			now:         day(7),
+			wantCurrent: 1,
+			wantLongest: 2,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			current, longest := computeStreaks(tt.dates, tt.schedule, tt.now, utc)
+			if current != tt.wantCurrent || longest != tt.wantLongest {
+				t.Errorf("got current %d longest %d, want current %d longest %d", current, longest, tt.wantCurrent, tt.wantLongest)
+			}
+		})
+	}
+}
+
+func TestComputeStreaksNearMidnight(t *testing.T) {
+	tokyo := mustLocation(t, "Asia/Tokyo")
+	newYork := mustLocation(t, "America/New_York")
+
+	// 23:30 in Tokyo on consecutive days is 14:30 UTC, one session per local day
+	tokyoDates := []time.Time{
+		time.Date(2024, time.March, 4, 23, 30, 0, 0, tokyo),
+		time.Date(2024, time.March, 5, 23, 30, 0, 0, tokyo),
+	}
+	if current, _ := computeStreaks(tokyoDates, nil, tokyoDates[1], tokyo); current != 2 {
+		t.Errorf("tokyo: got current %d, want 2", current)
+	}
+
+	// 00:30 UTC is still the previous evening in New York, so these two sessions land
+	// on the same local day and must not count twice
+	nyDates := []time.Time{
+		time.Date(2024, time.March, 5, 18, 0, 0, 0, newYork),
+		time.Date(2024, time.March, 6, 0, 30, 0, 0, time.UTC),
+	}
+	if current, longest := computeStreaks(nyDates, nil, nyDates[1], newYork); current != 1 || longest != 1 {
+		t.Errorf("new york: got current %d longest %d, want 1 and 1", current, longest)
+	}
+	// In UTC the same sessions fall on two calendar days
+	if current, _ := computeStreaks(nyDates, nil, nyDates[1], time.UTC); current != 2 {
+		t.Errorf("utc: got current %d, want 2", current)
+	}
+}
+
+func TestAdvanceStreak(t *testing.T) {
+	loc := mustLocation(t, "America/Los_Angeles")
+	at := func(d, h int) time.Time { return time.Date(2024, time.March, d, h, 0, 0, 0, loc) }
+	mwf := TrainingSchedule{time.Monday: true, time.Wednesday: true, time.Friday: true}
+	last := at(8, 22) // Friday night
+
+	tests := []struct {
+		name      string
+		completed time.Time
+		want      int
+	}{
+		{name: "same local day keeps the streak", completed: at(8, 23), want: 5},
+		{name: "next scheduled day after the weekend extends", completed: at(11, 7), want: 6},
+		{name: "skipping monday restarts", completed: at(13, 7), want: 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := advanceStreak(5, &last, tt.completed, mwf, loc); got != tt.want {
+				t.Errorf("got %d, want %d", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,281 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+
+	"yoked_backend/internal/db/repositories"
+	"yoked_backend/internal/models"
+)
+
+const (
+	// DefaultSubstituteLimit is how many substitutes are suggested when no limit is asked for
+	DefaultSubstituteLimit = 10
+	MaxSubstituteLimit     = 50
+)
+
+// How much each kind of similarity counts towards a substitute's score; they add up to 1
+const (
+	movementPatternWeight = 0.45
+	muscleOverlapWeight   = 0.35
+	equipmentWeight       = 0.2
+)
+
+// SubstitutionService finds alternatives to an exercise and keeps users' standing swaps.
+// An override replaces an exercise wherever the user's program prescribes it.
+type SubstitutionService interface {
+	// SuggestSubstitutes ranks alternatives to the exercise by movement pattern, muscle overlap
+	// and whether the user has the equipment
+	SuggestSubstitutes(ctx context.Context, userID string, exerciseID, limit int) ([]*models.SubstituteSuggestion, error)
+	GetOverrides(ctx context.Context, userID string) ([]*models.ExerciseOverride, error)
+	// SetOverride creates the user's override of the exercise in the program, or changes its
+	// substitute when there already is one. The program must be published and prescribe the
+	// exercise in the version the user trains or in its latest version.
+	SetOverride(ctx context.Context, override *models.ExerciseOverride) (*models.ExerciseOverride, error)
+	DeleteOverride(ctx context.Context, userID string, id int) error
+	// ProgramSubstitutes maps each exercise the user swapped in the program to its substitute,
+	// along with the duplicates merged into it
+	ProgramSubstitutes(ctx context.Context, userID string, programID int) (map[int]int, error)
+}
+
+type substitutionService struct {
+	exerciseRepo repositories.ExerciseRepository
+	overrideRepo repositories.ExerciseOverrideRepository
+	programRepo  repositories.ProgramRepository
+	userRepo     repositories.UserRepository
+}
+
+func NewSubstitutionService(exerciseRepo repositories.ExerciseRepository, overrideRepo repositories.ExerciseOverrideRepository, programRepo repositories.ProgramRepository, userRepo repositories.UserRepository) SubstitutionService {
+	return &substitutionService{
+		exerciseRepo: exerciseRepo,
+		overrideRepo: overrideRepo,
+		programRepo:  programRepo,
+		userRepo:     userRepo,
+	}
+}
+
+func (s *substitutionService) SuggestSubstitutes(ctx context.Context, userID string, exerciseID, limit int) ([]*models.SubstituteSuggestion, error) {
+	switch {
+	case limit == 0:
+		limit = DefaultSubstituteLimit
+	case limit < 0 || limit > MaxSubstituteLimit:
+		return nil, invalidInput("limit must be from 1 to %d", MaxSubstituteLimit)
+	}
+
+	exercise, err := s.exerciseRepo.GetExercise(ctx, exerciseID)
+	if err != nil {
+		return nil, err
+	}
+	prefs, err := s.userRepo.GetUserPreferences(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	candidates, err := s.exerciseRepo.ListSubstituteCandidates(ctx, exercise)
+	if err != nil {
+		return nil, err
+	}
+
+	suggestions := make([]*models.SubstituteSuggestion, 0, len(candidates))
+	for _, candidate := range candidates {
+		suggestions = append(suggestions, scoreSubstitute(exercise, candidate, prefs.Equipment))
+	}
+	slices.SortStableFunc(suggestions, func(a, b *models.SubstituteSuggestion) int {
+		if a.Score != b.Score {
+			if a.Score > b.Score {
+				return -1
+			}
+			return 1
+		}
+		return strings.Compare(a.Exercise.Name, b.Exercise.Name)
+	})
+	if len(suggestions) > limit {
+		suggestions = suggestions[:limit]
+	}
+	return suggestions, nil
+}
+
+// scoreSubstitute rates how well candidate stands in for exercise given the user's equipment
+func scoreSubstitute(exercise, candidate *models.Exercise, equipment []string) *models.SubstituteSuggestion {
+	suggestion := &models.SubstituteSuggestion{
+		Exercise:            candidate,
+		SameMovementPattern: exercise.MovementPattern != "" && candidate.MovementPattern == exercise.MovementPattern,
+		MuscleOverlap:       muscleOverlap(exercise, candidate),
+		EquipmentAvailable:  equipmentAvailable(candidate.Equipment, equipment),
+	}
+	if suggestion.SameMovementPattern {
+		suggestion.Score += movementPatternWeight
+	}
+	suggestion.Score += muscleOverlapWeight * suggestion.MuscleOverlap
+	if suggestion.EquipmentAvailable {
+		suggestion.Score += equipmentWeight
+	}
+	return suggestion
+}
+
+// muscleOverlap weighs a shared primary muscle group as much as the overlap of all muscle groups
+func muscleOverlap(a, b *models.Exercise) float64 {
+	musclesA, musclesB := exerciseMuscles(a), exerciseMuscles(b)
+	if len(musclesA) == 0 || len(musclesB) == 0 {
+		return 0
+	}
+
+	primary := 0.0
+	switch {
+	case a.PrimaryMuscleGroup == "" || b.PrimaryMuscleGroup == "":
+	case a.PrimaryMuscleGroup == b.PrimaryMuscleGroup:
+		primary = 1
+	case musclesB[a.PrimaryMuscleGroup] || musclesA[b.PrimaryMuscleGroup]:
+		primary = 0.5
+	}
+
+	shared := 0
+	for muscle := range musclesA {
+		if musclesB[muscle] {
+			shared++
+		}
+	}
+	union := len(musclesA) + len(musclesB) - shared
+	return 0.5*primary + 0.5*float64(shared)/float64(union)
+}
+
+func exerciseMuscles(exercise *models.Exercise) map[string]bool {
+	muscles := make(map[string]bool, len(exercise.SecondaryMuscleGroups)+1)
+	if exercise.PrimaryMuscleGroup != "" {
+		muscles[exercise.PrimaryMuscleGroup] = true
+	}
+	for _, muscle := range exercise.SecondaryMuscleGroups {
+		muscles[muscle] = true
+	}
+	return muscles
+}
+
+// equipmentAvailable treats an empty equipment list as a fully equipped gym, and exercises
+// without equipment as doable anywhere
+func equipmentAvailable(needed string, available []string) bool {
+	if len(available) == 0 || needed == "" || needed == models.EquipmentBodyweight {
+		return true
+	}
+	return slices.Contains(available, needed)
+}
+
+func (s *substitutionService) GetOverrides(ctx context.Context, userID string) ([]*models.ExerciseOverride, error) {
+	return s.overrideRepo.GetUserOverrides(ctx, userID)
+}
+
+func (s *substitutionService) SetOverride(ctx context.Context, override *models.ExerciseOverride) (*models.ExerciseOverride, error) {
+	if override.ExerciseID == override.SubstituteExerciseID {
+		return nil, invalidInput("an exercise cannot substitute itself")
+	}
+	program, err := s.programRepo.GetProgramByID(ctx, override.ProgramID)
+	if err != nil {
+		return nil, fmt.Errorf("program %d: %w", override.ProgramID, err)
+	}
+	// Unpublished programs are invisible to users
+	if program.PublishedAt == nil {
+		return nil, fmt.Errorf("program %d: %w", override.ProgramID, repositories.ErrNotFound)
+	}
+	// Published versions may still prescribe a merged exercise, but it cannot be swapped in.
+	// Its swap is kept against the exercise it was merged into, like swaps moved by the merge.
+	exercise, err := s.exerciseRepo.GetExercise(ctx, override.ExerciseID)
+	if err != nil {
+		return nil, fmt.Errorf("exercise %d: %w", override.ExerciseID, err)
+	}
+	substitute, err := s.exerciseRepo.GetExercise(ctx, override.SubstituteExerciseID)
+	if err != nil {
+		return nil, fmt.Errorf("exercise %d: %w", override.SubstituteExerciseID, err)
+	}
+	if substitute.MergedIntoID != nil {
+		return nil, invalidInput("exercise %d was merged into exercise %d", substitute.ID, *substitute.MergedIntoID)
+	}
+
+	prescribed, err := s.prescribedExercises(ctx, override.UserID, override.ProgramID)
+	if err != nil {
+		return nil, err
+	}
+	if !prescribed[override.ExerciseID] {
+		return nil, invalidInput("program %d does not prescribe exercise %d", override.ProgramID, override.ExerciseID)
+	}
+
+	saved := *override
+	if exercise.MergedIntoID != nil {
+		saved.ExerciseID = *exercise.MergedIntoID
+	}
+	if saved.ExerciseID == saved.SubstituteExerciseID {
+		return nil, invalidInput("exercise %d was merged into exercise %d", exercise.ID, saved.ExerciseID)
+	}
+	if err := s.overrideRepo.UpsertOverride(ctx, &saved); err != nil {
+		return nil, err
+	}
+	return &saved, nil
+}
+
+// prescribedExercises collects the exercises of the program's latest published version and,
+// when the user trains the program, of the version they are pinned to
+func (s *substitutionService) prescribedExercises(ctx context.Context, userID string, programID int) (map[int]bool, error) {
+	var versionIDs []int
+	latest, err := s.programRepo.GetLatestProgramVersion(ctx, programID)
+	if err != nil && !errors.Is(err, repositories.ErrNotFound) {
+		return nil, err
+	}
+	if latest != nil {
+		versionIDs = append(versionIDs, latest.ID)
+	}
+	enrolled, err := s.programRepo.GetUserActiveProgram(ctx, userID)
+	if err != nil && !errors.Is(err, repositories.ErrNotFound) {
+		return nil, err
+	}
+	if enrolled != nil && enrolled.ProgramID == programID && (latest == nil || enrolled.ProgramVersionID != latest.ID) {
+		versionIDs = append(versionIDs, enrolled.ProgramVersionID)
+	}
+
+	prescribed := make(map[int]bool)
+	for _, versionID := range versionIDs {
+		workouts, err := s.programRepo.GetProgramWorkouts(ctx, versionID)
+		if err != nil {
+			return nil, err
+		}
+		for _, workout := range workouts {
+			prescriptions, err := s.programRepo.GetProgramWorkoutExercises(ctx, workout.ID)
+			if err != nil {
+				return nil, err
+			}
+			for _, prescription := range prescriptions {
+				prescribed[prescription.ExerciseID] = true
+			}
+		}
+	}
+	return prescribed, nil
+}
+
+func (s *substitutionService) DeleteOverride(ctx context.Context, userID string, id int) error {
+	return s.overrideRepo.DeleteOverride(ctx, userID, id)
+}
+
+func (s *substitutionService) ProgramSubstitutes(ctx context.Context, userID string, programID int) (map[int]int, error) {
+	overrides, err := s.overrideRepo.GetProgramOverrides(ctx, userID, programID)
+	if err != nil {
+		return nil, err
+	}
+	substitutes := make(map[int]int, len(overrides))
+	swapped := make([]int, 0, len(overrides))
+	for _, override := range overrides {
+		substitutes[override.ExerciseID] = override.SubstituteExerciseID
+		swapped = append(swapped, override.ExerciseID)
+	}
+	if len(swapped) == 0 {
+		return substitutes, nil
+	}
+
+	// Published versions still prescribe the duplicates merged into a swapped exercise
+	merged, err := s.exerciseRepo.GetMergedExercises(ctx, swapped)
+	if err != nil {
+		return nil, err
+	}
+	for id, into := range merged {
+		substitutes[id] = substitutes[into]
+	}
+	return substitutes, nil
+}
@@ -0,0 +1,224 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"yoked_backend/internal/db/repositories"
+	"yoked_backend/internal/models"
+)
+
+// fakePreferencesRepo serves a single user's preferences
+type fakePreferencesRepo struct {
+	repositories.UserRepository
+	prefs *models.UserPreferences
+}
+
+func (f *fakePreferencesRepo) GetUserPreferences(ctx context.Context, userID string) (*models.UserPreferences, error) {
+	return f.prefs, nil
+}
+
+// fakeOverrideRepo keeps overrides in memory, one per user, program and exercise
+type fakeOverrideRepo struct {
+	overrides []*models.ExerciseOverride
+}
+
+func (f *fakeOverrideRepo) GetUserOverrides(ctx context.Context, userID string) ([]*models.ExerciseOverride, error) {
+	overrides := []*models.ExerciseOverride{}
+	for _, override := range f.overrides {
+		if override.UserID == userID {
+			overrides = append(overrides, override)
+		}
+	}
+	return overrides, nil
+}
+
+func (f *fakeOverrideRepo) GetProgramOverrides(ctx context.Context, userID string, programID int) ([]*models.ExerciseOverride, error) {
+	overrides := []*models.ExerciseOverride{}
+	for _, override := range f.overrides {
+		if override.UserID == userID && override.ProgramID == programID {
+			overrides = append(overrides, override)
+		}
+	}
+	return overrides, nil
+}
+
+func (f *fakeOverrideRepo) UpsertOverride(ctx context.Context, override *models.ExerciseOverride) error {
+	for _, existing := range f.overrides {
+		if existing.UserID == override.UserID && existing.ProgramID == override.ProgramID && existing.ExerciseID == override.ExerciseID {
+			existing.SubstituteExerciseID = override.SubstituteExerciseID
+			*override = *existing
+			return nil
+		}
+	}
+	override.ID = len(f.overrides) + 1
+	copied := *override
+	f.overrides = append(f.overrides, &copied)
+	return nil
+}
+
+func (f *fakeOverrideRepo) DeleteOverride(ctx context.Context, userID string, id int) error {
+	for i, override := range f.overrides {
+		if override.ID == id && override.UserID == userID {
+			f.overrides = append(f.overrides[:i], f.overrides[i+1:]...)
+			return nil
+		}
+	}
+	return repositories.ErrNotFound
+}
+
+func substitutionLibrary() *fakeExerciseRepo {
+	return newFakeExerciseRepo(
+		&models.Exercise{Name: "Bench Press", PrimaryMuscleGroup: "chest", SecondaryMuscleGroups: []string{"triceps", "shoulders"},
+			Equipment: "barbell", MovementPattern: models.MovementHorizontalPush},
+		&models.Exercise{Name: "Dumbbell Press", PrimaryMuscleGroup: "chest", SecondaryMuscleGroups: []string{"triceps", "shoulders"},
+			Equipment: "dumbbell", MovementPattern: models.MovementHorizontalPush},
+		&models.Exercise{Name: "Push-up", PrimaryMuscleGroup: "chest", SecondaryMuscleGroups: []string{"triceps"},
+			Equipment: models.EquipmentBodyweight, MovementPattern: models.MovementHorizontalPush},
+		&models.Exercise{Name: "Cable Fly", PrimaryMuscleGroup: "chest", Equipment: "cable"},
+		&models.Exercise{Name: "Triceps Pushdown", PrimaryMuscleGroup: "triceps", Equipment: "cable"},
+		&models.Exercise{Name: "Squat", PrimaryMuscleGroup: "quads", Equipment: "barbell", MovementPattern: models.MovementSquat},
+	)
+}
+
+func TestSuggestSubstitutesRanking(t *testing.T) {
+	ctx := context.Background()
+	prefs := &fakePreferencesRepo{prefs: &models.UserPreferences{Equipment: []string{"dumbbell"}}}
+	substitutions := NewSubstitutionService(substitutionLibrary(), &fakeOverrideRepo{}, &fakeProgramRepo{}, prefs)
+
+	suggestions, err := substitutions.SuggestSubstitutes(ctx, "user-1", 1, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var names []string
+	for _, suggestion := range suggestions {
+		names = append(names, suggestion.Exercise.Name)
+	}
+	want := []string{"Dumbbell Press", "Push-up", "Cable Fly", "Triceps Pushdown"}
+	if len(names) != len(want) {
+		t.Fatalf("got %q, want %q", names, want)
+	}
+	for i := range want {
+		if names[i] != want[i] {
+			t.Fatalf("got %q, want %q", names, want)
+		}
+	}
+	if best := suggestions[0]; !best.SameMovementPattern || !best.EquipmentAvailable || best.MuscleOverlap != 1 {
+		t.Errorf("unexpected best match %+v", best)
+	}
+	if suggestions[2].EquipmentAvailable {
+		t.Errorf("cables are not in the user's gym")
+	}
+
+	// Without an equipment list every gym is assumed fully equipped
+	prefs.prefs.Equipment = nil
+	suggestions, err = substitutions.SuggestSubstitutes(ctx, "user-1", 1, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(suggestions) != 2 || !suggestions[1].EquipmentAvailable {
+		t.Errorf("unexpected suggestions %+v", suggestions)
+	}
+
+	if _, err := substitutions.SuggestSubstitutes(ctx, "user-1", 1, MaxSubstituteLimit+1); !errors.Is(err, ErrInvalidInput) {
+		t.Errorf("limit too large: got %v", err)
+	}
+	if _, err := substitutions.SuggestSubstitutes(ctx, "user-1", 99, 0); !errors.Is(err, repositories.ErrNotFound) {
+		t.Errorf("missing exercise: got %v", err)
+	}
+}
+
+func TestSetOverride(t *testing.T) {
+	ctx := context.Background()
+	library := substitutionLibrary()
+	merged := 2
+	library.exercises[5].MergedIntoID = &merged
+	overrides := &fakeOverrideRepo{}
+	// user-1 trains version 1 of program 7; version 2 replaced its pushdowns with push-ups.
+	// Program 8 is not published.
+	published := time.Now()
+	programs := &fakeProgramRepo{
+		programs: map[int]*models.Program{7: {ID: 7, PublishedAt: &published}, 8: {ID: 8}},
+		versions: map[int]*models.ProgramVersion{
+			70: {ID: 70, ProgramID: 7, Version: 1, PublishedAt: &published},
+			71: {ID: 71, ProgramID: 7, Version: 2, PublishedAt: &published},
+		},
+		workouts: map[int]*models.ProgramWorkout{
+			700: {ID: 700, ProgramID: 7, ProgramVersionID: 70},
+			710: {ID: 710, ProgramID: 7, ProgramVersionID: 71},
+		},
+		prescriptions: []*models.ProgramWorkoutExercise{
+			{ID: 1, ProgramWorkoutID: 700, ExerciseID: 1},
+			{ID: 2, ProgramWorkoutID: 700, ExerciseID: 5},
+			{ID: 3, ProgramWorkoutID: 710, ExerciseID: 1},
+			{ID: 4, ProgramWorkoutID: 710, ExerciseID: 3},
+		},
+		userPrograms: map[int]*models.UserProgram{1: {ID: 1, UserID: "user-1", ProgramID: 7, ProgramVersionID: 70, IsActive: true}},
+	}
+	substitutions := NewSubstitutionService(library, overrides, programs, &fakePreferencesRepo{})
+
+	saved, err := substitutions.SetOverride(ctx, &models.ExerciseOverride{UserID: "user-1", ProgramID: 7, ExerciseID: 1, SubstituteExerciseID: 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := substitutions.SetOverride(ctx, &models.ExerciseOverride{UserID: "user-1", ProgramID: 7, ExerciseID: 1, SubstituteExerciseID: 3}); err != nil {
+		t.Fatal(err)
+	}
+	substitutes, err := substitutions.ProgramSubstitutes(ctx, "user-1", 7)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(overrides.overrides) != 1 || substitutes[1] != 3 {
+		t.Errorf("override not replaced: %v", substitutes)
+	}
+
+	for name, override := range map[string]*models.ExerciseOverride{
+		"itself":            {UserID: "user-1", ProgramID: 7, ExerciseID: 1, SubstituteExerciseID: 1},
+		"merged substitute": {UserID: "user-1", ProgramID: 7, ExerciseID: 1, SubstituteExerciseID: 5},
+		"not prescribed":    {UserID: "user-1", ProgramID: 7, ExerciseID: 4, SubstituteExerciseID: 2},
+		"another's version": {UserID: "user-2", ProgramID: 7, ExerciseID: 5, SubstituteExerciseID: 4},
+	} {
+		if _, err := substitutions.SetOverride(ctx, override); !errors.Is(err, ErrInvalidInput) {
+			t.Errorf("%s: got %v, want invalid input", name, err)
+		}
+	}
+	for name, override := range map[string]*models.ExerciseOverride{
+		"unpublished program": {UserID: "user-1", ProgramID: 8, ExerciseID: 1, SubstituteExerciseID: 2},
+		"unknown program":     {UserID: "user-1", ProgramID: 9, ExerciseID: 1, SubstituteExerciseID: 2},
+		"unknown substitute":  {UserID: "user-1", ProgramID: 7, ExerciseID: 1, SubstituteExerciseID: 99},
+		"unknown exercise":    {UserID: "user-1", ProgramID: 7, ExerciseID: 99, SubstituteExerciseID: 2},
+	} {
+		if _, err := substitutions.SetOverride(ctx, override); !errors.Is(err, repositories.ErrNotFound) {
+			t.Errorf("%s: got %v, want not found", name, err)
+		}
+	}
+
+	// The latest version's exercises can be swapped before upgrading to it
+	if _, err := substitutions.SetOverride(ctx, &models.ExerciseOverride{UserID: "user-2", ProgramID: 7, ExerciseID: 3, SubstituteExerciseID: 4}); err != nil {
+		t.Fatal(err)
+	}
+
+	// Exercise 5 was merged into 2, so its swap is kept against 2 and covers both
+	if _, err := substitutions.SetOverride(ctx, &models.ExerciseOverride{UserID: "user-1", ProgramID: 7, ExerciseID: 5, SubstituteExerciseID: 4}); err != nil {
+		t.Fatal(err)
+	}
+	substitutes, err = substitutions.ProgramSubstitutes(ctx, "user-1", 7)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(substitutes) != 3 || substitutes[2] != 4 || substitutes[5] != 4 {
+		t.Errorf("merged exercise not swapped with the one it was merged into: %v", substitutes)
+	}
+	if _, err := substitutions.SetOverride(ctx, &models.ExerciseOverride{UserID: "user-1", ProgramID: 7, ExerciseID: 5, SubstituteExerciseID: 2}); !errors.Is(err, ErrInvalidInput) {
+		t.Errorf("swapping a merged exercise for the one it was merged into: got %v", err)
+	}
+
+	if err := substitutions.DeleteOverride(ctx, "user-2", saved.ID); !errors.Is(err, repositories.ErrNotFound) {
+		t.Errorf("deleting another user's override: got %v", err)
+	}
+	if err := substitutions.DeleteOverride(ctx, "user-1", saved.ID); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,48 @@
+package services
+
+import (
+	"context"
+	"time"
+
+	"yoked_backend/internal/db/repositories"
+)
+
+// DefaultTokenVersionCacheTTL bounds how long another instance may keep accepting tokens
+// after a bump; the instance that made the bump forgets its entry straight away
+const DefaultTokenVersionCacheTTL = 30 * time.Second
+
+// TokenVersionStore answers which token version a user's access tokens must carry.
+// AuthMiddleware consults it on every request, so lookups are cached in process.
+type TokenVersionStore interface {
+	CurrentTokenVersion(ctx context.Context, userID string) (int, error)
+	Forget(userID string)
+}
+
+type tokenVersionCache struct {
+	userRepo repositories.UserRepository
+	versions *ttlCache[int]
+}
+
+func NewTokenVersionCache(userRepo repositories.UserRepository, ttl time.Duration) TokenVersionStore {
+	return &tokenVersionCache{userRepo: userRepo, versions: newTTLCache[int](ttl, ttlCacheMaxEntries)}
+}
+
+func (c *tokenVersionCache) CurrentTokenVersion(ctx context.Context, userID string) (int, error) {
+	if version, ok := c.versions.get(userID); ok {
+		return version, nil
+	}
+
+	// Deleted users are not cached, their tokens fail here until they expire
+	version, err := c.userRepo.GetTokenVersion(ctx, userID)
+	if err != nil {
+		return 0, err
+	}
+
+	c.versions.set(userID, version)
+	return version, nil
+}
+
+// Forget drops the cached version so the next request reads the bumped one
+func (c *tokenVersionCache) Forget(userID string) {
+	c.versions.delete(userID)
+}
@@ -0,0 +1,44 @@
+package services
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"yoked_backend/internal/models"
+)
+
+func TestTokenVersionCache(t *testing.T) {
+	ctx := context.Background()
+	users := &fakeUserRepo{users: map[string]*models.User{"u1": {ID: "u1", TokenVersion: 1}}}
+	cache := NewTokenVersionCache(users, time.Minute).(*tokenVersionCache)
+	now := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	cache.versions.now = func() time.Time { return now }
+
+	for i := 0; i < 3; i++ {
+		if version, err := cache.CurrentTokenVersion(ctx, "u1"); err != nil || version != 1 {
+			t.Fatalf("got %d, %v", version, err)
+		}
+	}
+	if users.lookups != 1 {
+		t.Fatalf("expected one lookup while cached, got %d", users.lookups)
+	}
+
+	// A bump made elsewhere is picked up once the entry expires
+	users.users["u1"].TokenVersion = 2
+	now = now.Add(time.Minute)
+	if version, _ := cache.CurrentTokenVersion(ctx, "u1"); version != 2 {
+		t.Errorf("after ttl: got %d, want 2", version)
+	}
+
+	// A local bump is picked up immediately
+	users.users["u1"].TokenVersion = 3
+	cache.Forget("u1")
+	if version, _ := cache.CurrentTokenVersion(ctx, "u1"); version != 3 {
+		t.Errorf("after forget: got %d, want 3", version)
+	}
+
+	if _, err := cache.CurrentTokenVersion(ctx, "deleted"); err == nil {
+		t.Error("expected an error for an unknown user")
+	}
+}
@@ -0,0 +1,53 @@
+package services
+
+import (
+	"net/url"
+	"testing"
+	"time"
+)
+
+// RFC 6238 appendix B vectors for SHA-1, truncated to six digits
+func TestTOTPCodeVectors(t *testing.T) {
+	secret := []byte("12345678901234567890")
+	vectors := map[int64]string{
+		59:          "287082",
+		1111111109:  "081804",
+		1234567890:  "005924",
+		2000000000:  "279037",
+		20000000000: "353130",
+	}
+	for unix, want := range vectors {
+		if got := totpCode(secret, totpStep(time.Unix(unix, 0))); got != want {
+			t.Errorf("at %d: got %s, want %s", unix, got, want)
+		}
+	}
+}
+
+func TestMatchTOTPAllowsOneStepOfDrift(t *testing.T) {
+	secret := []byte("12345678901234567890")
+	now := time.Unix(1234567890, 0)
+	code := totpCode(secret, totpStep(now))
+
+	if step, ok := matchTOTP(secret, code, now.Add(totpPeriod)); !ok || step != totpStep(now) {
+		t.Errorf("one step late: got %d, %v", step, ok)
+	}
+	if _, ok := matchTOTP(secret, code, now.Add(2*totpPeriod)); ok {
+		t.Error("accepted a code two steps old")
+	}
+	if _, ok := matchTOTP(secret, "12345", now); ok {
+		t.Error("accepted a short code")
+	}
+}
+
+func TestTOTPProvisioningURI(t *testing.T) {
+	uri, err := url.Parse(totpProvisioningURI("Yoked", "lifter@example.com", []byte("12345678901234567890")))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if uri.Scheme != "otpauth" || uri.Host != "totp" || uri.Path != "/Yoked:lifter@example.com" {
+		t.Errorf("unexpected uri %s", uri)
+	}
+	if secret := uri.Query().Get("secret"); secret != "GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ" {
+		t.Errorf("secret %s", secret)
+	}
+}
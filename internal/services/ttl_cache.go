@@ -0,0 +1,92 @@
+package services
+
+import (
+	"container/list"
+	"sync"
+	"time"
+)
+
+// ttlCacheMaxEntries bounds the in-process caches; past it the oldest entries make room
+const ttlCacheMaxEntries = 100000
+
+// ttlCache keeps values for ttl. Entries are kept oldest first, so storing one also drops the
+// expired ones and, once there are more than maxEntries, the oldest of the rest. Memory stays
+// bounded however many keys pass through.
+type ttlCache[V any] struct {
+	ttl        time.Duration
+	maxEntries int
+	now        func() time.Time
+
+	mu      sync.RWMutex
+	entries map[string]*list.Element
+	order   *list.List
+}
+
+type ttlEntry[V any] struct {
+	key      string
+	value    V
+	storedAt time.Time
+}
+
+func newTTLCache[V any](ttl time.Duration, maxEntries int) *ttlCache[V] {
+	return &ttlCache[V]{
+		ttl:        ttl,
+		maxEntries: maxEntries,
+		now:        time.Now,
+		entries:    make(map[string]*list.Element),
+		order:      list.New(),
+	}
+}
+
+// get returns the value stored for key unless it has expired
+func (c *ttlCache[V]) get(key string) (V, bool) {
+	now := c.now()
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	if element, ok := c.entries[key]; ok {
+		entry := element.Value.(*ttlEntry[V])
+		if now.Sub(entry.storedAt) < c.ttl {
+			return entry.value, true
+		}
+	}
+	var zero V
+	return zero, false
+}
+
+func (c *ttlCache[V]) set(key string, value V) {
+	now := c.now()
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if element, ok := c.entries[key]; ok {
+		c.order.Remove(element)
+	}
+	c.entries[key] = c.order.PushBack(&ttlEntry[V]{key: key, value: value, storedAt: now})
+
+	for front := c.order.Front(); front != nil; front = c.order.Front() {
+		entry := front.Value.(*ttlEntry[V])
+		if now.Sub(entry.storedAt) < c.ttl && c.order.Len() <= c.maxEntries {
+			break
+		}
+		c.order.Remove(front)
+		delete(c.entries, entry.key)
+	}
+}
+
+func (c *ttlCache[V]) delete(key string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if element, ok := c.entries[key]; ok {
+		c.order.Remove(element)
+		delete(c.entries, key)
+	}
+}
+
+// len counts the entries held, expired or not
+func (c *ttlCache[V]) len() int {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.order.Len()
+}
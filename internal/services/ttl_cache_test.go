@@ -0,0 +1,54 @@
+package services
+
+import (
+	"fmt"
+	"testing"
+	"time"
+)
+
+func TestTTLCache(t *testing.T) {
+	cache := newTTLCache[int](time.Minute, 3)
+	now := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	cache.now = func() time.Time { return now }
+
+	cache.set("a", 1)
+	if value, ok := cache.get("a"); !ok || value != 1 {
+		t.Fatalf("got %d, %v", value, ok)
+	}
+	now = now.Add(time.Minute)
+	if _, ok := cache.get("a"); ok {
+		t.Error("expired entry returned")
+	}
+
+	// Storing sweeps out what has expired
+	cache.set("b", 2)
+	if cache.len() != 1 {
+		t.Errorf("expired entries kept: %d entries", cache.len())
+	}
+
+	// Past maxEntries the oldest make room, and storing again renews an entry
+	cache.set("c", 3)
+	cache.set("d", 4)
+	cache.set("b", 5)
+	cache.set("e", 6)
+	if cache.len() != 3 {
+		t.Errorf("got %d entries, want 3", cache.len())
+	}
+	for key, want := range map[string]bool{"b": true, "c": false, "d": true, "e": true} {
+		if _, ok := cache.get(key); ok != want {
+			t.Errorf("%s cached = %v, want %v", key, ok, want)
+		}
+	}
+
+	cache.delete("b")
+	if _, ok := cache.get("b"); ok || cache.len() != 2 {
+		t.Errorf("deleted entry kept, %d entries", cache.len())
+	}
+
+	for i := 0; i < 100; i++ {
+		cache.set(fmt.Sprintf("user-%d", i), i)
+	}
+	if cache.len() != 3 {
+		t.Errorf("cache grew to %d entries", cache.len())
+	}
+}
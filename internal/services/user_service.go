@@ -4,6 +4,7 @@ import (
     "fmt"    
     "context"
     "strings"
+    "time"
 
     "yoked_backend/internal/models"
     "yoked_backend/internal/db/repositories"
@@ -12,6 +13,7 @@ import (
 type UserService interface {
     CreateUser(ctx context.Context, user *models.User) error
     CreateUserProgram(ctx context.Context, userProgram *models.UserProgram) error
+    RegisterUser(ctx context.Context, user *models.User, programID int) (*models.UserProgram, error)
     GetUserByID(ctx context.Context, userID string) (*models.User, error)
     GetUserByEmail(ctx context.Context, email string) (*models.User, error)
     UpdateUser(ctx context.Context, user *models.User) error
@@ -20,17 +22,28 @@ type UserService interface {
     UpdateUserPreferences(ctx context.Context, userID string, prefs *models.UserPreferences) error
     GetUserPreferences(ctx context.Context, userID string) (*models.UserPreferences, error)
     UpdateUserPassword(ctx context.Context, userID, passwordHash string) error
+    UpdateUserRole(ctx context.Context, userID, role string, permissions []string) (*models.User, error)
 }
 
 type userService struct {
-    userRepo repositories.UserRepository
+    userRepo      repositories.UserRepository
+    programRepo   repositories.ProgramRepository
+    tokenRepo     repositories.TokenRepository
+    txManager     repositories.TxManager
+    tokenVersions TokenVersionStore
 }
 
-func NewUserService(userRepo repositories.UserRepository) UserService {
-    return &userService{userRepo: userRepo}
+func NewUserService(userRepo repositories.UserRepository, programRepo repositories.ProgramRepository, tokenRepo repositories.TokenRepository, txManager repositories.TxManager, tokenVersions TokenVersionStore) UserService {
+    return &userService{userRepo: userRepo, programRepo: programRepo, tokenRepo: tokenRepo, txManager: txManager, tokenVersions: tokenVersions}
 }
 
 func (s *userService) CreateUser(ctx context.Context, user *models.User) error {
+    if user.Timezone == "" {
+        user.Timezone = "UTC"
+    }
+    if err := validateTimezone(user.Timezone); err != nil {
+        return err
+    }
     return s.userRepo.CreateUser(ctx, user)
 }
 
@@ -38,6 +51,41 @@ func (s *userService) CreateUserProgram(ctx context.Context, userProgram *models
 	return s.userRepo.CreateUserProgram(ctx, userProgram)
 }
 
+// RegisterUser creates the account and its first program together so a failure leaves neither behind
+func (s *userService) RegisterUser(ctx context.Context, user *models.User, programID int) (*models.UserProgram, error) {
+    program, err := s.programRepo.GetProgramByID(ctx, programID)
+    if err != nil {
+        return nil, fmt.Errorf("program %d: %w", programID, err)
+    }
+    // Unpublished programs take no new enrollments, same as AssignProgramToUser
+    if program.PublishedAt == nil {
+        return nil, fmt.Errorf("program %d: %w", programID, repositories.ErrNotFound)
+    }
+
+    var userProgram *models.UserProgram
+    err = s.txManager.WithinTx(ctx, func(ctx context.Context) error {
+        if err := s.CreateUser(ctx, user); err != nil {
+            return fmt.Errorf("failed to create user: %w", err)
+        }
+
+        // Start date is the user's local calendar day, not the server's
+        userProgram = &models.UserProgram{
+            UserID:    user.ID,
+            ProgramID: programID,
+            StartDate: calendarDate(time.Now(), user.Location()),
+            IsActive:  true,
+        }
+        if err := s.userRepo.CreateUserProgram(ctx, userProgram); err != nil {
+            return fmt.Errorf("failed to create user program: %w", err)
+        }
+        return nil
+    })
+    if err != nil {
+        return nil, err
+    }
+    return userProgram, nil
+}
+
 func (s *userService) GetUserByID(ctx context.Context, userID string) (*models.User, error) {
     user, err := s.userRepo.GetUserByID(ctx, userID)
     if err != nil {
@@ -90,8 +138,46 @@ func (s *userService) UpdateUserProfile(ctx context.Context, userID string, upda
     return user, nil
 }
 
+// UpdateUserPassword changes the password and signs the user out everywhere: the repository
+// bumps the token version, and refresh tokens are revoked so they cannot mint new access tokens
 func (s *userService) UpdateUserPassword(ctx context.Context, userID, passwordHash string) error {
-    return s.userRepo.UpdateUserPassword(ctx, userID, passwordHash)
+    err := s.txManager.WithinTx(ctx, func(ctx context.Context) error {
+        if err := s.userRepo.UpdateUserPassword(ctx, userID, passwordHash); err != nil {
+            return err
+        }
+        return s.tokenRepo.RevokeUserRefreshTokens(ctx, userID)
+    })
+    if err != nil {
+        return err
+    }
+    s.tokenVersions.Forget(userID)
+    return nil
+}
+
+// UpdateUserRole changes the user's role and individual permissions. Their outstanding
+// access tokens are revoked so the new claims apply from their next refresh.
+func (s *userService) UpdateUserRole(ctx context.Context, userID, role string, permissions []string) (*models.User, error) {
+    if !models.ValidRole(role) {
+        return nil, invalidInput("unknown role %q", role)
+    }
+    granted := []string{}
+    seen := make(map[string]bool)
+    for _, permission := range permissions {
+        if !models.ValidPermission(permission) {
+            return nil, invalidInput("unknown permission %q", permission)
+        }
+        if !seen[permission] {
+            seen[permission] = true
+            granted = append(granted, permission)
+        }
+    }
+
+    if err := s.userRepo.UpdateUserRole(ctx, userID, role, granted); err != nil {
+        return nil, err
+    }
+    s.tokenVersions.Forget(userID)
+
+    return s.GetUserProfile(ctx, userID)
 }
 
 // validateAndApplyProfileUpdates validates and applies profile updates
@@ -139,6 +225,15 @@ func (s *userService) validateAndApplyProfileUpdates(user *models.User, updates
             if name, ok := value.(string); ok && strings.TrimSpace(name) != "" {
                 user.Name = strings.TrimSpace(name)
             }
+        case "timezone":
+            timezone, ok := value.(string)
+            if !ok {
+                return invalidInput("timezone must be a string")
+            }
+            if err := validateTimezone(timezone); err != nil {
+                return err
+            }
+            user.Timezone = timezone
         }
     }
 
@@ -182,6 +277,16 @@ func (s *userService) validatePreferences(prefs *models.UserPreferences) error {
         return fmt.Errorf("too many dislikes (max 30)")
     }
 
+    if len(prefs.Equipment) > 30 {
+        return fmt.Errorf("too many pieces of equipment (max 30)")
+    }
+    // Equipment is matched against the exercise library, so it is stored the same way
+    equipment := make([]string, 0, len(prefs.Equipment))
+    for _, item := range prefs.Equipment {
+        equipment = append(equipment, normalizeTerm(item))
+    }
+    prefs.Equipment = distinct(equipment, "")
+
     return nil
 }
 
@@ -0,0 +1,41 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"yoked_backend/internal/db/repositories"
+	"yoked_backend/internal/models"
+)
+
+func TestRegisterUserRequiresPublishedProgram(t *testing.T) {
+	ctx := context.Background()
+	published := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	users := &fakeUserRepo{users: map[string]*models.User{}}
+	programs := &fakeProgramRepo{programs: map[int]*models.Program{
+		1: {ID: 1, Name: "Full body", PublishedAt: &published},
+		2: {ID: 2, Name: "Draft"},
+	}}
+	service := NewUserService(users, programs, newFakeTokenRepo(), passthroughTx{}, nil)
+
+	for _, programID := range []int{2, 3} {
+		user := &models.User{Email: "lifter@example.com", Timezone: "UTC"}
+		if _, err := service.RegisterUser(ctx, user, programID); !errors.Is(err, repositories.ErrNotFound) {
+			t.Errorf("program %d: got %v, want ErrNotFound", programID, err)
+		}
+	}
+	if len(users.users) != 0 {
+		t.Errorf("registration against an unavailable program left %d users behind", len(users.users))
+	}
+
+	user := &models.User{Email: "lifter@example.com", Timezone: "UTC"}
+	userProgram, err := service.RegisterUser(ctx, user, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if userProgram.UserID != user.ID || userProgram.ProgramID != 1 || !userProgram.IsActive {
+		t.Errorf("unexpected enrollment %+v", userProgram)
+	}
+}
@@ -0,0 +1,120 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"time"
+
+	"yoked_backend/internal/db/repositories"
+	"yoked_backend/internal/models"
+)
+
+// DefaultWorkoutSessionTimeout is how long a session may stay in progress before it is abandoned
+const DefaultWorkoutSessionTimeout = 4 * time.Hour
+
+var (
+	// ErrWorkoutInProgress is returned when starting a session while another is still open
+	ErrWorkoutInProgress = errors.New("a workout session is already in progress")
+	// ErrWorkoutNotInProgress is returned when completing or abandoning a session that has already ended
+	ErrWorkoutNotInProgress = errors.New("workout session is not in progress")
+)
+
+// WorkoutSessionTimeoutFromEnv returns the timeout configured in WORKOUT_SESSION_TIMEOUT as a
+// Go duration (e.g. "90m"), or the default. A zero timeout disables auto-abandoning.
+func WorkoutSessionTimeoutFromEnv() (time.Duration, error) {
+	value := os.Getenv("WORKOUT_SESSION_TIMEOUT")
+	if value == "" {
+		return DefaultWorkoutSessionTimeout, nil
+	}
+	timeout, err := time.ParseDuration(value)
+	if err != nil || timeout < 0 {
+		return 0, fmt.Errorf("invalid WORKOUT_SESSION_TIMEOUT %q", value)
+	}
+	return timeout, nil
+}
+
+// expired reports whether an in-progress session has outlived the timeout
+func (s *programService) expired(session *models.WorkoutSession, now time.Time) bool {
+	return s.sessionTimeout > 0 && session.Status == models.WorkoutStatusInProgress &&
+		now.Sub(session.StartedAt) > s.sessionTimeout
+}
+
+// GetActiveWorkoutSession returns the user's open session so a client can resume it, or nil.
+// A session past the timeout that the sweeper has not reached yet is abandoned here.
+func (s *programService) GetActiveWorkoutSession(ctx context.Context, userID string) (*models.WorkoutSession, error) {
+	session, err := s.programRepo.GetActiveWorkoutSession(ctx, userID)
+	if err != nil || session == nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	if s.expired(session, now) {
+		if _, err := s.programRepo.AbandonWorkoutSession(ctx, session.ID, now); err != nil && !errors.Is(err, repositories.ErrNotFound) {
+			return nil, err
+		}
+		return nil, nil
+	}
+	return session, nil
+}
+
+// AbandonWorkoutSession ends an in-progress session without logging it
+func (s *programService) AbandonWorkoutSession(ctx context.Context, actorID string, sessionID int) (*models.WorkoutSession, error) {
+	if _, _, err := s.authorizeWorkoutSession(ctx, actorID, sessionID); err != nil {
+		return nil, err
+	}
+
+	session, err := s.programRepo.AbandonWorkoutSession(ctx, sessionID, time.Now())
+	if errors.Is(err, repositories.ErrNotFound) {
+		return nil, ErrWorkoutNotInProgress
+	}
+	return session, err
+}
+
+// authorizeWorkoutSession loads a session and its user program, checking the actor may act on its owner
+func (s *programService) authorizeWorkoutSession(ctx context.Context, actorID string, sessionID int) (*models.WorkoutSession, *models.UserProgram, error) {
+	session, err := s.programRepo.GetWorkoutSessionByID(ctx, sessionID)
+	if err != nil {
+		return nil, nil, fmt.Errorf("workout session not found: %w", err)
+	}
+	userProgram, err := s.programRepo.GetUserProgramByID(ctx, session.UserProgramID)
+	if err != nil {
+		return nil, nil, err
+	}
+	if err := s.authorizer.AuthorizeUser(ctx, actorID, userProgram.UserID); err != nil {
+		return nil, nil, err
+	}
+	return session, userProgram, nil
+}
+
+// AbandonStaleWorkoutSessions abandons every session that has been open longer than the timeout
+func (s *programService) AbandonStaleWorkoutSessions(ctx context.Context) (int64, error) {
+	if s.sessionTimeout <= 0 {
+		return 0, nil
+	}
+	return s.programRepo.AbandonStaleWorkoutSessions(ctx, time.Now().Add(-s.sessionTimeout))
+}
+
+// RunWorkoutSessionSweeper abandons stale sessions every interval until ctx is cancelled
+func RunWorkoutSessionSweeper(ctx context.Context, programService ProgramService, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			abandoned, err := programService.AbandonStaleWorkoutSessions(ctx)
+			if err != nil {
+				log.Printf("Failed to abandon stale workout sessions: %v", err)
+				continue
+			}
+			if abandoned > 0 {
+				log.Printf("Abandoned %d stale workout sessions", abandoned)
+			}
+		}
+	}
+}
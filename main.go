@@ -1,14 +1,23 @@
 package main
 
 import (
+    "context"
+    "fmt"
     "log"
     "net/http"
+    "os"
+    "strconv"
+    "strings"
+    "time"
 
     "github.com/gin-gonic/gin"
     "yoked_backend/internal/api/handlers"
     "yoked_backend/internal/api/middleware"
     "yoked_backend/internal/db"
     "yoked_backend/internal/db/repositories"
+    "yoked_backend/internal/mail"
+    "yoked_backend/internal/models"
+    "yoked_backend/internal/oidc"
     "yoked_backend/internal/services"
 )
 
@@ -20,20 +29,138 @@ func main() {
     }
     defer database.Close()
 
+    // `server migrate up|down [steps]|status` manages the schema and exits
+    if len(os.Args) > 1 && os.Args[1] == "migrate" {
+        if err := runMigrate(database, os.Args[2:]); err != nil {
+            log.Fatalf("Migration failed: %v", err)
+        }
+        return
+    }
+
     // Initialize Repositories
     userRepo := repositories.NewUserRepository(database.GetPool())
     programRepo := repositories.NewProgramRepository(database.GetPool())
+    recordRepo := repositories.NewRecordRepository(database.GetPool())
+    grantRepo := repositories.NewAccessGrantRepository(database.GetPool())
+    tokenRepo := repositories.NewTokenRepository(database.GetPool())
+    signingKeyRepo := repositories.NewSigningKeyRepository(database.GetPool())
+    mfaRepo := repositories.NewMFARepository(database.GetPool())
+    identityRepo := repositories.NewIdentityRepository(database.GetPool())
+    catalogRepo := repositories.NewCatalogRepository(database.GetPool())
+    exerciseRepo := repositories.NewExerciseRepository(database.GetPool())
+    overrideRepo := repositories.NewExerciseOverrideRepository(database.GetPool())
+    txManager := repositories.NewTxManager(database.GetPool())
 
     // Initialize Services
-    userService := services.NewUserService(userRepo)
-    programService := services.NewProgramService(programRepo, userRepo)
+    e1RMFormula, err := services.OneRepMaxFormulaFromEnv()
+    if err != nil {
+        log.Fatalf("Invalid configuration: %v", err)
+    }
+    sessionTimeout, err := services.WorkoutSessionTimeoutFromEnv()
+    if err != nil {
+        log.Fatalf("Invalid configuration: %v", err)
+    }
+    signingKeyConfig, err := services.SigningKeyConfigFromEnv()
+    if err != nil {
+        log.Fatalf("Invalid configuration: %v", err)
+    }
+    keyManager, err := services.NewKeyManager(signingKeyRepo, signingKeyConfig)
+    if err != nil {
+        log.Fatalf("Failed to initialise signing keys: %v", err)
+    }
+    if err := keyManager.Refresh(context.Background()); err != nil {
+        log.Fatalf("Failed to load signing keys: %v", err)
+    }
+    mailer, err := mail.FromEnv()
+    if err != nil {
+        log.Fatalf("Invalid configuration: %v", err)
+    }
+    passwordResetURL, err := services.PasswordResetURLFromEnv()
+    if err != nil {
+        log.Fatalf("Invalid configuration: %v", err)
+    }
+    emailVerificationURL, err := services.EmailVerificationURLFromEnv()
+    if err != nil {
+        log.Fatalf("Invalid configuration: %v", err)
+    }
+    verificationPolicy, err := services.EmailVerificationPolicyFromEnv()
+    if err != nil {
+        log.Fatalf("Invalid configuration: %v", err)
+    }
+    loginThrottleConfig, err := services.LoginThrottleConfigFromEnv()
+    if err != nil {
+        log.Fatalf("Invalid configuration: %v", err)
+    }
+    deletionGracePeriod, err := services.AccountDeletionGracePeriodFromEnv()
+    if err != nil {
+        log.Fatalf("Invalid configuration: %v", err)
+    }
+    oidcConfigs, err := oidc.ProvidersFromEnv()
+    if err != nil {
+        log.Fatalf("Invalid configuration: %v", err)
+    }
+    var oidcProviders []services.OIDCProvider
+    for _, cfg := range oidcConfigs {
+        oidcProviders = append(oidcProviders, oidc.NewProvider(cfg, nil))
+    }
+    outbox := mail.NewOutbox(mailer, 100)
+    tokenVersions := services.NewTokenVersionCache(userRepo, services.DefaultTokenVersionCacheTTL)
+    sessionCache := services.NewSessionCache(tokenRepo, services.DefaultSessionCacheTTL)
+    userService := services.NewUserService(userRepo, programRepo, tokenRepo, txManager, tokenVersions)
+    authorizer := services.NewAuthorizer(grantRepo, userRepo)
+    authService := services.NewAuthService(userRepo, tokenRepo, txManager, services.NewMailSecurityNotifier(userRepo, outbox), sessionCache)
+    passwordResetService := services.NewPasswordResetService(userRepo, tokenRepo, txManager, tokenVersions, outbox, passwordResetURL)
+    emailVerificationService := services.NewEmailVerificationService(userRepo, txManager, outbox, emailVerificationURL, signingKeyConfig.Secret)
+    loginAttempts := services.NewMemoryLoginAttemptStore()
+    loginThrottle := services.NewLoginThrottle(loginAttempts, loginThrottleConfig)
+    userThrottle := services.NewUserThrottle(loginAttempts, loginThrottleConfig)
+    passwordResetThrottle := services.NewRequestThrottle(loginAttempts, loginThrottleConfig, "password-reset", services.PasswordResetIPMaxRequests)
+    mfaService, err := services.NewMFAService(mfaRepo, txManager, userThrottle, signingKeyConfig.Secret)
+    if err != nil {
+        log.Fatalf("Failed to initialise two-factor authentication: %v", err)
+    }
+    identityService := services.NewIdentityService(identityRepo, userRepo, userService, txManager, oidcProviders)
+    accountService := services.NewAccountService(userRepo, programRepo, recordRepo, tokenRepo, identityRepo, overrideRepo, grantRepo, txManager, tokenVersions, deletionGracePeriod)
+    recordService := services.NewRecordService(recordRepo, programRepo, e1RMFormula)
+    statsService := services.NewStatsService(userRepo, programRepo)
+    catalogService := services.NewCatalogService(catalogRepo, programRepo, txManager)
+    exerciseService := services.NewExerciseService(exerciseRepo, txManager)
+    substitutionService := services.NewSubstitutionService(exerciseRepo, overrideRepo, programRepo, userRepo)
+    programService := services.NewProgramService(programRepo, userRepo, txManager, recordService, statsService, authorizer, sessionTimeout, substitutionService)
+
+    // Abandon workout sessions left open past the timeout
+    if sessionTimeout > 0 {
+        go services.RunWorkoutSessionSweeper(context.Background(), programService, time.Minute)
+    }
+
+    // Reload signing keys, rotating and pruning them on schedule
+    go services.RunKeyRotation(context.Background(), keyManager, time.Minute)
+
+    // Deliver queued mail in the background
+    go outbox.Run(context.Background())
+
+    // Purge deleted accounts once their grace period is over
+    go services.RunAccountPurge(context.Background(), accountService, time.Hour)
 
     // Initialize Handlers
-    userHandler := handlers.NewUserHandler(userService)
-    programHandler := handlers.NewProgramHandler(programService, userService)
-    authHandler := handlers.NewAuthHandler(userService)
+    userHandler := handlers.NewUserHandler(userService, statsService)
+    programHandler := handlers.NewProgramHandler(programService, userService, authorizer)
+    authHandler := handlers.NewAuthHandler(userService, authService, passwordResetService, emailVerificationService, mfaService, loginThrottle, passwordResetThrottle, identityService, keyManager)
+    mfaHandler := handlers.NewMFAHandler(userService, mfaService)
+    identityHandler := handlers.NewIdentityHandler(identityService)
+    sessionHandler := handlers.NewSessionHandler(authService)
+    accountHandler := handlers.NewAccountHandler(userService, accountService, mfaService, identityService, userThrottle)
+    recordHandler := handlers.NewRecordHandler(recordService)
+    adminHandler := handlers.NewAdminHandler(userService, authorizer)
+    catalogHandler := handlers.NewCatalogHandler(catalogService)
+    exerciseHandler := handlers.NewExerciseHandler(exerciseService)
+    substitutionHandler := handlers.NewSubstitutionHandler(substitutionService, authorizer)
 
     router := gin.Default()
+    // Login throttling is per client address, so X-Forwarded-For is only believed from TRUSTED_PROXIES
+    if err := router.SetTrustedProxies(trustedProxiesFromEnv()); err != nil {
+        log.Fatalf("Invalid TRUSTED_PROXIES: %v", err)
+    }
     
     // Middleware
     router.Use(gin.Logger())
@@ -44,43 +171,114 @@ func main() {
     {
         public.POST("/auth/register", authHandler.Register)
         public.POST("/auth/login", authHandler.Login)
+        public.POST("/auth/refresh", authHandler.RefreshToken)
+        public.POST("/auth/password/forgot", authHandler.ForgotPassword)
+        public.POST("/auth/password/reset", authHandler.ResetPassword)
+        public.POST("/auth/verify-email", authHandler.VerifyEmail)
+        public.POST("/auth/mfa/verify", authHandler.VerifyMFA)
+        public.GET("/auth/oidc/providers", authHandler.OIDCProviders)
+        public.POST("/auth/oidc/:provider/authorize", authHandler.OIDCAuthorize)
+        public.POST("/auth/oidc/:provider/callback", authHandler.OIDCCallback)
+        public.GET("/.well-known/jwks.json", authHandler.JWKS)
         public.GET("/health", healthCheck)
 	public.GET("/programs?goal=hypertrophy",programHandler.GetProgramsByGoal)
     }
 
     // Authenticated Routes - Requires JWT
     authenticated := router.Group("/")
-    authenticated.Use(middleware.AuthMiddleware())
+    authenticated.Use(middleware.AuthMiddleware(keyManager, tokenVersions, sessionCache))
+    verifiedForPrograms := middleware.RequireVerifiedEmail(emailVerificationService, verificationPolicy.Restricts(services.VerifiedFeaturePrograms))
+    verifiedForWorkouts := middleware.RequireVerifiedEmail(emailVerificationService, verificationPolicy.Restricts(services.VerifiedFeatureWorkouts))
     {
         // Auth
         authenticated.POST("/auth/logout", authHandler.Logout)
-        authenticated.POST("/auth/refresh", authHandler.RefreshToken)
+        authenticated.POST("/auth/logout-all", authHandler.LogoutAll)
+        authenticated.POST("/auth/verify-email/resend", authHandler.ResendVerificationEmail)
+        authenticated.POST("/auth/mfa/enroll", mfaHandler.Enroll)
+        authenticated.POST("/auth/mfa/confirm", mfaHandler.Confirm)
+        authenticated.POST("/auth/mfa/disable", mfaHandler.Disable)
+        authenticated.POST("/auth/mfa/recovery-codes", mfaHandler.RegenerateRecoveryCodes)
 
         // User Routes
 	user := authenticated.Group("/users")
 	{
     		user.GET("/me", userHandler.GetCurrentUser)
     		user.PUT("/me", userHandler.UpdateUser)
+    		user.DELETE("/me", accountHandler.DeleteAccount)
+    		user.POST("/me/export", accountHandler.ExportAccount)
     		user.GET("/me/preferences", userHandler.GetUserPreferences)
     		user.PUT("/me/preferences", userHandler.UpdateUserPreferences)
     		user.PUT("/me/password", userHandler.UpdatePassword)
     		user.GET("/me/stats", userHandler.GetUserStats)
+    		user.POST("/me/stats/recompute", userHandler.RecomputeUserStats)
+    		user.GET("/me/records", recordHandler.GetMyRecords)
+    		user.GET("/me/sessions", sessionHandler.GetSessions)
+    		user.DELETE("/me/sessions/:id", sessionHandler.RevokeSession)
+    		user.GET("/me/identities", identityHandler.GetIdentities)
+    		user.POST("/me/identities/:provider/authorize", identityHandler.Authorize)
+    		user.POST("/me/identities/:provider/callback", identityHandler.Callback)
+    		user.DELETE("/me/identities/:provider", identityHandler.Unlink)
+    		user.POST("/me/reauthenticate/:provider", identityHandler.Reauthorize)
+	}
+	// Exercise Routes
+	exercises := authenticated.Group("/exercises")
+	{
+		exercises.GET("", exerciseHandler.SearchExercises)
+		exercises.GET("/:id", exerciseHandler.GetExercise)
+		exercises.GET("/:id/records", recordHandler.GetExerciseRecords)
+		exercises.GET("/:id/substitutes", substitutionHandler.SuggestSubstitutes)
 	}
 	//Program Routes
 	programs := authenticated.Group("/programs")
 	{
-		programs.POST("/assign", programHandler.AssignProgram)
+		programs.POST("/assign", verifiedForPrograms, programHandler.AssignProgram)
+		programs.POST("/upgrade", verifiedForPrograms, programHandler.UpgradeProgram)
 		programs.GET("/user/:user_id", programHandler.GetUserProgram)
+		programs.GET("/overrides", substitutionHandler.GetOverrides)
+		programs.POST("/overrides", substitutionHandler.SetOverride)
+		programs.DELETE("/overrides/:id", substitutionHandler.DeleteOverride)
 
 	}
 	// Workout Routes
 	workouts := authenticated.Group("/workouts")
 	{
-    		workouts.POST("/start", programHandler.StartWorkoutSession)
-		workouts.POST("/:id/complete", programHandler.CompleteWorkoutSession)
+    		workouts.POST("/start", verifiedForWorkouts, programHandler.StartWorkoutSession)
+		workouts.GET("/active", programHandler.GetActiveWorkoutSession)
+		workouts.POST("/:id/complete", verifiedForWorkouts, programHandler.CompleteWorkoutSession)
+		workouts.POST("/:id/abandon", programHandler.AbandonWorkoutSession)
 		workouts.GET("/history/:user_id", programHandler.GetWorkoutHistory)
 		workouts.GET("/next-weights", programHandler.GetNextWorkoutWeights)
     	}
+	// Admin Routes - each gated by role or permission scope
+	admin := authenticated.Group("/admin")
+	{
+		admin.GET("/users/:id", middleware.RequirePermission(models.PermissionUsersRead), adminHandler.GetUser)
+		admin.PUT("/users/:id/role", middleware.RequireRole(models.RoleAdmin), adminHandler.UpdateUserRole)
+		admin.POST("/grants", middleware.RequirePermission(models.PermissionGrantsWrite), adminHandler.CreateAccessGrant)
+
+		catalog := admin.Group("/programs", middleware.RequirePermission(models.PermissionCatalogWrite))
+		catalog.GET("", catalogHandler.ListPrograms)
+		catalog.POST("", catalogHandler.CreateProgram)
+		catalog.GET("/:id", catalogHandler.GetProgram)
+		catalog.PUT("/:id", catalogHandler.ReplaceProgram)
+		catalog.DELETE("/:id", catalogHandler.DeleteProgram)
+		catalog.POST("/:id/publish", catalogHandler.PublishProgram)
+		catalog.POST("/:id/unpublish", catalogHandler.UnpublishProgram)
+		catalog.GET("/:id/versions", catalogHandler.ListVersions)
+		catalog.GET("/:id/versions/:version", catalogHandler.GetVersion)
+		catalog.POST("/:id/workouts", catalogHandler.AddWorkout)
+		catalog.PUT("/:id/workouts/:workout_id", catalogHandler.UpdateWorkout)
+		catalog.DELETE("/:id/workouts/:workout_id", catalogHandler.DeleteWorkout)
+		catalog.POST("/:id/workouts/:workout_id/exercises", catalogHandler.AddExercise)
+		catalog.PUT("/:id/workouts/:workout_id/exercises/:exercise_id", catalogHandler.UpdateExercise)
+		catalog.DELETE("/:id/workouts/:workout_id/exercises/:exercise_id", catalogHandler.DeleteExercise)
+		catalog.PUT("/:id/workouts/:workout_id/exercise-order", catalogHandler.ReorderExercises)
+
+		exerciseLibrary := admin.Group("/exercises", middleware.RequirePermission(models.PermissionCatalogWrite))
+		exerciseLibrary.POST("", exerciseHandler.CreateExercise)
+		exerciseLibrary.PUT("/:id", exerciseHandler.UpdateExercise)
+		exerciseLibrary.POST("/:id/merge", exerciseHandler.MergeExercise)
+	}
 
     // Start Server - Listening to ALL MUST CHANGE BEFORE PRODUCTION
     if err := router.Run("0.0.0.0:8080"); err != nil {
@@ -89,6 +287,69 @@ func main() {
     }
 }
 
+func runMigrate(database *db.Database, args []string) error {
+    migrator, err := db.NewMigrator(database.GetPool())
+    if err != nil {
+        return err
+    }
+    ctx := context.Background()
+
+    command := "up"
+    if len(args) > 0 {
+        command = args[0]
+    }
+
+    switch command {
+    case "up":
+        applied, err := migrator.Up(ctx)
+        for _, m := range applied {
+            log.Printf("Applied %04d_%s", m.Version, m.Name)
+        }
+        if err == nil && len(applied) == 0 {
+            log.Println("Schema is up to date")
+        }
+        return err
+    case "down":
+        steps := 1
+        if len(args) > 1 {
+            if steps, err = strconv.Atoi(args[1]); err != nil || steps < 1 {
+                return fmt.Errorf("invalid step count %q", args[1])
+            }
+        }
+        reverted, err := migrator.Down(ctx, steps)
+        for _, m := range reverted {
+            log.Printf("Rolled back %04d_%s", m.Version, m.Name)
+        }
+        return err
+    case "status":
+        statuses, err := migrator.Status(ctx)
+        if err != nil {
+            return err
+        }
+        for _, status := range statuses {
+            applied := "pending"
+            if status.AppliedAt != nil {
+                applied = "applied " + status.AppliedAt.Format(time.RFC3339)
+            }
+            fmt.Printf("%04d_%-40s %s\n", status.Version, status.Name, applied)
+        }
+        return nil
+    default:
+        return fmt.Errorf("unknown migrate command %q, expected up, down or status", command)
+    }
+}
+
+// trustedProxiesFromEnv reads the comma separated TRUSTED_PROXIES, trusting none by default
+func trustedProxiesFromEnv() []string {
+    var proxies []string
+    for _, proxy := range strings.Split(os.Getenv("TRUSTED_PROXIES"), ",") {
+        if proxy = strings.TrimSpace(proxy); proxy != "" {
+            proxies = append(proxies, proxy)
+        }
+    }
+    return proxies
+}
+
 func healthCheck(c *gin.Context) {
     c.JSON(http.StatusOK, gin.H{"status": "healthy"})
 }